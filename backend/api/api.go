@@ -0,0 +1,196 @@
+//Package api contains the json bodies of the rest endpoints, which are shared by the backend and the client.
+package api
+
+import (
+	"github.com/worldiety/devdrasil/backend/plugin"
+	"github.com/worldiety/devdrasil/db"
+)
+
+//the client value of a go program, which uses the client package
+const GoClient = "go-client-1.0"
+
+//the json body of every error response
+type Error struct {
+	//the http status code, e.g. 404
+	Code int
+
+	//a message for the client, never an internal detail
+	Message string
+
+	//optional machine readable details, e.g. the missing permission kind
+	Details interface{} `json:",omitempty"`
+
+	//the id of the request, which is also logged
+	RequestId string
+}
+
+//the details of a 403 response, if a permission kind is missing
+type PermissionDenied struct {
+	//the missing permission kind, e.g. UPDATE_USER
+	Permission string
+
+	//e.g. 'not granted on the target'
+	Reason string
+}
+
+type Credentials struct {
+	//the login
+	Login string
+
+	//the password in plain text
+	Password string
+
+	//A client token, to validate, or issue compatiblity or what else. Allowed values: 'web-client-1.0' and 'go-client-1.0'
+	Client string
+}
+
+type Session struct {
+	//hex encoded session id
+	Id db.PK
+
+	//hex encoded user id
+	User db.PK
+
+	//the token to send in the X-CSRF-Token header for mutating requests, when authenticating with the cookie
+	CSRFToken string
+}
+
+type UserList struct {
+	List []*User
+}
+
+//all fields are optional, so that an update only changes the given fields
+type User struct {
+	//unique entity id, e.g. "abc38293"
+	Id *db.PK
+
+	//Abbreviation and/or Login, something like "tschinke", used for the login
+	Login *string
+
+	//e.g. Torben
+	Firstname *string
+
+	//e.g. Schinke
+	Lastname *string
+
+	//the new password
+	Password *string
+
+	//flag if user is active or not, without deleting him
+	Active *bool
+
+	//reference to an optional avatar image
+	AvatarImage *db.PK
+
+	//list of connected email addresses e.g. tschinke@domain.com, torben.schinke@otherdomain.com, ...
+	EMailAddresses *[]string
+
+	//reference to an optional company
+	Company *db.PK
+
+	//the groups, which this user is a member of. This determines his actual permissions.
+	Groups *[]db.PK
+
+	//read only, the external authentication provider, empty for local users
+	Provider *string
+
+	//a service account has no password and authenticates only with api tokens
+	ServiceAccount *bool
+
+	//the roles, which are assigned directly to this user
+	Roles *[]db.PK
+
+	//the preferred language of the server messages and e-mails, e.g. de. Empty means the Accept-Language of the client.
+	Locale *string
+}
+
+type GroupList struct {
+	List []*Group
+}
+
+type Group struct {
+	//unique entity id, e.g. "abc38293"
+	Id db.PK
+
+	//the name of the group
+	Name string
+
+	//the tenant, nil for groups of users without a company. Only a user with MANAGE_TENANTS can choose it at the
+	//creation, otherwise it is the company of the creator. It cannot be changed later.
+	Company *db.PK
+
+	//all users within this group, which must belong to the same tenant
+	Users []db.PK
+
+	//the groups, which this group is a member of. All members of this group inherit the membership.
+	Groups []db.PK
+
+	//the roles, which are assigned to all members of this group
+	Roles []db.PK
+}
+
+type CompanyList struct {
+	List []*Company
+}
+
+type Company struct {
+	//unique entity id, e.g. "abc38293"
+	Id db.PK
+
+	//the name of the group
+	Name string
+
+	//the primary color, e.g. #4caf50 or green
+	ThemePrimaryColor string
+
+	//the secondary color, e.g. #ff9800 or orange
+	ThemeSecondaryColor string
+
+	//the title of the app for the users of the company, empty uses the default
+	AppTitle string
+
+	//read only, the uploaded logo, see PUT /companies/logo/{id}
+	Logo *db.PK
+
+	//read only, the uploaded favicon, see PUT /companies/favicon/{id}
+	Favicon *db.PK
+
+	//all users within this group
+	Users []db.PK
+}
+
+type PermissionList struct {
+	List []*Permission
+}
+
+type Permission struct {
+	//e.g. LIST_USERS or START_BUILD
+	Name string
+
+	//the plugin which declared the kind, empty for built-in kinds
+	Plugin string
+
+	//human readable description of a plugin kind
+	Description string
+
+	//the users, who have the kind globally
+	AllowedUsers []db.PK
+
+	//the groups, whose members have the kind globally
+	AllowedGroups []db.PK
+}
+
+type PluginInfo struct {
+	plugin.PluginVersionInfo
+
+	//the permission kinds, which the plugin has declared in its manifest
+	Permissions []*PluginPermission
+}
+
+type PluginPermission struct {
+	//e.g. START_BUILD
+	Name string
+
+	//e.g. 'Allows to start a build manually'
+	Description string
+}
@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"net/http"
+	"github.com/worldiety/devdrasil/backend/audit"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"github.com/worldiety/devdrasil/log"
+	"strconv"
+)
+
+type auditListDTO struct {
+	List []*audit.Entry
+}
+
+//The audit endpoints, to query and export the log of administrative actions
+type EndpointAudit struct {
+	router      *Router
+	sessions    *session.Sessions
+	users       *user.Users
+	permissions *user.Permissions
+	audit       *audit.Log
+}
+
+func NewEndpointAudit(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, auditLog *audit.Log) *EndpointAudit {
+	endpoint := &EndpointAudit{router: router, sessions: sessions, users: users, permissions: permissions, audit: auditLog}
+	router.Handle("GET", "/audit", endpoint.listEntries, Permitted(sessions, users, permissions, user.LIST_AUDIT))
+	router.Handle("GET", "/audit/export", endpoint.exportEntries, Permitted(sessions, users, permissions, user.LIST_AUDIT))
+	return endpoint
+}
+
+//parses the query parameters actor, target, company, from, to and limit. Without MANAGE_TENANTS, only the entries of
+//the own tenant are selected and the company parameter is ignored. Writes the error, so just return if nil.
+func (e *EndpointAudit) readAuditFilter(writer http.ResponseWriter, request *http.Request) *audit.Filter {
+	ses, usr := CurrentSession(request)
+	query := request.URL.Query()
+	filter := &audit.Filter{Target: query.Get("target")}
+
+	manager, err := isAllowed(e.permissions, ses, usr, user.MANAGE_TENANTS)
+	if AnyErrorAsInternalError(err, writer) {
+		return nil
+	}
+	if !manager {
+		filter.ByTenant = true
+		filter.Tenant = usr.Company
+	} else if company := query.Get("company"); company != "" {
+		pk, err := db.ParsePK(company)
+		if err != nil {
+			WriteError(writer, http.StatusBadRequest, err.Error())
+			return nil
+		}
+		filter.ByTenant = true
+		filter.Tenant = &pk
+	}
+
+	if actor := query.Get("actor"); actor != "" {
+		pk, err := db.ParsePK(actor)
+		if err != nil {
+			WriteError(writer, http.StatusBadRequest, err.Error())
+			return nil
+		}
+		filter.Actor = &pk
+	}
+
+	for param, dst := range map[string]*int64{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(param); value != "" {
+			num, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				WriteError(writer, http.StatusBadRequest, param+" is not a number")
+				return nil
+			}
+			*dst = num
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		num, err := strconv.Atoi(value)
+		if err != nil {
+			WriteError(writer, http.StatusBadRequest, "limit is not a number")
+			return nil
+		}
+		filter.Limit = num
+	}
+	return filter
+}
+
+// A user can query the audit log of his tenant, if he has the permission LIST_AUDIT. With MANAGE_TENANTS, all entries
+// or those of the given company are returned. The newest entries come first.
+//  @Path GET /audit?actor={user id}&target={id}&company={company id}&from={unix seconds}&to={unix seconds}&limit={n} (all parameters are optional)
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/auditListDTO
+//  @Return 400 (if a parameter is malformed)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 500 (for any other error)
+func (e *EndpointAudit) listEntries(writer http.ResponseWriter, request *http.Request) {
+	filter := e.readAuditFilter(writer, request)
+	if filter == nil {
+		return
+	}
+
+	list, err := e.audit.Query(filter)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	WriteJSONBody(writer, &auditListDTO{List: list})
+}
+
+// Exports the audit log as json lines, the oldest entries first. Requires the permission LIST_AUDIT and is restricted
+// to the tenant like GET /audit.
+//  @Path GET /audit/export?actor={user id}&target={id}&company={company id}&from={unix seconds}&to={unix seconds} (all parameters are optional)
+//  @Header sid string
+//	@Return 200 (application/x-ndjson, one github.com/worldiety/devdrasil/backend/audit/Entry per line)
+//  @Return 400 (if a parameter is malformed)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+func (e *EndpointAudit) exportEntries(writer http.ResponseWriter, request *http.Request) {
+	filter := e.readAuditFilter(writer, request)
+	if filter == nil {
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/x-ndjson")
+	writer.Header().Set("Content-Disposition", "attachment; filename=\"audit.jsonl\"")
+	err := e.audit.Export(writer, filter)
+	if err != nil {
+		//the header is already written
+		log.Default.Error(log.New("failed to export audit log").SetError(err))
+	}
+}
+
+//appends an entry for a mutating call. A failure is only logged, because the change has already been made.
+//The session is nil for public calls, e.g. a registration.
+func recordAudit(auditLog *audit.Log, ses *session.Session, usr *user.User, request *http.Request, action string, target string, before interface{}, after interface{}) {
+	entry := &audit.Entry{Actor: usr.Id, Tenant: usr.Company, RemoteAddr: remoteHost(request), Action: action, Target: target, Changes: audit.Diff(before, after)}
+	if ses != nil && ses.Token != nil {
+		entry.Session = *ses.Token
+	} else if ses != nil {
+		entry.Session = ses.Handle()
+	}
+	err := auditLog.Append(entry)
+	if err != nil {
+		log.Default.Error(log.New("failed to append audit entry").Put("action", action).Put("target", target).SetError(err))
+	}
+}
@@ -0,0 +1,244 @@
+//Package audit records administrative actions in an append-only log file, one json entry per line.
+//The entries are chained by sha256 hashes and the head of the chain is periodically signed, see chain.go.
+package audit
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/json"
+	"github.com/worldiety/devdrasil/db"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+//An Entry describes a single mutating call
+type Entry struct {
+	//the position in the log, starting at 1
+	Seq uint64
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	Time int64
+
+	//the user who performed the action
+	Actor db.PK
+
+	//the handle of the session, see session.Session.Handle, or the id of the api token of the actor. Never the session
+	//id itself, because it authenticates.
+	Session db.PK
+
+	//the company of the actor, nil for the tenant of the users without a company
+	Tenant *db.PK `json:",omitempty"`
+
+	//the remote host of the request, e.g. 192.168.0.10
+	RemoteAddr string
+
+	//what happened, e.g. user.update
+	Action string
+
+	//the affected entity, e.g. the hex id of a user, a plugin id or a permission name
+	Target string
+
+	//the changed fields of the target
+	Changes []*Change `json:",omitempty"`
+
+	//the hex encoded hash of the previous entry, empty for the first entry
+	PrevHash string
+
+	//the hex encoded sha256 hash of this entry, including PrevHash but without Hash itself
+	Hash string
+}
+
+//A Filter selects entries. Zero values match everything.
+type Filter struct {
+	Actor  *db.PK
+	Target string
+
+	//inclusive, seconds since epoch
+	From int64
+
+	//inclusive, seconds since epoch
+	To int64
+
+	//the maximum amount of the newest entries
+	Limit int
+
+	//if true, only the entries of the Tenant match, where nil is the tenant of the users without a company
+	ByTenant bool
+	Tenant   *db.PK
+}
+
+func (f *Filter) matches(entry *Entry) bool {
+	if f.Actor != nil && *f.Actor != entry.Actor {
+		return false
+	}
+	if f.Target != "" && f.Target != entry.Target {
+		return false
+	}
+	if f.From != 0 && entry.Time < f.From {
+		return false
+	}
+	if f.To != 0 && entry.Time > f.To {
+		return false
+	}
+	if f.ByTenant && !sameTenant(f.Tenant, entry.Tenant) {
+		return false
+	}
+	return true
+}
+
+func sameTenant(a *db.PK, b *db.PK) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+//The Log is safe for concurrent use. Entries are only appended, never changed or removed.
+type Log struct {
+	file     string
+	mutex    sync.Mutex
+	lastSeq  uint64
+	lastHash string
+
+	//signs the checkpoints, may be nil
+	key ed25519.PrivateKey
+
+	//the sequence number of the last signed checkpoint
+	checkpointSeq uint64
+
+	stop chan struct{}
+}
+
+//opens or creates the log file
+func Open(file string) (*Log, error) {
+	l := &Log{file: file}
+	err := l.scan(func(entry *Entry) error {
+		l.lastSeq = entry.Seq
+		l.lastHash = entry.Hash
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	checkpoints, err := readCheckpoints(checkpointFile(file))
+	if err != nil {
+		return nil, err
+	}
+	if len(checkpoints) > 0 {
+		l.checkpointSeq = checkpoints[len(checkpoints)-1].Seq
+	}
+	return l, nil
+}
+
+//Append assigns the sequence number, the time and the hashes and writes the entry durably
+func (l *Log) Append(entry *Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entry.Seq = l.lastSeq + 1
+	if entry.Time == 0 {
+		entry.Time = time.Now().Unix()
+	}
+	entry.PrevHash = l.lastHash
+	hash, err := entry.computeHash()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+	l.lastSeq = entry.Seq
+	l.lastHash = entry.Hash
+	return nil
+}
+
+//returns the matching entries, the newest first
+func (l *Log) Query(filter *Filter) ([]*Entry, error) {
+	res := make([]*Entry, 0)
+	err := l.scan(func(entry *Entry) error {
+		if filter.matches(entry) {
+			res = append(res, entry)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+
+	if filter.Limit > 0 && len(res) > filter.Limit {
+		res = res[:filter.Limit]
+	}
+	return res, nil
+}
+
+//writes the matching entries as json lines, the oldest first. The limit is ignored.
+func (l *Log) Export(writer io.Writer, filter *Filter) error {
+	encoder := json.NewEncoder(writer)
+	err := l.scan(func(entry *Entry) error {
+		if filter.matches(entry) {
+			return encoder.Encode(entry)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+//reads all entries in order
+func (l *Log) scan(f func(entry *Entry) error) error {
+	file, err := os.Open(l.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			entry := &Entry{}
+			jsonErr := json.Unmarshal(line, entry)
+			if jsonErr != nil {
+				return jsonErr
+			}
+			cbErr := f(entry)
+			if cbErr != nil {
+				return cbErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
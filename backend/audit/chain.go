@@ -0,0 +1,325 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/worldiety/devdrasil/log"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//A Checkpoint is the signed head of the chain. Entries up to the last checkpoint cannot be changed, reordered
+//or truncated without breaking a signature. Later entries are only protected by the chain itself.
+type Checkpoint struct {
+	//the sequence number of the signed entry
+	Seq uint64
+
+	//the hash of the signed entry
+	Hash string
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	Time int64
+
+	//the hex encoded ed25519 signature of the server key
+	Signature string
+}
+
+//the message which is actually signed
+func (c *Checkpoint) message() []byte {
+	return []byte(strconv.FormatUint(c.Seq, 10) + ":" + c.Hash + ":" + strconv.FormatInt(c.Time, 10))
+}
+
+//A BrokenLink describes the first entry or checkpoint which does not verify
+type BrokenLink struct {
+	//the sequence number of the affected entry, or 0 if it cannot be parsed
+	Seq uint64
+
+	//the line in the log file, starting at 1
+	Line int
+
+	//e.g. 'hash mismatch'
+	Reason string
+}
+
+func (b *BrokenLink) String() string {
+	return fmt.Sprintf("line %d (seq %d): %s", b.Line, b.Seq, b.Reason)
+}
+
+//The Report of a verification
+type Report struct {
+	//the amount of valid entries before the first broken link
+	Entries uint64
+
+	//the amount of valid checkpoints
+	Checkpoints int
+
+	//the first broken link or nil if the whole chain is intact
+	Broken *BrokenLink
+}
+
+//the hash of the entry without its own hash but including the hash of the previous entry
+func (e *Entry) computeHash() (string, error) {
+	tmp := *e
+	tmp.Hash = ""
+	data, err := json.Marshal(&tmp)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+//the checkpoints are kept next to the log, e.g. audit.log.checkpoints
+func checkpointFile(logFile string) string {
+	return logFile + ".checkpoints"
+}
+
+//returns all checkpoints in order, or an empty list if there is no file yet
+func readCheckpoints(file string) ([]*Checkpoint, error) {
+	res := make([]*Checkpoint, 0)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		checkpoint := &Checkpoint{}
+		err = json.Unmarshal([]byte(line), checkpoint)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, checkpoint)
+	}
+	return res, nil
+}
+
+//LoadKey reads the hex encoded ed25519 seed from the file
+func LoadKey(file string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid key size in %s: %d", file, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+//LoadOrCreateKey reads the key from the file or generates a new one, which only the owner can read
+func LoadOrCreateKey(file string) (ed25519.PrivateKey, error) {
+	key, err := LoadKey(file)
+	if err == nil || !os.IsNotExist(err) {
+		return key, err
+	}
+
+	_, key, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(file, []byte(hex.EncodeToString(key.Seed())), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+//PublicKeyString returns the hex encoded public key, which should be kept outside of the server to verify the checkpoints
+func PublicKeyString(key ed25519.PrivateKey) string {
+	return hex.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+//ParsePublicKey parses a hex encoded public key
+func ParsePublicKey(str string) (ed25519.PublicKey, error) {
+	data, err := hex.DecodeString(strings.TrimSpace(str))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size: %d", len(data))
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+//SetKey sets the key which signs the checkpoints
+func (l *Log) SetKey(key ed25519.PrivateKey) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.key = key
+}
+
+//Checkpoint signs the current head of the chain. Does nothing, if there is no new entry since the last checkpoint.
+func (l *Log) Checkpoint() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.key == nil {
+		return fmt.Errorf("no key to sign audit checkpoints")
+	}
+	if l.lastSeq == 0 || l.lastSeq == l.checkpointSeq {
+		return nil
+	}
+
+	checkpoint := &Checkpoint{Seq: l.lastSeq, Hash: l.lastHash, Time: time.Now().Unix()}
+	checkpoint.Signature = hex.EncodeToString(ed25519.Sign(l.key, checkpoint.message()))
+
+	line, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(checkpointFile(l.file), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+	l.checkpointSeq = checkpoint.Seq
+	return nil
+}
+
+//signs a checkpoint in the given interval until StopCheckpoints is called
+func (l *Log) StartCheckpoints(interval time.Duration) {
+	l.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+
+			err := l.Checkpoint()
+			if err != nil {
+				log.Default.Error(log.New("failed to sign audit checkpoint").SetError(err))
+			}
+		}
+	}(l.stop)
+}
+
+//stops the periodic checkpoints
+func (l *Log) StopCheckpoints() {
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+}
+
+//Verify walks the chain of the log file and checks every checkpoint against the public key. The first broken link
+//is reported, e.g. an edited, inserted, removed or reordered entry, a forged checkpoint or a truncated log.
+func Verify(file string, publicKey ed25519.PublicKey) (*Report, error) {
+	report := &Report{}
+
+	checkpoints, err := readCheckpoints(checkpointFile(file))
+	if err != nil {
+		return nil, err
+	}
+
+	//the signed hashes by sequence number
+	signed := make(map[uint64]string)
+	for _, checkpoint := range checkpoints {
+		sig, err := hex.DecodeString(checkpoint.Signature)
+		if err != nil || !ed25519.Verify(publicKey, checkpoint.message(), sig) {
+			report.Broken = &BrokenLink{Seq: checkpoint.Seq, Reason: "invalid checkpoint signature"}
+			return report, nil
+		}
+		signed[checkpoint.Seq] = checkpoint.Hash
+	}
+
+	f, err := os.Open(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if f != nil {
+		defer f.Close()
+		report.Broken, err = verifyChain(f, signed, report)
+		if err != nil {
+			return nil, err
+		}
+		if report.Broken != nil {
+			return report, nil
+		}
+	}
+
+	//checkpoints which have no entry anymore
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Seq > report.Entries {
+			report.Broken = &BrokenLink{Seq: checkpoint.Seq, Reason: "log truncated, checkpointed entry is missing"}
+			return report, nil
+		}
+		report.Checkpoints++
+	}
+	return report, nil
+}
+
+//walks the entries, counts the valid ones and returns the first broken link
+func verifyChain(reader io.Reader, signed map[uint64]string, report *Report) (*BrokenLink, error) {
+	buf := bufio.NewReader(reader)
+	lastHash := ""
+	lineNo := 0
+	for {
+		line, err := buf.ReadBytes('\n')
+		if len(line) > 0 {
+			lineNo++
+			entry := &Entry{}
+			jsonErr := json.Unmarshal(line, entry)
+			if jsonErr != nil {
+				return &BrokenLink{Line: lineNo, Reason: "unreadable entry: " + jsonErr.Error()}, nil
+			}
+
+			if entry.Seq != report.Entries+1 {
+				return &BrokenLink{Seq: entry.Seq, Line: lineNo, Reason: fmt.Sprintf("expected seq %d", report.Entries+1)}, nil
+			}
+			if entry.PrevHash != lastHash {
+				return &BrokenLink{Seq: entry.Seq, Line: lineNo, Reason: "previous hash mismatch"}, nil
+			}
+			hash, hashErr := entry.computeHash()
+			if hashErr != nil {
+				return nil, hashErr
+			}
+			if entry.Hash != hash {
+				return &BrokenLink{Seq: entry.Seq, Line: lineNo, Reason: "hash mismatch"}, nil
+			}
+			if signedHash, ok := signed[entry.Seq]; ok && signedHash != hash {
+				return &BrokenLink{Seq: entry.Seq, Line: lineNo, Reason: "hash differs from signed checkpoint"}, nil
+			}
+
+			lastHash = hash
+			report.Entries++
+		}
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devdrasil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "audit.log")
+	auditLog, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadOrCreateKey(filepath.Join(dir, "audit.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog.SetKey(key)
+	publicKey := key.Public().(ed25519.PublicKey)
+
+	for _, target := range []string{"alice", "bob", "carol"} {
+		err = auditLog.Append(&Entry{Action: "user.update", Target: target, Changes: Diff(map[string]interface{}{"Active": true}, map[string]interface{}{"Active": false})})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := auditLog.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Verify(file, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Broken != nil || report.Entries != 3 || report.Checkpoints != 1 {
+		t.Fatalf("expected an intact chain but got %+v", report)
+	}
+
+	//the chain continues after reopening
+	auditLog, err = Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auditLog.Append(&Entry{Action: "user.delete", Target: "dave"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := string(data)
+
+	tampered := map[string]string{
+		"edited":    strings.Replace(original, "bob", "eve", 1),
+		"removed":   strings.Join(append(strings.SplitN(original, "\n", 3)[:1], strings.SplitN(original, "\n", 3)[2]), "\n"),
+		"truncated": strings.SplitN(original, "\n", 2)[0] + "\n",
+	}
+	for name, content := range tampered {
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		report, err := Verify(file, publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Broken == nil {
+			t.Fatalf("%s: expected a broken link", name)
+		}
+	}
+
+	//a forged checkpoint
+	if err := ioutil.WriteFile(file, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	report, err = Verify(file, otherKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Broken == nil || report.Broken.Reason != "invalid checkpoint signature" {
+		t.Fatalf("expected an invalid signature but got %+v", report)
+	}
+}
@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//the value which replaces secrets in a diff
+const redacted = "<redacted>"
+
+//A Change of a single top level field
+type Change struct {
+	Field  string
+	Before interface{} `json:",omitempty"`
+	After  interface{} `json:",omitempty"`
+}
+
+//Diff compares the json representation of both entities. Either may be nil, e.g. for creation or deletion.
+//The values of fields which look like secrets (password, secret, hash) are never recorded, only that they changed.
+func Diff(before interface{}, after interface{}) []*Change {
+	a := toMap(before)
+	b := toMap(after)
+
+	fields := make([]string, 0)
+	for k := range a {
+		fields = append(fields, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+
+	res := make([]*Change, 0)
+	for _, field := range fields {
+		va, vb := a[field], b[field]
+		if reflect.DeepEqual(va, vb) {
+			continue
+		}
+		change := &Change{Field: field, Before: va, After: vb}
+		if isSecret(field) {
+			change.Before = nil
+			change.After = redacted
+		}
+		res = append(res, change)
+	}
+	return res
+}
+
+func isSecret(field string) bool {
+	lower := strings.ToLower(field)
+	return strings.Contains(lower, "password") || strings.Contains(lower, "secret") || strings.Contains(lower, "hash")
+}
+
+func toMap(obj interface{}) map[string]interface{} {
+	res := make(map[string]interface{})
+	if obj == nil || (reflect.ValueOf(obj).Kind() == reflect.Ptr && reflect.ValueOf(obj).IsNil()) {
+		return res
+	}
+
+	buf, err := json.Marshal(obj)
+	if err != nil {
+		return res
+	}
+	json.Unmarshal(buf, &res)
+	return res
+}
@@ -0,0 +1,33 @@
+package backend
+
+import (
+	"github.com/worldiety/devdrasil/backend/user"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAuditRecordsSessionHandle(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	admin, err := env.users.Get(user.ADMIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ses := env.login(t, admin)
+	alice := env.addUser(t, "alice")
+	if status := env.serve(newSessionRequest("PUT", "/users/"+alice.Id.String(), `{"Firstname":"Alice"}`, ses)).Code; status != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, status)
+	}
+
+	recorder := env.serve(newSessionRequest("GET", "/audit", "", ses))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, recorder.Code)
+	}
+	body := recorder.Body.String()
+	if strings.Contains(body, ses.Id.String()) || !strings.Contains(body, ses.Handle().String()) {
+		t.Fatal(body)
+	}
+}
@@ -0,0 +1,282 @@
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"github.com/worldiety/devdrasil/backend/audit"
+	"github.com/worldiety/devdrasil/backend/company"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"strings"
+)
+
+//the branding for the current user, with urls instead of image ids
+type brandingDTO struct {
+	//the title of the app
+	AppTitle string
+
+	ThemePrimaryColor   string
+	ThemeSecondaryColor string
+
+	//the url of the logo, empty if absent
+	LogoURL string
+
+	//the url of the favicon, empty if absent
+	FaviconURL string
+}
+
+func newBrandingDTO(branding *company.Branding) *brandingDTO {
+	return &brandingDTO{AppTitle: branding.AppTitle, ThemePrimaryColor: branding.ThemePrimaryColor, ThemeSecondaryColor: branding.ThemeSecondaryColor, LogoURL: BrandingImageURL(branding.Logo), FaviconURL: BrandingImageURL(branding.Favicon)}
+}
+
+//returns the public url of a logo or favicon or the empty string
+func BrandingImageURL(id *db.PK) string {
+	if id == nil {
+		return ""
+	}
+	return "/branding/images/" + id.String()
+}
+
+//The branding endpoints upload the logo and favicon of a company and serve the branding of the current user.
+//The branding is public, so that it can be applied before the login, as far as a session cookie is known.
+type EndpointBranding struct {
+	router      *Router
+	sessions    *session.Sessions
+	users       *user.Users
+	permissions *user.Permissions
+	companies   *company.Companies
+	audit       *audit.Log
+}
+
+func NewEndpointBranding(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, companies *company.Companies, auditLog *audit.Log) *EndpointBranding {
+	endpoint := &EndpointBranding{router: router, sessions: sessions, users: users, permissions: permissions, companies: companies, audit: auditLog}
+	auth := Authenticated(sessions, users)
+	router.HandlePK("PUT", "/companies/logo/{id:pk}", endpoint.updateLogo, auth)
+	router.HandlePK("DELETE", "/companies/logo/{id:pk}", endpoint.deleteLogo, auth)
+	router.HandlePK("PUT", "/companies/favicon/{id:pk}", endpoint.updateFavicon, auth)
+	router.HandlePK("DELETE", "/companies/favicon/{id:pk}", endpoint.deleteFavicon, auth)
+	router.Handle("GET", "/branding", endpoint.getBranding)
+	router.Handle("GET", "/branding/theme.css", endpoint.getThemeCSS)
+	router.HandlePK("GET", "/branding/images/{id:pk}", endpoint.getImage)
+	return endpoint
+}
+
+//Current returns the branding of the company of the user, who is identified by the sid header or cookie.
+//Anonymous requests and any failure result in the default branding.
+func (e *EndpointBranding) Current(request *http.Request) *company.Branding {
+	return e.currentCompany(request).Branding()
+}
+
+//returns the company of the session user or nil
+func (e *EndpointBranding) currentCompany(request *http.Request) *company.Company {
+	sid := request.Header.Get("sid")
+	if sid == "" {
+		if cookie, err := request.Cookie(SessionCookie); err == nil {
+			sid = cookie.Value
+		}
+	}
+
+	sessionId, err := db.ParsePK(sid)
+	if err != nil || sessionId.IsNIL() {
+		return nil
+	}
+	ses, err := e.sessions.Get(sessionId)
+	if err != nil {
+		return nil
+	}
+	usr, err := e.users.Get(ses.User)
+	if err != nil || !usr.Active || usr.Company == nil {
+		return nil
+	}
+	cmp, err := e.companies.Get(*usr.Company)
+	if err != nil {
+		return nil
+	}
+	return cmp
+}
+
+// Returns the branding of the company of the current user or the default branding, if there is no session.
+//  @Path GET /branding
+//  @Header sid string (optional, the sid cookie is also accepted)
+//	@Return 200 github.com/worldiety/devdrasil/backend/brandingDTO
+func (e *EndpointBranding) getBranding(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Cache-Control", "no-cache, private")
+	WriteJSONBody(writer, newBrandingDTO(e.Current(request)))
+}
+
+// Returns a style sheet with the theme colors of the company of the current user, as custom properties of the material components.
+//  @Path GET /branding/theme.css
+//  @Header sid string (optional, the sid cookie is also accepted)
+//	@Return 200 (text/css)
+func (e *EndpointBranding) getThemeCSS(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/css; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-cache, private")
+	writer.Write([]byte(ThemeCSS(e.Current(request))))
+}
+
+//ThemeCSS renders the colors of the branding, which are validated by company.IsColor
+func ThemeCSS(branding *company.Branding) string {
+	sb := &strings.Builder{}
+	sb.WriteString(":root {\n")
+	fmt.Fprintf(sb, "  --mdc-theme-primary: %s;\n", branding.ThemePrimaryColor)
+	if branding.ThemeSecondaryColor != "" {
+		fmt.Fprintf(sb, "  --mdc-theme-secondary: %s;\n", branding.ThemeSecondaryColor)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Returns a logo or favicon. The images are public and never change, a new upload gets a new id.
+//  @Path GET /branding/images/{id}
+//	@Return 200 (the image)
+//  @Return 404 (if the image does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointBranding) getImage(writer http.ResponseWriter, request *http.Request, imageId db.PK) {
+	img, err := e.companies.GetImage(imageId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+	writer.Header().Set("Content-Type", img.ContentType)
+	writer.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	//an svg may contain scripts, which must not run in our origin when the image is opened directly
+	writer.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	writer.Write(img.Data)
+}
+
+// Uploads the logo of a company. The body is the image, its content type must be one of png, jpeg, gif, webp, svg or ico.
+// Requires UPDATE_COMPANY for the company.
+//  @Path PUT /companies/logo/{id}
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/companyDTO
+//  @Return 400 (if the image is empty or larger than 1 MiB)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 404 (if the company does not exist)
+//  @Return 415 (if the content type is not supported)
+//  @Return 500 (for any other error)
+func (e *EndpointBranding) updateLogo(writer http.ResponseWriter, request *http.Request, companyId db.PK) {
+	e.updateImage(writer, request, companyId, "company.logo.update", func(cmp *company.Company) **db.PK {
+		return &cmp.Logo
+	})
+}
+
+// Removes the logo of a company, so that the default is used. Requires UPDATE_COMPANY for the company.
+//  @Path DELETE /companies/logo/{id}
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/companyDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 404 (if the company does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointBranding) deleteLogo(writer http.ResponseWriter, request *http.Request, companyId db.PK) {
+	e.updateImage(writer, request, companyId, "company.logo.delete", func(cmp *company.Company) **db.PK {
+		return &cmp.Logo
+	})
+}
+
+// Uploads the favicon of a company, like the logo.
+//  @Path PUT /companies/favicon/{id}
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/companyDTO
+//  @Return 400 (if the image is empty or larger than 1 MiB)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 404 (if the company does not exist)
+//  @Return 415 (if the content type is not supported)
+//  @Return 500 (for any other error)
+func (e *EndpointBranding) updateFavicon(writer http.ResponseWriter, request *http.Request, companyId db.PK) {
+	e.updateImage(writer, request, companyId, "company.favicon.update", func(cmp *company.Company) **db.PK {
+		return &cmp.Favicon
+	})
+}
+
+// Removes the favicon of a company, so that the default is used. Requires UPDATE_COMPANY for the company.
+//  @Path DELETE /companies/favicon/{id}
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/companyDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 404 (if the company does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointBranding) deleteFavicon(writer http.ResponseWriter, request *http.Request, companyId db.PK) {
+	e.updateImage(writer, request, companyId, "company.favicon.delete", func(cmp *company.Company) **db.PK {
+		return &cmp.Favicon
+	})
+}
+
+//replaces the image, which is selected by field, with the body of a PUT or removes it for a DELETE
+func (e *EndpointBranding) updateImage(writer http.ResponseWriter, request *http.Request, companyId db.PK, action string, field func(cmp *company.Company) **db.PK) {
+	ses, usr := CurrentSession(request)
+
+	if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_COMPANY, &user.Target{Company: &companyId}) {
+		return
+	}
+
+	cmp, err := e.companies.Get(companyId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+	before := *cmp
+
+	var img *company.Image
+	if request.Method == "PUT" {
+		img = e.readImage(writer, request)
+		if img == nil {
+			return
+		}
+		img.Company = companyId
+		err = e.companies.AddImage(img)
+		if AnyErrorAsInternalError(err, writer) {
+			return
+		}
+	}
+
+	old := *field(cmp)
+	*field(cmp) = nil
+	if img != nil {
+		*field(cmp) = &img.Id
+	}
+	err = e.companies.Update(cmp)
+	if AnyErrorAsHTTPError(err, writer) {
+		if img != nil {
+			e.companies.DeleteImage(img.Id)
+		}
+		return
+	}
+	if old != nil {
+		e.companies.DeleteImage(*old)
+	}
+
+	res := newCompanyDTO(e.users, cmp)
+	recordAudit(e.audit, ses, usr, request, action, companyId.String(), newCompanyDTO(e.users, &before), res)
+	WriteJSONBody(writer, res)
+}
+
+//reads and checks the uploaded image. Writes the error, so just return if nil.
+func (e *EndpointBranding) readImage(writer http.ResponseWriter, request *http.Request) *company.Image {
+	contentType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || !containsString(company.ImageContentTypes, contentType) {
+		WriteError(writer, http.StatusUnsupportedMediaType, "unsupported image type, expected one of "+strings.Join(company.ImageContentTypes, ", "))
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(writer, request.Body, company.MaxImageSize))
+	if err != nil {
+		WriteError(writer, http.StatusBadRequest, "image too large")
+		return nil
+	}
+	if len(data) == 0 {
+		WriteError(writer, http.StatusBadRequest, "image is empty")
+		return nil
+	}
+	return &company.Image{ContentType: contentType, Data: data}
+}
+
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package backend
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"github.com/worldiety/devdrasil/backend/audit"
+	"github.com/worldiety/devdrasil/backend/bulk"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/log"
+	"strings"
+)
+
+//the maximum size of an import
+const maxBulkBodySize = 16 << 20
+
+//The bulk endpoints import and export users, groups and companies as json or csv. Importing requires the global
+//permissions to create and update, because every row may do either. The rows span all tenants, so that MANAGE_TENANTS
+//is always required.
+type EndpointBulk struct {
+	router   *Router
+	sessions *session.Sessions
+	users    *user.Users
+	importer *bulk.Importer
+	audit    *audit.Log
+}
+
+func NewEndpointBulk(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, importer *bulk.Importer, auditLog *audit.Log) *EndpointBulk {
+	endpoint := &EndpointBulk{router: router, sessions: sessions, users: users, importer: importer, audit: auditLog}
+	tenants := Permitted(sessions, users, permissions, user.MANAGE_TENANTS)
+	router.Handle("POST", "/bulk/users", endpoint.importUsers, tenants, Permitted(sessions, users, permissions, user.CREATE_USER), Permitted(sessions, users, permissions, user.UPDATE_USER))
+	router.Handle("GET", "/bulk/users", endpoint.exportUsers, tenants, Permitted(sessions, users, permissions, user.LIST_USERS))
+	router.Handle("POST", "/bulk/groups", endpoint.importGroups, tenants, Permitted(sessions, users, permissions, user.CREATE_GROUP), Permitted(sessions, users, permissions, user.UPDATE_GROUP))
+	router.Handle("GET", "/bulk/groups", endpoint.exportGroups, tenants, Permitted(sessions, users, permissions, user.LIST_GROUPS))
+	router.Handle("POST", "/bulk/companies", endpoint.importCompanies, tenants, Permitted(sessions, users, permissions, user.CREATE_COMPANY), Permitted(sessions, users, permissions, user.UPDATE_COMPANY))
+	router.Handle("GET", "/bulk/companies", endpoint.exportCompanies, tenants, Permitted(sessions, users, permissions, user.LIST_COMPANIES))
+	return endpoint
+}
+
+// Imports users as a json list or as csv, if the content type is text/csv. The csv has a header line with the columns
+// login, firstname, lastname, email, company, groups, active, service_account and password. Lists are separated by ;
+// and companies and groups are referenced by name. All rows are validated first and either all or none are applied.
+//  @Path POST /bulk/users?dryRun={true|false} (a dry run only validates the rows)
+//  @Header sid string
+//	@Body []github.com/worldiety/devdrasil/backend/bulk/UserRow
+//	@Return 200 github.com/worldiety/devdrasil/backend/bulk/Report
+//  @Return 400 (if the body cannot be parsed | if any row is invalid, the report is in the details)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 409 (if a login has been taken concurrently)
+//  @Return 500 (for any other error)
+func (e *EndpointBulk) importUsers(writer http.ResponseWriter, request *http.Request) {
+	rows := make([]*bulk.UserRow, 0)
+	if !readBulkRows(writer, request, &rows, func(r io.Reader) (err error) {
+		rows, err = bulk.ReadUsersCSV(r)
+		return
+	}) {
+		return
+	}
+
+	report, err := e.importer.ImportUsers(rows, isDryRun(request))
+	e.writeReport(writer, request, "user.import", report, err)
+}
+
+// Exports all users as json or as csv, if requested by the format parameter or the accept header. Passwords are never exported.
+//  @Path GET /bulk/users?format={json|csv}
+//  @Header sid string
+//	@Return 200 []github.com/worldiety/devdrasil/backend/bulk/UserRow
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 500 (for any other error)
+func (e *EndpointBulk) exportUsers(writer http.ResponseWriter, request *http.Request) {
+	rows, err := e.importer.ExportUsers()
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	writeBulkRows(writer, request, "users", rows, func(w io.Writer) error {
+		return bulk.WriteUsersCSV(w, rows)
+	})
+}
+
+// Imports groups as a json list or as csv with the columns name, groups and roles. The parent groups may be part of
+// the same import. All rows are validated first and either all or none are applied.
+//  @Path POST /bulk/groups?dryRun={true|false} (a dry run only validates the rows)
+//  @Header sid string
+//	@Body []github.com/worldiety/devdrasil/backend/bulk/GroupRow
+//	@Return 200 github.com/worldiety/devdrasil/backend/bulk/Report
+//  @Return 400 (if the body cannot be parsed | if any row is invalid, the report is in the details)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 409 (if a name has been taken concurrently)
+//  @Return 500 (for any other error)
+func (e *EndpointBulk) importGroups(writer http.ResponseWriter, request *http.Request) {
+	rows := make([]*bulk.GroupRow, 0)
+	if !readBulkRows(writer, request, &rows, func(r io.Reader) (err error) {
+		rows, err = bulk.ReadGroupsCSV(r)
+		return
+	}) {
+		return
+	}
+
+	report, err := e.importer.ImportGroups(rows, isDryRun(request))
+	e.writeReport(writer, request, "group.import", report, err)
+}
+
+// Exports all groups as json or csv.
+//  @Path GET /bulk/groups?format={json|csv}
+//  @Header sid string
+//	@Return 200 []github.com/worldiety/devdrasil/backend/bulk/GroupRow
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 500 (for any other error)
+func (e *EndpointBulk) exportGroups(writer http.ResponseWriter, request *http.Request) {
+	rows, err := e.importer.ExportGroups()
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	writeBulkRows(writer, request, "groups", rows, func(w io.Writer) error {
+		return bulk.WriteGroupsCSV(w, rows)
+	})
+}
+
+// Imports companies as a json list or as csv with the columns name and theme_primary_color. All rows are validated
+// first and either all or none are applied.
+//  @Path POST /bulk/companies?dryRun={true|false} (a dry run only validates the rows)
+//  @Header sid string
+//	@Body []github.com/worldiety/devdrasil/backend/bulk/CompanyRow
+//	@Return 200 github.com/worldiety/devdrasil/backend/bulk/Report
+//  @Return 400 (if the body cannot be parsed | if any row is invalid, the report is in the details)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 409 (if a name has been taken concurrently)
+//  @Return 500 (for any other error)
+func (e *EndpointBulk) importCompanies(writer http.ResponseWriter, request *http.Request) {
+	rows := make([]*bulk.CompanyRow, 0)
+	if !readBulkRows(writer, request, &rows, func(r io.Reader) (err error) {
+		rows, err = bulk.ReadCompaniesCSV(r)
+		return
+	}) {
+		return
+	}
+
+	report, err := e.importer.ImportCompanies(rows, isDryRun(request))
+	e.writeReport(writer, request, "company.import", report, err)
+}
+
+// Exports all companies as json or csv.
+//  @Path GET /bulk/companies?format={json|csv}
+//  @Header sid string
+//	@Return 200 []github.com/worldiety/devdrasil/backend/bulk/CompanyRow
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 500 (for any other error)
+func (e *EndpointBulk) exportCompanies(writer http.ResponseWriter, request *http.Request) {
+	rows, err := e.importer.ExportCompanies()
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	writeBulkRows(writer, request, "companies", rows, func(w io.Writer) error {
+		return bulk.WriteCompaniesCSV(w, rows)
+	})
+}
+
+//responds with the report, which is a 400 if any row is invalid
+func (e *EndpointBulk) writeReport(writer http.ResponseWriter, request *http.Request, action string, report *bulk.Report, err error) {
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+	if report.Failed() {
+		WriteErrorDetails(writer, http.StatusBadRequest, "invalid rows", report)
+		return
+	}
+	if report.Applied {
+		ses, usr := CurrentSession(request)
+		recordAudit(e.audit, ses, usr, request, action, "", nil, report)
+	}
+	WriteJSONBody(writer, report)
+}
+
+//reads the json list into rows or calls readCSV for a text/csv body. Writes the error, so just return if false.
+func readBulkRows(writer http.ResponseWriter, request *http.Request, rows interface{}, readCSV func(r io.Reader) error) bool {
+	body := http.MaxBytesReader(writer, request.Body, maxBulkBodySize)
+	var err error
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "text/csv") {
+		err = readCSV(body)
+	} else {
+		err = json.NewDecoder(body).Decode(rows)
+	}
+	if err != nil {
+		writeBodyError(writer, err)
+		return false
+	}
+	return true
+}
+
+//writes the rows as json or calls writeCSV, if csv has been requested
+func writeBulkRows(writer http.ResponseWriter, request *http.Request, name string, rows interface{}, writeCSV func(w io.Writer) error) {
+	format := request.URL.Query().Get("format")
+	if format == "" && strings.Contains(request.Header.Get("Accept"), "text/csv") {
+		format = "csv"
+	}
+	if format != "csv" {
+		WriteJSONBody(writer, rows)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writer.Header().Set("Content-Disposition", "attachment; filename=\""+name+".csv\"")
+	err := writeCSV(writer)
+	if err != nil {
+		//the header is already written
+		log.Default.Error(log.New("failed to export csv").Put("name", name).SetError(err))
+	}
+}
+
+func isDryRun(request *http.Request) bool {
+	return request.URL.Query().Get("dryRun") == "true"
+}
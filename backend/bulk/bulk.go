@@ -0,0 +1,99 @@
+package bulk
+
+import (
+	"github.com/worldiety/devdrasil/backend/company"
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"github.com/worldiety/devdrasil/log"
+	"strings"
+	"sync"
+)
+
+//the actions of a row
+const (
+	ACTION_CREATE = "create"
+	ACTION_UPDATE = "update"
+)
+
+//the outcome of a single row
+type RowResult struct {
+	//the number of the row, starting at 1. The header of a csv file is not counted.
+	Row int
+
+	//the login or the name
+	Key string
+
+	//create or update
+	Action string
+
+	//the id of the entity, nil if it has not been created yet
+	Id *db.PK `json:",omitempty"`
+
+	//the reasons, why the row is invalid
+	Errors []string `json:",omitempty"`
+}
+
+//the per-row report of an import
+type Report struct {
+	//true, if the rows have only been validated
+	DryRun bool
+
+	//true, if all rows have been applied. Either all rows are applied or none.
+	Applied bool
+
+	Rows []*RowResult
+}
+
+//returns true, if any row is invalid
+func (r *Report) Failed() bool {
+	for _, row := range r.Rows {
+		if len(row.Errors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RowResult) fail(msg string) {
+	r.Errors = append(r.Errors, msg)
+}
+
+//The Importer validates all rows before it applies any of them. The database cannot roll back, so if applying fails
+//halfway, the already applied rows are reverted by the recorded compensations.
+type Importer struct {
+	users     *user.Users
+	groups    *group.Groups
+	companies *company.Companies
+	roles     *user.Roles
+	sessions  *session.Sessions
+
+	//serializes the imports, so that the validation still holds when the rows are applied
+	mutex sync.Mutex
+}
+
+func NewImporter(users *user.Users, groups *group.Groups, companies *company.Companies, roles *user.Roles, sessions *session.Sessions) *Importer {
+	return &Importer{users: users, groups: groups, companies: companies, roles: roles, sessions: sessions}
+}
+
+//the compensations of the applied rows
+type undoLog []func() error
+
+func (u *undoLog) add(undo func() error) {
+	*u = append(*u, undo)
+}
+
+//reverts in reverse order and continues on errors, so that as much as possible is reverted
+func (u undoLog) rollback() {
+	for i := len(u) - 1; i >= 0; i-- {
+		if err := u[i](); err != nil {
+			log.Default.Error(log.New("failed to revert a bulk import").SetError(err))
+		}
+	}
+}
+
+//the key of a name, which is unique case insensitive
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
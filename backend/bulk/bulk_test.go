@@ -0,0 +1,108 @@
+package bulk
+
+import (
+	"github.com/worldiety/devdrasil/backend/company"
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestImporter(t *testing.T) (*Importer, func()) {
+	dir, err := ioutil.TempDir("", "devdrasil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := db.Open(dir)
+	users, err := user.NewUsers(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	importer := NewImporter(users, group.NewGroups(d), company.NewCompanies(d), user.NewRoles(d), session.NewSessions(d))
+	return importer, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestImportIsAllOrNothing(t *testing.T) {
+	importer, cleanup := newTestImporter(t)
+	defer cleanup()
+
+	rows, err := ReadGroupsCSV(strings.NewReader("name,groups\nstaff,\nadmins,staff\nbroken,unknown\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := importer.ImportGroups(rows, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Failed() || report.Applied || len(report.Rows[2].Errors) != 1 {
+		t.Fatalf("expected the third row to fail: %+v", report.Rows[2])
+	}
+	exported, err := importer.ExportGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 0 {
+		t.Fatalf("expected nothing to be applied, got %d groups", len(exported))
+	}
+
+	//a parent of the same batch and a cycle
+	report, err = importer.ImportGroups(rows[:2], false)
+	if err != nil || !report.Applied {
+		t.Fatalf("expected the import to succeed: %v %+v", err, report)
+	}
+	report, err = importer.ImportGroups([]*GroupRow{{Name: "Staff", Groups: []string{"admins"}}}, false)
+	if err != nil || !report.Failed() {
+		t.Fatalf("expected a cycle: %v %+v", err, report)
+	}
+
+	exported, err = importer.ExportGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 2 || exported[0].Name != "admins" || len(exported[0].Groups) != 1 || exported[0].Groups[0] != "staff" {
+		t.Fatalf("unexpected export %+v", exported)
+	}
+}
+
+func TestImportUsersRoundTrip(t *testing.T) {
+	importer, cleanup := newTestImporter(t)
+	defer cleanup()
+
+	_, err := importer.ImportCompanies([]*CompanyRow{{Name: "ACME"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csv := "login,firstname,email,company,password\njdoe,John,a@b.c;d@e.f,acme,Very-Secret-42\n"
+	rows, err := ReadUsersCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := importer.ImportUsers(rows, true)
+	if err != nil || report.Failed() || report.Applied {
+		t.Fatalf("expected a valid dry run: %v %+v", err, report)
+	}
+	report, err = importer.ImportUsers(rows, false)
+	if err != nil || report.Failed() || !report.Applied || report.Rows[0].Id == nil {
+		t.Fatalf("expected the user to be created: %v %+v", err, report)
+	}
+
+	exported, err := importer.ExportUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb := &strings.Builder{}
+	err = WriteUsersCSV(sb, exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sb.String(), "password") || !strings.Contains(sb.String(), "jdoe,John,,a@b.c;d@e.f,ACME,,true,false") {
+		t.Fatalf("unexpected export\n%s", sb.String())
+	}
+}
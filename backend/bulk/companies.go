@@ -0,0 +1,127 @@
+package bulk
+
+import (
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/company"
+	"io"
+	"sort"
+)
+
+var companyColumns = []string{"name", "theme_primary_color"}
+
+//a company, which is identified by its case insensitive name
+type CompanyRow struct {
+	Name string
+
+	//e.g. #ff0000
+	ThemePrimaryColor string
+}
+
+func ReadCompaniesCSV(r io.Reader) ([]*CompanyRow, error) {
+	records, err := readCSV(r, companyColumns, "name")
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*CompanyRow, 0, len(records))
+	for _, rec := range records {
+		res = append(res, &CompanyRow{Name: rec["name"], ThemePrimaryColor: rec["theme_primary_color"]})
+	}
+	return res, nil
+}
+
+func WriteCompaniesCSV(w io.Writer, rows []*CompanyRow) error {
+	records := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, []string{row.Name, row.ThemePrimaryColor})
+	}
+	return writeCSV(w, companyColumns, records)
+}
+
+//ImportCompanies creates the companies with an unknown name and updates the others
+func (i *Importer) ImportCompanies(rows []*CompanyRow, dryRun bool) (*Report, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	companies, err := i.companies.List()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*company.Company)
+	for _, cmp := range companies {
+		byName[nameKey(cmp.Name)] = cmp
+	}
+
+	report := &Report{DryRun: dryRun}
+	seen := make(map[string]int)
+	for idx, row := range rows {
+		res := &RowResult{Row: idx + 1, Key: row.Name, Action: ACTION_CREATE}
+		report.Rows = append(report.Rows, res)
+
+		key := nameKey(row.Name)
+		if key == "" {
+			res.fail("name is required")
+		} else if other, ok := seen[key]; ok {
+			res.fail(fmt.Sprintf("duplicate of row %d", other))
+		}
+		seen[key] = res.Row
+		if !company.IsColor(row.ThemePrimaryColor) {
+			res.fail("invalid color: " + row.ThemePrimaryColor)
+		}
+
+		if existing := byName[key]; existing != nil {
+			res.Action = ACTION_UPDATE
+			id := existing.Id
+			res.Id = &id
+		}
+	}
+	if report.Failed() || dryRun {
+		return report, nil
+	}
+
+	undo := undoLog{}
+	for idx, row := range rows {
+		res := report.Rows[idx]
+		if existing := byName[nameKey(row.Name)]; existing != nil {
+			before := *existing
+			existing.Name = row.Name
+			existing.ThemePrimaryColor = row.ThemePrimaryColor
+			err = i.companies.Update(existing)
+			if err == nil {
+				undo.add(func() error {
+					return i.companies.Update(&before)
+				})
+			}
+		} else {
+			cmp := &company.Company{Name: row.Name, ThemePrimaryColor: row.ThemePrimaryColor}
+			err = i.companies.Add(cmp)
+			if err == nil {
+				res.Id = &cmp.Id
+				undo.add(func() error {
+					return i.companies.Delete(cmp.Id)
+				})
+			}
+		}
+		if err != nil {
+			undo.rollback()
+			return nil, err
+		}
+	}
+	report.Applied = true
+	return report, nil
+}
+
+//ExportCompanies returns all companies, sorted by name
+func (i *Importer) ExportCompanies() ([]*CompanyRow, error) {
+	companies, err := i.companies.List()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*CompanyRow, 0, len(companies))
+	for _, cmp := range companies {
+		res = append(res, &CompanyRow{Name: cmp.Name, ThemePrimaryColor: cmp.ThemePrimaryColor})
+	}
+	sort.Slice(res, func(a, b int) bool {
+		return nameKey(res[a].Name) < nameKey(res[b].Name)
+	})
+	return res, nil
+}
@@ -0,0 +1,109 @@
+package bulk
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//separates the values of a list within a csv cell, e.g. developers;admins
+const listSeparator = ";"
+
+//reads a csv file with a header line. Each record is returned by its lower case column name. Unknown columns are rejected.
+func readCSV(r io.Reader, columns []string, required string) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("missing csv header")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(header))
+	hasRequired := false
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !contains(columns, name) {
+			return nil, fmt.Errorf("unknown column '%s', expected %s", name, strings.Join(columns, ","))
+		}
+		hasRequired = hasRequired || name == required
+		names[i] = name
+	}
+	if !hasRequired {
+		return nil, fmt.Errorf("missing column '%s'", required)
+	}
+
+	res := make([]map[string]string, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]string)
+		for i, value := range record {
+			values[names[i]] = strings.TrimSpace(value)
+		}
+		res = append(res, values)
+	}
+}
+
+func writeCSV(w io.Writer, columns []string, records [][]string) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(columns)
+	if err != nil {
+		return err
+	}
+	err = writer.WriteAll(records)
+	if err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+//parses an optional boolean, an empty value is nil
+func parseBool(row int, column string, value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	switch strings.ToLower(value) {
+	case "yes", "y":
+		value = "true"
+	case "no", "n":
+		value = "false"
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("row %d: %s is not a boolean: %s", row, column, value)
+	}
+	return &b, nil
+}
+
+func splitList(value string) []string {
+	res := make([]string, 0)
+	for _, item := range strings.Split(value, listSeparator) {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+func joinList(values []string) string {
+	return strings.Join(values, listSeparator)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
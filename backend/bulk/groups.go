@@ -0,0 +1,251 @@
+package bulk
+
+import (
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/db"
+	"io"
+	"sort"
+)
+
+var groupColumns = []string{"name", "groups", "roles"}
+
+//a group, which is identified by its case insensitive name
+type GroupRow struct {
+	Name string
+
+	//the names of the groups, which this group is a member of. They may be imported by the same batch.
+	Groups []string
+
+	//the names of the roles, which are assigned to all members
+	Roles []string
+}
+
+func ReadGroupsCSV(r io.Reader) ([]*GroupRow, error) {
+	records, err := readCSV(r, groupColumns, "name")
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*GroupRow, 0, len(records))
+	for _, rec := range records {
+		res = append(res, &GroupRow{Name: rec["name"], Groups: splitList(rec["groups"]), Roles: splitList(rec["roles"])})
+	}
+	return res, nil
+}
+
+func WriteGroupsCSV(w io.Writer, rows []*GroupRow) error {
+	records := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, []string{row.Name, joinList(row.Groups), joinList(row.Roles)})
+	}
+	return writeCSV(w, groupColumns, records)
+}
+
+//ImportGroups creates the groups with an unknown name and replaces the parent groups and roles of the others.
+//Groups which are managed by an external provider cannot be imported.
+func (i *Importer) ImportGroups(rows []*GroupRow, dryRun bool) (*Report, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	groups, err := i.groups.List()
+	if err != nil {
+		return nil, err
+	}
+	roleIds, err := i.roleIds()
+	if err != nil {
+		return nil, err
+	}
+
+	//the groups as they would be after the import. New groups get a temporary id, to detect cycles.
+	byName := make(map[string]*group.Group)
+	for _, grp := range groups {
+		byName[nameKey(grp.Name)] = grp
+	}
+	planned := make(map[string]*group.Group)
+	for idx, row := range rows {
+		key := nameKey(row.Name)
+		if existing := byName[key]; existing != nil {
+			tmp := *existing
+			planned[key] = &tmp
+		} else if planned[key] == nil {
+			planned[key] = &group.Group{Id: db.NewPK(fmt.Sprintf("bulk:%d", idx))}
+		}
+	}
+	for key, grp := range byName {
+		if planned[key] == nil {
+			planned[key] = grp
+		}
+	}
+
+	report := &Report{DryRun: dryRun}
+	seen := make(map[string]int)
+	parents := make([][]db.PK, len(rows))
+	roles := make([][]db.PK, len(rows))
+	for idx, row := range rows {
+		res := &RowResult{Row: idx + 1, Key: row.Name, Action: ACTION_CREATE}
+		report.Rows = append(report.Rows, res)
+
+		key := nameKey(row.Name)
+		if key == "" {
+			res.fail("name is required")
+			continue
+		}
+		if other, ok := seen[key]; ok {
+			res.fail(fmt.Sprintf("duplicate of row %d", other))
+		}
+		seen[key] = res.Row
+
+		if existing := byName[key]; existing != nil {
+			res.Action = ACTION_UPDATE
+			id := existing.Id
+			res.Id = &id
+			if existing.Provider != "" {
+				res.fail("the group is managed by " + existing.Provider)
+			}
+		}
+
+		for _, name := range row.Groups {
+			parent := planned[nameKey(name)]
+			if parent == nil {
+				res.fail("unknown group: " + name)
+				continue
+			}
+			parents[idx] = append(parents[idx], parent.Id)
+		}
+		for _, name := range row.Roles {
+			roleId, ok := roleIds[nameKey(name)]
+			if !ok {
+				res.fail("unknown role: " + name)
+				continue
+			}
+			roles[idx] = append(roles[idx], roleId)
+		}
+		planned[key].Groups = parents[idx]
+	}
+
+	all := make([]*group.Group, 0, len(planned))
+	for _, grp := range planned {
+		all = append(all, grp)
+	}
+	for idx, row := range rows {
+		if grp := planned[nameKey(row.Name)]; grp != nil && len(report.Rows[idx].Errors) == 0 && group.IsCyclic(all, grp.Id, grp.Groups) {
+			report.Rows[idx].fail("a group cannot be a member of itself")
+		}
+	}
+	if report.Failed() || dryRun {
+		return report, nil
+	}
+
+	//first create the new groups, so that their ids are known as parents
+	undo := undoLog{}
+	ids := make(map[db.PK]db.PK)
+	for idx, row := range rows {
+		if byName[nameKey(row.Name)] != nil {
+			continue
+		}
+		grp := &group.Group{Name: row.Name}
+		err = i.groups.Add(grp)
+		if err != nil {
+			undo.rollback()
+			return nil, err
+		}
+		ids[planned[nameKey(row.Name)].Id] = grp.Id
+		report.Rows[idx].Id = &grp.Id
+		undo.add(func() error {
+			return i.groups.Delete(grp.Id)
+		})
+	}
+
+	for idx, row := range rows {
+		grp, err := i.groups.Get(*report.Rows[idx].Id)
+		if err != nil {
+			undo.rollback()
+			return nil, err
+		}
+		before := *grp
+
+		grp.Name = row.Name
+		grp.Roles = roles[idx]
+		grp.Groups = make([]db.PK, 0, len(parents[idx]))
+		for _, parent := range parents[idx] {
+			if id, ok := ids[parent]; ok {
+				parent = id
+			}
+			grp.Groups = append(grp.Groups, parent)
+		}
+
+		err = i.groups.Update(grp)
+		if err != nil {
+			undo.rollback()
+			return nil, err
+		}
+		if report.Rows[idx].Action == ACTION_UPDATE {
+			undo.add(func() error {
+				return i.groups.Update(&before)
+			})
+		}
+	}
+	report.Applied = true
+	return report, nil
+}
+
+//ExportGroups returns all groups, sorted by name
+func (i *Importer) ExportGroups() ([]*GroupRow, error) {
+	groups, err := i.groups.List()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[db.PK]string)
+	for _, grp := range groups {
+		names[grp.Id] = grp.Name
+	}
+	roleNames, err := i.roleNames()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*GroupRow, 0, len(groups))
+	for _, grp := range groups {
+		res = append(res, &GroupRow{Name: grp.Name, Groups: lookup(names, grp.Groups), Roles: lookup(roleNames, grp.Roles)})
+	}
+	sort.Slice(res, func(a, b int) bool {
+		return nameKey(res[a].Name) < nameKey(res[b].Name)
+	})
+	return res, nil
+}
+
+//returns the role ids by their case insensitive name
+func (i *Importer) roleIds() (map[string]db.PK, error) {
+	list, err := i.roles.List()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]db.PK)
+	for _, role := range list {
+		res[nameKey(role.Name)] = role.Id
+	}
+	return res, nil
+}
+
+func (i *Importer) roleNames() (map[db.PK]string, error) {
+	list, err := i.roles.List()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[db.PK]string)
+	for _, role := range list {
+		res[role.Id] = role.Name
+	}
+	return res, nil
+}
+
+//returns the names of the ids, ids without a name have been deleted and are skipped
+func lookup(names map[db.PK]string, ids []db.PK) []string {
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if name, ok := names[id]; ok {
+			res = append(res, name)
+		}
+	}
+	return res
+}
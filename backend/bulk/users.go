@@ -0,0 +1,273 @@
+package bulk
+
+import (
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"github.com/worldiety/devdrasil/log"
+	"io"
+	"sort"
+	"strconv"
+)
+
+var userColumns = []string{"login", "firstname", "lastname", "email", "company", "groups", "active", "service_account", "password"}
+
+//a user, which is identified by the case insensitive login. An existing user is updated to the values of the row.
+type UserRow struct {
+	Login     string
+	Firstname string
+	Lastname  string
+
+	EMailAddresses []string
+
+	//the optional name of the company
+	Company string
+
+	//the names of the groups
+	Groups []string
+
+	//nil activates a new user and keeps an existing one
+	Active *bool `json:",omitempty"`
+
+	//nil creates a regular user and keeps an existing one
+	ServiceAccount *bool `json:",omitempty"`
+
+	//required for a new user, which is no service account. Empty keeps the password of an existing user. Never exported.
+	Password string `json:",omitempty"`
+}
+
+func ReadUsersCSV(r io.Reader) ([]*UserRow, error) {
+	records, err := readCSV(r, userColumns, "login")
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*UserRow, 0, len(records))
+	for idx, rec := range records {
+		row := &UserRow{Login: rec["login"], Firstname: rec["firstname"], Lastname: rec["lastname"], EMailAddresses: splitList(rec["email"]), Company: rec["company"], Groups: splitList(rec["groups"]), Password: rec["password"]}
+		row.Active, err = parseBool(idx+1, "active", rec["active"])
+		if err != nil {
+			return nil, err
+		}
+		row.ServiceAccount, err = parseBool(idx+1, "service_account", rec["service_account"])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, row)
+	}
+	return res, nil
+}
+
+//the password column is never written
+func WriteUsersCSV(w io.Writer, rows []*UserRow) error {
+	records := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, []string{row.Login, row.Firstname, row.Lastname, joinList(row.EMailAddresses), row.Company, joinList(row.Groups), formatBool(row.Active), formatBool(row.ServiceAccount)})
+	}
+	return writeCSV(w, userColumns[:len(userColumns)-1], records)
+}
+
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+//ImportUsers creates the users with an unknown login and updates the others. Companies and groups are resolved by
+//their names and must exist. Users which are managed by an external provider cannot be imported. Deactivating a user
+//or changing his password revokes his sessions.
+func (i *Importer) ImportUsers(rows []*UserRow, dryRun bool) (*Report, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	users, err := i.users.List()
+	if err != nil {
+		return nil, err
+	}
+	byLogin := make(map[string]*user.User)
+	for _, usr := range users {
+		byLogin[nameKey(usr.Login)] = usr
+	}
+
+	companies, err := i.companies.List()
+	if err != nil {
+		return nil, err
+	}
+	companyIds := make(map[string]db.PK)
+	for _, cmp := range companies {
+		companyIds[nameKey(cmp.Name)] = cmp.Id
+	}
+
+	groups, err := i.groups.List()
+	if err != nil {
+		return nil, err
+	}
+	groupIds := make(map[string]db.PK)
+	for _, grp := range groups {
+		groupIds[nameKey(grp.Name)] = grp.Id
+	}
+
+	report := &Report{DryRun: dryRun}
+	seen := make(map[string]int)
+	planned := make([]*user.User, len(rows))
+	for idx, row := range rows {
+		res := &RowResult{Row: idx + 1, Key: row.Login, Action: ACTION_CREATE}
+		report.Rows = append(report.Rows, res)
+
+		key := nameKey(row.Login)
+		if key == "" {
+			res.fail("login is required")
+			continue
+		}
+		if other, ok := seen[key]; ok {
+			res.fail(fmt.Sprintf("duplicate of row %d", other))
+		}
+		seen[key] = res.Row
+
+		usr := &user.User{Login: key, Active: true}
+		if existing := byLogin[key]; existing != nil {
+			res.Action = ACTION_UPDATE
+			id := existing.Id
+			res.Id = &id
+			if !existing.IsLocal() {
+				res.fail("the user is managed by " + existing.Provider)
+			}
+			tmp := *existing
+			usr = &tmp
+		}
+
+		usr.Firstname = row.Firstname
+		usr.Lastname = row.Lastname
+		usr.EMailAddresses = row.EMailAddresses
+		if usr.EMailAddresses == nil {
+			usr.EMailAddresses = make([]string, 0)
+		}
+		if row.Active != nil {
+			usr.Active = *row.Active
+		}
+		if row.ServiceAccount != nil {
+			usr.ServiceAccount = *row.ServiceAccount
+		}
+
+		usr.Company = nil
+		if row.Company != "" {
+			companyId, ok := companyIds[nameKey(row.Company)]
+			if ok {
+				usr.Company = &companyId
+			} else {
+				res.fail("unknown company: " + row.Company)
+			}
+		}
+
+		usr.Groups = make([]db.PK, 0)
+		for _, name := range row.Groups {
+			groupId, ok := groupIds[nameKey(name)]
+			if !ok {
+				res.fail("unknown group: " + name)
+				continue
+			}
+			usr.Groups = append(usr.Groups, groupId)
+		}
+
+		switch {
+		case usr.ServiceAccount && row.Password != "":
+			res.fail("a service account has no password")
+		case row.Password != "" && !user.IsGoodPassword(row.Password):
+			res.fail("password to weak")
+		case row.Password == "" && res.Action == ACTION_CREATE && !usr.ServiceAccount:
+			res.fail("password is required")
+		}
+		planned[idx] = usr
+	}
+	if report.Failed() || dryRun {
+		return report, nil
+	}
+
+	undo := undoLog{}
+	revoke := make([]db.PK, 0)
+	for idx, row := range rows {
+		usr := planned[idx]
+		if row.Password != "" {
+			usr.SetPassword(row.Password)
+		}
+		if usr.ServiceAccount {
+			usr.PasswordHash = nil
+		}
+
+		if existing := byLogin[usr.Login]; existing != nil {
+			before := *existing
+			err = i.users.Update(usr)
+			if err == nil {
+				undo.add(func() error {
+					return i.users.Update(&before)
+				})
+				if (before.Active && !usr.Active) || row.Password != "" {
+					revoke = append(revoke, usr.Id)
+				}
+			}
+		} else {
+			err = i.users.Add(usr)
+			if err == nil {
+				report.Rows[idx].Id = &usr.Id
+				undo.add(func() error {
+					return i.users.Delete(usr.Id)
+				})
+			}
+		}
+		if err != nil {
+			undo.rollback()
+			return nil, err
+		}
+	}
+
+	//cannot be reverted, so only after everything has been applied
+	for _, userId := range revoke {
+		_, err := i.sessions.DeleteByUser(userId)
+		if err != nil {
+			log.Default.Error(log.New("failed to revoke the sessions of an imported user").Put("user", userId.String()).SetError(err))
+		}
+	}
+	report.Applied = true
+	return report, nil
+}
+
+//ExportUsers returns all users, sorted by login, without their passwords
+func (i *Importer) ExportUsers() ([]*UserRow, error) {
+	users, err := i.users.List()
+	if err != nil {
+		return nil, err
+	}
+
+	companies, err := i.companies.List()
+	if err != nil {
+		return nil, err
+	}
+	companyNames := make(map[db.PK]string)
+	for _, cmp := range companies {
+		companyNames[cmp.Id] = cmp.Name
+	}
+
+	groups, err := i.groups.List()
+	if err != nil {
+		return nil, err
+	}
+	groupNames := make(map[db.PK]string)
+	for _, grp := range groups {
+		groupNames[grp.Id] = grp.Name
+	}
+
+	res := make([]*UserRow, 0, len(users))
+	for _, usr := range users {
+		active := usr.Active
+		serviceAccount := usr.ServiceAccount
+		row := &UserRow{Login: usr.Login, Firstname: usr.Firstname, Lastname: usr.Lastname, EMailAddresses: usr.EMailAddresses, Groups: lookup(groupNames, usr.Groups), Active: &active, ServiceAccount: &serviceAccount}
+		if usr.Company != nil {
+			row.Company = companyNames[*usr.Company]
+		}
+		res = append(res, row)
+	}
+	sort.Slice(res, func(a, b int) bool {
+		return res[a].Login < res[b].Login
+	})
+	return res, nil
+}
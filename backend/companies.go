@@ -1,25 +1,26 @@
 package backend
 
 import (
+	"github.com/worldiety/devdrasil/backend/api"
 	"net/http"
+	"github.com/worldiety/devdrasil/backend/audit"
 	"github.com/worldiety/devdrasil/backend/session"
 	"github.com/worldiety/devdrasil/backend/user"
 	"github.com/worldiety/devdrasil/db"
-	"strings"
 	"github.com/worldiety/devdrasil/backend/company"
 )
 
 type EndpointCompanies struct {
-	mux         *http.ServeMux
+	router      *Router
 	users       *user.Users
 	sessions    *session.Sessions
 	companies   *company.Companies
 	permissions *user.Permissions
+	grants      *user.Grants
+	audit       *audit.Log
 }
 
-type companyListDTO struct {
-	List []*companyDTO
-}
+type companyListDTO = api.CompanyList
 
 func newCompanyDTO(users *user.Users, company *company.Company) *companyDTO {
 	list, _ := users.List()
@@ -29,102 +30,71 @@ func newCompanyDTO(users *user.Users, company *company.Company) *companyDTO {
 			tmp = append(tmp, usr.Id)
 		}
 	}
-	return &companyDTO{Id: company.Id, Name: company.Name, Users: tmp, ThemePrimaryColor: company.ThemePrimaryColor}
+	return &companyDTO{Id: company.Id, Name: company.Name, Users: tmp, ThemePrimaryColor: company.ThemePrimaryColor, ThemeSecondaryColor: company.ThemeSecondaryColor, AppTitle: company.AppTitle, Logo: company.Logo, Favicon: company.Favicon}
 }
 
-type companyDTO struct {
-	//unique entity id, e.g. "abc38293"
-	Id db.PK
-
-	//the name of the group
-	Name string
-
-	//the primary color
-	ThemePrimaryColor string
+type companyDTO = api.Company
 
-	//all users within this group
-	Users []db.PK
-}
-
-func NewEndpointCompanies(mux *http.ServeMux, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, companies *company.Companies) *EndpointCompanies {
-	endpoint := &EndpointCompanies{mux: mux, sessions: sessions, permissions: permissions, users: users, companies: companies}
-	mux.HandleFunc("/companies/", endpoint.companyVerbs)
-	mux.HandleFunc("/companies", endpoint.companiesVerbs)
+func NewEndpointCompanies(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, companies *company.Companies, grants *user.Grants, auditLog *audit.Log) *EndpointCompanies {
+	endpoint := &EndpointCompanies{router: router, sessions: sessions, permissions: permissions, users: users, companies: companies, grants: grants, audit: auditLog}
+	auth := Authenticated(sessions, users)
+	router.Handle("GET", "/companies", endpoint.listCompanies, auth)
+	router.Handle("POST", "/companies", endpoint.addCompany, Permitted(sessions, users, permissions, user.CREATE_COMPANY))
+	router.HandlePK("GET", "/companies/{id:pk}", endpoint.getCompany, auth)
+	router.HandlePK("PUT", "/companies/{id:pk}", endpoint.updateCompany, auth)
+	router.HandlePK("DELETE", "/companies/{id:pk}", endpoint.deleteCompany)
 	return endpoint
 }
 
-func (e *EndpointCompanies) companyVerbs(writer http.ResponseWriter, request *http.Request) {
-	groupId, err := db.ParsePK(strings.TrimPrefix(request.URL.Path, "/companies/"))
-	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	switch request.Method {
-	case "GET":
-		e.getCompany(writer, request, groupId)
-	case "PUT":
-		e.updateCompany(writer, request, groupId)
-	case "DELETE":
-		e.deleteCompany(writer, request, groupId)
-
-	default:
-		http.Error(writer, request.Method, http.StatusMethodNotAllowed);
-		return
-	}
-}
-
-// A user can list all companies, if he has the permission LIST_COMPANIES
+// A user can list all companies, if he has the permission LIST_COMPANIES. A permission for a company lists only that company.
 //  @Path GET /companies
 //  @Header sid string
-//	@Body []github.com/worldiety/devdrasil/backend/companyListDTO
-//	@Return 200
+//	@Return 200 github.com/worldiety/devdrasil/backend/companyListDTO
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointCompanies) listCompanies(writer http.ResponseWriter, request *http.Request) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.LIST_COMPANIES)
-	if usr == nil {
+	ses, usr := CurrentSession(request)
+
+	allowed, err := isAllowedAnywhere(e.permissions, ses, usr, user.LIST_COMPANIES)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	if !allowed {
+		writePermissionDenied(writer, ses, user.LIST_COMPANIES, "not granted on any scope")
 		return
 	}
 
 	companies, err := e.companies.List()
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 
 	res := &companyListDTO{}
 	res.List = make([]*companyDTO, 0)
 	for _, g := range companies {
-		res.List = append(res.List, newCompanyDTO(e.users, g))
+		visible, err := isAllowedOn(e.permissions, ses, usr, user.LIST_COMPANIES, &user.Target{Company: &g.Id})
+		if AnyErrorAsInternalError(err, writer) {
+			return
+		}
+		if visible {
+			res.List = append(res.List, newCompanyDTO(e.users, g))
+		}
 	}
 	WriteJSONBody(writer, res)
 }
 
-func (e *EndpointCompanies) companiesVerbs(writer http.ResponseWriter, request *http.Request) {
-	switch request.Method {
-	case "GET":
-		e.listCompanies(writer, request);
-	case "POST":
-		e.addCompany(writer, request);
-	default:
-		http.Error(writer, request.Method, http.StatusMethodNotAllowed);
-		return
-	}
-}
-
-// A user can add another company, if he has the permission CREATE_COMPANY
+// A user can add another company, if he has the permission CREATE_COMPANY. Because each company is a tenant, also
+// MANAGE_TENANTS is required.
 //  @Path POST /companies
 //  @Header sid string
 //	@Body github.com/worldiety/devdrasil/backend/companyDTO
 //	@Return 200 github.com/worldiety/devdrasil/backend/companyDTO
+//  @Return 400 (if a color is invalid)
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointCompanies) addCompany(writer http.ResponseWriter, request *http.Request) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.CREATE_COMPANY)
-	if usr == nil {
-		return
-	}
+	ses, usr := CurrentSession(request)
 
 	dto := &companyDTO{}
 	err := ReadJSONBody(writer, request, dto)
@@ -132,30 +102,75 @@ func (e *EndpointCompanies) addCompany(writer http.ResponseWriter, request *http
 		return
 	}
 
+	if !checkAllowedOn(e.permissions, writer, ses, usr, user.MANAGE_TENANTS, nil) {
+		return
+	}
+
+	if !isValidBranding(writer, dto) {
+		return
+	}
+
 	newCompany := &company.Company{}
 
 	updateModelFromDTO(dto, newCompany)
 
 	err = e.companies.Add(newCompany)
-	if err != nil {
-		if db.IsNotUnique(err) {
-			http.Error(writer, err.Error(), http.StatusBadRequest)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+	if AnyErrorAsHTTPError(err, writer) {
 		return
 	}
 
 	err = e.updateAllUsers(newCompany.Id, dto.Users)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 
-	WriteJSONBody(writer, newCompanyDTO(e.users, newCompany))
+	res := newCompanyDTO(e.users, newCompany)
+	recordAudit(e.audit, ses, usr, request, "company.create", newCompany.Id.String(), nil, res)
+	WriteJSONBody(writer, res)
+}
+
+//Adding or removing a user moves him into another tenant, so that MANAGE_TENANTS is required. In addition, a global
+//UPDATE_COMPANY permission allows to assign any user. Otherwise each added or removed user requires UPDATE_USER
+//for that user, so that a company manager cannot take users from other companies. Writes the error, so just return if false.
+func (e *EndpointCompanies) isAllowedToAssign(writer http.ResponseWriter, ses *session.Session, usr *user.User, companyId db.PK, users []db.PK) bool {
+	allUsers, err := e.users.List()
+	if AnyErrorAsInternalError(err, writer) {
+		return false
+	}
+
+	changed := make([]*user.User, 0)
+	for _, other := range allUsers {
+		if other.HasCompany(companyId) != containsPK(users, other.Id) {
+			changed = append(changed, other)
+		}
+	}
+	if len(changed) == 0 {
+		return true
+	}
+
+	if !checkAllowedOn(e.permissions, writer, ses, usr, user.MANAGE_TENANTS, nil) {
+		return false
+	}
+
+	global, err := isAllowed(e.permissions, ses, usr, user.UPDATE_COMPANY)
+	if AnyErrorAsInternalError(err, writer) {
+		return false
+	}
+	if global {
+		return true
+	}
+
+	for _, other := range changed {
+		if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_USER, &user.Target{User: other}) {
+			return false
+		}
+	}
+	return true
 }
 
-//loops through all users and removes the group reference from all users which are not in the given list and adds the group to all users given.
+//loops through all users and removes the company reference from all users which are not in the given list and adds the company to all users given.
+//A moved user loses the groups of his former tenant.
 func (e *EndpointCompanies) updateAllUsers(companyId db.PK, users []db.PK) error {
 	allUsers, err := e.users.List()
 	if err != nil {
@@ -172,6 +187,10 @@ func (e *EndpointCompanies) updateAllUsers(companyId db.PK, users []db.PK) error
 		}
 		if userShouldBeInCompany && !user.HasCompany(companyId) {
 			user.Company = &companyId
+			err = e.removeForeignGroups(user)
+			if err != nil {
+				return err
+			}
 			err = e.users.Update(user)
 			if err != nil {
 				return err
@@ -179,6 +198,10 @@ func (e *EndpointCompanies) updateAllUsers(companyId db.PK, users []db.PK) error
 		} else
 		if !userShouldBeInCompany && user.HasCompany(companyId) {
 			user.Company = nil
+			err = e.removeForeignGroups(user)
+			if err != nil {
+				return err
+			}
 			err = e.users.Update(user)
 			if err != nil {
 				return err
@@ -189,29 +212,46 @@ func (e *EndpointCompanies) updateAllUsers(companyId db.PK, users []db.PK) error
 	return nil
 }
 
-// A user can delete another company, if he has the permission DELETE_COMPANY
+//removes the groups, which do not belong to the tenant of the user
+func (e *EndpointCompanies) removeForeignGroups(usr *user.User) error {
+	outside, err := e.permissions.GroupsOutsideTenant(usr.Company, usr.Groups)
+	if err != nil {
+		return err
+	}
+	for _, gid := range outside {
+		usr.RemoveGroup(gid)
+	}
+	return nil
+}
+
+// A user can delete another company, if he has the permission DELETE_COMPANY and MANAGE_TENANTS
 //  @Path DELETE /companies/{id}
 //  @Header sid string
 //	@Return 200
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointCompanies) deleteCompany(writer http.ResponseWriter, request *http.Request, companyId db.PK) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.DELETE_COMPANY)
+	ses, usr := validateOn(e.sessions, e.users, e.permissions, writer, request, user.DELETE_COMPANY, &user.Target{Company: &companyId})
 	if usr == nil {
 		return
 	}
+	if !checkAllowedOn(e.permissions, writer, ses, usr, user.MANAGE_TENANTS, nil) {
+		return
+	}
+
+	var before *companyDTO
+	if cmp, err := e.companies.Get(companyId); err == nil {
+		before = newCompanyDTO(e.users, cmp)
+	}
 
 	e.updateAllUsers(companyId, nil)
+	e.grants.DeleteReferences(companyId)
 	err := e.companies.Delete(companyId)
-	if err != nil {
-		if db.IsEntityNotFound(err) {
-			http.Error(writer, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+	if AnyErrorAsHTTPError(err, writer) {
 		return
 	}
 
+	recordAudit(e.audit, ses, usr, request, "company.delete", companyId.String(), before, nil)
 	WriteOK(writer)
 }
 
@@ -222,10 +262,7 @@ func (e *EndpointCompanies) deleteCompany(writer http.ResponseWriter, request *h
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
 //  @Return 500 (for any other error)
 func (e *EndpointCompanies) getCompany(writer http.ResponseWriter, request *http.Request, companyId db.PK) {
-	_, usr := GetSessionAndUser(e.sessions, e.users, writer, request)
-	if usr == nil {
-		return
-	}
+	ses, usr := CurrentSession(request)
 
 	allowed := false
 	//check if it is the company of the current user
@@ -235,27 +272,21 @@ func (e *EndpointCompanies) getCompany(writer http.ResponseWriter, request *http
 
 	//check if the permission is available
 	if !allowed {
-		tmp, err := e.permissions.IsAllowed(user.GET_COMPANY, usr)
+		tmp, err := isAllowedOn(e.permissions, ses, usr, user.GET_COMPANY, &user.Target{Company: &companyId})
 		if err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			WriteInternalError(writer, err)
 			return
 		}
 		allowed = tmp
 	}
 
 	if !allowed {
-		http.Error(writer, "", http.StatusForbidden)
+		writePermissionDenied(writer, ses, user.GET_COMPANY, deniedReason(&user.Target{Company: &companyId}))
 		return
 	}
 
 	company, err := e.companies.Get(companyId)
-	if err != nil {
-		if db.IsEntityNotFound(err) {
-			http.Error(writer, err.Error(), http.StatusNotFound)
-			return
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+	if AnyErrorAsHTTPError(err, writer) {
 		return
 	}
 	//return the other user dto
@@ -263,9 +294,21 @@ func (e *EndpointCompanies) getCompany(writer http.ResponseWriter, request *http
 	return
 }
 
+//the images are not part of the dto, they are uploaded separately
 func updateModelFromDTO(src *companyDTO, dst *company.Company) {
 	dst.Name = src.Name
 	dst.ThemePrimaryColor = src.ThemePrimaryColor
+	dst.ThemeSecondaryColor = src.ThemeSecondaryColor
+	dst.AppTitle = src.AppTitle
+}
+
+//the colors are written into the served html and css. Writes the error, so just return if false.
+func isValidBranding(writer http.ResponseWriter, dto *companyDTO) bool {
+	if !company.IsColor(dto.ThemePrimaryColor) || !company.IsColor(dto.ThemeSecondaryColor) {
+		WriteError(writer, http.StatusBadRequest, "invalid color, expected e.g. #4caf50 or green")
+		return false
+	}
+	return true
 }
 
 // A user needs the UPDATE_COMPANY permission.
@@ -273,13 +316,11 @@ func updateModelFromDTO(src *companyDTO, dst *company.Company) {
 //  @Header sid string
 //	@Body github.com/worldiety/devdrasil/backend/companyDTO
 //	@Return 200 github.com/worldiety/devdrasil/backend/companyDTO
+//  @Return 400 (if a color is invalid)
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
 //  @Return 500 (for any other error)
 func (e *EndpointCompanies) updateCompany(writer http.ResponseWriter, request *http.Request, groupId db.PK) {
-	_, usr := GetSessionAndUser(e.sessions, e.users, writer, request)
-	if usr == nil {
-		return
-	}
+	ses, usr := CurrentSession(request)
 
 	dto := &companyDTO{}
 	err := ReadJSONBody(writer, request, dto)
@@ -288,47 +329,43 @@ func (e *EndpointCompanies) updateCompany(writer http.ResponseWriter, request *h
 	}
 
 	//check if the permission is available
-	allowed, err := e.permissions.IsAllowed(user.UPDATE_COMPANY, usr)
-	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+	if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_COMPANY, &user.Target{Company: &groupId}) {
 		return
 	}
-	if !allowed {
-		http.Error(writer, err.Error(), http.StatusForbidden)
+
+	if !isValidBranding(writer, dto) {
 		return
 	}
 
 	otherCompany, err := e.companies.Get(groupId)
-	if err != nil {
-		if db.IsEntityNotFound(err) {
-			http.Error(writer, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	if !e.isAllowedToAssign(writer, ses, usr, otherCompany.Id, dto.Users) {
 		return
 	}
 
+	before := newCompanyDTO(e.users, otherCompany)
 	updateModelFromDTO(dto, otherCompany)
 
 	//rewrite
 	err = e.companies.Update(otherCompany)
 	if err != nil {
-		if db.IsNotUnique(err) {
-			http.Error(writer, err.Error(), http.StatusBadRequest)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+		AnyErrorAsHTTPError(err, writer)
 
 		return
 	}
 
 	err = e.updateAllUsers(otherCompany.Id, dto.Users)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 
 	//return the newly data
-	WriteJSONBody(writer, newCompanyDTO(e.users, otherCompany))
+	res := newCompanyDTO(e.users, otherCompany)
+	recordAudit(e.audit, ses, usr, request, "company.update", otherCompany.Id.String(), before, res)
+	WriteJSONBody(writer, res)
 
 }
@@ -0,0 +1,87 @@
+package company
+
+import (
+	"github.com/worldiety/devdrasil/db"
+	"regexp"
+)
+
+const TABLE_COMPANY_IMAGE = "company_image"
+
+//the maximum size of a logo or favicon
+const MaxImageSize = 1 << 20
+
+//the content types, which can be uploaded as logo or favicon
+var ImageContentTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "image/svg+xml", "image/x-icon", "image/vnd.microsoft.icon"}
+
+//either a hex color like #4caf50 or a css color name like green
+var colorRegex = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]{1,32})$`)
+
+//IsColor checks if the value can be safely written into html and css. Empty is valid and means the default.
+func IsColor(value string) bool {
+	return value == "" || colorRegex.MatchString(value)
+}
+
+//The branding of the frontend, which is served to the users of a company
+type Branding struct {
+	//the title of the app, e.g. shown in the browser tab
+	AppTitle string
+
+	ThemePrimaryColor   string
+	ThemeSecondaryColor string
+
+	//references to the images, nil if absent
+	Logo    *db.PK
+	Favicon *db.PK
+}
+
+//the branding for users without a company or for fields, which a company does not define
+var DefaultBranding = Branding{AppTitle: "devdrasil", ThemePrimaryColor: "green"}
+
+//returns the branding of the company, each empty or invalid field is taken from the DefaultBranding
+func (c *Company) Branding() *Branding {
+	res := DefaultBranding
+	if c == nil {
+		return &res
+	}
+	if c.AppTitle != "" {
+		res.AppTitle = c.AppTitle
+	}
+	if c.ThemePrimaryColor != "" && IsColor(c.ThemePrimaryColor) {
+		res.ThemePrimaryColor = c.ThemePrimaryColor
+	}
+	if c.ThemeSecondaryColor != "" && IsColor(c.ThemeSecondaryColor) {
+		res.ThemeSecondaryColor = c.ThemeSecondaryColor
+	}
+	res.Logo = c.Logo
+	res.Favicon = c.Favicon
+	return &res
+}
+
+//A logo or favicon of a company
+type Image struct {
+	//Entity id, e.g. "xyz1234"
+	Id db.PK
+
+	//the owning company
+	Company db.PK
+
+	//e.g. image/png
+	ContentType string
+
+	Data []byte
+}
+
+//stores the image with a new id
+func (r *Companies) AddImage(img *Image) error {
+	return r.crud.Create(TABLE_COMPANY_IMAGE, img)
+}
+
+func (r *Companies) GetImage(id db.PK) (*Image, error) {
+	img := &Image{Id: id}
+	err := r.crud.Read(TABLE_COMPANY_IMAGE, img)
+	return img, err
+}
+
+func (r *Companies) DeleteImage(id db.PK) error {
+	return r.crud.Delete(TABLE_COMPANY_IMAGE, id)
+}
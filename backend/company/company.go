@@ -15,8 +15,18 @@ type Company struct {
 	//Name of the company, e.g. 'My company'
 	Name string
 
-	//the primary color
+	//the primary color, e.g. #4caf50
 	ThemePrimaryColor string
+
+	//the secondary color, e.g. #ff9800
+	ThemeSecondaryColor string
+
+	//the title of the app, empty uses the default
+	AppTitle string
+
+	//references to the uploaded images, see AddImage
+	Logo    *db.PK
+	Favicon *db.PK
 }
 
 type Companies struct {
@@ -83,7 +93,20 @@ func (r *Companies) Update(company *Company) error {
 	return r.crud.Update(TABLE_COMPANY, company)
 }
 
+//deletes the company and its images
 func (r *Companies) Delete(id db.PK) error {
+	cmp, err := r.Get(id)
+	if err != nil {
+		return err
+	}
+	for _, img := range []*db.PK{cmp.Logo, cmp.Favicon} {
+		if img != nil {
+			err = r.DeleteImage(*img)
+			if err != nil && !db.IsEntityNotFound(err) {
+				return err
+			}
+		}
+	}
 	return r.crud.Delete(TABLE_COMPANY, id)
 }
 
@@ -0,0 +1,294 @@
+package backend
+
+import (
+	"net/http"
+	"github.com/worldiety/devdrasil/backend/audit"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/backend/company"
+	"github.com/worldiety/devdrasil/db"
+)
+
+type EndpointGrants struct {
+	router      *Router
+	users       *user.Users
+	sessions    *session.Sessions
+	groups      *group.Groups
+	companies   *company.Companies
+	roles       *user.Roles
+	grants      *user.Grants
+	permissions *user.Permissions
+	audit       *audit.Log
+}
+
+type grantListDTO struct {
+	List []*grantDTO
+}
+
+type grantDTO struct {
+	//unique entity id, e.g. "abc38293"
+	Id db.PK
+
+	//the user, who receives the grant. Either User or Group is required.
+	User *db.PK
+
+	//the group, whose members receive the grant
+	Group *db.PK
+
+	//the names of the granted permission kinds, e.g. UPDATE_USER
+	Permissions []string
+
+	//the granted roles
+	Roles []db.PK
+
+	//the company, for whose users and itself the kinds are granted. Either ScopeCompany or ScopeGroup is required.
+	ScopeCompany *db.PK
+
+	//the group, for whose members, nested groups and itself the kinds are granted
+	ScopeGroup *db.PK
+}
+
+func newGrantDTO(grant *user.Grant) *grantDTO {
+	dto := &grantDTO{Id: grant.Id, User: grant.User, Group: grant.Group, Roles: grant.Roles, ScopeCompany: grant.ScopeCompany, ScopeGroup: grant.ScopeGroup, Permissions: make([]string, 0)}
+	for _, kind := range grant.Permissions {
+		dto.Permissions = append(dto.Permissions, user.PermissionName(kind))
+	}
+	return dto
+}
+
+func NewEndpointGrants(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, groups *group.Groups, companies *company.Companies, roles *user.Roles, grants *user.Grants, auditLog *audit.Log) *EndpointGrants {
+	endpoint := &EndpointGrants{router: router, sessions: sessions, permissions: permissions, users: users, groups: groups, companies: companies, roles: roles, grants: grants, audit: auditLog}
+	router.Handle("GET", "/grants", endpoint.listGrants, Permitted(sessions, users, permissions, user.LIST_GRANTS))
+	router.Handle("POST", "/grants", endpoint.addGrant, Permitted(sessions, users, permissions, user.CREATE_GRANT))
+	router.HandlePK("DELETE", "/grants/{id:pk}", endpoint.deleteGrant, Permitted(sessions, users, permissions, user.DELETE_GRANT))
+	return endpoint
+}
+
+// A user can list the scoped grants of his tenant, if he has the permission LIST_GRANTS. Only MANAGE_TENANTS lists all.
+//  @Path GET /grants
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/grantListDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 500 (for any other error)
+func (e *EndpointGrants) listGrants(writer http.ResponseWriter, request *http.Request) {
+	_, usr := CurrentSession(request)
+
+	grants, err := e.grants.List()
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	effective, err := e.permissions.Resolve(usr)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	res := &grantListDTO{}
+	res.List = make([]*grantDTO, 0)
+	for _, g := range grants {
+		visible, err := e.inTenant(effective, g)
+		if AnyErrorAsInternalError(err, writer) {
+			return
+		}
+		if visible {
+			res.List = append(res.List, newGrantDTO(g))
+		}
+	}
+	WriteJSONBody(writer, res)
+}
+
+//checks if the grantee and the scope of the grant belong to the tenant of the effective permissions
+func (e *EndpointGrants) inTenant(effective *user.EffectivePermissions, grant *user.Grant) (bool, error) {
+	targets := []*user.Target{{Company: grant.ScopeCompany, Group: grant.ScopeGroup}}
+	switch {
+	case grant.User != nil:
+		grantee, err := e.users.Get(*grant.User)
+		if err != nil {
+			if !db.IsEntityNotFound(err) {
+				return false, err
+			}
+			grantee = &user.User{Id: *grant.User}
+		}
+		targets = append(targets, &user.Target{User: grantee})
+	case grant.Group != nil:
+		targets = append(targets, &user.Target{Group: grant.Group})
+	}
+
+	for _, target := range targets {
+		if !effective.InTenant(target) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// A user can grant permission kinds or roles for a company or group, if he has the permission CREATE_GRANT.
+// Without MANAGE_TENANTS, the grantee and the scope must belong to the tenant of the user. The user must hold each
+// granted kind, also those of the granted roles, on the scope himself.
+//  @Path POST /grants
+//  @Header sid string
+//	@Body github.com/worldiety/devdrasil/backend/grantDTO
+//	@Return 200 github.com/worldiety/devdrasil/backend/grantDTO
+//  @Return 400 (if not exactly one grantee and one scope is given or a permission kind, role, user, group or company is unknown)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission | if the grantee or the scope belongs to another tenant | if user has not a granted kind on the scope)
+//  @Return 500 (for any other error)
+func (e *EndpointGrants) addGrant(writer http.ResponseWriter, request *http.Request) {
+	ses, usr := CurrentSession(request)
+
+	dto := &grantDTO{}
+	err := ReadJSONBody(writer, request, dto)
+	if err != nil {
+		return
+	}
+
+	if (dto.User == nil) == (dto.Group == nil) {
+		WriteError(writer, http.StatusBadRequest, "either user or group is required")
+		return
+	}
+
+	if (dto.ScopeCompany == nil) == (dto.ScopeGroup == nil) {
+		WriteError(writer, http.StatusBadRequest, "either company or group scope is required")
+		return
+	}
+
+	grant := &user.Grant{User: dto.User, Group: dto.Group, Roles: dto.Roles, ScopeCompany: dto.ScopeCompany, ScopeGroup: dto.ScopeGroup, Permissions: make([]db.PK, 0)}
+	for _, name := range dto.Permissions {
+		kind, ok, err := e.permissions.ParseName(name)
+		if AnyErrorAsInternalError(err, writer) {
+			return
+		}
+		if !ok {
+			WriteError(writer, http.StatusBadRequest, "unknown permission kind: "+name)
+			return
+		}
+		grant.Permissions = append(grant.Permissions, kind)
+	}
+
+	if !e.checkReferences(writer, grant) {
+		return
+	}
+
+	if !e.checkInTenant(writer, ses, usr, grant) {
+		return
+	}
+
+	if !e.checkGrantable(writer, ses, usr, grant) {
+		return
+	}
+
+	err = e.grants.Add(grant)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	res := newGrantDTO(grant)
+	recordAudit(e.audit, ses, usr, request, "grant.create", grant.Id.String(), nil, res)
+	WriteJSONBody(writer, res)
+}
+
+// A user can revoke a scoped grant of his tenant, if he has the permission DELETE_GRANT
+//  @Path DELETE /grants/{id}
+//  @Header sid string
+//	@Return 200
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission | if the grantee or the scope belongs to another tenant)
+//  @Return 404 (if the grant does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointGrants) deleteGrant(writer http.ResponseWriter, request *http.Request, grantId db.PK) {
+	ses, usr := CurrentSession(request)
+
+	grant, err := e.grants.Get(grantId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	if !e.checkInTenant(writer, ses, usr, grant) {
+		return
+	}
+
+	err = e.grants.Delete(grantId)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	recordAudit(e.audit, ses, usr, request, "grant.delete", grantId.String(), newGrantDTO(grant), nil)
+	WriteOK(writer)
+}
+
+//checks that the grantee and the scope belong to the tenant of the user. Writes the error, so just return if false.
+func (e *EndpointGrants) checkInTenant(writer http.ResponseWriter, ses *session.Session, usr *user.User, grant *user.Grant) bool {
+	effective, err := e.permissions.Resolve(usr)
+	if AnyErrorAsInternalError(err, writer) {
+		return false
+	}
+	visible, err := e.inTenant(effective, grant)
+	if AnyErrorAsInternalError(err, writer) {
+		return false
+	}
+	if !visible {
+		writePermissionDenied(writer, ses, user.MANAGE_TENANTS, "the grantee or the scope belongs to another tenant")
+		return false
+	}
+	return true
+}
+
+//checks that the grantee, the scope and the roles exist. Writes the error, so just return if false.
+func (e *EndpointGrants) checkReferences(writer http.ResponseWriter, grant *user.Grant) bool {
+	exists := func(message string, id db.PK, err error) bool {
+		if err == nil {
+			return true
+		}
+		if db.IsEntityNotFound(err) {
+			WriteErrorDetails(writer, http.StatusBadRequest, message, id)
+		} else {
+			WriteInternalError(writer, err)
+		}
+		return false
+	}
+
+	if grant.User != nil {
+		if _, err := e.users.Get(*grant.User); !exists("unknown user", *grant.User, err) {
+			return false
+		}
+	}
+	for _, gid := range []*db.PK{grant.Group, grant.ScopeGroup} {
+		if gid == nil {
+			continue
+		}
+		if _, err := e.groups.Get(*gid); !exists("unknown group", *gid, err) {
+			return false
+		}
+	}
+	if grant.ScopeCompany != nil {
+		if _, err := e.companies.Get(*grant.ScopeCompany); !exists("unknown company", *grant.ScopeCompany, err) {
+			return false
+		}
+	}
+	for _, rid := range grant.Roles {
+		if _, err := e.roles.Get(rid); !exists("unknown role", rid, err) {
+			return false
+		}
+	}
+	return true
+}
+
+//checks that the user holds each granted kind, also those of the granted roles, on the scope of the grant, because
+//otherwise he could pass on more than he has. Writes the error, so just return if false.
+func (e *EndpointGrants) checkGrantable(writer http.ResponseWriter, ses *session.Session, usr *user.User, grant *user.Grant) bool {
+	kinds := append([]db.PK{}, grant.Permissions...)
+	for _, rid := range grant.Roles {
+		role, err := e.roles.Get(rid)
+		if AnyErrorAsInternalError(err, writer) {
+			return false
+		}
+		kinds = append(kinds, role.Permissions...)
+	}
+
+	scope := &user.Target{Company: grant.ScopeCompany, Group: grant.ScopeGroup}
+	for _, kind := range kinds {
+		if !checkAllowedOn(e.permissions, writer, ses, usr, kind, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package backend
+
+import (
+	"github.com/worldiety/devdrasil/backend/company"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	companies := company.NewCompanies(db.Open(env.dir))
+	var acme, other db.PK
+	for _, c := range []struct {
+		name string
+		id   *db.PK
+	}{{"acme", &acme}, {"other", &other}} {
+		cmp := &company.Company{Name: c.name}
+		if err := companies.Add(cmp); err != nil {
+			t.Fatal(err)
+		}
+		*c.id = cmp.Id
+	}
+	alice := env.addUser(t, "alice")
+	bob := env.addUser(t, "bob")
+	for _, c := range []struct {
+		usr     *user.User
+		company db.PK
+	}{{alice, acme}, {bob, other}} {
+		company := c.company
+		c.usr.Company = &company
+		if err := env.users.Update(c.usr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//alice and bob administrate their tenants
+	for _, kind := range []db.PK{user.GRANT_PERMISSION, user.UPDATE_ROLE, user.LIST_GRANTS, user.CREATE_GRANT, user.DELETE_GRANT} {
+		perm, err := env.permissions.Get(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		perm.AllowedUsers = append(perm.AllowedUsers, alice.Id, bob.Id)
+		if err := env.permissions.Update(perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	own := &user.Grant{User: &alice.Id, ScopeCompany: &acme, Permissions: []db.PK{user.UPDATE_USER}}
+	foreign := &user.Grant{User: &bob.Id, ScopeCompany: &other, Permissions: []db.PK{user.UPDATE_USER}}
+	for _, grant := range []*user.Grant{own, foreign} {
+		if err := env.grants.Add(grant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ses := env.login(t, alice)
+	denied := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"PUT", "/permissions/MANAGE_TENANTS", `{"AllowedUsers":["` + alice.Id.String() + `"]}`},
+		{"PUT", "/roles/" + db.NewPK("role").String(), `{"Name":"admin","Permissions":["MANAGE_TENANTS"]}`},
+		{"POST", "/grants", `{"User":"` + alice.Id.String() + `","ScopeCompany":"` + other.String() + `","Permissions":["UPDATE_USER"]}`},
+		{"POST", "/grants", `{"User":"` + bob.Id.String() + `","ScopeCompany":"` + acme.String() + `","Permissions":["UPDATE_USER"]}`},
+		{"DELETE", "/grants/" + foreign.Id.String(), ""},
+	}
+	for _, c := range denied {
+		if status := env.serve(newSessionRequest(c.method, c.path, c.body, ses)).Code; status != http.StatusForbidden {
+			t.Fatalf("%s %s: expected %d but got %d", c.method, c.path, http.StatusForbidden, status)
+		}
+	}
+	if _, err := env.grants.Get(foreign.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	//only the kinds and roles, which alice holds on the scope, can be granted
+	roles := user.NewRoles(db.Open(env.dir))
+	editor := &user.Role{Name: "editor", Permissions: []db.PK{user.UPDATE_USER}}
+	admin := &user.Role{Name: "admin", Permissions: []db.PK{user.UPDATE_USER, user.DELETE_USER}}
+	for _, role := range []*user.Role{editor, admin} {
+		if err := roles.Add(role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	grantee := `{"User":"` + alice.Id.String() + `","ScopeCompany":"` + acme.String() + `",`
+	cases := []struct {
+		body   string
+		status int
+	}{
+		{grantee + `"Permissions":["UPDATE_USER"]}`, http.StatusOK},
+		{grantee + `"Roles":["` + editor.Id.String() + `"]}`, http.StatusOK},
+		{grantee + `"Permissions":["DELETE_USER"]}`, http.StatusForbidden},
+		{grantee + `"Roles":["` + admin.Id.String() + `"]}`, http.StatusForbidden},
+		{grantee + `"Roles":["` + db.NewPK("unknown").String() + `"]}`, http.StatusBadRequest},
+		{`{"User":"` + alice.Id.String() + `","ScopeGroup":"` + db.NewPK("unknown").String() + `"}`, http.StatusBadRequest},
+		{`{"User":"` + alice.Id.String() + `","ScopeCompany":"` + db.NewPK("unknown").String() + `"}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if status := env.serve(newSessionRequest("POST", "/grants", c.body, ses)).Code; status != c.status {
+			t.Fatalf("%s: expected %d but got %d", c.body, c.status, status)
+		}
+	}
+
+	//neither the grants nor the grantees of another tenant are visible
+	for _, path := range []string{"/grants", "/permissions"} {
+		recorder := env.serve(newSessionRequest("GET", path, "", ses))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d but got %d", path, http.StatusOK, recorder.Code)
+		}
+		if body := recorder.Body.String(); strings.Contains(body, bob.Id.String()) || !strings.Contains(body, alice.Id.String()) {
+			t.Fatal(body)
+		}
+	}
+}
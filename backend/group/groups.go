@@ -14,6 +14,49 @@ type Group struct {
 
 	//Name of the group, e.g. 'My Employees'
 	Name string
+
+	//the tenant, nil for groups of users without a company. Only users and groups of the same company can be members.
+	Company *db.PK
+
+	//the external provider which manages the members of this group, e.g. ldap. Empty for local groups.
+	Provider string
+
+	//the groups, which this group is a member of. The members of this group are also members of those groups.
+	Groups []db.PK
+
+	//the roles, which are assigned to all members of this group
+	Roles []db.PK
+}
+
+func (g *Group) HasGroup(id db.PK) bool {
+	for _, gid := range g.Groups {
+		if gid == id {
+			return true
+		}
+	}
+	return false
+}
+
+//removes the group and returns true if it has been actually removed
+func (g *Group) RemoveGroup(id db.PK) bool {
+	for i, gid := range g.Groups {
+		if gid == id {
+			g.Groups = append(g.Groups[:i], g.Groups[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+//removes the role and returns true if it has been actually removed
+func (g *Group) RemoveRole(id db.PK) bool {
+	for i, rid := range g.Roles {
+		if rid == id {
+			g.Roles = append(g.Roles[:i], g.Roles[i+1:]...)
+			return true
+		}
+	}
+	return false
 }
 
 type Groups struct {
@@ -89,3 +132,54 @@ func (r *Groups) Get(id db.PK) (*Group, error) {
 	err := r.crud.Read(TABLE_GROUP, group)
 	return group, err
 }
+
+//finds a group by its case insensitive name
+func (r *Groups) FindByName(name string) (*Group, error) {
+	groups, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+
+	myLowerCaseName := strings.ToLower(name)
+	for _, grp := range groups {
+		if strings.ToLower(grp.Name) == myLowerCaseName {
+			return grp, nil
+		}
+	}
+	return nil, &db.EntityNotFound{What: name}
+}
+
+//returns the given groups and all groups which they are a member of, transitively. Cycles are tolerated.
+func Expand(all []*Group, ids []db.PK) []db.PK {
+	byId := make(map[db.PK]*Group)
+	for _, grp := range all {
+		byId[grp.Id] = grp
+	}
+
+	seen := make(map[db.PK]bool)
+	res := make([]db.PK, 0)
+	queue := append([]db.PK{}, ids...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		res = append(res, id)
+		if grp := byId[id]; grp != nil {
+			queue = append(queue, grp.Groups...)
+		}
+	}
+	return res
+}
+
+//checks if the group would be a member of itself, when its parent groups are the given ones
+func IsCyclic(all []*Group, id db.PK, parents []db.PK) bool {
+	for _, gid := range Expand(all, parents) {
+		if gid == id {
+			return true
+		}
+	}
+	return false
+}
@@ -1,25 +1,26 @@
 package backend
 
 import (
+	"github.com/worldiety/devdrasil/backend/api"
 	"net/http"
+	"github.com/worldiety/devdrasil/backend/audit"
 	"github.com/worldiety/devdrasil/backend/session"
 	"github.com/worldiety/devdrasil/backend/user"
 	"github.com/worldiety/devdrasil/backend/group"
 	"github.com/worldiety/devdrasil/db"
-	"strings"
 )
 
 type EndpointGroups struct {
-	mux         *http.ServeMux
+	router      *Router
 	users       *user.Users
 	sessions    *session.Sessions
 	groups      *group.Groups
 	permissions *user.Permissions
+	grants      *user.Grants
+	audit       *audit.Log
 }
 
-type groupListDTO struct {
-	List []*groupDTO
-}
+type groupListDTO = api.GroupList
 
 func newGroupDTO(users *user.Users, group *group.Group) *groupDTO {
 	list, _ := users.List()
@@ -29,88 +30,62 @@ func newGroupDTO(users *user.Users, group *group.Group) *groupDTO {
 			tmp = append(tmp, usr.Id)
 		}
 	}
-	return &groupDTO{Id: group.Id, Name: group.Name, Users: tmp}
+	return &groupDTO{Id: group.Id, Name: group.Name, Company: group.Company, Users: tmp, Groups: group.Groups, Roles: group.Roles}
 }
 
-type groupDTO struct {
-	//unique entity id, e.g. "abc38293"
-	Id db.PK
-
-	//the name of the group
-	Name string
-
-	//all users within this group
-	Users []db.PK
-}
+type groupDTO = api.Group
 
-func NewEndpointGroups(mux *http.ServeMux, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, groups *group.Groups) *EndpointGroups {
-	endpoint := &EndpointGroups{mux: mux, sessions: sessions, permissions: permissions, users: users, groups: groups}
-	mux.HandleFunc("/groups/", endpoint.groupVerbs)
-	mux.HandleFunc("/groups", endpoint.groupsVerbs)
+func NewEndpointGroups(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, groups *group.Groups, grants *user.Grants, auditLog *audit.Log) *EndpointGroups {
+	endpoint := &EndpointGroups{router: router, sessions: sessions, permissions: permissions, users: users, groups: groups, grants: grants, audit: auditLog}
+	auth := Authenticated(sessions, users)
+	router.Handle("GET", "/groups", endpoint.listGroups, auth)
+	router.Handle("POST", "/groups", endpoint.addGroup, Permitted(sessions, users, permissions, user.CREATE_GROUP))
+	router.HandlePK("GET", "/groups/{id:pk}", endpoint.getGroup)
+	router.HandlePK("PUT", "/groups/{id:pk}", endpoint.updateGroup, auth)
+	router.HandlePK("DELETE", "/groups/{id:pk}", endpoint.deleteGroup)
 	return endpoint
 }
 
-func (e *EndpointGroups) groupVerbs(writer http.ResponseWriter, request *http.Request) {
-	groupId, err := db.ParsePK(strings.TrimPrefix(request.URL.Path, "/groups/"))
-	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	switch request.Method {
-	case "GET":
-		e.getGroup(writer, request, groupId)
-	case "PUT":
-		e.updateGroup(writer, request, groupId)
-	case "DELETE":
-		e.deleteGroup(writer, request, groupId)
-
-	default:
-		http.Error(writer, request.Method, http.StatusMethodNotAllowed);
-		return
-	}
-}
-
-// A user can list all groups, if he has the permission LIST_GROUPS
+// A user can list all groups, if he has the permission LIST_GROUPS. A permission for a group lists only the group and its nested groups.
 //  @Path GET /groups
 //  @Header sid string
-//	@Body []github.com/worldiety/devdrasil/backend/groupListDTO
-//	@Return 200
+//	@Return 200 github.com/worldiety/devdrasil/backend/groupListDTO
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointGroups) listGroups(writer http.ResponseWriter, request *http.Request) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.LIST_GROUPS)
-	if usr == nil {
+	ses, usr := CurrentSession(request)
+
+	allowed, err := isAllowedAnywhere(e.permissions, ses, usr, user.LIST_GROUPS)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	if !allowed {
+		writePermissionDenied(writer, ses, user.LIST_GROUPS, "not granted on any scope")
 		return
 	}
 
 	groups, err := e.groups.List()
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 
 	res := &groupListDTO{}
 	res.List = make([]*groupDTO, 0)
 	for _, g := range groups {
-		res.List = append(res.List, newGroupDTO(e.users, g))
+		visible, err := isAllowedOn(e.permissions, ses, usr, user.LIST_GROUPS, &user.Target{Group: &g.Id})
+		if AnyErrorAsInternalError(err, writer) {
+			return
+		}
+		if visible {
+			res.List = append(res.List, newGroupDTO(e.users, g))
+		}
 	}
 	WriteJSONBody(writer, res)
 }
 
-func (e *EndpointGroups) groupsVerbs(writer http.ResponseWriter, request *http.Request) {
-	switch request.Method {
-	case "GET":
-		e.listGroups(writer, request);
-	case "POST":
-		e.addGroup(writer, request);
-	default:
-		http.Error(writer, request.Method, http.StatusMethodNotAllowed);
-		return
-	}
-}
-
-// A user can add another group, if he has the permission for ADDING_GROUPS
+// A user can add another group, if he has the permission for ADDING_GROUPS. Without MANAGE_TENANTS, the group always
+// belongs to the company of the session user.
 //  @Path POST /groups
 //  @Header sid string
 //	@Body github.com/worldiety/devdrasil/backend/groupDTO
@@ -118,10 +93,7 @@ func (e *EndpointGroups) groupsVerbs(writer http.ResponseWriter, request *http.R
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointGroups) addGroup(writer http.ResponseWriter, request *http.Request) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.CREATE_GROUP)
-	if usr == nil {
-		return
-	}
+	ses, usr := CurrentSession(request)
 
 	dto := &groupDTO{}
 	err := ReadJSONBody(writer, request, dto)
@@ -129,26 +101,35 @@ func (e *EndpointGroups) addGroup(writer http.ResponseWriter, request *http.Requ
 		return
 	}
 
+	tenant, ok := tenantOfNew(e.permissions, writer, ses, usr, dto.Company)
+	if !ok {
+		return
+	}
+
+	if !e.isAllowedToAssign(writer, ses, usr, &group.Group{Company: tenant}, dto) {
+		return
+	}
+
 	newGroup := &group.Group{}
+	newGroup.Company = tenant
 	newGroup.Name = dto.Name
+	newGroup.Groups = dto.Groups
+	newGroup.Roles = dto.Roles
 
 	err = e.groups.Add(newGroup)
-	if err != nil {
-		if db.IsNotUnique(err) {
-			http.Error(writer, err.Error(), http.StatusBadRequest)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+	if AnyErrorAsHTTPError(err, writer) {
 		return
 	}
 
 	err = e.updateAllUsers(newGroup.Id, dto.Users)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 
-	WriteJSONBody(writer, newGroupDTO(e.users, newGroup))
+	res := newGroupDTO(e.users, newGroup)
+	recordAudit(e.audit, ses, usr, request, "group.create", newGroup.Id.String(), nil, res)
+	WriteJSONBody(writer, res)
 }
 
 //loops through all users and removes the group reference from all users which are not in the given list and adds the group to all users given.
@@ -185,6 +166,57 @@ func (e *EndpointGroups) updateAllUsers(groupId db.PK, users []db.PK) error {
 	return nil
 }
 
+//The parent groups and the users must belong to the tenant of the group. Within the tenant, a global UPDATE_GROUP
+//permission allows any assignment. Otherwise adding or removing a parent group requires UPDATE_GROUP
+//for that parent and roles cannot be changed at all. Writes the error, so just return if false.
+func (e *EndpointGroups) isAllowedToAssign(writer http.ResponseWriter, ses *session.Session, usr *user.User, target *group.Group, dto *groupDTO) bool {
+	if !checkGroupsInTenant(e.permissions, writer, target.Company, dto.Groups) {
+		return false
+	}
+	if !checkUsersInTenant(e.users, writer, target.Company, dto.Users) {
+		return false
+	}
+
+	global, err := isAllowed(e.permissions, ses, usr, user.UPDATE_GROUP)
+	if AnyErrorAsInternalError(err, writer) {
+		return false
+	}
+	if global {
+		return true
+	}
+
+	for _, gid := range changedPKs(target.Groups, dto.Groups) {
+		groupId := gid
+		if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_GROUP, &user.Target{Group: &groupId}) {
+			return false
+		}
+	}
+
+	if len(changedPKs(target.Roles, dto.Roles)) > 0 {
+		writePermissionDenied(writer, ses, user.UPDATE_GROUP, "roles require the global permission")
+		return false
+	}
+	return true
+}
+
+//removes the group reference from all other groups
+func (e *EndpointGroups) removeFromAllGroups(groupId db.PK) error {
+	allGroups, err := e.groups.List()
+	if err != nil {
+		return err
+	}
+
+	for _, grp := range allGroups {
+		if grp.RemoveGroup(groupId) {
+			err = e.groups.Update(grp)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // A user can delete another group, if he has the permission DELETE_GROUP
 //  @Path DELETE /groups/{id}
 //  @Header sid string
@@ -192,22 +224,25 @@ func (e *EndpointGroups) updateAllUsers(groupId db.PK, users []db.PK) error {
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointGroups) deleteGroup(writer http.ResponseWriter, request *http.Request, groupId db.PK) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.DELETE_GROUP)
+	ses, usr := validateOn(e.sessions, e.users, e.permissions, writer, request, user.DELETE_GROUP, &user.Target{Group: &groupId})
 	if usr == nil {
 		return
 	}
 
+	var before *groupDTO
+	if grp, err := e.groups.Get(groupId); err == nil {
+		before = newGroupDTO(e.users, grp)
+	}
+
 	e.updateAllUsers(groupId, nil)
+	e.removeFromAllGroups(groupId)
+	e.grants.DeleteReferences(groupId)
 	err := e.groups.Delete(groupId)
-	if err != nil {
-		if db.IsEntityNotFound(err) {
-			http.Error(writer, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+	if AnyErrorAsHTTPError(err, writer) {
 		return
 	}
 
+	recordAudit(e.audit, ses, usr, request, "group.delete", groupId.String(), before, nil)
 	WriteOK(writer)
 }
 
@@ -218,30 +253,13 @@ func (e *EndpointGroups) deleteGroup(writer http.ResponseWriter, request *http.R
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
 //  @Return 500 (for any other error)
 func (e *EndpointGroups) getGroup(writer http.ResponseWriter, request *http.Request, groupId db.PK) {
-	_, usr := GetSessionAndUser(e.sessions, e.users, writer, request)
+	_, usr := validateOn(e.sessions, e.users, e.permissions, writer, request, user.GET_GROUP, &user.Target{Group: &groupId})
 	if usr == nil {
 		return
 	}
 
-	//check if the permission is available
-	allowed, err := e.permissions.IsAllowed(user.GET_GROUP, usr)
-	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if !allowed {
-		http.Error(writer, err.Error(), http.StatusForbidden)
-		return
-	}
-
 	group, err := e.groups.Get(groupId)
-	if err != nil {
-		if db.IsEntityNotFound(err) {
-			http.Error(writer, err.Error(), http.StatusNotFound)
-			return
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+	if AnyErrorAsHTTPError(err, writer) {
 		return
 	}
 	//return the other user dto
@@ -254,13 +272,11 @@ func (e *EndpointGroups) getGroup(writer http.ResponseWriter, request *http.Requ
 //  @Header sid string
 //	@Body github.com/worldiety/devdrasil/backend/groupDTO
 //	@Return 200 github.com/worldiety/devdrasil/backend/groupDTO
+//  @Return 400 (if the group would become a member of itself | if a parent group or user belongs to another tenant)
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
 //  @Return 500 (for any other error)
 func (e *EndpointGroups) updateGroup(writer http.ResponseWriter, request *http.Request, groupId db.PK) {
-	_, usr := GetSessionAndUser(e.sessions, e.users, writer, request)
-	if usr == nil {
-		return
-	}
+	ses, usr := CurrentSession(request)
 
 	dto := &groupDTO{}
 	err := ReadJSONBody(writer, request, dto)
@@ -269,47 +285,51 @@ func (e *EndpointGroups) updateGroup(writer http.ResponseWriter, request *http.R
 	}
 
 	//check if the permission is available
-	allowed, err := e.permissions.IsAllowed(user.UPDATE_GROUP, usr)
-	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+	if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_GROUP, &user.Target{Group: &groupId}) {
 		return
 	}
-	if !allowed {
-		http.Error(writer, err.Error(), http.StatusForbidden)
+
+	otherGroup, err := e.groups.Get(groupId)
+	if AnyErrorAsHTTPError(err, writer) {
 		return
 	}
 
-	otherGroup, err := e.groups.Get(groupId)
-	if err != nil {
-		if db.IsEntityNotFound(err) {
-			http.Error(writer, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+	if !e.isAllowedToAssign(writer, ses, usr, otherGroup, dto) {
 		return
 	}
 
+	before := newGroupDTO(e.users, otherGroup)
+
 	otherGroup.Name = dto.Name
+	otherGroup.Roles = dto.Roles
+	otherGroup.Groups = dto.Groups
+
+	allGroups, err := e.groups.List()
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	if group.IsCyclic(allGroups, otherGroup.Id, otherGroup.Groups) {
+		WriteError(writer, http.StatusBadRequest, "a group cannot be a member of itself")
+		return
+	}
 
 	//rewrite
 	err = e.groups.Update(otherGroup)
 	if err != nil {
-		if db.IsNotUnique(err) {
-			http.Error(writer, err.Error(), http.StatusBadRequest)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+		AnyErrorAsHTTPError(err, writer)
 
 		return
 	}
 
 	err = e.updateAllUsers(otherGroup.Id, dto.Users)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 
 	//return the newly data
-	WriteJSONBody(writer, newGroupDTO(e.users, otherGroup))
+	res := newGroupDTO(e.users, otherGroup)
+	recordAudit(e.audit, ses, usr, request, "group.update", otherGroup.Id.String(), before, res)
+	WriteJSONBody(writer, res)
 
 }
@@ -0,0 +1,103 @@
+package backend
+
+import (
+	"github.com/worldiety/devdrasil/backend/i18n"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/log"
+	"net/http"
+)
+
+//the header, which carries the negotiated locale of a response, see Localize
+const ContentLanguageHeader = "Content-Language"
+
+//the available translations
+type localesDTO struct {
+	//e.g. de and en
+	Locales []string
+
+	//the locale of untranslated texts
+	Default string
+
+	//the negotiated locale of the request, see Localize
+	Current string
+}
+
+//Localize negotiates the locale of each response by the Accept-Language header. The locale of an authenticated user
+//takes precedence, see GetSessionAndUser. Error messages are translated accordingly, see WriteError.
+func Localize(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set(ContentLanguageHeader, i18n.Default.Negotiate(request.Header.Get("Accept-Language")))
+		writer.Header().Add("Vary", "Accept-Language")
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+//the locale of the user overrides the negotiated one, if the catalog supports it
+func applyUserLocale(writer http.ResponseWriter, usr *user.User) {
+	if usr.Locale != "" && i18n.Default.Supports(usr.Locale) {
+		writer.Header().Set(ContentLanguageHeader, usr.Locale)
+	}
+}
+
+//returns the negotiated locale of the response or the default locale
+func responseLocale(writer http.ResponseWriter) string {
+	if locale := writer.Header().Get(ContentLanguageHeader); locale != "" {
+		return locale
+	}
+	return i18n.DefaultLocale
+}
+
+//checks that the locale is empty or has a bundle. Writes the error, so just return if false.
+func isValidLocale(writer http.ResponseWriter, locale *string) bool {
+	if locale != nil && *locale != "" && !i18n.Default.Supports(*locale) {
+		WriteError(writer, http.StatusBadRequest, "unknown locale: "+*locale)
+		return false
+	}
+	return true
+}
+
+//The translation endpoints serve the bundles of the catalog, so that the frontend and the server share them.
+//They are public, because the login form is translated as well.
+type EndpointI18n struct {
+	router *Router
+}
+
+func NewEndpointI18n(router *Router) *EndpointI18n {
+	endpoint := &EndpointI18n{router: router}
+	router.Handle("GET", "/i18n", endpoint.listLocales)
+	router.HandleString("GET", "/i18n/{locale}", endpoint.getBundle)
+	return endpoint
+}
+
+// Lists the available locales and the one, which has been negotiated by the Accept-Language header.
+//  @Path GET /i18n
+//	@Return 200 github.com/worldiety/devdrasil/backend/localesDTO
+func (e *EndpointI18n) listLocales(writer http.ResponseWriter, request *http.Request) {
+	WriteJSONBody(writer, &localesDTO{Locales: i18n.Default.Locales(), Default: i18n.DefaultLocale, Current: responseLocale(writer)})
+}
+
+// Returns the translations of a locale by their name, completed by the default locale. The format xml returns
+// the android style strings.xml, which the frontend loads like its own resources.
+//  @Path GET /i18n/{locale}?format={json|xml}
+//	@Return 200 github.com/worldiety/devdrasil/backend/i18n/Bundle
+//  @Return 404 (if the locale is unknown)
+func (e *EndpointI18n) getBundle(writer http.ResponseWriter, request *http.Request, locale string) {
+	bundle, ok := i18n.Default.Bundle(locale)
+	if !ok {
+		WriteError(writer, http.StatusNotFound, "unknown locale: "+locale)
+		return
+	}
+
+	writer.Header().Set(ContentLanguageHeader, locale)
+	if request.URL.Query().Get("format") != "xml" {
+		WriteJSONBody(writer, bundle)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	err := i18n.WriteStrings(writer, bundle)
+	if err != nil {
+		//the header is already written
+		log.Default.Error(log.New("failed to write bundle").Put("locale", locale).SetError(err))
+	}
+}
@@ -0,0 +1,242 @@
+//Package i18n translates the messages of the server. The catalog is read from the same android style string resources,
+//which the frontend uses, e.g. frontend/values-de/strings.xml, so that both sides share one source of truth.
+package i18n
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//the locale of the messages in the code, which are also the fallback for any missing translation
+const DefaultLocale = "en"
+
+//the file of a bundle within a values-<locale> directory
+const stringsFilename = "strings.xml"
+
+//the translations of a locale by their name, e.g. login_failed
+type Bundle map[string]string
+
+//Default is the catalog, which is used to translate the error responses, see backend.WriteError
+var Default = NewCatalog()
+
+//The Catalog contains a Bundle per locale. It is safe for concurrent use.
+type Catalog struct {
+	mutex   sync.RWMutex
+	bundles map[string]Bundle
+
+	//the names of the default bundle by their text, to translate messages which are written in the DefaultLocale
+	names map[string]string
+}
+
+func NewCatalog() *Catalog {
+	return &Catalog{bundles: make(map[string]Bundle), names: make(map[string]string)}
+}
+
+//Load reads each dir/values-<locale>/strings.xml. A missing dir results in an empty catalog, which never translates.
+func Load(dir string) (*Catalog, error) {
+	catalog := NewCatalog()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return catalog, nil
+		}
+		return nil, err
+	}
+
+	for _, file := range files {
+		if !file.IsDir() || !strings.HasPrefix(file.Name(), "values-") {
+			continue
+		}
+		locale := normalize(strings.TrimPrefix(file.Name(), "values-"))
+		f, err := os.Open(filepath.Join(dir, file.Name(), stringsFilename))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		bundle, err := ReadStrings(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file.Name(), err)
+		}
+		catalog.Add(locale, bundle)
+	}
+	return catalog, nil
+}
+
+//adds the translations to the bundle of the locale, existing names are replaced
+func (c *Catalog) Add(locale string, bundle Bundle) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	locale = normalize(locale)
+	dst := c.bundles[locale]
+	if dst == nil {
+		dst = make(Bundle)
+		c.bundles[locale] = dst
+	}
+	for name, text := range bundle {
+		dst[name] = text
+		if locale == DefaultLocale {
+			c.names[text] = name
+		}
+	}
+}
+
+//returns the sorted locales, which have a bundle
+func (c *Catalog) Locales() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	res := make([]string, 0, len(c.bundles))
+	for locale := range c.bundles {
+		res = append(res, locale)
+	}
+	sort.Strings(res)
+	return res
+}
+
+//checks if the catalog has a bundle for the locale
+func (c *Catalog) Supports(locale string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	_, ok := c.bundles[normalize(locale)]
+	return ok
+}
+
+//returns a copy of the bundle of the locale. Missing translations are completed from the DefaultLocale.
+func (c *Catalog) Bundle(locale string) (Bundle, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	bundle, ok := c.bundles[normalize(locale)]
+	if !ok {
+		return nil, false
+	}
+	res := make(Bundle)
+	for name, text := range c.bundles[DefaultLocale] {
+		res[name] = text
+	}
+	for name, text := range bundle {
+		res[name] = text
+	}
+	return res, true
+}
+
+//the positional arguments of android, e.g. %1$s, which are %[1]s in go
+var positionalArg = regexp.MustCompile(`%([0-9]+)\$`)
+
+//String formats the named translation of the locale with the args. A missing translation falls back to the
+//DefaultLocale and at last to the name itself.
+func (c *Catalog) String(locale string, name string, args ...interface{}) string {
+	c.mutex.RLock()
+	text, ok := c.bundles[normalize(locale)][name]
+	if !ok {
+		text, ok = c.bundles[DefaultLocale][name]
+	}
+	c.mutex.RUnlock()
+
+	if !ok {
+		text = name
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(positionalArg.ReplaceAllString(text, "%[$1]"), args...)
+}
+
+//Translate returns the message, which is written in the DefaultLocale, in the given locale. A message like
+//"unknown group: 1234" is translated by its prefix and keeps the detail. Unknown messages are returned as they are.
+func (c *Catalog) Translate(locale string, message string) string {
+	locale = normalize(locale)
+	if locale == "" || locale == DefaultLocale {
+		return message
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	detail := ""
+	name, ok := c.names[message]
+	if !ok {
+		idx := strings.Index(message, ": ")
+		if idx < 0 {
+			return message
+		}
+		name, ok = c.names[message[:idx]]
+		if !ok {
+			return message
+		}
+		detail = message[idx:]
+	}
+
+	text, ok := c.bundles[locale][name]
+	if !ok {
+		return message
+	}
+	return text + detail
+}
+
+//Negotiate returns the supported locale, which the client prefers most by the Accept-Language header, e.g.
+//de-DE,de;q=0.9,en;q=0.8. A region falls back to its language. Returns the DefaultLocale, if nothing matches.
+func (c *Catalog) Negotiate(acceptLanguage string) string {
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if c.Supports(tag) {
+			return normalize(tag)
+		}
+		if idx := strings.IndexAny(tag, "-_"); idx > 0 && c.Supports(tag[:idx]) {
+			return normalize(tag[:idx])
+		}
+	}
+	return DefaultLocale
+}
+
+//returns the language tags, ordered by their quality. Tags with q=0 are excluded.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	list := make([]weighted, 0)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if _, err := fmt.Sscanf(param[2:], "%g", &q); err != nil {
+					q = 0
+				}
+			}
+		}
+		if q > 0 {
+			list = append(list, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(list, func(a, b int) bool {
+		return list[a].q > list[b].q
+	})
+
+	res := make([]string, 0, len(list))
+	for _, w := range list {
+		res = append(res, w.tag)
+	}
+	return res
+}
+
+//e.g. de-DE becomes de-de, so that locales compare case insensitive
+func normalize(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
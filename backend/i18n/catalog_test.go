@@ -0,0 +1,98 @@
+package i18n
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func newTestCatalog() *Catalog {
+	catalog := NewCatalog()
+	catalog.Add("en", Bundle{"error_unknown_group": "unknown group", "hello_x": "Hello %1$s from %2$s", "login": "Login"})
+	catalog.Add("de", Bundle{"error_unknown_group": "unbekannte Gruppe", "hello_x": "Hallo %1$s aus %2$s"})
+	return catalog
+}
+
+func TestNegotiate(t *testing.T) {
+	catalog := newTestCatalog()
+	cases := map[string]string{
+		"":                        "en",
+		"de":                      "de",
+		"de-DE,de;q=0.9,en;q=0.8": "de",
+		"fr-FR,en;q=0.5,de;q=0.7": "de",
+		"de;q=0,en":               "en",
+		"fr, *":                   "en",
+		"EN_us":                   "en",
+	}
+	for header, expected := range cases {
+		if locale := catalog.Negotiate(header); locale != expected {
+			t.Fatalf("%s: expected %s but got %s", header, expected, locale)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	catalog := newTestCatalog()
+	if msg := catalog.Translate("de", "unknown group"); msg != "unbekannte Gruppe" {
+		t.Fatal(msg)
+	}
+	if msg := catalog.Translate("de", "unknown group: 1234"); msg != "unbekannte Gruppe: 1234" {
+		t.Fatal(msg)
+	}
+	if msg := catalog.Translate("de", "something else"); msg != "something else" {
+		t.Fatal(msg)
+	}
+	if msg := catalog.String("de", "hello_x", "Anna", "Bremen"); msg != "Hallo Anna aus Bremen" {
+		t.Fatal(msg)
+	}
+	if msg := catalog.String("de", "login"); msg != "Login" {
+		t.Fatal(msg)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	bundle, err := ReadStrings(strings.NewReader(`<resources>
+    <string name="a">"Login"</string>
+    <string name="b">Do you really want to delete \'%s\'?
+    </string>
+    <string name="c">Hello,\n\nworld</string>
+</resources>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle["a"] != "Login" || bundle["b"] != "Do you really want to delete '%s'?" || bundle["c"] != "Hello,\n\nworld" {
+		t.Fatal(bundle)
+	}
+
+	buf := &bytes.Buffer{}
+	err = WriteStrings(buf, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ReadStrings(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range bundle {
+		if other[name] != text {
+			t.Fatalf("%s: expected %q but got %q", name, text, other[name])
+		}
+	}
+}
+
+//the english texts of the errors must be unique, otherwise a message cannot be translated
+func TestFrontendResources(t *testing.T) {
+	catalog, err := Load("../../frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !catalog.Supports("de") || !catalog.Supports("en") {
+		t.Fatal(catalog.Locales())
+	}
+	if msg := catalog.Translate("de", "groups of another tenant: 1234"); msg == "groups of another tenant: 1234" {
+		t.Fatal("not translated")
+	}
+	if subject := catalog.String("en", "mail_invitation_subject", "devdrasil"); subject != "Invitation to devdrasil" {
+		t.Fatal(subject)
+	}
+}
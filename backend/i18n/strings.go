@@ -0,0 +1,71 @@
+package i18n
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+)
+
+//the android style resources, e.g. <resources><string name="login">Login</string></resources>
+type resources struct {
+	XMLName xml.Name          `xml:"resources"`
+	Strings []*resourceString `xml:"string"`
+}
+
+type resourceString struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+//ReadStrings parses a strings.xml. Like android, the whitespace of a value is collapsed, surrounding quotes are
+//removed and the escapes \n, \t, \' and \" are resolved.
+func ReadStrings(r io.Reader) (Bundle, error) {
+	res := &resources{}
+	err := xml.NewDecoder(r).Decode(res)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := make(Bundle)
+	for _, str := range res.Strings {
+		bundle[str.Name] = unescape(str.Value)
+	}
+	return bundle, nil
+}
+
+//WriteStrings writes the bundle as strings.xml, sorted by name, so that the frontend can load it like its own resources
+func WriteStrings(w io.Writer, bundle Bundle) error {
+	res := &resources{}
+	for name, text := range bundle {
+		res.Strings = append(res.Strings, &resourceString{Name: name, Value: escape(text)})
+	}
+	sort.Slice(res.Strings, func(a, b int) bool {
+		return res.Strings[a].Name < res.Strings[b].Name
+	})
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "    ")
+	err = enc.Encode(res)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func unescape(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+	return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\'`, "'", `\"`, `"`, `\\`, `\`).Replace(value)
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, "'", `\'`, `"`, `\"`).Replace(value)
+}
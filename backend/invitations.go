@@ -0,0 +1,384 @@
+package backend
+
+import (
+	"github.com/worldiety/devdrasil/backend/i18n"
+	"net/http"
+	netmail "net/mail"
+	"github.com/worldiety/devdrasil/backend/audit"
+	"github.com/worldiety/devdrasil/backend/company"
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/backend/invite"
+	"github.com/worldiety/devdrasil/backend/mail"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"github.com/worldiety/devdrasil/log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type invitationListDTO struct {
+	List []*invitationDTO
+}
+
+type invitationDTO struct {
+	//unique entity id, e.g. "abc38293"
+	Id db.PK
+
+	//the invited address
+	EMail string
+
+	//the optional company of the new user
+	Company *db.PK
+
+	//the groups of the new user
+	Groups []db.PK
+
+	//the user, who has sent the invitation
+	InvitedBy db.PK
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	CreatedAt int64
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	ExpiresAt int64
+
+	//the registered user, absent as long as the invitation is open
+	User *db.PK
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	AcceptedAt int64
+}
+
+func newInvitationDTO(inv *invite.Invitation) *invitationDTO {
+	return &invitationDTO{Id: inv.Id, EMail: inv.EMail, Company: inv.Company, Groups: inv.Groups, InvitedBy: inv.InvitedBy, CreatedAt: inv.CreatedAt, ExpiresAt: inv.ExpiresAt, User: inv.User, AcceptedAt: inv.AcceptedAt}
+}
+
+type invitationTokenDTO struct {
+	//the token from the invitation mail
+	Token string
+}
+
+//what the invitee sees before the registration
+type invitationInfoDTO struct {
+	//the invited address, which becomes the address of the new user
+	EMail string
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	ExpiresAt int64
+}
+
+type registrationDTO struct {
+	//the token from the invitation mail
+	Token string
+
+	Login     string
+	Firstname string
+	Lastname  string
+	Password  string
+}
+
+//The invitation endpoints. Inviting requires CREATE_USER, like adding a user directly, and the invitee registers
+//without a session.
+type EndpointInvitations struct {
+	router      *Router
+	sessions    *session.Sessions
+	users       *user.Users
+	permissions *user.Permissions
+	groups      *group.Groups
+	companies   *company.Companies
+	invitations *invite.Invitations
+	mailer      mail.Mailer
+	audit       *audit.Log
+
+	//the public url of the frontend, e.g. https://devdrasil.mycompany.com
+	publicURL string
+
+	//how long an invitation is valid
+	ttl time.Duration
+}
+
+func NewEndpointInvitations(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, groups *group.Groups, companies *company.Companies, invitations *invite.Invitations, mailer mail.Mailer, publicURL string, ttl time.Duration, auditLog *audit.Log) *EndpointInvitations {
+	endpoint := &EndpointInvitations{router: router, sessions: sessions, users: users, permissions: permissions, groups: groups, companies: companies, invitations: invitations, mailer: mailer, publicURL: strings.TrimSuffix(publicURL, "/"), ttl: ttl, audit: auditLog}
+	auth := Authenticated(sessions, users)
+	router.Handle("GET", "/invitations", endpoint.listInvitations, Permitted(sessions, users, permissions, user.LIST_USERS))
+	router.Handle("POST", "/invitations", endpoint.addInvitation, auth)
+	router.HandlePK("DELETE", "/invitations/{id:pk}", endpoint.deleteInvitation, auth)
+	router.Handle("POST", "/register/verify", endpoint.verifyInvitation)
+	router.Handle("POST", "/register", endpoint.register)
+	return endpoint
+}
+
+// Lists all invitations of the tenant, including the accepted and expired ones.
+//  @Path GET /invitations
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/invitationListDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 500 (for any other error)
+func (e *EndpointInvitations) listInvitations(writer http.ResponseWriter, request *http.Request) {
+	_, usr := CurrentSession(request)
+
+	list, err := e.invitations.List()
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	res := &invitationListDTO{}
+	res.List = make([]*invitationDTO, 0)
+	for _, inv := range list {
+		visible, err := isInTenant(e.permissions, usr, inv.Company)
+		if AnyErrorAsInternalError(err, writer) {
+			return
+		}
+		if visible {
+			res.List = append(res.List, newInvitationDTO(inv))
+		}
+	}
+	WriteJSONBody(writer, res)
+}
+
+//Like adding a user, the company defaults to the tenant of the session user, CREATE_USER is checked for the company
+//and the groups must belong to the tenant. Without the global UPDATE_USER, the company and each
+//group also require the UPDATE permission. Writes the error, so just return if false.
+func (e *EndpointInvitations) isAllowedToInvite(writer http.ResponseWriter, ses *session.Session, usr *user.User, dto *invitationDTO) bool {
+	tenant, ok := tenantOfNew(e.permissions, writer, ses, usr, dto.Company)
+	if !ok {
+		return false
+	}
+	dto.Company = tenant
+	if !checkGroupsInTenant(e.permissions, writer, dto.Company, dto.Groups) {
+		return false
+	}
+
+	var target *user.Target
+	if dto.Company != nil {
+		target = &user.Target{Company: dto.Company}
+	}
+	if !checkAllowedOn(e.permissions, writer, ses, usr, user.CREATE_USER, target) {
+		return false
+	}
+
+	global, err := isAllowed(e.permissions, ses, usr, user.UPDATE_USER)
+	if AnyErrorAsInternalError(err, writer) {
+		return false
+	}
+	if global {
+		return true
+	}
+
+	if dto.Company != nil && !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_USER, &user.Target{Company: dto.Company}) {
+		return false
+	}
+	for _, gid := range dto.Groups {
+		groupId := gid
+		if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_GROUP, &user.Target{Group: &groupId}) {
+			return false
+		}
+	}
+	return true
+}
+
+//checks that the company and groups exist. Writes the error, so just return if false.
+func (e *EndpointInvitations) isValid(writer http.ResponseWriter, dto *invitationDTO) bool {
+	addr, err := netmail.ParseAddress(dto.EMail)
+	if err != nil || addr.Address != dto.EMail {
+		WriteError(writer, http.StatusBadRequest, "invalid e-mail address")
+		return false
+	}
+
+	if dto.Company != nil {
+		_, err := e.companies.Get(*dto.Company)
+		if db.IsEntityNotFound(err) {
+			WriteError(writer, http.StatusBadRequest, "unknown company: "+dto.Company.String())
+			return false
+		}
+		if AnyErrorAsInternalError(err, writer) {
+			return false
+		}
+	}
+
+	for _, groupId := range dto.Groups {
+		_, err := e.groups.Get(groupId)
+		if db.IsEntityNotFound(err) {
+			WriteError(writer, http.StatusBadRequest, "unknown group: "+groupId.String())
+			return false
+		}
+		if AnyErrorAsInternalError(err, writer) {
+			return false
+		}
+	}
+	return true
+}
+
+// Invites the address to register a user with the given company and groups. The token is only sent to the address
+// and the invitation expires after the configured time. If the mail cannot be delivered, the invitation is discarded.
+// The link in the mail is built from the configured public url, never from the host of the request.
+//  @Path POST /invitations
+//  @Header sid string
+//	@Body github.com/worldiety/devdrasil/backend/invitationDTO
+//	@Return 200 github.com/worldiety/devdrasil/backend/invitationDTO
+//  @Return 400 (if the address is invalid | if the company or a group does not exist | if a group belongs to another tenant)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 502 (if the mail cannot be sent)
+//  @Return 503 (if the public url is not configured)
+//  @Return 500 (for any other error)
+func (e *EndpointInvitations) addInvitation(writer http.ResponseWriter, request *http.Request) {
+	ses, usr := CurrentSession(request)
+
+	//the host header is chosen by the client, so the token could be sent to a link of anybody
+	if e.publicURL == "" {
+		WriteError(writer, http.StatusServiceUnavailable, "invitations require the public url")
+		return
+	}
+
+	dto := &invitationDTO{}
+	err := ReadJSONBody(writer, request, dto)
+	if err != nil {
+		return
+	}
+	dto.EMail = strings.TrimSpace(dto.EMail)
+
+	if !e.isValid(writer, dto) || !e.isAllowedToInvite(writer, ses, usr, dto) {
+		return
+	}
+
+	inv := &invite.Invitation{EMail: dto.EMail, Company: dto.Company, Groups: dto.Groups, InvitedBy: usr.Id}
+	token, err := e.invitations.Create(inv, e.ttl)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	inviter := strings.TrimSpace(usr.Firstname + " " + usr.Lastname)
+	if inviter == "" {
+		inviter = usr.Login
+	}
+	link := e.publicURL + "/#/register?invitation=" + url.QueryEscape(token)
+	//the mail is written in the language of the inviter
+	locale := responseLocale(writer)
+	msg := &mail.Message{To: []string{inv.EMail}, Subject: i18n.Default.String(locale, "mail_invitation_subject", "devdrasil")}
+	msg.Body = i18n.Default.String(locale, "mail_invitation_body", inviter, "devdrasil", time.Unix(inv.ExpiresAt, 0).UTC().Format(time.RFC1123), link)
+
+	err = e.mailer.Send(msg)
+	if err != nil {
+		log.Default.Error(log.New("failed to send invitation").Put("invitation", inv.Id.String()).SetError(err))
+		e.invitations.Delete(inv.Id)
+		WriteError(writer, http.StatusBadGateway, "failed to send the invitation")
+		return
+	}
+
+	res := newInvitationDTO(inv)
+	recordAudit(e.audit, ses, usr, request, "invitation.create", inv.Id.String(), nil, res)
+	WriteJSONBody(writer, res)
+}
+
+// Revokes an open invitation or removes an accepted or expired one. Requires CREATE_USER for the company of the invitation.
+//  @Path DELETE /invitations/{id}
+//  @Header sid string
+//	@Return 200
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 404 (if the invitation does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointInvitations) deleteInvitation(writer http.ResponseWriter, request *http.Request, invitationId db.PK) {
+	ses, usr := CurrentSession(request)
+
+	inv, err := e.invitations.Get(invitationId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	visible, err := isInTenant(e.permissions, usr, inv.Company)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	if !visible {
+		writePermissionDenied(writer, ses, user.MANAGE_TENANTS, "the invitation belongs to another tenant")
+		return
+	}
+
+	var target *user.Target
+	if inv.Company != nil {
+		target = &user.Target{Company: inv.Company}
+	}
+	if !checkAllowedOn(e.permissions, writer, ses, usr, user.CREATE_USER, target) {
+		return
+	}
+
+	err = e.invitations.Delete(invitationId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+	recordAudit(e.audit, ses, usr, request, "invitation.delete", invitationId.String(), newInvitationDTO(inv), nil)
+	WriteOK(writer)
+}
+
+// Checks the token of an invitation, so that the registration form can be shown. No session is required.
+//  @Path POST /register/verify
+//	@Body github.com/worldiety/devdrasil/backend/invitationTokenDTO
+//	@Return 200 github.com/worldiety/devdrasil/backend/invitationInfoDTO
+//  @Return 403 (if the token is invalid | if the invitation has expired or has already been accepted)
+//  @Return 500 (for any other error)
+func (e *EndpointInvitations) verifyInvitation(writer http.ResponseWriter, request *http.Request) {
+	dto := &invitationTokenDTO{}
+	err := ReadJSONBody(writer, request, dto)
+	if err != nil {
+		return
+	}
+
+	inv, err := e.invitations.Verify(dto.Token)
+	if err == invite.ErrInvalidInvitation {
+		WriteError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	WriteJSONBody(writer, &invitationInfoDTO{EMail: inv.EMail, ExpiresAt: inv.ExpiresAt})
+}
+
+// Registers a new user with the token of an invitation. The user gets the invited address and the preselected company
+// and groups. Each invitation can only be accepted once. No session is required, the user has to login afterwards.
+//  @Path POST /register
+//	@Body github.com/worldiety/devdrasil/backend/registrationDTO
+//	@Return 200 github.com/worldiety/devdrasil/backend/userDTO
+//  @Return 400 (if the login is empty | if the password is to weak)
+//  @Return 403 (if the token is invalid | if the invitation has expired or has already been accepted)
+//  @Return 409 (if the login is already taken)
+//  @Return 500 (for any other error)
+func (e *EndpointInvitations) register(writer http.ResponseWriter, request *http.Request) {
+	dto := &registrationDTO{}
+	err := ReadJSONBody(writer, request, dto)
+	if err != nil {
+		return
+	}
+
+	dto.Login = strings.TrimSpace(dto.Login)
+	if dto.Login == "" {
+		WriteError(writer, http.StatusBadRequest, "login is required")
+		return
+	}
+	if !user.IsGoodPassword(dto.Password) {
+		WriteError(writer, http.StatusBadRequest, "password to weak")
+		return
+	}
+
+	newUser := &user.User{Login: dto.Login, Firstname: dto.Firstname, Lastname: dto.Lastname, Active: true}
+	_, err = e.invitations.Accept(dto.Token, func(inv *invite.Invitation) (db.PK, error) {
+		newUser.EMailAddresses = []string{inv.EMail}
+		newUser.Company = inv.Company
+		newUser.Groups = inv.Groups
+		newUser.SetPassword(dto.Password)
+		err := e.users.Add(newUser)
+		return newUser.Id, err
+	})
+	if err == invite.ErrInvalidInvitation {
+		WriteError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	recordAudit(e.audit, nil, newUser, request, "user.register", newUser.Id.String(), nil, newUser)
+	WriteJSONBody(writer, newUserDTO(newUser))
+}
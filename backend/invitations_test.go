@@ -0,0 +1,23 @@
+package backend
+
+import (
+	"github.com/worldiety/devdrasil/backend/user"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestInvitationRequiresPublicURL(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	admin, err := env.users.Get(user.ADMIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := newSessionRequest("POST", "/invitations", `{"EMail":"alice@example.com"}`, env.login(t, admin))
+	request.Host = "evil.com"
+	if status := env.serve(request).Code; status != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d but got %d", http.StatusServiceUnavailable, status)
+	}
+}
@@ -0,0 +1,191 @@
+package invite
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/worldiety/devdrasil/db"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const TABLE_INVITATION = "invitation"
+
+//every invitation token starts with this prefix, so that leaked tokens can be found by scanners
+const invitationPrefix = "ddi_"
+
+var ErrInvalidInvitation = fmt.Errorf("invalid or expired invitation")
+
+//An Invitation allows the owner of the e-mail address to register exactly one user, which is a member of the
+//preselected company and groups. The token is signed and is not stored at all.
+type Invitation struct {
+	//unique entity id, which is also part of the token string
+	Id db.PK
+
+	//the invited address
+	EMail string
+
+	//the optional company of the new user
+	Company *db.PK
+
+	//the groups of the new user
+	Groups []db.PK
+
+	//the user, who has sent the invitation
+	InvitedBy db.PK
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	CreatedAt int64
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	ExpiresAt int64
+
+	//the registered user, nil as long as the invitation has not been accepted
+	User *db.PK
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	AcceptedAt int64
+}
+
+func (i *Invitation) IsExpired() bool {
+	return i.ExpiresAt < time.Now().Unix()
+}
+
+func (i *Invitation) IsAccepted() bool {
+	return i.User != nil
+}
+
+//the invitations repository
+type Invitations struct {
+	db   *db.Database
+	crud *db.CRUD
+	key  []byte
+
+	//serializes the acceptance, so that an invitation is only used once
+	mutex sync.Mutex
+}
+
+//creates the repository, the key signs the tokens
+func NewInvitations(d *db.Database, key []byte) *Invitations {
+	return &Invitations{db: d, crud: db.NewCRUD(d), key: key}
+}
+
+//LoadOrCreateKey reads the signing key from the file or generates a new one, which only the owner can read
+func LoadOrCreateKey(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(data)))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(file, []byte(hex.EncodeToString(key)), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+//the signature covers everything which the token grants, so changing the stored invitation invalidates the token
+func (r *Invitations) sign(inv *Invitation) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(inv.Id.String() + "\n" + strings.ToLower(inv.EMail) + "\n" + strconv.FormatInt(inv.ExpiresAt, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+//creates the invitation with a new id, which expires after ttl, and returns the token string
+func (r *Invitations) Create(inv *Invitation, ttl time.Duration) (string, error) {
+	inv.CreatedAt = time.Now().Unix()
+	inv.ExpiresAt = time.Now().Add(ttl).Unix()
+	inv.User = nil
+	inv.AcceptedAt = 0
+	if inv.Groups == nil {
+		inv.Groups = make([]db.PK, 0)
+	}
+
+	err := r.crud.Create(TABLE_INVITATION, inv)
+	if err != nil {
+		return "", err
+	}
+	return invitationPrefix + inv.Id.String() + "_" + r.sign(inv), nil
+}
+
+func (r *Invitations) Get(id db.PK) (*Invitation, error) {
+	inv := &Invitation{Id: id}
+	err := r.crud.Read(TABLE_INVITATION, inv)
+	return inv, err
+}
+
+func (r *Invitations) Delete(id db.PK) error {
+	return r.crud.Delete(TABLE_INVITATION, id)
+}
+
+func (r *Invitations) List() ([]*Invitation, error) {
+	res := make([]*Invitation, 0)
+	err := r.crud.List(TABLE_INVITATION, "", &res)
+	return res, err
+}
+
+//parses the token, compares the signature and checks that the invitation is still open. Returns ErrInvalidInvitation
+//for any mismatch.
+func (r *Invitations) Verify(str string) (*Invitation, error) {
+	if !strings.HasPrefix(str, invitationPrefix) {
+		return nil, ErrInvalidInvitation
+	}
+	parts := strings.SplitN(strings.TrimPrefix(str, invitationPrefix), "_", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidInvitation
+	}
+
+	id, err := db.ParsePK(parts[0])
+	if err != nil || id.IsNIL() {
+		return nil, ErrInvalidInvitation
+	}
+
+	inv, err := r.Get(id)
+	if err != nil {
+		if db.IsEntityNotFound(err) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(r.sign(inv))) || inv.IsExpired() || inv.IsAccepted() {
+		return nil, ErrInvalidInvitation
+	}
+	return inv, nil
+}
+
+//Accept verifies the token and calls register, which creates the user of the invitation. The invitation is marked as
+//accepted afterwards, so that it cannot be used again, even by concurrent requests.
+func (r *Invitations) Accept(str string, register func(inv *Invitation) (db.PK, error)) (*Invitation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	inv, err := r.Verify(str)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := register(inv)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.User = &userId
+	inv.AcceptedAt = time.Now().Unix()
+	return inv, r.crud.Update(TABLE_INVITATION, inv)
+}
@@ -0,0 +1,62 @@
+package invite
+
+import (
+	"github.com/worldiety/devdrasil/db"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestInvitationIsAcceptedOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devdrasil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	invitations := NewInvitations(db.Open(dir), []byte("secret"))
+	token, err := invitations.Create(&Invitation{EMail: "jdoe@mycompany.com"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := []byte(token)
+	tampered[len(tampered)-1] ^= 1
+	_, err = invitations.Verify(string(tampered))
+	if err != ErrInvalidInvitation {
+		t.Fatalf("expected a tampered token to be invalid, got %v", err)
+	}
+	_, err = NewInvitations(db.Open(dir), []byte("other")).Verify(token)
+	if err != ErrInvalidInvitation {
+		t.Fatalf("expected a token of another key to be invalid, got %v", err)
+	}
+
+	userId := db.NewPK("jdoe")
+	inv, err := invitations.Accept(token, func(inv *Invitation) (db.PK, error) {
+		return userId, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.User == nil || *inv.User != userId || inv.AcceptedAt == 0 {
+		t.Fatalf("expected the invitation to be accepted: %+v", inv)
+	}
+
+	_, err = invitations.Accept(token, func(inv *Invitation) (db.PK, error) {
+		t.Fatal("must not register twice")
+		return userId, nil
+	})
+	if err != ErrInvalidInvitation {
+		t.Fatalf("expected the accepted invitation to be invalid, got %v", err)
+	}
+
+	expired, err := invitations.Create(&Invitation{EMail: "jdoe@mycompany.com"}, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = invitations.Verify(expired)
+	if err != ErrInvalidInvitation {
+		t.Fatalf("expected the expired invitation to be invalid, got %v", err)
+	}
+}
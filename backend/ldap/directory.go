@@ -0,0 +1,454 @@
+//Package ldap authenticates users against a LDAP or Active Directory and synchronizes users and groups into devdrasil.
+package ldap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"github.com/worldiety/devdrasil/log"
+	"gopkg.in/ldap.v2"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//the page size for searching all users or groups
+const pageSize = 500
+
+type Config struct {
+	//e.g. ldap://ldap.mycompany.com:389 or ldaps://ldap.mycompany.com:636
+	URL string
+
+	//upgrades a ldap:// connection with StartTLS
+	StartTLS bool
+
+	//disables the certificate verification, only for testing
+	InsecureSkipVerify bool
+
+	//the service account to search for users and groups, e.g. cn=devdrasil,ou=services,dc=mycompany,dc=com
+	BindDN string
+
+	//the password of the service account
+	BindPassword string
+
+	//where to search for users, e.g. ou=people,dc=mycompany,dc=com
+	UserBaseDN string
+
+	//the filter for all users, e.g. (objectClass=person)
+	UserFilter string
+
+	//the attribute which contains the login, e.g. uid or sAMAccountName
+	LoginAttribute string
+
+	//e.g. givenName
+	FirstnameAttribute string
+
+	//e.g. sn
+	LastnameAttribute string
+
+	//e.g. mail
+	MailAttribute string
+
+	//where to search for groups, e.g. ou=groups,dc=mycompany,dc=com. If empty, groups are not synchronized.
+	GroupBaseDN string
+
+	//the filter for all groups, e.g. (objectClass=groupOfNames)
+	GroupFilter string
+
+	//the attribute which contains the name of the group, e.g. cn
+	GroupNameAttribute string
+
+	//the attribute which contains the DNs of the members, e.g. member
+	GroupMemberAttribute string
+}
+
+//applies the defaults of an OpenLDAP
+func (c *Config) setDefaults() {
+	if c.UserFilter == "" {
+		c.UserFilter = "(objectClass=person)"
+	}
+	if c.LoginAttribute == "" {
+		c.LoginAttribute = "uid"
+	}
+	if c.FirstnameAttribute == "" {
+		c.FirstnameAttribute = "givenName"
+	}
+	if c.LastnameAttribute == "" {
+		c.LastnameAttribute = "sn"
+	}
+	if c.MailAttribute == "" {
+		c.MailAttribute = "mail"
+	}
+	if c.GroupFilter == "" {
+		c.GroupFilter = "(objectClass=groupOfNames)"
+	}
+	if c.GroupNameAttribute == "" {
+		c.GroupNameAttribute = "cn"
+	}
+	if c.GroupMemberAttribute == "" {
+		c.GroupMemberAttribute = "member"
+	}
+}
+
+//A Directory is an user.Authenticator and keeps the ldap users and groups in sync. Users and groups which are not
+//provisioned by the directory are never touched.
+type Directory struct {
+	config   *Config
+	users    *user.Users
+	groups   *group.Groups
+	sessions *session.Sessions
+
+	//serializes authentication provisioning, synchronization and starting or stopping the background synchronization
+	mutex sync.Mutex
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func NewDirectory(config *Config, users *user.Users, groups *group.Groups, sessions *session.Sessions) *Directory {
+	config.setDefaults()
+	return &Directory{config: config, users: users, groups: groups, sessions: sessions}
+}
+
+//connects and binds with the service account
+func (d *Directory) connect() (*ldap.Conn, error) {
+	u, err := url.Parse(d.config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: d.config.InsecureSkipVerify}
+	var conn *ldap.Conn
+	switch u.Scheme {
+	case "ldaps":
+		conn, err = ldap.DialTLS("tcp", hostPort(u, "636"), tlsConfig)
+	case "ldap":
+		conn, err = ldap.Dial("tcp", hostPort(u, "389"))
+		if err == nil && d.config.StartTLS {
+			err = conn.StartTLS(tlsConfig)
+			if err != nil {
+				conn.Close()
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ldap url scheme '%s'", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.Bind(d.config.BindDN, d.config.BindPassword)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() == "" {
+		return u.Hostname() + ":" + defaultPort
+	}
+	return u.Host
+}
+
+func (d *Directory) userAttributes() []string {
+	return []string{"dn", d.config.LoginAttribute, d.config.FirstnameAttribute, d.config.LastnameAttribute, d.config.MailAttribute}
+}
+
+//Authenticate binds with the DN of the login and the given password. On success the user is provisioned or updated.
+//If the directory cannot be reached or searched, the login is treated as unknown.
+func (d *Directory) Authenticate(login string, password string) (*user.User, error) {
+	//an empty password is an anonymous bind for many servers, which would always succeed
+	if password == "" {
+		return nil, user.ErrInvalidCredentials
+	}
+
+	//an unreachable directory must not fail the login of the other authenticators or of the local users
+	conn, err := d.connect()
+	if err != nil {
+		log.Default.Warn(log.New("ldap not available for login").Put("login", login).SetError(err))
+		return nil, user.ErrUnknownLogin
+	}
+	defer conn.Close()
+
+	filter := fmt.Sprintf("(&%s(%s=%s))", d.config.UserFilter, d.config.LoginAttribute, ldap.EscapeFilter(login))
+	res, err := conn.Search(ldap.NewSearchRequest(d.config.UserBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false, filter, d.userAttributes(), nil))
+	if err != nil {
+		log.Default.Warn(log.New("ldap search for login failed").Put("login", login).SetError(err))
+		return nil, user.ErrUnknownLogin
+	}
+
+	if len(res.Entries) == 0 {
+		return nil, user.ErrUnknownLogin
+	}
+
+	if len(res.Entries) > 1 {
+		return nil, fmt.Errorf("login '%s' is ambiguous in the directory", login)
+	}
+
+	entry := res.Entries[0]
+	err = conn.Bind(entry.DN, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, user.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	usr, err := d.provision(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	//the membership is updated with the next synchronization, the new user has no groups yet
+	return usr, nil
+}
+
+//creates or updates the user from the entry, but does not change the active state of an existing user, except if the
+//synchronization has deactivated him, because he was gone
+func (d *Directory) provision(entry *ldap.Entry) (*user.User, error) {
+	externalId := strings.ToLower(entry.DN)
+	usr, err := d.users.FindByExternalId(user.PROVIDER_LDAP, externalId)
+	isNew := false
+	if err != nil {
+		if !db.IsEntityNotFound(err) {
+			return nil, err
+		}
+		isNew = true
+		usr = &user.User{Active: true, Provider: user.PROVIDER_LDAP, ExternalId: externalId}
+	}
+
+	usr.Login = entry.GetAttributeValue(d.config.LoginAttribute)
+	usr.Firstname = entry.GetAttributeValue(d.config.FirstnameAttribute)
+	usr.Lastname = entry.GetAttributeValue(d.config.LastnameAttribute)
+	usr.EMailAddresses = entry.GetAttributeValues(d.config.MailAttribute)
+
+	reactivated := usr.Vanished
+	if reactivated {
+		usr.Active = true
+		usr.Vanished = false
+	}
+
+	if isNew {
+		err = d.users.Add(usr)
+		if err == nil {
+			log.Default.Info(log.New("provisioned ldap user").Put("login", usr.Login).Put("dn", entry.DN))
+		}
+	} else {
+		err = d.users.Update(usr)
+		if err == nil && reactivated {
+			log.Default.Info(log.New("reactivated ldap user").Put("login", usr.Login).Put("dn", entry.DN))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return usr, nil
+}
+
+//Sync creates and updates all users of the directory, deactivates the ldap users which disappeared and replaces
+//the membership of ldap users in ldap groups. Local users and local groups are never touched.
+func (d *Directory) Sync() error {
+	conn, err := d.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	userEntries, err := conn.SearchWithPaging(ldap.NewSearchRequest(d.config.UserBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, d.config.UserFilter, d.userAttributes(), nil), pageSize)
+	if err != nil {
+		return err
+	}
+
+	var groupEntries []*ldap.Entry
+	if d.config.GroupBaseDN != "" {
+		res, err := conn.SearchWithPaging(ldap.NewSearchRequest(d.config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, d.config.GroupFilter, []string{"dn", d.config.GroupNameAttribute, d.config.GroupMemberAttribute}, nil), pageSize)
+		if err != nil {
+			return err
+		}
+		groupEntries = res.Entries
+	}
+
+	return d.apply(userEntries.Entries, groupEntries)
+}
+
+//applies the searched entries, see Sync. The ldap users which are not in the entries are only deactivated, if all
+//entries have been provisioned, because a partial or an empty result is rather a failure than the actual directory.
+//An entry whose login is taken by another user is skipped, because it would fail on every run.
+func (d *Directory) apply(userEntries []*ldap.Entry, groupEntries []*ldap.Entry) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	//ensure the groups and remember the members of each group by lower case DN
+	membership := make(map[string][]db.PK)
+	ldapGroups := make([]db.PK, 0)
+	for _, entry := range groupEntries {
+		name := entry.GetAttributeValue(d.config.GroupNameAttribute)
+		if name == "" {
+			continue
+		}
+		grp, err := d.ensureGroup(name)
+		if err != nil {
+			return err
+		}
+		if grp == nil {
+			continue
+		}
+		ldapGroups = append(ldapGroups, grp.Id)
+		for _, member := range entry.GetAttributeValues(d.config.GroupMemberAttribute) {
+			dn := strings.ToLower(member)
+			membership[dn] = append(membership[dn], grp.Id)
+		}
+	}
+
+	//create or update all users
+	seen := make(map[db.PK]bool)
+	failed := 0
+	conflicts := 0
+	for _, entry := range userEntries {
+		usr, err := d.provision(entry)
+		//a login which is taken by a local user fails on every run, so it must not prevent the deactivation forever
+		if db.IsNotUnique(err) {
+			log.Default.Warn(log.New("ldap user ignored, because another user has the same login").Put("dn", entry.DN).SetError(err))
+			conflicts++
+			known, err := d.users.FindByExternalId(user.PROVIDER_LDAP, strings.ToLower(entry.DN))
+			if err == nil {
+				seen[known.Id] = true
+			} else if !db.IsEntityNotFound(err) {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			log.Default.Error(log.New("failed to sync ldap user").Put("dn", entry.DN).SetError(err))
+			failed++
+			continue
+		}
+		seen[usr.Id] = true
+
+		//keep the local groups, but replace the ldap groups
+		groups := make([]db.PK, 0)
+		for _, gid := range usr.Groups {
+			if !containsPK(ldapGroups, gid) {
+				groups = append(groups, gid)
+			}
+		}
+		usr.Groups = append(groups, membership[usr.ExternalId]...)
+		err = d.users.Update(usr)
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to sync %d of %d ldap users, no user has been deactivated", failed, len(userEntries))
+	}
+	if len(userEntries) == 0 {
+		return fmt.Errorf("the directory returned no users, no user has been deactivated")
+	}
+
+	//deactivate ldap users which are gone
+	list, err := d.users.List()
+	if err != nil {
+		return err
+	}
+	for _, usr := range list {
+		if usr.Provider != user.PROVIDER_LDAP || seen[usr.Id] || !usr.Active {
+			continue
+		}
+		usr.Active = false
+		usr.Vanished = true
+		err = d.users.Update(usr)
+		if err != nil {
+			return err
+		}
+		_, err = d.sessions.DeleteByUser(usr.Id)
+		if err != nil {
+			return err
+		}
+		log.Default.Info(log.New("deactivated ldap user").Put("login", usr.Login).Put("dn", usr.ExternalId))
+	}
+
+	log.Default.Info(log.New("ldap sync finished").Put("users", len(userEntries)).Put("groups", len(groupEntries)).Put("conflicts", conflicts))
+	return nil
+}
+
+//returns the ldap group with the given name, creating it if required. Returns nil, if a local group has the same name.
+func (d *Directory) ensureGroup(name string) (*group.Group, error) {
+	grp, err := d.groups.FindByName(name)
+	if err == nil {
+		if grp.Provider != user.PROVIDER_LDAP {
+			log.Default.Warn(log.New("ldap group ignored, because a local group has the same name").Put("group", name))
+			return nil, nil
+		}
+		return grp, nil
+	}
+
+	if !db.IsEntityNotFound(err) {
+		return nil, err
+	}
+
+	grp = &group.Group{Name: name, Provider: user.PROVIDER_LDAP}
+	err = d.groups.Add(grp)
+	if err != nil {
+		return nil, err
+	}
+	return grp, nil
+}
+
+//starts a background synchronization in the given interval. Failures are logged.
+func (d *Directory) StartSync(interval time.Duration) {
+	d.StopSync()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+	go func(stop chan struct{}, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := d.Sync()
+			if err != nil {
+				log.Default.Error(log.New("ldap sync failed").SetError(err))
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}(d.stop, d.done)
+}
+
+//stops the background synchronization and waits for a running one
+func (d *Directory) StopSync() {
+	d.mutex.Lock()
+	stop, done := d.stop, d.done
+	d.stop, d.done = nil, nil
+	d.mutex.Unlock()
+
+	//the running synchronization requires the mutex
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func containsPK(list []db.PK, pk db.PK) bool {
+	for _, k := range list {
+		if k == pk {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package ldap
+
+import (
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"gopkg.in/ldap.v2"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newUserEntry(login string) *ldap.Entry {
+	return ldap.NewEntry("uid="+login+",ou=people,dc=mycompany,dc=com", map[string][]string{"uid": {login}, "sn": {login}})
+}
+
+func TestSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devdrasil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := db.Open(dir)
+	users, err := user.NewUsers(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := session.NewSessions(d)
+	directory := NewDirectory(&Config{GroupBaseDN: "ou=groups,dc=mycompany,dc=com"}, users, group.NewGroups(d), sessions)
+
+	alice := newUserEntry("alice")
+	bob := newUserEntry("bob")
+	developers := ldap.NewEntry("cn=developers,ou=groups,dc=mycompany,dc=com", map[string][]string{"cn": {"developers"}, "member": {alice.DN}})
+
+	find := func(login string) *user.User {
+		usr, err := users.FindByLogin(login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return usr
+	}
+
+	err = directory.apply([]*ldap.Entry{alice, bob}, []*ldap.Entry{developers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr := find("alice"); !usr.Active || len(usr.Groups) != 1 {
+		t.Fatal(usr)
+	}
+	now := time.Now().Unix()
+	err = sessions.Create(&session.Session{User: find("bob").Id, CreatedAt: now, LastUsedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//an empty result must not deactivate anybody
+	if err := directory.apply(nil, nil); err == nil {
+		t.Fatal("expected an empty result")
+	}
+	if usr := find("bob"); !usr.Active {
+		t.Fatal(usr)
+	}
+
+	//bob is gone, although the login of carol is taken by a local user
+	local := &user.User{Login: "carol", Active: true}
+	err = users.Add(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = directory.apply([]*ldap.Entry{alice, newUserEntry("carol")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr := find("bob"); usr.Active || !usr.Vanished {
+		t.Fatal(usr)
+	}
+	if list, err := sessions.ListByUser(find("bob").Id); err != nil || len(list) != 0 {
+		t.Fatal(list, err)
+	}
+	if usr := find("carol"); !usr.Active {
+		t.Fatal(usr)
+	}
+
+	//bob is back, but a user who has been deactivated by an admin stays inactive
+	usr := find("alice")
+	usr.Active = false
+	err = users.Update(usr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = directory.apply([]*ldap.Entry{alice, bob}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr := find("bob"); !usr.Active || usr.Vanished {
+		t.Fatal(usr)
+	}
+	if usr := find("alice"); usr.Active {
+		t.Fatal(usr)
+	}
+}
+
+func TestAuthenticateUnreachable(t *testing.T) {
+	directory := NewDirectory(&Config{URL: "ldap://127.0.0.1:1"}, nil, nil, nil)
+	if _, err := directory.Authenticate("admin", "secret"); err != user.ErrUnknownLogin {
+		t.Fatal(err)
+	}
+}
+
+func TestStopSync(t *testing.T) {
+	directory := NewDirectory(&Config{URL: "ldap://127.0.0.1:1"}, nil, nil, nil)
+	directory.StopSync()
+	directory.StartSync(time.Hour)
+	directory.StartSync(time.Hour)
+	directory.StopSync()
+	directory.StopSync()
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"fmt"
+	"github.com/worldiety/devdrasil/log"
+	"strings"
+)
+
+//A Mailer delivers plain text messages, e.g. invitations. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+type Message struct {
+	//the addresses of the recipients, e.g. jdoe@mycompany.com
+	To []string
+
+	Subject string
+
+	//the plain text body
+	Body string
+}
+
+//checks that no header can be injected by the recipients or the subject
+func (m *Message) validate() error {
+	if len(m.To) == 0 {
+		return fmt.Errorf("no recipient")
+	}
+	for _, to := range m.To {
+		if to == "" || strings.ContainsAny(to, "\r\n,") {
+			return fmt.Errorf("invalid recipient: %q", to)
+		}
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return fmt.Errorf("invalid subject")
+	}
+	return nil
+}
+
+//The LogMailer does not deliver anything but writes the messages into the log. Only useful for development,
+//because the messages may contain secrets.
+type LogMailer struct {
+}
+
+func (m *LogMailer) Send(msg *Message) error {
+	err := msg.validate()
+	if err != nil {
+		return err
+	}
+	log.Default.Info(log.New("mail not delivered").Put("to", strings.Join(msg.To, ", ")).Put("subject", msg.Subject).Put("body", msg.Body))
+	return nil
+}
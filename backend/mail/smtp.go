@@ -0,0 +1,71 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SMTPConfig struct {
+	//host and port of the server, e.g. smtp.mycompany.com:587
+	Addr string
+
+	//the sender address, e.g. devdrasil@mycompany.com
+	From string
+
+	//optional, to authenticate with PLAIN. The server must offer TLS, otherwise the credentials are not sent.
+	Username string
+	Password string
+}
+
+//The SMTPMailer delivers the messages to a mail server, using StartTLS if offered.
+type SMTPMailer struct {
+	config *SMTPConfig
+}
+
+func NewSMTPMailer(config *SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{config: config}
+}
+
+func (m *SMTPMailer) Send(msg *Message) error {
+	err := msg.validate()
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		host, _, err := net.SplitHostPort(m.config.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+	}
+
+	err = smtp.SendMail(m.config.Addr, auth, m.config.From, msg.To, m.format(msg))
+	if err != nil {
+		return fmt.Errorf("failed to send mail: %v", err)
+	}
+	return nil
+}
+
+//returns the message with its header, the body is sent as utf-8 quoted printable
+func (m *SMTPMailer) format(msg *Message) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", m.config.From)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(buf)
+	qp.Write([]byte(strings.Replace(msg.Body, "\n", "\r\n", -1)))
+	qp.Close()
+	return buf.Bytes()
+}
@@ -1,126 +1,145 @@
 package backend
 
 import (
+	"github.com/worldiety/devdrasil/backend/api"
 	"net/http"
+	"github.com/worldiety/devdrasil/backend/audit"
 	"github.com/worldiety/devdrasil/backend/session"
 	"github.com/worldiety/devdrasil/backend/user"
 	"github.com/worldiety/devdrasil/backend/store"
 	"github.com/worldiety/devdrasil/backend/plugin"
-	"strings"
 	"os"
 	"time"
+	"github.com/worldiety/devdrasil/db"
+	"github.com/worldiety/devdrasil/log"
 )
 
-type PluginInfo struct {
-	plugin.PluginVersionInfo
-}
+type PluginInfo = api.PluginInfo
+
+type pluginPermissionDTO = api.PluginPermission
 
 type EndpointMarket struct {
-	mux           *http.ServeMux
+	router        *Router
 	sessions      *session.Sessions
 	users         *user.Users
 	permissions   *user.Permissions
 	store         *store.Store
-	pluginManager *plugin.PluginManager
+	tenants       *plugin.Tenants
+	audit         *audit.Log
 }
 
-func NewEndpointStore(mux *http.ServeMux, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, pluginManager *plugin.PluginManager) *EndpointMarket {
-	endpoint := &EndpointMarket{mux: mux, users: users, sessions: sessions, permissions: permissions, store: &store.Store{}, pluginManager: pluginManager}
-	mux.HandleFunc("/market/index", endpoint.getIndex)
-	mux.HandleFunc("/plugins/", endpoint.pluginsVerbs)
+func NewEndpointStore(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, tenants *plugin.Tenants, st *store.Store, auditLog *audit.Log) *EndpointMarket {
+	endpoint := &EndpointMarket{router: router, users: users, sessions: sessions, permissions: permissions, store: st, tenants: tenants, audit: auditLog}
+	router.Handle("GET", "/market/index", endpoint.getIndex, Permitted(sessions, users, permissions, user.LIST_MARKET))
+	router.HandleString("GET", "/plugins/{id}", endpoint.getPluginInfo, Authenticated(sessions, users))
+	router.HandleString("POST", "/plugins/{id}", endpoint.installPlugin, Permitted(sessions, users, permissions, user.INSTALL_PLUGIN))
+	router.HandleString("PUT", "/plugins/{id}", endpoint.updatePlugin, Permitted(sessions, users, permissions, user.UPDATE_PLUGIN))
+	router.HandleString("DELETE", "/plugins/{id}", endpoint.deletePlugin, Permitted(sessions, users, permissions, user.REMOVE_PLUGIN))
 	return endpoint
 }
 
-func (e *EndpointMarket) pluginsVerbs(writer http.ResponseWriter, request *http.Request) {
-	pluginId := strings.TrimPrefix(request.URL.Path, "/plugins/")
-	switch request.Method {
-	case "GET":
-		e.getPluginInfo(writer, request, pluginId)
-	case "POST":
-		e.installPlugin(writer, request, pluginId)
-	case "PUT":
-		e.updatePlugin(writer, request, pluginId)
-	case "DELETE":
-		e.deletePlugin(writer, request, pluginId)
-	default:
-		http.Error(writer, request.Method, http.StatusMethodNotAllowed);
-		return
+//returns the plugins of the tenant of the session user. With MANAGE_TENANTS, the query parameter company selects
+//another tenant. Writes the error, so just return if nil.
+func (e *EndpointMarket) pluginManager(writer http.ResponseWriter, request *http.Request) *plugin.PluginManager {
+	ses, usr := CurrentSession(request)
+
+	company := request.URL.Query().Get("company")
+	if company == "" {
+		return e.tenants.Get(usr.Company)
 	}
+
+	pk, err := db.ParsePK(company)
+	if err != nil {
+		WriteError(writer, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	if !usr.HasCompany(pk) && !checkAllowedOn(e.permissions, writer, ses, usr, user.MANAGE_TENANTS, nil) {
+		return nil
+	}
+	return e.tenants.Get(&pk)
 }
 
 // Requires permissions LIST_MARKET
-//  @Path GET /market/plugins
+//  @Path GET /market/index
 //  @Header sid string
 //	@Return 200 github.com/worldiety/devdrasil/backend/store/Index
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
 //  @Return 500 (for any other error)
 func (e *EndpointMarket) getIndex(writer http.ResponseWriter, request *http.Request) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.LIST_MARKET)
-	if usr == nil {
-		return
-	}
-
 	index, err := e.store.GetIndex()
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 	WriteJSONBody(writer, index)
 }
 
 // Requires permissions UPDATE_PLUGIN
-//  @Path PUT /plugins/{id}
+//  @Path PUT /plugins/{id}?company={company id} (the plugins are installed per tenant, another company requires MANAGE_TENANTS)
 //  @Header sid string
 //	@Return 200 github.com/worldiety/devdrasil/backend/PluginInfo
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
 //  @Return 500 (for any other error)
 func (e *EndpointMarket) updatePlugin(writer http.ResponseWriter, request *http.Request, pluginId string) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.UPDATE_PLUGIN)
-	if usr == nil {
+	ses, usr := CurrentSession(request)
+
+	pluginManager := e.pluginManager(writer, request)
+	if pluginManager == nil {
 		return
 	}
 
 	//some sleep for nice visualization
 	time.Sleep(2 * time.Second)
 
+	before, _ := pluginManager.GetVersion(pluginId)
+
 	index, err := e.store.GetIndex()
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 	plg := index.GetPlugin(pluginId)
 	if plg == nil {
-		http.Error(writer, pluginId, http.StatusNotFound)
+		WriteError(writer, http.StatusNotFound, pluginId)
 		return
 	}
 	if plg.Source.Type != "git" {
-		http.Error(writer, "sources of type "+plg.Source.Type+" are not supported", http.StatusInternalServerError)
+		WriteError(writer, http.StatusInternalServerError, "sources of type "+plg.Source.Type+" are not supported")
 		return
 	}
-	err = e.pluginManager.Update(pluginId)
+	err = pluginManager.Update(pluginId)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
+		return
+	}
+
+	err = e.registerPermissions(pluginManager, pluginId)
+	if AnyErrorAsHTTPError(err, writer) {
 		return
 	}
 
-	version, err := e.pluginManager.GetVersion(pluginId)
+	version, err := pluginManager.GetVersion(pluginId)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
-	WriteJSONBody(writer, &PluginInfo{*version})
+	recordAudit(e.audit, ses, usr, request, "plugin.update", pluginId, before, version)
+	e.writePluginInfo(writer, version)
 
 }
 
-// Requires permissions INSTALL_PLUGIN
-//  @Path POST /plugins/{id}
+// Requires permissions INSTALL_PLUGIN. The permission kinds of the plugin manifest are created.
+//  @Path POST /plugins/{id}?company={company id} (the plugins are installed per tenant, another company requires MANAGE_TENANTS)
 //  @Header sid string
 //	@Return 200 github.com/worldiety/devdrasil/backend/PluginInfo
+//  @Return 409 (if a permission kind of the manifest already exists)
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
 //  @Return 500 (for any other error)
 func (e *EndpointMarket) installPlugin(writer http.ResponseWriter, request *http.Request, pluginId string) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.INSTALL_PLUGIN)
-	if usr == nil {
+	ses, usr := CurrentSession(request)
+
+	pluginManager := e.pluginManager(writer, request)
+	if pluginManager == nil {
 		return
 	}
 
@@ -129,87 +148,144 @@ func (e *EndpointMarket) installPlugin(writer http.ResponseWriter, request *http
 
 	index, err := e.store.GetIndex()
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 	plg := index.GetPlugin(pluginId)
 	if plg == nil {
-		http.Error(writer, pluginId, http.StatusNotFound)
+		WriteError(writer, http.StatusNotFound, pluginId)
 		return
 	}
 	if plg.Source.Type != "git" {
-		http.Error(writer, "sources of type "+plg.Source.Type+" are not supported", http.StatusInternalServerError)
+		WriteError(writer, http.StatusInternalServerError, "sources of type "+plg.Source.Type+" are not supported")
 		return
 	}
-	err = e.pluginManager.Install(pluginId, plg.Source.Url)
+	err = pluginManager.Install(pluginId, plg.Source.Url)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
+		return
+	}
+
+	err = e.registerPermissions(pluginManager, pluginId)
+	if err != nil {
+		//a plugin without its permissions would be unusable, so do not keep it
+		removeErr := pluginManager.Remove(pluginId, false)
+		if removeErr != nil {
+			log.Default.Error(log.New("failed to remove plugin").Put("plugin", pluginId).SetError(removeErr))
+		}
+		AnyErrorAsHTTPError(err, writer)
 		return
 	}
 
-	version, err := e.pluginManager.GetVersion(pluginId)
+	version, err := pluginManager.GetVersion(pluginId)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
-	WriteJSONBody(writer, &PluginInfo{*version})
+	recordAudit(e.audit, ses, usr, request, "plugin.install", pluginId, nil, version)
+	e.writePluginInfo(writer, version)
 }
 
 // Requires only an authenticated user. By design every user can query installed plugins, so that later UI components can fit themself properly
-//  @Path GET /plugins/{id}
+//  @Path GET /plugins/{id}?company={company id} (the plugins are installed per tenant, another company requires MANAGE_TENANTS)
 //  @Header sid string
 //	@Return 200 github.com/worldiety/devdrasil/backend/PluginInfo
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
 //  @Return 500 (for any other error)
 func (e *EndpointMarket) getPluginInfo(writer http.ResponseWriter, request *http.Request, pluginId string) {
-	_, usr := GetSessionAndUser(e.sessions, e.users, writer, request)
-	if usr == nil {
+	pluginManager := e.pluginManager(writer, request)
+	if pluginManager == nil {
 		return
 	}
 
-	version, err := e.pluginManager.GetVersion(pluginId)
+	version, err := pluginManager.GetVersion(pluginId)
 	if err != nil {
 		if os.IsNotExist(err) {
-			http.Error(writer, err.Error(), http.StatusNotFound)
+			WriteError(writer, http.StatusNotFound, "plugin not installed: "+pluginId)
 			return
 		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			WriteInternalError(writer, err)
 			return
 		}
 
 	}
-	WriteJSONBody(writer, &PluginInfo{*version})
+	e.writePluginInfo(writer, version)
 }
 
-// Requires permissions REMOVE_PLUGIN
-//  @Path DELETE /plugins/{id}
+// Requires permissions REMOVE_PLUGIN. The permission kinds of the plugin are removed as well, as soon as no tenant has the plugin installed.
+//  @Path DELETE /plugins/{id}?company={company id} (the plugins are installed per tenant, another company requires MANAGE_TENANTS)
 //  @Header sid string
 //	@Return 200
-//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointMarket) deletePlugin(writer http.ResponseWriter, request *http.Request, pluginId string) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.UPDATE_PLUGIN)
-	if usr == nil {
+	ses, usr := CurrentSession(request)
+
+	pluginManager := e.pluginManager(writer, request)
+	if pluginManager == nil {
 		return
 	}
 
 	//some sleep for nice visualization
 	time.Sleep(2 * time.Second)
 
-	_, err := e.pluginManager.GetVersion(pluginId)
+	before, err := pluginManager.GetVersion(pluginId)
 	if err != nil {
 		if os.IsNotExist(err) {
-			http.Error(writer, err.Error(), http.StatusNotFound)
+			WriteError(writer, http.StatusNotFound, "plugin not installed: "+pluginId)
 			return
 		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			WriteInternalError(writer, err)
 			return
 		}
 	}
 
-	err = e.pluginManager.Remove(pluginId, false)
+	err = pluginManager.Remove(pluginId, false)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
+		return
+	}
+
+	//the kinds are shared by all tenants, which have installed the plugin
+	installed, err := e.tenants.IsInstalledAnywhere(pluginId)
+	if AnyErrorAsInternalError(err, writer) {
 		return
 	}
+	if !installed {
+		err = e.permissions.RemovePlugin(pluginId)
+		if err != nil {
+			WriteInternalError(writer, err)
+			return
+		}
+	}
+
+	recordAudit(e.audit, ses, usr, request, "plugin.remove", pluginId, before, nil)
+}
+
+//creates or updates the permission kinds from the manifest of the installed plugin
+func (e *EndpointMarket) registerPermissions(pluginManager *plugin.PluginManager, pluginId string) error {
+	manifest, err := pluginManager.GetManifest(pluginId)
+	if err != nil {
+		return err
+	}
+
+	kinds := make([]*user.Permission, 0)
+	for _, perm := range manifest.Permissions {
+		kinds = append(kinds, &user.Permission{Id: db.NewPK(perm.Name), Description: perm.Description})
+	}
+	return e.permissions.RegisterPlugin(pluginId, kinds)
+}
+
+//writes the version info together with the permission kinds of the plugin
+func (e *EndpointMarket) writePluginInfo(writer http.ResponseWriter, version *plugin.PluginVersionInfo) {
+	perms, err := e.permissions.ListByPlugin(version.Id)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	info := &PluginInfo{PluginVersionInfo: *version, Permissions: make([]*pluginPermissionDTO, 0)}
+	for _, perm := range perms {
+		info.Permissions = append(info.Permissions, &pluginPermissionDTO{Name: user.PermissionName(perm.Id), Description: perm.Description})
+	}
+	WriteJSONBody(writer, info)
 }
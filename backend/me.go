@@ -0,0 +1,230 @@
+package backend
+
+import (
+	"net/http"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"time"
+)
+
+//the fields a user can change on his own, without any permission. Groups, Company and Active are intentionally missing.
+type profileDTO struct {
+	//e.g. Torben
+	Firstname *string
+
+	//e.g. Schinke
+	Lastname *string
+
+	//reference to an optional avatar image
+	AvatarImage *db.PK
+
+	//list of connected email addresses e.g. tschinke@domain.com, torben.schinke@otherdomain.com, ...
+	EMailAddresses *[]string
+
+	//the preferred language, e.g. de. Empty means the Accept-Language of the client.
+	Locale *string
+}
+
+type passwordChangeDTO struct {
+	//the current password, to proof that the session owner knows it
+	OldPassword string
+
+	//the new password
+	NewPassword string
+}
+
+//The self service endpoints always operate on the user of the session and do not require any permissions. Therefore
+//they are not available for api tokens, see Interactive.
+type EndpointMe struct {
+	router   *Router
+	sessions *session.Sessions
+	users    *user.Users
+}
+
+func NewEndpointMe(router *Router, sessions *session.Sessions, users *user.Users) *EndpointMe {
+	endpoint := &EndpointMe{router: router, sessions: sessions, users: users}
+	auth := Interactive(sessions, users)
+	router.Handle("GET", "/me", endpoint.getMe, auth)
+	router.Handle("PUT", "/me", endpoint.updateMe, auth)
+	router.Handle("PUT", "/me/password", endpoint.changePassword, auth)
+	router.Handle("GET", "/me/sessions", endpoint.listSessions, auth)
+	router.Handle("DELETE", "/me/sessions", endpoint.deleteSessions, auth)
+	router.HandlePK("DELETE", "/me/sessions/{handle:pk}", endpoint.deleteSession, auth)
+	return endpoint
+}
+
+// Every authenticated user can request his own user object.
+//  @Path GET /me
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/userDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token)
+func (e *EndpointMe) getMe(writer http.ResponseWriter, request *http.Request) {
+	_, usr := CurrentSession(request)
+
+	WriteJSONBody(writer, newUserDTO(usr))
+}
+
+// Every authenticated user can update his names, e-mail addresses, avatar and locale. Groups, Company and Active cannot be changed here.
+//  @Path PUT /me
+//  @Header sid string
+//	@Body github.com/worldiety/devdrasil/backend/profileDTO
+//	@Return 200 github.com/worldiety/devdrasil/backend/userDTO
+//  @Return 400 (if the locale is unknown)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token)
+//  @Return 500 (for any other error)
+func (e *EndpointMe) updateMe(writer http.ResponseWriter, request *http.Request) {
+	_, usr := CurrentSession(request)
+
+	dto := &profileDTO{}
+	err := ReadJSONBody(writer, request, dto)
+	if err != nil {
+		return
+	}
+
+	if !isValidLocale(writer, dto.Locale) {
+		return
+	}
+
+	if dto.Firstname != nil {
+		usr.Firstname = *dto.Firstname
+	}
+
+	if dto.Lastname != nil {
+		usr.Lastname = *dto.Lastname
+	}
+
+	if dto.AvatarImage != nil {
+		usr.AvatarImage = dto.AvatarImage
+	}
+
+	if dto.EMailAddresses != nil {
+		usr.EMailAddresses = *dto.EMailAddresses
+	}
+
+	if dto.Locale != nil {
+		usr.Locale = *dto.Locale
+	}
+
+	err = e.users.Update(usr)
+	if err != nil {
+		WriteInternalError(writer, err)
+		return
+	}
+
+	WriteJSONBody(writer, newUserDTO(usr))
+}
+
+// Every authenticated user can change his password, if he knows the current one. A wrong old password is delayed by 1 second.
+// All other sessions of the user are revoked.
+//  @Path PUT /me/password
+//  @Header sid string
+//	@Body github.com/worldiety/devdrasil/backend/passwordChangeDTO
+//	@Return 200
+//  @Return 400 (if the new password is too weak)
+//  @Return 403 (if session id is invalid | if session user is inactive | if authenticated by an api token | if the old password is wrong)
+//  @Return 500 (for any other error)
+func (e *EndpointMe) changePassword(writer http.ResponseWriter, request *http.Request) {
+	ses, usr := CurrentSession(request)
+
+	dto := &passwordChangeDTO{}
+	err := ReadJSONBody(writer, request, dto)
+	if err != nil {
+		return
+	}
+
+	if !usr.PasswordEquals(dto.OldPassword) {
+		//same brute force protection as for the login
+		time.Sleep(1000 * time.Millisecond)
+		WriteError(writer, http.StatusForbidden, "credentials invalid")
+		return
+	}
+
+	if !user.IsGoodPassword(dto.NewPassword) {
+		WriteError(writer, http.StatusBadRequest, "password to weak")
+		return
+	}
+
+	usr.SetPassword(dto.NewPassword)
+	err = e.users.Update(usr)
+	if err != nil {
+		WriteInternalError(writer, err)
+		return
+	}
+
+	//a changed password invalidates all other sessions, but keeps the current one
+	_, err = e.sessions.DeleteByUser(usr.Id, ses.Id)
+	if err != nil {
+		WriteInternalError(writer, err)
+		return
+	}
+
+	WriteOK(writer)
+}
+
+// Every authenticated user can list his own sessions.
+//  @Path GET /me/sessions
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/sessionInfoListDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token)
+//  @Return 500 (for any other error)
+func (e *EndpointMe) listSessions(writer http.ResponseWriter, request *http.Request) {
+	ses, usr := CurrentSession(request)
+
+	list, err := e.sessions.ListByUser(usr.Id)
+	if err != nil {
+		WriteInternalError(writer, err)
+		return
+	}
+
+	res := &sessionInfoListDTO{}
+	res.List = make([]*sessionInfoDTO, 0)
+	for _, s := range list {
+		res.List = append(res.List, newSessionInfoDTO(s, ses))
+	}
+	WriteJSONBody(writer, res)
+}
+
+// Every authenticated user can revoke his own sessions by their handle, see GET /me/sessions, but not the sessions of others.
+//  @Path DELETE /me/sessions/{handle}
+//  @Header sid string
+//	@Return 200
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token)
+//  @Return 404 (if the session does not exist or belongs to another user)
+//  @Return 500 (for any other error)
+func (e *EndpointMe) deleteSession(writer http.ResponseWriter, request *http.Request, handle db.PK) {
+	_, usr := CurrentSession(request)
+
+	//only the sessions of the user are found, so nothing is told about the sessions of others
+	other, err := e.sessions.GetByHandle(usr.Id, handle)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	err = e.sessions.Delete(other.Id)
+	if err != nil && !db.IsEntityNotFound(err) {
+		WriteInternalError(writer, err)
+		return
+	}
+
+	WriteOK(writer)
+}
+
+// Every authenticated user can log out everywhere, which revokes all of his sessions including the current one.
+//  @Path DELETE /me/sessions
+//  @Header sid string
+//	@Return 200
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token)
+//  @Return 500 (for any other error)
+func (e *EndpointMe) deleteSessions(writer http.ResponseWriter, request *http.Request) {
+	_, usr := CurrentSession(request)
+
+	_, err := e.sessions.DeleteByUser(usr.Id)
+	if err != nil {
+		WriteInternalError(writer, err)
+		return
+	}
+
+	expireSessionCookie(writer, request)
+	WriteOK(writer)
+}
@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"github.com/worldiety/devdrasil/backend/user"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestSelfUpdateEscalation(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	alice := env.addUser(t, "alice")
+	ses := env.login(t, alice)
+	path := "/users/" + alice.Id.String()
+
+	cases := []struct {
+		body   string
+		status int
+	}{
+		{`{"Firstname":"Alice"}`, http.StatusOK},
+		{`{"Active":false}`, http.StatusForbidden},
+		{`{"Groups":["` + alice.Id.String() + `"]}`, http.StatusForbidden},
+		{`{"Roles":["` + alice.Id.String() + `"]}`, http.StatusForbidden},
+		{`{"Company":"` + alice.Id.String() + `"}`, http.StatusForbidden},
+		{`{"ServiceAccount":true}`, http.StatusForbidden},
+		{`{"Password":"Other-Password2"}`, http.StatusForbidden},
+		{`{"Password":""}`, http.StatusOK},
+	}
+	for _, c := range cases {
+		if status := env.serve(newSessionRequest("PUT", path, c.body, ses)).Code; status != c.status {
+			t.Fatalf("%s: expected %d but got %d", c.body, c.status, status)
+		}
+	}
+
+	//the profile silently ignores everything else
+	recorder := env.serve(newSessionRequest("PUT", "/me", `{"Lastname":"Doe","Active":false,"Groups":["`+alice.Id.String()+`"],"ServiceAccount":true}`, ses))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, recorder.Code)
+	}
+	usr, err := env.users.Get(alice.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.Lastname != "Doe" || usr.Firstname != "Alice" || !usr.Active || len(usr.Groups) != 0 || usr.ServiceAccount || !usr.PasswordEquals("Secret-Password1") {
+		t.Fatal(usr)
+	}
+
+	//with the permission, the password can be set and the other sessions are revoked
+	perm, err := env.permissions.Get(user.UPDATE_USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perm.AllowedUsers = append(perm.AllowedUsers, alice.Id)
+	if err := env.permissions.Update(perm); err != nil {
+		t.Fatal(err)
+	}
+	other := env.login(t, alice)
+	if status := env.serve(newSessionRequest("PUT", path, `{"Password":"Other-Password2"}`, ses)).Code; status != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, status)
+	}
+	if _, err := env.sessions.Get(other.Id); err == nil {
+		t.Fatal("expected that the other session is revoked")
+	}
+}
@@ -0,0 +1,212 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"github.com/worldiety/devdrasil/log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//WithRequestId assigns a request id to each request, e.g. to find the log entry of an internal error. A valid id of a
+//reverse proxy is kept.
+func WithRequestId(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(RequestIdHeader)
+		if !isValidRequestId(id) {
+			id = newRequestId()
+			request.Header.Set(RequestIdHeader, id)
+		}
+		writer.Header().Set(RequestIdHeader, id)
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+//Recover turns a panic of a handler into a 500, instead of dropping the connection
+func Recover(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			if r := recover(); r != nil {
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				WriteInternalError(writer, fmt.Errorf("panic: %v", r))
+			}
+		}()
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+//remembers the status code for the log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+//keeps streaming responses working, e.g. of the plugin proxy
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+//LogRequests logs method, path, status and duration of each request
+func LogRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+		handler.ServeHTTP(recorder, request)
+		log.Default.Info(log.New("request").Put("method", request.Method).Put("path", request.URL.Path).Put("status", recorder.status).Put("duration", time.Since(start).String()).Put("request", writer.Header().Get(RequestIdHeader)))
+	})
+}
+
+//CORS allows browsers of the given origins to call the api. A preflight request is answered directly. An empty list
+//disables cross origin requests and * allows any origin, but only without credentials, so that a foreign site cannot
+//use the session cookie of the browser. Such a site must authenticate by the sid header or an api token.
+func CORS(origins []string) Middleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			origin := request.Header.Get("Origin")
+			if origin == "" {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+
+			header := writer.Header()
+			switch {
+			case isAllowedOrigin(origins, origin):
+				header.Set("Access-Control-Allow-Origin", origin)
+				header.Set("Access-Control-Allow-Credentials", "true")
+				header.Add("Vary", "Origin")
+			case isAllowedOrigin(origins, "*"):
+				header.Set("Access-Control-Allow-Origin", "*")
+			default:
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			header.Set("Access-Control-Expose-Headers", RequestIdHeader)
+
+			if request.Method == "OPTIONS" && request.Header.Get("Access-Control-Request-Method") != "" {
+				header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+				header.Set("Access-Control-Allow-Headers", strings.Join([]string{"Content-Type", "Authorization", "sid", CSRFHeader, RequestIdHeader}, ", "))
+				header.Set("Access-Control-Max-Age", "600")
+				writer.WriteHeader(http.StatusNoContent)
+				return
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+func isAllowedOrigin(origins []string, origin string) bool {
+	for _, o := range origins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+//HSTS tells browsers to use only https for the max age, see Strict-Transport-Security. The header is only sent with
+//https responses, because a browser ignores it otherwise.
+func HSTS(maxAge time.Duration, includeSubdomains bool) Middleware {
+	value := "max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.TLS != nil {
+				writer.Header().Set("Strict-Transport-Security", value)
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+//RedirectToHTTPS redirects each plain http request to the same url at the https port, which is omitted if it is 443
+func RedirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		host := request.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			//an ipv6 address
+			host = "[" + host + "]"
+		}
+		target := url.URL{Scheme: "https", Host: host, Path: request.URL.Path, RawQuery: request.URL.RawQuery}
+		http.Redirect(writer, request, target.String(), http.StatusPermanentRedirect)
+	})
+}
+
+//Authenticated rejects requests without a valid session, see GetSessionAndUser. The handler gets both by CurrentSession.
+func Authenticated(sessions *session.Sessions, users *user.Users) Middleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			ses, usr := GetSessionAndUser(sessions, users, writer, request)
+			if usr == nil {
+				return
+			}
+			handler.ServeHTTP(writer, withSession(request, ses, usr))
+		})
+	}
+}
+
+//Interactive is like Authenticated but rejects api tokens. The self-service and credential routes are not restricted
+//by any permission, so the scopes of a token cannot limit them and e.g. a leaked token must not change the password.
+func Interactive(sessions *session.Sessions, users *user.Users) Middleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			ses, usr := GetSessionAndUser(sessions, users, writer, request)
+			if usr == nil {
+				return
+			}
+			if ses.Token != nil {
+				WriteError(writer, http.StatusForbidden, "api tokens are not allowed, please login")
+				return
+			}
+			handler.ServeHTTP(writer, withSession(request, ses, usr))
+		})
+	}
+}
+
+//Permitted is like Authenticated but also requires the global permission kind, see validate
+func Permitted(sessions *session.Sessions, users *user.Users, permissions *user.Permissions, kind db.PK) Middleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			ses, usr := validate(sessions, users, permissions, writer, request, kind)
+			if usr == nil {
+				return
+			}
+			handler.ServeHTTP(writer, withSession(request, ses, usr))
+		})
+	}
+}
+
+func withSession(request *http.Request, ses *session.Session, usr *user.User) *http.Request {
+	ctx := context.WithValue(request.Context(), sessionKey, ses)
+	ctx = context.WithValue(ctx, userKey, usr)
+	return request.WithContext(ctx)
+}
+
+//returns the session and the user, which have been authenticated by a middleware, or nil
+func CurrentSession(request *http.Request) (*session.Session, *user.User) {
+	ses, _ := request.Context().Value(sessionKey).(*session.Session)
+	usr, _ := request.Context().Value(userKey).(*user.User)
+	return ses, usr
+}
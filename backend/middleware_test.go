@@ -0,0 +1,34 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
+	cases := []struct {
+		origins     []string
+		origin      string
+		allowed     string
+		credentials string
+	}{
+		{nil, "https://evil.com", "", ""},
+		{[]string{"https://app.com"}, "https://evil.com", "", ""},
+		{[]string{"https://app.com"}, "https://app.com", "https://app.com", "true"},
+		{[]string{"*"}, "https://evil.com", "*", ""},
+		{[]string{"*", "https://app.com"}, "https://app.com", "https://app.com", "true"},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest("GET", "/users", nil)
+		request.Header.Set("Origin", c.origin)
+		recorder := httptest.NewRecorder()
+		CORS(c.origins)(ok).ServeHTTP(recorder, request)
+
+		header := recorder.Header()
+		if header.Get("Access-Control-Allow-Origin") != c.allowed || header.Get("Access-Control-Allow-Credentials") != c.credentials {
+			t.Fatalf("%v %s: unexpected %v", c.origins, c.origin, header)
+		}
+	}
+}
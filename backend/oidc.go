@@ -0,0 +1,227 @@
+package backend
+
+import (
+	"net/http"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/backend/oidc"
+	"github.com/worldiety/devdrasil/db"
+	"github.com/worldiety/devdrasil/log"
+	"sync"
+	"time"
+)
+
+//the cookie which binds a pending login to the browser, which started it
+const oidcStateCookie = "oidc_state"
+
+//the amount of time, a user has to authenticate at the issuer
+const oidcLoginTimeout = 10 * time.Minute
+
+//the maximum amount of pending logins, because everybody can start a login and each one is remembered
+const oidcMaxPending = 10000
+
+//the remembered parameters of a login, which has been redirected to the issuer
+type pendingLogin struct {
+	nonce     string
+	verifier  string
+	createdAt time.Time
+}
+
+//The OpenID Connect endpoints, which implement the authorization code flow with PKCE and just-in-time provisioning of users.
+type EndpointOIDC struct {
+	router   *Router
+	sessions *session.Sessions
+	users    *user.Users
+	groups   *group.Groups
+	provider *oidc.Provider
+
+	//the tenant of provisioned users, nil for no company
+	company *db.PK
+
+	mutex   sync.Mutex
+	pending map[string]*pendingLogin
+}
+
+func NewEndpointOIDC(router *Router, sessions *session.Sessions, users *user.Users, groups *group.Groups, provider *oidc.Provider, company *db.PK) *EndpointOIDC {
+	endpoint := &EndpointOIDC{router: router, sessions: sessions, users: users, groups: groups, provider: provider, company: company, pending: make(map[string]*pendingLogin)}
+	router.Handle("GET", "/oidc/login", endpoint.login)
+	router.Handle("GET", "/oidc/callback", endpoint.callback)
+	return endpoint
+}
+
+// Everybody can start a login at the configured issuer. The user agent is redirected to the issuer.
+//  @Path GET /oidc/login
+//	@Return 302 (redirect to the authorization endpoint of the issuer)
+//  @Return 500 (if the issuer is not available)
+//  @Return 503 (if too many logins are pending)
+func (e *EndpointOIDC) login(writer http.ResponseWriter, request *http.Request) {
+	state := oidc.RandomString()
+	login := &pendingLogin{nonce: oidc.RandomString(), verifier: oidc.RandomString(), createdAt: time.Now()}
+
+	authURL, err := e.provider.AuthCodeURL(state, login.nonce, oidc.CodeChallenge(login.verifier))
+	if err != nil {
+		log.Default.Error(log.New("oidc issuer not available").SetError(err))
+		WriteError(writer, http.StatusInternalServerError, "identity provider not available")
+		return
+	}
+
+	e.mutex.Lock()
+	e.removeExpired()
+	full := len(e.pending) >= oidcMaxPending
+	if !full {
+		e.pending[state] = login
+	}
+	e.mutex.Unlock()
+
+	if full {
+		log.Default.Warn(log.New("too many pending oidc logins").Put("max", oidcMaxPending))
+		WriteError(writer, http.StatusServiceUnavailable, "too many pending logins")
+		return
+	}
+
+	//lax, because the issuer redirects back with a cross site top level navigation
+	http.SetCookie(writer, &http.Cookie{Name: oidcStateCookie, Value: state, Path: "/oidc/", MaxAge: int(oidcLoginTimeout.Seconds()), HttpOnly: true, Secure: isSecureRequest(request), SameSite: http.SameSiteLaxMode})
+	http.Redirect(writer, request, authURL, http.StatusFound)
+}
+
+// The issuer redirects back to this endpoint. The user is provisioned or updated from the claims, a session is created and the user agent is redirected to the root.
+//  @Path GET /oidc/callback
+//	@Return 302 (redirect to the root, with the session cookie)
+//  @Return 400 (if state or code are invalid)
+//  @Return 403 (if the user is inactive or the login is already taken by a local user)
+//  @Return 500 (for any other error)
+func (e *EndpointOIDC) callback(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if query.Get("error") != "" {
+		WriteError(writer, http.StatusForbidden, "identity provider rejected the login: "+query.Get("error"))
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := request.Cookie(oidcStateCookie)
+	if err != nil || cookie.Value != state {
+		WriteError(writer, http.StatusBadRequest, "invalid state")
+		return
+	}
+	http.SetCookie(writer, &http.Cookie{Name: oidcStateCookie, Value: "", Path: "/oidc/", MaxAge: -1, HttpOnly: true, Secure: isSecureRequest(request), SameSite: http.SameSiteLaxMode})
+
+	e.mutex.Lock()
+	login := e.pending[state]
+	delete(e.pending, state)
+	e.mutex.Unlock()
+
+	if login == nil || time.Since(login.createdAt) > oidcLoginTimeout {
+		WriteError(writer, http.StatusBadRequest, "invalid state")
+		return
+	}
+
+	claims, err := e.provider.Exchange(query.Get("code"), login.verifier, login.nonce)
+	if err != nil {
+		log.Default.Warn(log.New("oidc code exchange failed").SetError(err))
+		WriteError(writer, http.StatusBadRequest, "invalid code")
+		return
+	}
+
+	usr, err := e.provision(claims)
+	if err != nil {
+		if db.IsNotUnique(err) {
+			//a local user has the same login
+			WriteError(writer, http.StatusForbidden, "login already taken")
+		} else {
+			WriteInternalError(writer, err)
+		}
+		return
+	}
+
+	if !usr.Active {
+		WriteError(writer, http.StatusForbidden, "user is inactive")
+		return
+	}
+
+	_, err = createSession(e.sessions, writer, request, usr)
+	if err != nil {
+		WriteInternalError(writer, err)
+		return
+	}
+
+	http.Redirect(writer, request, "/", http.StatusFound)
+}
+
+//creates or updates the user from the claims. A new user belongs to the configured company. The user becomes a member
+//of the existing groups of his tenant, which are named in the groups claim, other names are ignored. Groups which have
+//been mapped before but are no longer claimed are removed, the locally assigned groups are kept.
+func (e *EndpointOIDC) provision(claims *oidc.Claims) (*user.User, error) {
+	usr, err := e.users.FindByExternalId(user.PROVIDER_OIDC, claims.Subject)
+	isNew := false
+	if err != nil {
+		if !db.IsEntityNotFound(err) {
+			return nil, err
+		}
+		isNew = true
+		usr = &user.User{Active: true, Provider: user.PROVIDER_OIDC, ExternalId: claims.Subject, Company: e.company}
+	}
+
+	usr.Login = claims.Login
+	//an unverified address may belong to somebody else
+	if usr.Login == "" && claims.EMailVerified {
+		usr.Login = claims.EMail
+	}
+	if usr.Login == "" {
+		usr.Login = claims.Subject
+	}
+	usr.Firstname = claims.Firstname
+	usr.Lastname = claims.Lastname
+	if claims.EMail != "" {
+		usr.EMailAddresses = []string{claims.EMail}
+	}
+
+	mapped := make([]db.PK, 0)
+	for _, name := range claims.Groups {
+		grp, err := e.groups.FindByName(name)
+		if err != nil {
+			if db.IsEntityNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		//the names are unique, but a group of another tenant must never be assigned
+		if !sameTenant(grp.Company, usr.Company) {
+			log.Default.Warn(log.New("ignoring oidc group of another tenant").Put("login", usr.Login).Put("group", name))
+			continue
+		}
+		mapped = append(mapped, grp.Id)
+	}
+
+	//keep the local groups, but replace those which have been mapped from the claims before
+	groups := make([]db.PK, 0)
+	for _, gid := range usr.Groups {
+		if !containsPK(usr.ProviderGroups, gid) && !containsPK(mapped, gid) {
+			groups = append(groups, gid)
+		}
+	}
+	usr.Groups = append(groups, mapped...)
+	usr.ProviderGroups = mapped
+
+	if isNew {
+		err = e.users.Add(usr)
+		if err == nil {
+			log.Default.Info(log.New("provisioned oidc user").Put("login", usr.Login).Put("subject", claims.Subject))
+		}
+	} else {
+		err = e.users.Update(usr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return usr, nil
+}
+
+//removes timed out logins, the caller must hold the mutex
+func (e *EndpointOIDC) removeExpired() {
+	for state, login := range e.pending {
+		if time.Since(login.createdAt) > oidcLoginTimeout {
+			delete(e.pending, state)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+//the allowed difference of clocks between us and the issuer, in seconds
+const clockSkew = 60
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type keySet struct {
+	Keys []*jwk `json:"keys"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+//returns the public key of the given key id, reloading the key set once, if the key is unknown (e.g. after a key rotation)
+func (p *Provider) getKey(kid string, doc *discovery) (*rsa.PublicKey, error) {
+	p.mutex.Lock()
+	keys := p.keys
+	p.mutex.Unlock()
+
+	if keys != nil {
+		if key := keys.find(kid); key != nil {
+			return key.publicKey()
+		}
+	}
+
+	keys = &keySet{}
+	err := p.getJSON(doc.JWKSURI, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	p.keys = keys
+	p.mutex.Unlock()
+
+	key := keys.find(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown key id '%s'", kid)
+	}
+	return key.publicKey()
+}
+
+func (s *keySet) find(kid string) *jwk {
+	for _, key := range s.Keys {
+		if key.Kid == kid && key.Kty == "RSA" {
+			return key
+		}
+	}
+	return nil
+}
+
+func (k *jwk) publicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+//verifies signature, issuer, audience and expiry of the given RS256 token and returns its claims
+func (p *Provider) verify(token string, doc *discovery) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed jwt")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	header := &jwtHeader{}
+	err = json.Unmarshal(headerBytes, header)
+	if err != nil {
+		return nil, err
+	}
+
+	//never accept 'none' or symmetric algorithms
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported jwt algorithm '%s'", header.Alg)
+	}
+
+	key, err := p.getKey(header.Kid, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt signature: %s", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	claims := make(map[string]interface{})
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); iss != p.config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch")
+	}
+
+	if !hasAudience(claims["aud"], p.config.ClientId) {
+		return nil, fmt.Errorf("audience mismatch")
+	}
+
+	now := time.Now().Unix()
+	exp, ok := claims["exp"].(float64)
+	if !ok || int64(exp)+clockSkew < now {
+		return nil, fmt.Errorf("token expired")
+	}
+
+	if iat, ok := claims["iat"].(float64); ok && int64(iat)-clockSkew > now {
+		return nil, fmt.Errorf("token issued in the future")
+	}
+
+	//the subject identifies the user, so a token without it would match any other token without it
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("missing subject")
+	}
+	return claims, nil
+}
+
+//the aud claim is either a single string or an array of strings
+func hasAudience(aud interface{}, clientId string) bool {
+	switch t := aud.(type) {
+	case string:
+		return t == clientId
+	case []interface{}:
+		for _, a := range t {
+			if a == clientId {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+//the key id of the mock signing key
+const mockKid = "mock"
+
+//A MockIssuer is a local identity provider for tests and development. It authorizes every request without any
+//user interaction and issues id tokens with the configured claims.
+type MockIssuer struct {
+	//the issuer url, e.g. http://127.0.0.1:34567
+	Issuer string
+
+	ClientId     string
+	ClientSecret string
+
+	//the claims of issued tokens, e.g. sub, preferred_username or groups. iss, aud, exp, iat and nonce are set automatically.
+	Claims map[string]interface{}
+
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	mutex  sync.Mutex
+	grants map[string]*mockGrant
+}
+
+type mockGrant struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+}
+
+//starts a new mock issuer on a random local port. Call Close when done.
+func NewMockIssuer(clientId string, clientSecret string) *MockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	m := &MockIssuer{ClientId: clientId, ClientSecret: clientSecret, Claims: make(map[string]interface{}), key: key, grants: make(map[string]*mockGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, m.handleDiscovery)
+	mux.HandleFunc("/authorize", m.handleAuthorize)
+	mux.HandleFunc("/token", m.handleToken)
+	mux.HandleFunc("/keys", m.handleKeys)
+	m.server = httptest.NewServer(mux)
+	m.Issuer = m.server.URL
+	return m
+}
+
+//stops the server
+func (m *MockIssuer) Close() {
+	m.server.Close()
+}
+
+func (m *MockIssuer) handleDiscovery(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, &discovery{Issuer: m.Issuer, AuthorizationEndpoint: m.Issuer + "/authorize", TokenEndpoint: m.Issuer + "/token", JWKSURI: m.Issuer + "/keys"})
+}
+
+func (m *MockIssuer) handleKeys(writer http.ResponseWriter, request *http.Request) {
+	pub := m.key.PublicKey
+	key := &jwk{Kid: mockKid, Kty: "RSA", Alg: "RS256", Use: "sig", N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()), E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())}
+	writeJSON(writer, &keySet{Keys: []*jwk{key}})
+}
+
+//authorizes immediately and redirects back with a code
+func (m *MockIssuer) handleAuthorize(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if query.Get("client_id") != m.ClientId || query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		http.Error(writer, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code := RandomString()
+	m.mutex.Lock()
+	m.grants[code] = &mockGrant{redirectURI: query.Get("redirect_uri"), nonce: query.Get("nonce"), codeChallenge: query.Get("code_challenge")}
+	m.mutex.Unlock()
+
+	values := url.Values{}
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	http.Redirect(writer, request, query.Get("redirect_uri")+"?"+values.Encode(), http.StatusFound)
+}
+
+func (m *MockIssuer) handleToken(writer http.ResponseWriter, request *http.Request) {
+	clientId, clientSecret, ok := request.BasicAuth()
+	if !ok || clientId != m.ClientId || clientSecret != m.ClientSecret {
+		writer.WriteHeader(http.StatusUnauthorized)
+		writeJSON(writer, &tokenResponse{Error: "invalid_client"})
+		return
+	}
+
+	err := request.ParseForm()
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writeJSON(writer, &tokenResponse{Error: "invalid_request"})
+		return
+	}
+
+	//a code can only be used once
+	code := request.PostForm.Get("code")
+	m.mutex.Lock()
+	grant := m.grants[code]
+	delete(m.grants, code)
+	m.mutex.Unlock()
+
+	if grant == nil || grant.redirectURI != request.PostForm.Get("redirect_uri") || CodeChallenge(request.PostForm.Get("code_verifier")) != grant.codeChallenge {
+		writer.WriteHeader(http.StatusBadRequest)
+		writeJSON(writer, &tokenResponse{Error: "invalid_grant"})
+		return
+	}
+
+	claims := make(map[string]interface{})
+	for k, v := range m.Claims {
+		claims[k] = v
+	}
+	now := time.Now().Unix()
+	claims["iss"] = m.Issuer
+	claims["aud"] = m.ClientId
+	claims["iat"] = now
+	claims["exp"] = now + 300
+	claims["nonce"] = grant.nonce
+
+	writeJSON(writer, &tokenResponse{AccessToken: RandomString(), TokenType: "Bearer", IDToken: m.sign(claims)})
+}
+
+//creates a RS256 signed jwt
+func (m *MockIssuer) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(&jwtHeader{Alg: "RS256", Kid: mockKid})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		panic(err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(writer http.ResponseWriter, obj interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(obj)
+}
@@ -0,0 +1,264 @@
+//Package oidc implements the authorization code flow with PKCE of OpenID Connect, as far as devdrasil requires it.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//the path below the issuer, where the discovery document is located
+const discoveryPath = "/.well-known/openid-configuration"
+
+type Config struct {
+	//the issuer url, e.g. https://login.mycompany.com/realms/main
+	Issuer string
+
+	//the client id, registered at the identity provider
+	ClientId string
+
+	//the client secret, registered at the identity provider
+	ClientSecret string
+
+	//the url of our callback endpoint, e.g. https://devdrasil.mycompany.com/oidc/callback
+	RedirectURL string
+
+	//additional scopes, openid is always requested
+	Scopes []string
+
+	//the claim which contains the login, e.g. preferred_username
+	LoginClaim string
+
+	//the claim which contains the list of group names, e.g. groups
+	GroupsClaim string
+}
+
+//the subset of the discovery document, see https://openid.net/specs/openid-connect-discovery-1_0.html
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+}
+
+//The verified claims of an id token
+type Claims struct {
+	//the unique and stable id of the user at the issuer
+	Subject string
+
+	//the login, taken from the configured login claim
+	Login string
+
+	//e.g. Torben
+	Firstname string
+
+	//e.g. Schinke
+	Lastname string
+
+	//the e-mail address, if any
+	EMail string
+
+	//true, if the issuer has verified, that the e-mail address belongs to the user
+	EMailVerified bool
+
+	//the group names, taken from the configured groups claim
+	Groups []string
+
+	//all raw claims
+	Raw map[string]interface{}
+}
+
+//A Provider talks to a single issuer. The discovery document and the keys are loaded lazily and cached.
+type Provider struct {
+	config *Config
+	client *http.Client
+
+	mutex     sync.Mutex
+	discovery *discovery
+	keys      *keySet
+}
+
+func NewProvider(config *Config) *Provider {
+	if config.LoginClaim == "" {
+		config.LoginClaim = "preferred_username"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	return &Provider{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+//returns the configuration of the provider
+func (p *Provider) Config() *Config {
+	return p.config
+}
+
+//loads the discovery document once
+func (p *Provider) getDiscovery() (*discovery, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	doc := &discovery{}
+	err := p.getJSON(strings.TrimSuffix(p.config.Issuer, "/")+discoveryPath, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: expected '%s' but discovered '%s'", p.config.Issuer, doc.Issuer)
+	}
+	p.discovery = doc
+	return doc, nil
+}
+
+func (p *Provider) getJSON(url string, obj interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(obj)
+}
+
+//returns the url to redirect the user agent to. State and nonce must be random and remembered, the challenge is derived from the verifier.
+func (p *Provider) AuthCodeURL(state string, nonce string, codeChallenge string) (string, error) {
+	doc, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	scopes := append([]string{"openid"}, p.config.Scopes...)
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", p.config.ClientId)
+	values.Set("redirect_uri", p.config.RedirectURL)
+	values.Set("scope", strings.Join(scopes, " "))
+	values.Set("state", state)
+	values.Set("nonce", nonce)
+	values.Set("code_challenge", codeChallenge)
+	values.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + values.Encode(), nil
+}
+
+//exchanges the authorization code for an id token and returns its verified claims
+func (p *Provider) Exchange(code string, codeVerifier string, nonce string) (*Claims, error) {
+	doc, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", p.config.RedirectURL)
+	values.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest("POST", doc.TokenEndpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientId), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &tokenResponse{}
+	err = json.Unmarshal(body, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s %s", resp.Status, token.Error)
+	}
+
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("token response contains no id_token")
+	}
+
+	raw, err := p.verify(token.IDToken, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if tmp, _ := raw["nonce"].(string); tmp != nonce {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+
+	return p.newClaims(raw), nil
+}
+
+//maps the raw claims according to the configuration
+func (p *Provider) newClaims(raw map[string]interface{}) *Claims {
+	claims := &Claims{Raw: raw}
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Login, _ = raw[p.config.LoginClaim].(string)
+	claims.Firstname, _ = raw["given_name"].(string)
+	claims.Lastname, _ = raw["family_name"].(string)
+	claims.EMail, _ = raw["email"].(string)
+	claims.EMailVerified, _ = raw["email_verified"].(bool)
+
+	switch groups := raw[p.config.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if name, ok := g.(string); ok {
+				claims.Groups = append(claims.Groups, name)
+			}
+		}
+	case string:
+		claims.Groups = []string{groups}
+	}
+	return claims
+}
+
+//creates a random and url safe string, e.g. for state, nonce and pkce verifier
+func RandomString() string {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+//calculates the S256 pkce code challenge of the given verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package oidc
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	issuer := NewMockIssuer("devdrasil", "secret")
+	defer issuer.Close()
+	issuer.Claims["sub"] = "1234"
+	issuer.Claims["preferred_username"] = "tschinke"
+	issuer.Claims["given_name"] = "Torben"
+	issuer.Claims["groups"] = []string{"developers", "admins"}
+
+	provider := NewProvider(&Config{Issuer: issuer.Issuer, ClientId: "devdrasil", ClientSecret: "secret", RedirectURL: "http://localhost/oidc/callback"})
+
+	state := RandomString()
+	nonce := RandomString()
+	verifier := RandomString()
+	code := authorize(t, provider, state, nonce, verifier)
+
+	claims, err := provider.Exchange(code, verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != "1234" || claims.Login != "tschinke" || claims.Firstname != "Torben" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	if len(claims.Groups) != 2 || claims.Groups[0] != "developers" {
+		t.Fatalf("unexpected groups %v", claims.Groups)
+	}
+
+	//a code must not be usable twice
+	_, err = provider.Exchange(code, verifier, nonce)
+	if err == nil {
+		t.Fatal("expected error for reused code")
+	}
+}
+
+func TestRejectsWrongVerifierAndNonce(t *testing.T) {
+	issuer := NewMockIssuer("devdrasil", "secret")
+	defer issuer.Close()
+	issuer.Claims["sub"] = "1234"
+
+	provider := NewProvider(&Config{Issuer: issuer.Issuer, ClientId: "devdrasil", ClientSecret: "secret", RedirectURL: "http://localhost/oidc/callback"})
+
+	code := authorize(t, provider, "state", "nonce", "verifier")
+	_, err := provider.Exchange(code, "other verifier", "nonce")
+	if err == nil {
+		t.Fatal("expected error for wrong pkce verifier")
+	}
+
+	code = authorize(t, provider, "state", "nonce", "verifier")
+	_, err = provider.Exchange(code, "verifier", "other nonce")
+	if err == nil {
+		t.Fatal("expected error for wrong nonce")
+	}
+}
+
+func TestRejectsMissingSubject(t *testing.T) {
+	issuer := NewMockIssuer("devdrasil", "secret")
+	defer issuer.Close()
+	issuer.Claims["email"] = "alice@example.com"
+
+	provider := NewProvider(&Config{Issuer: issuer.Issuer, ClientId: "devdrasil", ClientSecret: "secret", RedirectURL: "http://localhost/oidc/callback"})
+
+	code := authorize(t, provider, "state", "nonce", "verifier")
+	_, err := provider.Exchange(code, "verifier", "nonce")
+	if err == nil {
+		t.Fatal("expected error for missing subject")
+	}
+}
+
+//performs the redirect to the issuer and returns the code of the callback
+func authorize(t *testing.T, provider *Provider, state string, nonce string, verifier string) string {
+	authURL, err := provider.AuthCodeURL(state, nonce, CodeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if callback.Query().Get("state") != state {
+		t.Fatalf("state mismatch")
+	}
+	return callback.Query().Get("code")
+}
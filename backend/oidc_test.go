@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/backend/oidc"
+	"github.com/worldiety/devdrasil/db"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestProvisionWithinTenant(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	company := db.NewPK("acme")
+	other := db.NewPK("other")
+	groups := group.NewGroups(db.Open(env.dir))
+	developers := &group.Group{Name: "developers", Company: &company}
+	operators := &group.Group{Name: "operators", Company: &other}
+	testers := &group.Group{Name: "testers", Company: &company}
+	for _, grp := range []*group.Group{developers, operators, testers} {
+		if err := groups.Add(grp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	endpoint := NewEndpointOIDC(NewRouter(http.NewServeMux()), env.sessions, env.users, groups, oidc.NewProvider(&oidc.Config{}), &company)
+	usr, err := endpoint.provision(&oidc.Claims{Subject: "1234", Login: "alice", Groups: []string{"developers", "operators", "unknown"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.Company == nil || *usr.Company != company {
+		t.Fatal(usr.Company)
+	}
+	if len(usr.Groups) != 1 || usr.Groups[0] != developers.Id {
+		t.Fatal(usr.Groups)
+	}
+
+	//a locally assigned group survives the next login, but a group which is no longer claimed is removed
+	usr.Groups = append(usr.Groups, testers.Id)
+	if err := env.users.Update(usr); err != nil {
+		t.Fatal(err)
+	}
+	usr, err = endpoint.provision(&oidc.Claims{Subject: "1234", Login: "alice", Groups: []string{"unknown"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usr.Groups) != 1 || usr.Groups[0] != testers.Id {
+		t.Fatal(usr.Groups)
+	}
+
+	//only a verified address is used as login
+	for _, verified := range []bool{false, true} {
+		claims := &oidc.Claims{Subject: "5678", EMail: "bob@example.com", EMailVerified: verified}
+		usr, err := endpoint.provision(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (usr.Login == claims.EMail) != verified {
+			t.Fatal(usr.Login)
+		}
+	}
+}
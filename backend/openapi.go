@@ -0,0 +1,30 @@
+package backend
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//the document is generated from the annotations of the handlers, see the openapi command
+//go:generate go run .. openapi -module .. -out openapi.json
+//go:embed openapi.json
+var openAPIDocument []byte
+
+//Serves the OpenAPI document of the endpoints
+type EndpointOpenAPI struct {
+	router *Router
+}
+
+func NewEndpointOpenAPI(router *Router) *EndpointOpenAPI {
+	endpoint := &EndpointOpenAPI{router: router}
+	router.Handle("GET", "/openapi.json", endpoint.getDocument)
+	return endpoint
+}
+
+// Everybody can download the OpenAPI 3 document of the api.
+//  @Path GET /openapi.json
+//	@Return 200 (the OpenAPI document)
+func (e *EndpointOpenAPI) getDocument(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(openAPIDocument)
+}
@@ -0,0 +1,297 @@
+package openapi
+
+import (
+	"fmt"
+	"go/ast"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//the import path of the module, which is resolved relative to the module directory
+const Module = "github.com/worldiety/devdrasil"
+
+//the http methods, which are documented for a handler of any method
+var anyMethods = []string{"get", "post", "put", "delete"}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+//Generate parses the annotated handlers of the package and emits a document. The annotations are
+//  @Path METHOD /path/{param}?query={value} (remark)
+//  @Header name type (remark)
+//  @Body type
+//  @Return code type or (remark)
+//where a type is the full qualified name of a struct, e.g. []github.com/worldiety/devdrasil/backend/userDTO.
+//The method * documents a handler for any method. A GET has no request body, so its @Body documents the response.
+func Generate(moduleDir string, pkgPath string) (*Document, error) {
+	ld := newLoader(moduleDir, pkgPath)
+	pkg, err := ld.load(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		OpenAPI:    "3.0.3",
+		Info:       Info{Title: "devdrasil", Description: "Generated from the annotations of the endpoints", Version: "1"},
+		Paths:      make(map[string]PathItem),
+		Components: Components{Schemas: ld.schemas},
+	}
+
+	for _, fun := range pkg.funcs {
+		anno, err := parseAnnotation(fun)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ld.fset.Position(fun.Pos()), err)
+		}
+		if anno == nil {
+			continue
+		}
+
+		methods := []string{strings.ToLower(anno.method)}
+		if anno.method == "*" {
+			methods = anyMethods
+		}
+		for _, method := range methods {
+			op, err := anno.operation(ld, method)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", ld.fset.Position(fun.Pos()), err)
+			}
+			if anno.method == "*" {
+				op.OperationId += "." + method
+			}
+
+			item := doc.Paths[anno.path]
+			if item == nil {
+				item = make(PathItem)
+				doc.Paths[anno.path] = item
+			}
+			if item[method] != nil {
+				return nil, fmt.Errorf("%s: %s %s is already annotated by %s", ld.fset.Position(fun.Pos()), anno.method, anno.path, item[method].OperationId)
+			}
+			item[method] = op
+		}
+	}
+	return doc, nil
+}
+
+//a parsed @Return
+type returnAnnotation struct {
+	code   string
+	typ    string
+	remark string
+}
+
+//a parsed @Header
+type headerAnnotation struct {
+	name   string
+	remark string
+}
+
+//the annotations of a handler
+type annotation struct {
+	id          string
+	tag         string
+	summary     string
+	description string
+
+	method     string
+	path       string
+	pathRemark string
+	query      []string
+	headers    []headerAnnotation
+	body       string
+	returns    []returnAnnotation
+}
+
+//returns nil, if the function has no @Path
+func parseAnnotation(fun *ast.FuncDecl) (*annotation, error) {
+	if fun.Doc == nil {
+		return nil, nil
+	}
+
+	anno := &annotation{id: fun.Name.Name}
+	if fun.Recv != nil && len(fun.Recv.List) == 1 {
+		recv := fun.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		if ident, ok := recv.(*ast.Ident); ok {
+			anno.tag = strings.TrimPrefix(ident.Name, "Endpoint")
+			anno.id = anno.tag + "." + anno.id
+		}
+	}
+
+	text := make([]string, 0)
+	for _, line := range strings.Split(fun.Doc.Text(), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "@") {
+			if line != "" {
+				text = append(text, line)
+			}
+			continue
+		}
+
+		keyword, rest := cut(line)
+		switch keyword {
+		case "@Path":
+			anno.method, rest = cut(rest)
+			anno.path, anno.pathRemark = cut(rest)
+			if idx := strings.Index(anno.path, "?"); idx >= 0 {
+				for _, param := range strings.Split(anno.path[idx+1:], "&") {
+					anno.query = append(anno.query, strings.SplitN(param, "=", 2)[0])
+				}
+				anno.path = anno.path[:idx]
+			}
+		case "@Header":
+			name, remark := cut(rest)
+			_, remark = cut(remark)
+			anno.headers = append(anno.headers, headerAnnotation{name: name, remark: remark})
+		case "@Body":
+			anno.body = rest
+		case "@Return":
+			code, rest := cut(rest)
+			ret := returnAnnotation{code: code}
+			if strings.HasPrefix(rest, "(") {
+				ret.remark = rest
+			} else {
+				ret.typ = rest
+			}
+			anno.returns = append(anno.returns, ret)
+		default:
+			return nil, fmt.Errorf("unknown annotation %s", keyword)
+		}
+	}
+
+	if anno.method == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(anno.path, "/") {
+		return nil, fmt.Errorf("invalid @Path %s %s", anno.method, anno.path)
+	}
+
+	anno.description = strings.Join(text, "\n")
+	anno.summary = anno.description
+	if idx := strings.Index(anno.summary, ". "); idx >= 0 {
+		anno.summary = anno.summary[:idx+1]
+	}
+	if idx := strings.Index(anno.summary, "\n"); idx >= 0 {
+		anno.summary = anno.summary[:idx]
+	}
+	if anno.pathRemark != "" {
+		anno.description += "\n" + unwrap(anno.pathRemark)
+	}
+	return anno, nil
+}
+
+func (a *annotation) operation(ld *loader, method string) (*Operation, error) {
+	op := &Operation{OperationId: a.id, Summary: a.summary, Description: a.description, Responses: make(map[string]*Response)}
+	if a.tag != "" {
+		op.Tags = []string{a.tag}
+	}
+
+	for _, match := range pathParamPattern.FindAllStringSubmatch(a.path, -1) {
+		op.Parameters = append(op.Parameters, &Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	for _, name := range a.query {
+		op.Parameters = append(op.Parameters, &Parameter{Name: name, In: "query", Schema: &Schema{Type: "string"}})
+	}
+	for _, header := range a.headers {
+		op.Parameters = append(op.Parameters, &Parameter{Name: header.name, In: "header", Description: unwrap(header.remark), Schema: &Schema{Type: "string"}})
+	}
+
+	bodyIsResponse := method == "get"
+	if a.body != "" && !bodyIsResponse {
+		schema, err := ld.annotatedSchema(a.body)
+		if err != nil {
+			return nil, err
+		}
+		op.RequestBody = &RequestBody{Content: jsonContent(schema), Required: true}
+	}
+
+	for _, ret := range a.returns {
+		code := ret.code
+		if code == "*" {
+			code = "default"
+		} else if _, err := strconv.Atoi(code); err != nil {
+			return nil, fmt.Errorf("invalid @Return code %s", code)
+		}
+
+		res := &Response{Description: unwrap(ret.remark)}
+		typ := ret.typ
+		if typ == "" && code == "200" && bodyIsResponse {
+			typ = a.body
+		}
+		if typ != "" {
+			schema, err := ld.annotatedSchema(typ)
+			if err != nil {
+				return nil, err
+			}
+			res.Content = jsonContent(schema)
+		}
+		if res.Description == "" {
+			status, _ := strconv.Atoi(code)
+			res.Description = http.StatusText(status)
+		}
+		if res.Description == "" {
+			res.Description = "any response"
+		}
+		op.Responses[code] = res
+	}
+	if len(op.Responses) == 0 {
+		return nil, fmt.Errorf("no @Return for %s %s", a.method, a.path)
+	}
+	return op, nil
+}
+
+//resolves a type like []github.com/worldiety/devdrasil/backend/userDTO
+func (l *loader) annotatedSchema(typ string) (*Schema, error) {
+	if strings.HasPrefix(typ, "[]") {
+		items, err := l.annotatedSchema(typ[2:])
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	}
+
+	idx := strings.LastIndex(typ, "/")
+	if idx < 0 {
+		return nil, fmt.Errorf("type %s is not full qualified", typ)
+	}
+	return l.named(typ[:idx], typ[idx+1:])
+}
+
+//the paths of the annotations use the names of the router but not its types, e.g. /users/{id} for /users/{id:pk}
+func PathOf(pattern string) string {
+	return pathParamPattern.ReplaceAllStringFunc(pattern, func(param string) string {
+		if idx := strings.Index(param, ":"); idx >= 0 {
+			return param[:idx] + "}"
+		}
+		return param
+	})
+}
+
+func jsonContent(schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: schema}}
+}
+
+//splits at the first space
+func cut(str string) (string, string) {
+	str = strings.TrimSpace(str)
+	if idx := strings.IndexAny(str, " \t"); idx >= 0 {
+		return str[:idx], strings.TrimSpace(str[idx+1:])
+	}
+	return str, ""
+}
+
+//removes the parentheses of a remark
+func unwrap(remark string) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(remark, "("), ")"))
+}
+
+//sorts the functions by their position, so that the document does not depend on the order of the files
+func sortFuncs(funcs []*ast.FuncDecl) {
+	sort.Slice(funcs, func(i, j int) bool {
+		return funcs[i].Pos() < funcs[j].Pos()
+	})
+}
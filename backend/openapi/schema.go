@@ -0,0 +1,288 @@
+package openapi
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//a parsed package of the module
+type goPackage struct {
+	types map[string]*typeDecl
+	funcs []*ast.FuncDecl
+}
+
+//a type declaration together with the imports of its file
+type typeDecl struct {
+	pkgPath string
+	spec    *ast.TypeSpec
+	imports map[string]string
+}
+
+//parses the packages of the module on demand and collects the schemas of the structs
+type loader struct {
+	moduleDir string
+	rootPath  string
+	fset      *token.FileSet
+	packages  map[string]*goPackage
+	schemas   map[string]*Schema
+}
+
+func newLoader(moduleDir string, rootPath string) *loader {
+	return &loader{moduleDir: moduleDir, rootPath: rootPath, fset: token.NewFileSet(), packages: make(map[string]*goPackage), schemas: make(map[string]*Schema)}
+}
+
+func (l *loader) load(pkgPath string) (*goPackage, error) {
+	if pkg := l.packages[pkgPath]; pkg != nil {
+		return pkg, nil
+	}
+	if pkgPath != Module && !strings.HasPrefix(pkgPath, Module+"/") {
+		return nil, fmt.Errorf("package %s is not part of %s", pkgPath, Module)
+	}
+
+	dir := filepath.Join(l.moduleDir, filepath.FromSlash(strings.TrimPrefix(pkgPath, Module)))
+	parsed, err := parser.ParseDir(l.fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &goPackage{types: make(map[string]*typeDecl)}
+	for _, astPkg := range parsed {
+		for _, file := range astPkg.Files {
+			imports := make(map[string]string)
+			for _, imp := range file.Imports {
+				impPath, _ := strconv.Unquote(imp.Path.Value)
+				name := path.Base(impPath)
+				if imp.Name != nil {
+					name = imp.Name.Name
+				}
+				imports[name] = impPath
+			}
+
+			for _, decl := range file.Decls {
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					pkg.funcs = append(pkg.funcs, decl)
+				case *ast.GenDecl:
+					for _, spec := range decl.Specs {
+						if spec, ok := spec.(*ast.TypeSpec); ok {
+							pkg.types[spec.Name.Name] = &typeDecl{pkgPath: pkgPath, spec: spec, imports: imports}
+						}
+					}
+				}
+			}
+		}
+	}
+	sortFuncs(pkg.funcs)
+	l.packages[pkgPath] = pkg
+	return pkg, nil
+}
+
+//returns a reference for a struct or the inlined schema of any other named type
+func (l *loader) named(pkgPath string, name string) (*Schema, error) {
+	switch pkgPath + "." + name {
+	case Module + "/db.PK":
+		return &Schema{Type: "string", Format: "hex", Description: "a hex encoded primary key"}, nil
+	case "time.Time":
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case "time.Duration":
+		return &Schema{Type: "integer", Format: "int64", Description: "nanoseconds"}, nil
+	case "encoding/json.RawMessage":
+		return &Schema{}, nil
+	}
+	if !strings.HasPrefix(pkgPath, Module+"/") {
+		//e.g. an interface of the standard library
+		return &Schema{}, nil
+	}
+
+	decl, err := l.decl(pkgPath, name)
+	if err != nil {
+		return nil, err
+	}
+	structType, ok := decl.spec.Type.(*ast.StructType)
+	if !ok {
+		return l.schema(decl, decl.spec.Type)
+	}
+
+	key := name
+	if pkgPath != l.rootPath {
+		key = path.Base(pkgPath) + "." + name
+	}
+	ref := &Schema{Ref: "#/components/schemas/" + key}
+	if l.schemas[key] != nil {
+		return ref, nil
+	}
+
+	//register before the fields are resolved, so that recursive types terminate
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	l.schemas[key] = schema
+	if err := l.fields(decl, structType, schema.Properties); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+func (l *loader) decl(pkgPath string, name string) (*typeDecl, error) {
+	pkg, err := l.load(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+	decl := pkg.types[name]
+	if decl == nil {
+		return nil, fmt.Errorf("type %s not found in %s", name, pkgPath)
+	}
+	return decl, nil
+}
+
+//collects the json properties of the struct, the fields of embedded structs are inlined like encoding/json does
+func (l *loader) fields(decl *typeDecl, structType *ast.StructType, properties map[string]*Schema) error {
+	for _, field := range structType.Fields.List {
+		name := ""
+		if field.Tag != nil {
+			tag, _ := strconv.Unquote(field.Tag.Value)
+			name = strings.Split(reflect.StructTag(tag).Get("json"), ",")[0]
+		}
+		if name == "-" {
+			continue
+		}
+
+		if len(field.Names) == 0 && name == "" {
+			embedded, err := l.embedded(decl, field.Type)
+			if err != nil {
+				return err
+			}
+			if embedded != nil {
+				if err := l.fields(embedded, embedded.spec.Type.(*ast.StructType), properties); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		names := make([]string, 0)
+		for _, ident := range field.Names {
+			if ident.IsExported() {
+				names = append(names, ident.Name)
+			}
+		}
+		if len(field.Names) == 0 {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			continue
+		}
+
+		schema, err := l.schema(decl, field.Type)
+		if err != nil {
+			return err
+		}
+		if doc := strings.TrimSpace(field.Doc.Text()); doc != "" && schema.Ref == "" {
+			copied := *schema
+			copied.Description = doc
+			schema = &copied
+		}
+		for _, fieldName := range names {
+			if name != "" {
+				fieldName = name
+			}
+			properties[fieldName] = schema
+		}
+	}
+	return nil
+}
+
+//returns the declaration of an embedded struct or nil, if it is not a struct of the module
+func (l *loader) embedded(decl *typeDecl, expr ast.Expr) (*typeDecl, error) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+
+	pkgPath, name := "", ""
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		pkgPath, name = decl.pkgPath, expr.Name
+	case *ast.SelectorExpr:
+		pkgIdent, ok := expr.X.(*ast.Ident)
+		if !ok {
+			return nil, nil
+		}
+		pkgPath, name = decl.imports[pkgIdent.Name], expr.Sel.Name
+	default:
+		return nil, nil
+	}
+	if !strings.HasPrefix(pkgPath, Module+"/") {
+		return nil, nil
+	}
+
+	embedded, err := l.decl(pkgPath, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := embedded.spec.Type.(*ast.StructType); !ok {
+		return nil, nil
+	}
+	return embedded, nil
+}
+
+//the schema of a type expression in the context of the declaration
+func (l *loader) schema(decl *typeDecl, expr ast.Expr) (*Schema, error) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		switch expr.Name {
+		case "string":
+			return &Schema{Type: "string"}, nil
+		case "bool":
+			return &Schema{Type: "boolean"}, nil
+		case "int", "int8", "int16", "int32", "uint", "uint8", "uint16", "uint32", "byte", "rune":
+			return &Schema{Type: "integer"}, nil
+		case "int64", "uint64":
+			return &Schema{Type: "integer", Format: "int64"}, nil
+		case "float32", "float64":
+			return &Schema{Type: "number"}, nil
+		case "error", "any":
+			return &Schema{}, nil
+		}
+		return l.named(decl.pkgPath, expr.Name)
+	case *ast.SelectorExpr:
+		pkgIdent, ok := expr.X.(*ast.Ident)
+		if !ok || decl.imports[pkgIdent.Name] == "" {
+			return nil, fmt.Errorf("cannot resolve %s in %s", expr.Sel.Name, decl.pkgPath)
+		}
+		return l.named(decl.imports[pkgIdent.Name], expr.Sel.Name)
+	case *ast.StarExpr:
+		return l.schema(decl, expr.X)
+	case *ast.ArrayType:
+		if ident, ok := expr.Elt.(*ast.Ident); ok && ident.Name == "byte" && expr.Len == nil {
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := l.schema(decl, expr.Elt)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	case *ast.MapType:
+		values, err := l.schema(decl, expr.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case *ast.StructType:
+		schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		if err := l.fields(decl, expr, schema.Properties); err != nil {
+			return nil, err
+		}
+		return schema, nil
+	default:
+		//interfaces, functions and channels are not described
+		return &Schema{}, nil
+	}
+}
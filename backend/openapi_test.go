@@ -0,0 +1,103 @@
+package backend
+
+import (
+	"bytes"
+	"github.com/worldiety/devdrasil/backend/audit"
+	"github.com/worldiety/devdrasil/backend/bulk"
+	"github.com/worldiety/devdrasil/backend/company"
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/backend/invite"
+	"github.com/worldiety/devdrasil/backend/mail"
+	"github.com/worldiety/devdrasil/backend/oidc"
+	"github.com/worldiety/devdrasil/backend/openapi"
+	"github.com/worldiety/devdrasil/backend/plugin"
+	"github.com/worldiety/devdrasil/backend/store"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//registers all endpoints like the server does
+func newTestRouter(t *testing.T, dir string) *Router {
+	d := db.Open(dir)
+	users, err := user.NewUsers(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	permissions, err := user.NewPermissions(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := session.NewSessions(d)
+	groups := group.NewGroups(d)
+	roles := user.NewRoles(d)
+	grants := user.NewGrants(d)
+	companies := company.NewCompanies(d)
+	pluginTenants := plugin.NewTenants(filepath.Join(dir, "plugins"), plugin.DefaultPortMin, plugin.DefaultPortMax)
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := NewRouter(http.NewServeMux())
+	NewEndpointUsers(router, sessions, users, permissions, grants, auditLog)
+	NewEndpointSessions(router, sessions, users)
+	NewEndpointGroups(router, sessions, users, permissions, groups, grants, auditLog)
+	NewEndpointCompanies(router, sessions, users, permissions, companies, grants, auditLog)
+	NewEndpointStore(router, sessions, users, permissions, pluginTenants, store.NewStore(store.DefaultIndexURL), auditLog)
+	NewEndpointMe(router, sessions, users)
+	NewEndpointTokens(router, sessions, users, permissions)
+	NewEndpointRoles(router, sessions, users, permissions, groups, roles, grants, auditLog)
+	NewEndpointGrants(router, sessions, users, permissions, groups, companies, roles, grants, auditLog)
+	NewEndpointPermissions(router, sessions, users, permissions, auditLog)
+	NewEndpointPluginProxy(router, sessions, users, permissions, pluginTenants)
+	NewEndpointAudit(router, sessions, users, permissions, auditLog)
+	NewEndpointOpenAPI(router)
+	NewEndpointI18n(router)
+	NewEndpointBulk(router, sessions, users, permissions, bulk.NewImporter(users, groups, companies, roles, sessions), auditLog)
+	NewEndpointInvitations(router, sessions, users, permissions, groups, companies, invite.NewInvitations(d, []byte("secret")), &mail.LogMailer{}, "", time.Hour, auditLog)
+	NewEndpointBranding(router, sessions, users, permissions, companies, auditLog)
+	NewEndpointOIDC(router, sessions, users, groups, oidc.NewProvider(&oidc.Config{}), nil)
+	return router
+}
+
+func TestEveryRouteIsAnnotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devdrasil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	doc, err := openapi.Generate("..", openapi.Module+"/backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := newTestRouter(t, dir)
+	for _, set := range router.routes {
+		for _, rt := range set.routes {
+			method := strings.ToLower(rt.method)
+			if rt.method == AnyMethod {
+				method = "get"
+			}
+			if doc.Paths[openapi.PathOf(rt.pattern)][method] == nil {
+				t.Errorf("%s %s has no @Path annotation", rt.method, rt.pattern)
+			}
+		}
+	}
+
+	data, err := doc.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, openAPIDocument) {
+		t.Errorf("openapi.json is outdated, run go generate")
+	}
+}
@@ -0,0 +1,148 @@
+package backend
+
+import (
+	"github.com/worldiety/devdrasil/backend/api"
+	"net/http"
+	"github.com/worldiety/devdrasil/backend/audit"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+)
+
+type permissionListDTO = api.PermissionList
+
+type permissionDTO = api.Permission
+
+func newPermissionDTO(perm *user.Permission) *permissionDTO {
+	return &permissionDTO{Name: user.PermissionName(perm.Id), Plugin: perm.Plugin, Description: perm.Description, AllowedUsers: perm.AllowedUsers, AllowedGroups: perm.AllowedGroups}
+}
+
+//The permission kinds endpoint, so that administrators can build roles and grants
+type EndpointPermissions struct {
+	router      *Router
+	sessions    *session.Sessions
+	users       *user.Users
+	permissions *user.Permissions
+	audit       *audit.Log
+}
+
+func NewEndpointPermissions(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, auditLog *audit.Log) *EndpointPermissions {
+	endpoint := &EndpointPermissions{router: router, sessions: sessions, users: users, permissions: permissions, audit: auditLog}
+	router.Handle("GET", "/permissions", endpoint.listPermissions, Authenticated(sessions, users))
+	router.HandleString("PUT", "/permissions/{name}", endpoint.updatePermission, Permitted(sessions, users, permissions, user.GRANT_PERMISSION))
+	return endpoint
+}
+
+// Every authenticated user can list the built-in and plugin permission kinds and who of his tenant has them globally
+//  @Path GET /permissions
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/permissionListDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
+//  @Return 500 (for any other error)
+func (e *EndpointPermissions) listPermissions(writer http.ResponseWriter, request *http.Request) {
+	_, usr := CurrentSession(request)
+
+	list, err := e.permissions.List()
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	effective, err := e.permissions.Resolve(usr)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	res := &permissionListDTO{}
+	res.List = make([]*permissionDTO, 0)
+	for _, perm := range list {
+		dto := newPermissionDTO(perm)
+		dto.AllowedUsers, err = e.usersInTenant(effective, perm.AllowedUsers)
+		if AnyErrorAsInternalError(err, writer) {
+			return
+		}
+		dto.AllowedGroups = groupsInTenant(effective, perm.AllowedGroups)
+		res.List = append(res.List, dto)
+	}
+	WriteJSONBody(writer, res)
+}
+
+//returns those of the users, which belong to the tenant of the effective permissions. Unknown users are omitted.
+func (e *EndpointPermissions) usersInTenant(effective *user.EffectivePermissions, userIds []db.PK) ([]db.PK, error) {
+	res := make([]db.PK, 0)
+	for _, uid := range userIds {
+		other, err := e.users.Get(uid)
+		if err != nil {
+			if db.IsEntityNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if effective.InTenant(&user.Target{User: other}) {
+			res = append(res, uid)
+		}
+	}
+	return res, nil
+}
+
+//returns those of the groups, which belong to the tenant of the effective permissions
+func groupsInTenant(effective *user.EffectivePermissions, groupIds []db.PK) []db.PK {
+	res := make([]db.PK, 0)
+	for _, gid := range groupIds {
+		id := gid
+		if effective.InTenant(&user.Target{Group: &id}) {
+			res = append(res, gid)
+		}
+	}
+	return res
+}
+
+// A user can replace the users and groups which have a kind globally, if he has the permission GRANT_PERMISSION.
+// Because a global kind applies to all tenants, the user also requires MANAGE_TENANTS. The admin always keeps every kind.
+//  @Path PUT /permissions/{name}
+//  @Header sid string
+//	@Body github.com/worldiety/devdrasil/backend/permissionDTO
+//	@Return 200 github.com/worldiety/devdrasil/backend/permissionDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission | if user has not the permission MANAGE_TENANTS)
+//  @Return 404 (if the kind does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointPermissions) updatePermission(writer http.ResponseWriter, request *http.Request, name string) {
+	ses, usr := CurrentSession(request)
+	if !checkManagesTenants(e.permissions, writer, ses, usr, "global permissions apply to all tenants") {
+		return
+	}
+
+	dto := &permissionDTO{}
+	err := ReadJSONBody(writer, request, dto)
+	if err != nil {
+		return
+	}
+
+	kind, ok, err := e.permissions.ParseName(name)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	if !ok {
+		WriteError(writer, http.StatusNotFound, "unknown permission kind: "+name)
+		return
+	}
+
+	perm, err := e.permissions.Get(kind)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	before := *perm
+
+	perm.AllowedUsers = dto.AllowedUsers
+	perm.AllowedGroups = dto.AllowedGroups
+	if !containsPK(perm.AllowedUsers, user.ADMIN) {
+		perm.AllowedUsers = append(perm.AllowedUsers, user.ADMIN)
+	}
+
+	err = e.permissions.Update(perm)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	recordAudit(e.audit, ses, usr, request, "permission.update", name, &before, perm)
+	WriteJSONBody(writer, newPermissionDTO(perm))
+}
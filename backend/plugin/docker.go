@@ -19,6 +19,19 @@ const pluginApp = "app"
 const pluginData = "data"
 const pluginBranch = "master"
 
+//the address of the plugin containers on the host
+const pluginHostIP = "127.0.0.1"
+
+//the port of the plugins, which have been installed before each plugin got its own port
+const legacyPluginHostPort = 4000
+
+//the file within the plugin directory, which contains the host port of the container
+const pluginPortFile = "port"
+
+//the default range of the host ports, which are assigned to the plugin containers
+const DefaultPortMin = 4000
+const DefaultPortMax = 4999
+
 type PluginManager struct {
 	/*
 		The dir where all plugins are stored, e.g.
@@ -30,6 +43,12 @@ type PluginManager struct {
 	 */
 	rootDir string
 	mutex   sync.Mutex
+
+	//prefixes the docker images and labels of a tenant, empty for the default tenant, see Tenants
+	namespace string
+
+	//assigns the host ports across all tenants
+	tenants *Tenants
 }
 
 type PluginVersionInfo struct {
@@ -50,7 +69,15 @@ type PluginVersionInfo struct {
 }
 
 func NewPluginManager(dir string) *PluginManager {
-	return &PluginManager{rootDir: dir}
+	return NewTenants(dir, DefaultPortMin, DefaultPortMax).Get(nil)
+}
+
+//returns the docker repository and label value of the plugin, which is unique across the tenants
+func (r *PluginManager) imageName(pluginId string) string {
+	if r.namespace == "" {
+		return pluginId
+	}
+	return r.namespace + "." + pluginId
 }
 
 func (r *PluginManager) getGit(dir string) *tools.Git {
@@ -72,6 +99,15 @@ need to solve that for the devdrasil-user by hand on the devdrasil machine. We c
 but we would require to support all edge cases then - unclear if it is worth the effort.
  */
 func (r *PluginManager) Install(pluginId string, gitUrl string) error {
+	done, err := r.tenants.beginJob()
+	if err != nil {
+		return err
+	}
+	defer done()
+	return r.install(pluginId, gitUrl)
+}
+
+func (r *PluginManager) install(pluginId string, gitUrl string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
@@ -124,27 +160,38 @@ func (r *PluginManager) Install(pluginId string, gitUrl string) error {
 		return err
 	}
 
+	//fail early, before building anything
+	_, err = readManifest(appDir)
+	if err != nil {
+		return err
+	}
+
 	//all files are here, start dockering
 	revision, err := git.GetHead()
 	if err != nil {
 		return err
 	}
+	port, err := r.tenants.assignPort(pluginDir)
+	if err != nil {
+		return err
+	}
+
 	docker := r.getDocker(appDir)
-	err = docker.Build(pluginId, revision, true)
+	err = docker.Build(r.imageName(pluginId), revision, true)
 	if err != nil {
 		return err
 	}
 
 	options := &tools.StartOptions{}
-	options.Repository = pluginId
+	options.Repository = r.imageName(pluginId)
 	options.Tag = revision
-	options.Labels = map[string]string{dockerLabelPlugin: pluginId}
+	options.Labels = map[string]string{dockerLabelPlugin: r.imageName(pluginId)}
 	options.ContainerPort = 80
-	options.HostPort = 4000      //TODO
+	options.HostPort = port
 	options.RemoveOnExit = false //does not work with restart always
 	options.Mounts = []*tools.Mount{{HostDir: dataDir, ContainerDir: "/" + pluginData, ReadOnly: false}}
 	options.Restart = "always"
-	options.HostIP = "127.0.0.1"
+	options.HostIP = pluginHostIP
 
 	cid, err := docker.Start(options)
 	if err != nil {
@@ -205,8 +252,26 @@ func (r *PluginManager) GetVersion(pluginId string) (*PluginVersionInfo, error)
 	}
 }
 
+//checks if the app folder of the plugin is available, like GetVersion but without asking the remote repository
+func (r *PluginManager) IsInstalled(pluginId string) bool {
+	if validatePluginId(pluginId) != nil {
+		return false
+	}
+	files, err := ioutil.ReadDir(filepath.Join(r.rootDir, pluginId, pluginApp))
+	return err == nil && len(files) > 0
+}
+
 //removes everything, including data, git, docker images, etc.
 func (r *PluginManager) Remove(pluginId string, keepData bool) error {
+	done, err := r.tenants.beginJob()
+	if err != nil {
+		return err
+	}
+	defer done()
+	return r.remove(pluginId, keepData)
+}
+
+func (r *PluginManager) remove(pluginId string, keepData bool) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
@@ -215,23 +280,7 @@ func (r *PluginManager) Remove(pluginId string, keepData bool) error {
 		return err
 	}
 
-	//remove all plugin data, like the git repo and app data (only if not keepData)
-	pluginDir := filepath.Join(r.rootDir, pluginId)
-	var errDirRemove error
-	if keepData {
-		files, err := ioutil.ReadDir(pluginDir)
-		errDirRemove = err
-		if err == nil {
-			for _, file := range files {
-				if file.Name() == pluginData {
-					continue
-				}
-				errDirRemove = os.RemoveAll(pluginDir)
-			}
-		}
-	} else {
-		errDirRemove = os.RemoveAll(pluginDir)
-	}
+	errDirRemove := removeFiles(filepath.Join(r.rootDir, pluginId), keepData)
 
 	docker := r.getDocker(".")
 
@@ -243,7 +292,7 @@ func (r *PluginManager) Remove(pluginId string, keepData bool) error {
 	var errDockerContainer error
 	for _, con := range containers {
 		value, _ := con.GetLabelValue(dockerLabelPlugin)
-		if value == pluginId {
+		if value == r.imageName(pluginId) {
 			err := docker.Stop(con.ID)
 			if errDockerContainer != nil {
 				errDockerContainer = err
@@ -254,15 +303,15 @@ func (r *PluginManager) Remove(pluginId string, keepData bool) error {
 		}
 	}
 
-	//remove all docker images for the plugin (pluginId==repository)
+	//remove all docker images for the plugin (imageName==repository)
 	images, err := docker.ListImages()
 	if err != nil {
 		return err
 	}
 	var errDockerRemove error
 	for _, img := range images {
-		if img.Repository == pluginId {
-			err := docker.RemoveImage(pluginId, img.Tag, true)
+		if img.Repository == r.imageName(pluginId) {
+			err := docker.RemoveImage(img.Repository, img.Tag, true)
 			if errDockerRemove == nil {
 				errDockerRemove = err
 			}
@@ -290,7 +339,36 @@ func (r *PluginManager) Remove(pluginId string, keepData bool) error {
 	return nil
 }
 
+//removes all files of the plugin, like the git repo and the app. If keepData, the data dir and the port file are kept, so
+//that an update keeps both.
+func removeFiles(pluginDir string, keepData bool) error {
+	if !keepData {
+		return os.RemoveAll(pluginDir)
+	}
+
+	files, err := ioutil.ReadDir(pluginDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.Name() == pluginData || file.Name() == pluginPortFile {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(pluginDir, file.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *PluginManager) Update(pluginId string) error {
+	done, err := r.tenants.beginJob()
+	if err != nil {
+		return err
+	}
+	defer done()
+
 	version, err := r.GetVersion(pluginId)
 	if err != nil {
 		return err
@@ -307,13 +385,13 @@ func (r *PluginManager) Update(pluginId string) error {
 	log.Default.Info(log.New("plugin needs update").Put("plugin", pluginId).Put("dir", version.AppDirectory).Put("hash-current", version.RepositoryVersionCurrent).Put("hash-remote", version.RepositoryVersionRemote))
 
 	//remove everything but keep the data dir
-	err = r.Remove(pluginId, true)
+	err = r.remove(pluginId, true)
 	if err != nil {
 		return err
 	}
 
 	//now just install again
-	return r.Install(pluginId, version.RepositoryURL)
+	return r.install(pluginId, version.RepositoryURL)
 }
 
 //this is a security essential: avoid various filename attacks, like ../../etc/ because the id is used directly in the filesystem
@@ -0,0 +1,39 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveFilesKeepsDataAndPort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devdrasil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{pluginData, pluginApp} {
+		if err := os.MkdirAll(filepath.Join(dir, name), defaultFilePermission); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, pluginPortFile), []byte("4001"), defaultFilePermission); err != nil {
+		t.Fatal(err)
+	}
+
+	err = removeFiles(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port, err := readPort(dir); err != nil || port != 4001 {
+		t.Fatal(port, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, pluginData)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, pluginApp)); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
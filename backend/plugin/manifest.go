@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+//the optional manifest in the root of the plugin repository
+const manifestFilename = "devdrasil.json"
+
+//The Manifest declares what a plugin requires from devdrasil
+type Manifest struct {
+	//the permission kinds, which are created when the plugin is installed and removed with the plugin
+	Permissions []*ManifestPermission `json:"permissions"`
+}
+
+type ManifestPermission struct {
+	//unique name of the kind, at most 16 upper case letters, digits or underscores, e.g. START_BUILD
+	Name string `json:"name"`
+
+	//human readable description, shown to administrators
+	Description string `json:"description"`
+}
+
+//a permission name must fit into a db.PK
+var permissionNamePattern = regexp.MustCompile("^[A-Z][A-Z0-9_]{0,15}$")
+
+//reads and validates the manifest of the app dir. A missing manifest is an empty manifest.
+func readManifest(appDir string) (*Manifest, error) {
+	manifest := &Manifest{}
+	buf, err := ioutil.ReadFile(filepath.Join(appDir, manifestFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(buf, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", manifestFilename, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, perm := range manifest.Permissions {
+		if !permissionNamePattern.MatchString(perm.Name) {
+			return nil, fmt.Errorf("invalid permission name '%s' in %s, use at most 16 characters like 'START_BUILD'", perm.Name, manifestFilename)
+		}
+		if seen[perm.Name] {
+			return nil, fmt.Errorf("duplicate permission name '%s' in %s", perm.Name, manifestFilename)
+		}
+		seen[perm.Name] = true
+	}
+	return manifest, nil
+}
+
+//returns the manifest of the installed plugin
+func (r *PluginManager) GetManifest(pluginId string) (*Manifest, error) {
+	err := validatePluginId(pluginId)
+	if err != nil {
+		return nil, err
+	}
+	return readManifest(filepath.Join(r.rootDir, pluginId, pluginApp))
+}
+
+//returns the address of the container of the plugin, e.g. 127.0.0.1:4000
+func (r *PluginManager) GetAddress(pluginId string) (string, error) {
+	err := validatePluginId(pluginId)
+	if err != nil {
+		return "", err
+	}
+	port, err := readPort(filepath.Join(r.rootDir, pluginId))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		port = legacyPluginHostPort
+	}
+	return fmt.Sprintf("%s:%d", pluginHostIP, port), nil
+}
@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/worldiety/devdrasil/db"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//the prefix of the directory and the docker namespace of a tenant. A plugin id cannot contain a dash, so that the
+//directories of the tenants never collide with the plugins of the default tenant.
+const tenantPrefix = "tenant-"
+
+//Tenants keeps a PluginManager per company, so that each tenant installs its own plugins with separate data
+//directories, e.g.
+//	~/.devdrasil/plugins
+//		./de.worldiety.devdrasil.buildserver/ (the default tenant)
+//		./tenant-<company id>/de.worldiety.devdrasil.buildserver/
+type Tenants struct {
+	rootDir  string
+	mutex    sync.Mutex
+	managers map[string]*PluginManager
+
+	//the range of the host ports, which are assigned to the plugin containers of all tenants
+	portMin   int
+	portMax   int
+	portMutex sync.Mutex
+
+	//the amount of running installations, updates and removals, see WaitForJobs
+	jobs int64
+
+	//set by WaitForJobs, then no new jobs are accepted
+	closed int32
+}
+
+func NewTenants(rootDir string, portMin int, portMax int) *Tenants {
+	return &Tenants{rootDir: rootDir, managers: make(map[string]*PluginManager), portMin: portMin, portMax: portMax}
+}
+
+//returns the plugins of the company, nil is the default tenant of all users without a company
+func (t *Tenants) Get(company *db.PK) *PluginManager {
+	namespace := ""
+	if company != nil {
+		namespace = tenantPrefix + company.String()
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	manager := t.managers[namespace]
+	if manager == nil {
+		manager = &PluginManager{rootDir: filepath.Join(t.rootDir, namespace), namespace: namespace, tenants: t}
+		t.managers[namespace] = manager
+	}
+	return manager
+}
+
+//checks if the default tenant or any company has installed the plugin
+func (t *Tenants) IsInstalledAnywhere(pluginId string) (bool, error) {
+	err := validatePluginId(pluginId)
+	if err != nil {
+		return false, err
+	}
+
+	dirs, err := t.dirs()
+	if err != nil {
+		return false, err
+	}
+	for _, dir := range dirs {
+		manager := &PluginManager{rootDir: dir}
+		if manager.IsInstalled(pluginId) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//returns the plugin directories of the default tenant and of each company
+func (t *Tenants) dirs() ([]string, error) {
+	dirs := []string{t.rootDir}
+	files, err := ioutil.ReadDir(t.rootDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() && strings.HasPrefix(file.Name(), tenantPrefix) {
+			dirs = append(dirs, filepath.Join(t.rootDir, file.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+//returns the port of the plugin or assigns the lowest port of the range, which no plugin of any tenant uses yet
+func (t *Tenants) assignPort(pluginDir string) (int, error) {
+	t.portMutex.Lock()
+	defer t.portMutex.Unlock()
+
+	//an update keeps the port
+	if port, err := readPort(pluginDir); err == nil {
+		return port, nil
+	}
+
+	dirs, err := t.dirs()
+	if err != nil {
+		return 0, err
+	}
+	used := make(map[int]bool)
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		for _, file := range files {
+			if !file.IsDir() || strings.HasPrefix(file.Name(), tenantPrefix) || filepath.Join(dir, file.Name()) == pluginDir {
+				continue
+			}
+			if port, err := readPort(filepath.Join(dir, file.Name())); err == nil {
+				used[port] = true
+			} else if (&PluginManager{rootDir: dir}).IsInstalled(file.Name()) {
+				//installed before each plugin got its own port
+				used[legacyPluginHostPort] = true
+			}
+		}
+	}
+
+	for port := t.portMin; port <= t.portMax; port++ {
+		if used[port] {
+			continue
+		}
+		err = ioutil.WriteFile(filepath.Join(pluginDir, pluginPortFile), []byte(strconv.Itoa(port)), defaultFilePermission)
+		if err != nil {
+			return 0, err
+		}
+		return port, nil
+	}
+	return 0, fmt.Errorf("all plugin ports from %d to %d are in use", t.portMin, t.portMax)
+}
+
+//reads the port file of the plugin
+func readPort(pluginDir string) (int, error) {
+	data, err := ioutil.ReadFile(filepath.Join(pluginDir, pluginPortFile))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+//the interval to check for running jobs
+const waitInterval = 100 * time.Millisecond
+
+//registers a job, which must call done when it has finished. Fails, if the tenants are shutting down.
+func (t *Tenants) beginJob() (func(), error) {
+	atomic.AddInt64(&t.jobs, 1)
+	if atomic.LoadInt32(&t.closed) != 0 {
+		atomic.AddInt64(&t.jobs, -1)
+		return nil, fmt.Errorf("plugins cannot be changed while shutting down")
+	}
+	return func() {
+		atomic.AddInt64(&t.jobs, -1)
+	}, nil
+}
+
+//WaitForJobs rejects new installations, updates and removals of plugins and blocks until the running ones have
+//finished. Returns the error of the context, if it is done before.
+func (t *Tenants) WaitForJobs(ctx context.Context) error {
+	atomic.StoreInt32(&t.closed, 1)
+	ticker := time.NewTicker(waitInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&t.jobs) > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d plugin jobs still running: %v", atomic.LoadInt64(&t.jobs), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
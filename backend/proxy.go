@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/backend/plugin"
+	"github.com/worldiety/devdrasil/log"
+	"strings"
+)
+
+//the headers, which tell the plugin who is calling. Values sent by the client are always removed.
+const (
+	//the hex encoded user id
+	PluginUserHeader = "X-Devdrasil-User"
+
+	//the login of the user
+	PluginLoginHeader = "X-Devdrasil-Login"
+
+	//the comma separated names of the kinds of the plugin, which are granted to the user, e.g. START_BUILD,VIEW_LOGS
+	PluginPermissionsHeader = "X-Devdrasil-Permissions"
+)
+
+//The plugin proxy forwards authenticated requests to the container of a plugin, together with the permissions of the user.
+type EndpointPluginProxy struct {
+	router        *Router
+	sessions      *session.Sessions
+	users         *user.Users
+	permissions   *user.Permissions
+	tenants       *plugin.Tenants
+}
+
+func NewEndpointPluginProxy(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, tenants *plugin.Tenants) *EndpointPluginProxy {
+	endpoint := &EndpointPluginProxy{router: router, sessions: sessions, users: users, permissions: permissions, tenants: tenants}
+	router.Handle(AnyMethod, "/rpc/{plugin}/{path:path}", endpoint.proxy, Authenticated(sessions, users))
+	return endpoint
+}
+
+// Every authenticated user can call a plugin of his tenant. The plugin decides on the passed permissions, what the user is allowed to do.
+// The passed permissions are the kinds of the plugin, which are granted to the user globally or for his company.
+// The session credentials are never passed to the plugin.
+//  @Path * /rpc/{plugin}/{path} (plugin is the id of the plugin, path is forwarded to the plugin)
+//  @Header sid string
+//	@Return * (the response of the plugin)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
+//  @Return 404 (if the tenant has not installed the plugin)
+//  @Return 502 (if the plugin is not available)
+func (e *EndpointPluginProxy) proxy(writer http.ResponseWriter, request *http.Request) {
+	ses, usr := CurrentSession(request)
+
+	pluginId := PathString(request, "plugin")
+	path := "/" + PathString(request, "path")
+
+	pluginManager := e.tenants.Get(usr.Company)
+	addr, err := pluginManager.GetAddress(pluginId)
+	if err != nil {
+		WriteError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !pluginManager.IsInstalled(pluginId) {
+		WriteError(writer, http.StatusNotFound, "plugin not installed: "+pluginId)
+		return
+	}
+
+	kinds, err := e.permissions.ListByPlugin(pluginId)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	//a kind may be granted globally or for the company, whose plugin is called
+	tenant := &user.Target{Company: usr.Company}
+	granted := make([]string, 0)
+	for _, kind := range kinds {
+		allowed, err := isAllowedOn(e.permissions, ses, usr, kind.Id, tenant)
+		if AnyErrorAsInternalError(err, writer) {
+			return
+		}
+		if allowed {
+			granted = append(granted, user.PermissionName(kind.Id))
+		}
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = addr
+			req.URL.Path = path
+			req.URL.RawPath = ""
+			req.Host = addr
+
+			removeCredentials(req)
+			req.Header.Set(PluginUserHeader, usr.Id.String())
+			req.Header.Set(PluginLoginHeader, usr.Login)
+			req.Header.Set(PluginPermissionsHeader, strings.Join(granted, ","))
+		},
+		ErrorHandler: func(writer http.ResponseWriter, req *http.Request, err error) {
+			log.Default.Warn(log.New("plugin not available").Put("plugin", pluginId).SetError(err))
+			WriteError(writer, http.StatusBadGateway, "plugin not available")
+		},
+	}
+	proxy.ServeHTTP(writer, request)
+}
+
+//removes the devdrasil session, token and csrf credentials and any forged identity headers
+func removeCredentials(req *http.Request) {
+	req.Header.Del("sid")
+	req.Header.Del("Authorization")
+	req.Header.Del(CSRFHeader)
+	req.Header.Del(PluginUserHeader)
+	req.Header.Del(PluginLoginHeader)
+	req.Header.Del(PluginPermissionsHeader)
+
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != SessionCookie && cookie.Name != CSRFCookie {
+			req.AddCookie(cookie)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package backend
+
+import (
+	"net/http"
+	"github.com/worldiety/devdrasil/backend/audit"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/db"
+)
+
+type EndpointRoles struct {
+	router      *Router
+	users       *user.Users
+	sessions    *session.Sessions
+	groups      *group.Groups
+	roles       *user.Roles
+	grants      *user.Grants
+	permissions *user.Permissions
+	audit       *audit.Log
+}
+
+type roleListDTO struct {
+	List []*roleDTO
+}
+
+type roleDTO struct {
+	//unique entity id, e.g. "abc38293"
+	Id db.PK
+
+	//the name of the role
+	Name string
+
+	//the names of the bundled permission kinds, e.g. LIST_USERS
+	Permissions []string
+}
+
+func newRoleDTO(role *user.Role) *roleDTO {
+	dto := &roleDTO{Id: role.Id, Name: role.Name, Permissions: make([]string, 0)}
+	for _, kind := range role.Permissions {
+		dto.Permissions = append(dto.Permissions, user.PermissionName(kind))
+	}
+	return dto
+}
+
+//parses the permission names of the dto into the role. Writes the error, so just return if false.
+func applyRoleDTO(writer http.ResponseWriter, permissions *user.Permissions, role *user.Role, dto *roleDTO) bool {
+	role.Name = dto.Name
+	role.Permissions = make([]db.PK, 0)
+	for _, name := range dto.Permissions {
+		kind, ok, err := permissions.ParseName(name)
+		if AnyErrorAsInternalError(err, writer) {
+			return false
+		}
+		if !ok {
+			WriteError(writer, http.StatusBadRequest, "unknown permission kind: "+name)
+			return false
+		}
+		role.Permissions = append(role.Permissions, kind)
+	}
+	return true
+}
+
+func NewEndpointRoles(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, groups *group.Groups, roles *user.Roles, grants *user.Grants, auditLog *audit.Log) *EndpointRoles {
+	endpoint := &EndpointRoles{router: router, sessions: sessions, permissions: permissions, users: users, groups: groups, roles: roles, grants: grants, audit: auditLog}
+	router.Handle("GET", "/roles", endpoint.listRoles, Permitted(sessions, users, permissions, user.LIST_ROLES))
+	router.Handle("POST", "/roles", endpoint.addRole, Permitted(sessions, users, permissions, user.CREATE_ROLE))
+	router.HandlePK("GET", "/roles/{id:pk}", endpoint.getRole, Permitted(sessions, users, permissions, user.GET_ROLE))
+	router.HandlePK("PUT", "/roles/{id:pk}", endpoint.updateRole, Permitted(sessions, users, permissions, user.UPDATE_ROLE))
+	router.HandlePK("DELETE", "/roles/{id:pk}", endpoint.deleteRole, Permitted(sessions, users, permissions, user.DELETE_ROLE))
+	return endpoint
+}
+
+// A user can list all roles, if he has the permission LIST_ROLES
+//  @Path GET /roles
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/roleListDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 500 (for any other error)
+func (e *EndpointRoles) listRoles(writer http.ResponseWriter, request *http.Request) {
+	roles, err := e.roles.List()
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	res := &roleListDTO{}
+	res.List = make([]*roleDTO, 0)
+	for _, r := range roles {
+		res.List = append(res.List, newRoleDTO(r))
+	}
+	WriteJSONBody(writer, res)
+}
+
+// A user can add a role, if he has the permission CREATE_ROLE and, because roles apply to all tenants, MANAGE_TENANTS
+//  @Path POST /roles
+//  @Header sid string
+//	@Body github.com/worldiety/devdrasil/backend/roleDTO
+//	@Return 200 github.com/worldiety/devdrasil/backend/roleDTO
+//  @Return 400 (if a permission kind is unknown)
+//  @Return 409 (if the name is not unique)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission | if user has not the permission MANAGE_TENANTS)
+//  @Return 500 (for any other error)
+func (e *EndpointRoles) addRole(writer http.ResponseWriter, request *http.Request) {
+	ses, usr := CurrentSession(request)
+	if !checkManagesTenants(e.permissions, writer, ses, usr, "roles apply to all tenants") {
+		return
+	}
+
+	dto := &roleDTO{}
+	err := ReadJSONBody(writer, request, dto)
+	if err != nil {
+		return
+	}
+
+	newRole := &user.Role{}
+	if !applyRoleDTO(writer, e.permissions, newRole, dto) {
+		return
+	}
+
+	err = e.roles.Add(newRole)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	res := newRoleDTO(newRole)
+	recordAudit(e.audit, ses, usr, request, "role.create", newRole.Id.String(), nil, res)
+	WriteJSONBody(writer, res)
+}
+
+// A user needs the GET_ROLE permission
+//  @Path GET /roles/{id} (id is hex encoded role PK)
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/roleDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 404 (if the role does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointRoles) getRole(writer http.ResponseWriter, request *http.Request, roleId db.PK) {
+	role, err := e.roles.Get(roleId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+	WriteJSONBody(writer, newRoleDTO(role))
+}
+
+// A user needs the UPDATE_ROLE and MANAGE_TENANTS permissions. The change applies to all users and groups of all tenants
+// which have the role.
+//  @Path PUT /roles/{id}
+//  @Header sid string
+//	@Body github.com/worldiety/devdrasil/backend/roleDTO
+//	@Return 200 github.com/worldiety/devdrasil/backend/roleDTO
+//  @Return 400 (if a permission kind is unknown)
+//  @Return 409 (if the name is not unique)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission | if user has not the permission MANAGE_TENANTS)
+//  @Return 404 (if the role does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointRoles) updateRole(writer http.ResponseWriter, request *http.Request, roleId db.PK) {
+	ses, usr := CurrentSession(request)
+	if !checkManagesTenants(e.permissions, writer, ses, usr, "roles apply to all tenants") {
+		return
+	}
+
+	dto := &roleDTO{}
+	err := ReadJSONBody(writer, request, dto)
+	if err != nil {
+		return
+	}
+
+	role, err := e.roles.Get(roleId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	before := newRoleDTO(role)
+	if !applyRoleDTO(writer, e.permissions, role, dto) {
+		return
+	}
+
+	err = e.roles.Update(role)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	res := newRoleDTO(role)
+	recordAudit(e.audit, ses, usr, request, "role.update", role.Id.String(), before, res)
+	WriteJSONBody(writer, res)
+}
+
+// A user can delete a role, if he has the permissions DELETE_ROLE and MANAGE_TENANTS. The role is removed from all users,
+// groups and grants.
+//  @Path DELETE /roles/{id}
+//  @Header sid string
+//	@Return 200
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission | if user has not the permission MANAGE_TENANTS)
+//  @Return 404 (if the role does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointRoles) deleteRole(writer http.ResponseWriter, request *http.Request, roleId db.PK) {
+	ses, usr := CurrentSession(request)
+	if !checkManagesTenants(e.permissions, writer, ses, usr, "roles apply to all tenants") {
+		return
+	}
+
+	role, err := e.roles.Get(roleId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	err = e.removeRoleReferences(roleId)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	err = e.roles.Delete(roleId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	recordAudit(e.audit, ses, usr, request, "role.delete", roleId.String(), newRoleDTO(role), nil)
+	WriteOK(writer)
+}
+
+//removes the role from all users, groups and grants
+func (e *EndpointRoles) removeRoleReferences(roleId db.PK) error {
+	err := e.grants.DeleteReferences(roleId)
+	if err != nil {
+		return err
+	}
+
+	allUsers, err := e.users.List()
+	if err != nil {
+		return err
+	}
+	for _, usr := range allUsers {
+		if usr.RemoveRole(roleId) {
+			err = e.users.Update(usr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	allGroups, err := e.groups.List()
+	if err != nil {
+		return err
+	}
+	for _, grp := range allGroups {
+		if grp.RemoveRole(roleId) {
+			err = e.groups.Update(grp)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
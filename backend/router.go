@@ -0,0 +1,286 @@
+package backend
+
+import (
+	"context"
+	"github.com/worldiety/devdrasil/db"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//matches every http method, e.g. for a proxy
+const AnyMethod = "*"
+
+//A Middleware wraps a handler, e.g. to check a permission before the actual handler is invoked
+type Middleware func(handler http.Handler) http.Handler
+
+//Chain applies the middleware in order, so that the first one is the outermost
+func Chain(handler http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+//The Router is a small routing layer on top of a http.ServeMux. A pattern consists of literal segments and typed
+//parameters, e.g. /users/{id:pk} or /rpc/{plugin}/{path:path}. The types are
+//  string (the default): any non-empty segment
+//  pk: a hex encoded db.PK
+//  int: a decimal integer
+//  path: the remaining path, only allowed as the last segment
+type Router struct {
+	mux *http.ServeMux
+
+	//the routes by the pattern, which is registered at the mux
+	routes map[string]*routeSet
+
+	//applied to every route
+	middleware []Middleware
+}
+
+func NewRouter(mux *http.ServeMux) *Router {
+	return &Router{mux: mux, routes: make(map[string]*routeSet)}
+}
+
+//Use appends middleware, which applies to all routes which are added afterwards
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+//Handle binds the handler to the method, which may be AnyMethod, and the pattern. The middleware applies after the middleware of the router.
+//Panics if the pattern is malformed, like http.ServeMux does.
+func (r *Router) Handle(method string, pattern string, handler http.HandlerFunc, middleware ...Middleware) {
+	segments := parsePattern(pattern)
+	all := append(append([]Middleware{}, r.middleware...), middleware...)
+	rt := &route{method: method, pattern: pattern, segments: segments, handler: Chain(handler, all...)}
+
+	prefix := muxPattern(segments)
+	set := r.routes[prefix]
+	if set == nil {
+		set = &routeSet{}
+		r.routes[prefix] = set
+		r.mux.Handle(prefix, set)
+	}
+	set.routes = append(set.routes, rt)
+}
+
+//HandlePK binds a handler, which receives the only pk parameter of the pattern, e.g. /users/{id:pk}
+func (r *Router) HandlePK(method string, pattern string, handler func(writer http.ResponseWriter, request *http.Request, id db.PK), middleware ...Middleware) {
+	name := onlyParam(pattern, paramPK)
+	r.Handle(method, pattern, func(writer http.ResponseWriter, request *http.Request) {
+		handler(writer, request, PathPK(request, name))
+	}, middleware...)
+}
+
+//HandleString binds a handler, which receives the only string parameter of the pattern, e.g. /plugins/{id}
+func (r *Router) HandleString(method string, pattern string, handler func(writer http.ResponseWriter, request *http.Request, value string), middleware ...Middleware) {
+	name := onlyParam(pattern, paramString)
+	r.Handle(method, pattern, func(writer http.ResponseWriter, request *http.Request) {
+		handler(writer, request, PathString(request, name))
+	}, middleware...)
+}
+
+//the types of path parameters
+const (
+	paramString = "string"
+	paramPK     = "pk"
+	paramInt    = "int"
+	paramPath   = "path"
+)
+
+//a literal or a parameter
+type segment struct {
+	literal string
+
+	//the name of the parameter or empty for a literal
+	param string
+	kind  string
+}
+
+func parsePattern(pattern string) []*segment {
+	if !strings.HasPrefix(pattern, "/") {
+		panic("pattern must start with /: " + pattern)
+	}
+	parts := strings.Split(pattern[1:], "/")
+	res := make([]*segment, 0, len(parts))
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			res = append(res, &segment{literal: part})
+			continue
+		}
+
+		name := part[1 : len(part)-1]
+		kind := paramString
+		if idx := strings.Index(name, ":"); idx >= 0 {
+			kind = name[idx+1:]
+			name = name[:idx]
+		}
+		switch kind {
+		case paramString, paramPK, paramInt:
+		case paramPath:
+			if i != len(parts)-1 {
+				panic("a path parameter must be the last segment: " + pattern)
+			}
+		default:
+			panic("unknown parameter type '" + kind + "' in " + pattern)
+		}
+		res = append(res, &segment{param: name, kind: kind})
+	}
+	return res
+}
+
+//returns the longest literal prefix, e.g. /users/ for /users/{id:pk} or /users for /users
+func muxPattern(segments []*segment) string {
+	prefix := ""
+	for _, seg := range segments {
+		if seg.param != "" {
+			return prefix + "/"
+		}
+		prefix += "/" + seg.literal
+	}
+	return prefix
+}
+
+//returns the name of the only parameter, which must be of the given type
+func onlyParam(pattern string, kind string) string {
+	name := ""
+	for _, seg := range parsePattern(pattern) {
+		if seg.param == "" {
+			continue
+		}
+		if name != "" || seg.kind != kind {
+			panic("expected exactly one parameter of type " + kind + ": " + pattern)
+		}
+		name = seg.param
+	}
+	if name == "" {
+		panic("expected exactly one parameter of type " + kind + ": " + pattern)
+	}
+	return name
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []*segment
+	handler  http.Handler
+}
+
+//matches the path. A literal mismatch returns false, a malformed typed parameter returns the name of the parameter.
+func (r *route) match(path string) (map[string]interface{}, bool, string) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	params := make(map[string]interface{})
+	bad := ""
+	for i, seg := range r.segments {
+		if seg.kind == paramPath {
+			rest := ""
+			if i < len(parts) {
+				rest = strings.Join(parts[i:], "/")
+			}
+			params[seg.param] = rest
+			return params, true, bad
+		}
+
+		if i >= len(parts) {
+			return nil, false, ""
+		}
+		part := parts[i]
+
+		switch {
+		case seg.param == "":
+			if part != seg.literal {
+				return nil, false, ""
+			}
+		case part == "":
+			return nil, false, ""
+		case seg.kind == paramPK:
+			pk, err := db.ParsePK(part)
+			if err != nil && bad == "" {
+				bad = seg.param
+			}
+			params[seg.param] = pk
+		case seg.kind == paramInt:
+			n, err := strconv.Atoi(part)
+			if err != nil && bad == "" {
+				bad = seg.param
+			}
+			params[seg.param] = n
+		default:
+			params[seg.param] = part
+		}
+	}
+
+	if len(parts) != len(r.segments) {
+		return nil, false, ""
+	}
+	return params, true, bad
+}
+
+//all routes which share the same pattern of the mux
+type routeSet struct {
+	routes []*route
+}
+
+func (s *routeSet) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	allowed := make([]string, 0)
+	badParam := ""
+	for _, rt := range s.routes {
+		params, ok, bad := rt.match(request.URL.Path)
+		if !ok {
+			continue
+		}
+		if rt.method != AnyMethod && rt.method != request.Method {
+			allowed = append(allowed, rt.method)
+			continue
+		}
+		if bad != "" {
+			badParam = bad
+			continue
+		}
+		rt.handler.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), pathParamsKey, params)))
+		return
+	}
+
+	switch {
+	case badParam != "":
+		WriteError(writer, http.StatusBadRequest, "invalid path parameter: "+badParam)
+	case len(allowed) > 0:
+		sort.Strings(allowed)
+		writer.Header().Set("Allow", strings.Join(allowed, ", "))
+		WriteError(writer, http.StatusMethodNotAllowed, request.Method)
+	default:
+		WriteError(writer, http.StatusNotFound, request.URL.Path)
+	}
+}
+
+type contextKey int
+
+const (
+	pathParamsKey contextKey = iota
+	sessionKey
+	userKey
+)
+
+func pathParam(request *http.Request, name string) interface{} {
+	params, _ := request.Context().Value(pathParamsKey).(map[string]interface{})
+	return params[name]
+}
+
+//returns the parameter of type pk or db.NIL
+func PathPK(request *http.Request, name string) db.PK {
+	pk, _ := pathParam(request, name).(db.PK)
+	return pk
+}
+
+//returns the parameter of type string or path
+func PathString(request *http.Request, name string) string {
+	str, _ := pathParam(request, name).(string)
+	return str
+}
+
+//returns the parameter of type int
+func PathInt(request *http.Request, name string) int {
+	n, _ := pathParam(request, name).(int)
+	return n
+}
@@ -0,0 +1,67 @@
+package backend
+
+import (
+	"github.com/worldiety/devdrasil/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterTypedParametersAndMethods(t *testing.T) {
+	router := NewRouter(http.NewServeMux())
+
+	var gotId db.PK
+	var gotPath string
+	trace := ""
+	router.Use(func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			trace += "router,"
+			handler.ServeHTTP(writer, request)
+		})
+	})
+	router.HandlePK("GET", "/users/{id:pk}", func(writer http.ResponseWriter, request *http.Request, id db.PK) {
+		trace += "handler"
+		gotId = id
+	}, func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			trace += "route,"
+			handler.ServeHTTP(writer, request)
+		})
+	})
+	router.Handle("GET", "/users", func(writer http.ResponseWriter, request *http.Request) {})
+	router.Handle(AnyMethod, "/rpc/{plugin}/{path:path}", func(writer http.ResponseWriter, request *http.Request) {
+		gotPath = PathString(request, "plugin") + ":" + PathString(request, "path")
+	})
+
+	id := db.NewPK("alice")
+	cases := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/users/" + id.String(), http.StatusOK},
+		{"GET", "/users/xyz", http.StatusBadRequest},
+		{"PUT", "/users/" + id.String(), http.StatusMethodNotAllowed},
+		{"GET", "/users/" + id.String() + "/other", http.StatusNotFound},
+		{"GET", "/users/", http.StatusNotFound},
+		{"GET", "/users", http.StatusOK},
+		{"POST", "/rpc/build/api/v1/jobs", http.StatusOK},
+	}
+	for i, c := range cases {
+		recorder := httptest.NewRecorder()
+		router.mux.ServeHTTP(recorder, httptest.NewRequest(c.method, c.path, nil))
+		if recorder.Code != c.status {
+			t.Fatalf("%s %s: expected %d but got %d", c.method, c.path, c.status, recorder.Code)
+		}
+		if i == 0 && trace != "router,route,handler" {
+			t.Fatalf("unexpected middleware order: %s", trace)
+		}
+	}
+
+	if gotId != id {
+		t.Fatalf("expected %v but got %v", id, gotId)
+	}
+	if gotPath != "build:api/v1/jobs" {
+		t.Fatalf("unexpected path parameters: %s", gotPath)
+	}
+}
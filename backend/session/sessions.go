@@ -1,7 +1,10 @@
 package session
 
 import (
+	"crypto/sha256"
 	"github.com/worldiety/devdrasil/db"
+	"sync"
+	"time"
 )
 
 const TABLE_SESSION = "session"
@@ -24,18 +27,110 @@ type Session struct {
 
 	//the user agent string
 	LastUserAgent string
+
+	//the token which must be echoed in the X-CSRF-Token header for mutating requests authenticated by cookie
+	CSRFToken string
+
+	//if not nil, the session is restricted to these permission kinds, e.g. for api tokens
+	Scopes []db.PK `json:",omitempty"`
+
+	//the api token, if this is an ephemeral session created from a bearer token. Such a session is never persisted.
+	Token *db.PK `json:",omitempty"`
+}
+
+//checks if the session is restricted and whether the permission kind is in scope
+func (s *Session) InScope(kind db.PK) bool {
+	if s.Scopes == nil {
+		return true
+	}
+	return containsPK(s.Scopes, kind)
+}
+
+//Handle identifies the session in lists, e.g. to revoke it. Unlike the id, it cannot be used to authenticate.
+func (s *Session) Handle() db.PK {
+	return HandleOf(s.Id)
+}
+
+//HandleOf returns the handle of the session id, which is the truncated sha256 of the id
+func HandleOf(id db.PK) db.PK {
+	sum := sha256.Sum256(id[:])
+	return db.NewPKFromArray(sum[:len(id)])
 }
 
 type Sessions struct {
-	db   *db.Database
-	crud *db.CRUD
+	db     *db.Database
+	crud   *db.CRUD
+	tokens *Tokens
+
+	//serializes the writes of the session table, because a transaction only locks its own partition instance, so that
+	//e.g. a touch cannot write back a concurrently revoked session
+	writes sync.Mutex
+
+	//guards the lifetimes, which are changed by a reload of the configuration
+	mutex sync.RWMutex
+
+	//a session expires, if it has not been used for this duration, 0 disables it
+	idleTimeout time.Duration
+
+	//a session expires at the latest after this duration, 0 disables it
+	maxLifetime time.Duration
 }
 
 func NewSessions(d *db.Database) *Sessions {
-	r := &Sessions{d, db.NewCRUD(d)}
+	r := &Sessions{db: d, crud: db.NewCRUD(d), tokens: NewTokens(d)}
 	return r
 }
 
+//sets the durations after which a session expires, 0 disables the respective expiry
+func (s *Sessions) SetLifetime(idleTimeout time.Duration, maxLifetime time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.idleTimeout = idleTimeout
+	s.maxLifetime = maxLifetime
+}
+
+//returns the duration after which each session expires at the latest, 0 if it never expires
+func (s *Sessions) MaxLifetime() time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.maxLifetime
+}
+
+//checks if the session has been idle for too long or is too old. The ephemeral sessions of api tokens expire by their token.
+func (s *Sessions) IsExpired(ses *Session) bool {
+	if ses.Token != nil {
+		return false
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	now := time.Now().Unix()
+	if s.idleTimeout > 0 && now-ses.LastUsedAt > int64(s.idleTimeout.Seconds()) {
+		return true
+	}
+	if s.maxLifetime > 0 && now-ses.CreatedAt > int64(s.maxLifetime.Seconds()) {
+		return true
+	}
+	return false
+}
+
+//returns the repository of the api tokens, which are long living sessions
+func (s *Sessions) Tokens() *Tokens {
+	return s.tokens
+}
+
+//creates an ephemeral session from a valid bearer token, which is restricted to the scopes of the token
+func (s *Sessions) FromToken(bearer string) (*Session, error) {
+	token, err := s.tokens.Authenticate(bearer)
+	if err != nil {
+		return nil, err
+	}
+	scopes := token.Permissions
+	if scopes == nil {
+		scopes = make([]db.PK, 0)
+	}
+	return &Session{Id: token.Id, User: token.User, CreatedAt: token.CreatedAt, LastUsedAt: token.LastUsedAt, Scopes: scopes, Token: &token.Id}, nil
+}
+
 func (s *Sessions) Get(pk db.PK) (*Session, error) {
 	session := &Session{Id: pk}
 	err := s.crud.Read(TABLE_SESSION, session)
@@ -43,19 +138,103 @@ func (s *Sessions) Get(pk db.PK) (*Session, error) {
 }
 
 func (s *Sessions) Delete(pk db.PK) error {
+	s.writes.Lock()
+	defer s.writes.Unlock()
 	return s.crud.Delete(TABLE_SESSION, pk)
 }
 
+//returns the session of the user with the given handle, see Session.Handle
+func (s *Sessions) GetByHandle(user db.PK, handle db.PK) (*Session, error) {
+	list, err := s.ListByUser(user)
+	if err != nil {
+		return nil, err
+	}
+	for _, ses := range list {
+		if ses.Handle() == handle {
+			return ses, nil
+		}
+	}
+	return nil, &db.EntityNotFound{What: handle}
+}
+
+//deletes all sessions of the given user, except the given ones. Returns the amount of deleted sessions.
+func (s *Sessions) DeleteByUser(user db.PK, except ...db.PK) (int, error) {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	tx := s.db.Partition(TABLE_SESSION).Begin(true)
+	defer tx.Commit()
+
+	list := make([]*Session, 0)
+	err := s.crud.ListTX(tx, "", &list)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, ses := range list {
+		if ses.User != user || containsPK(except, ses.Id) {
+			continue
+		}
+		err = tx.Delete(ses.Id)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func containsPK(list []db.PK, pk db.PK) bool {
+	for _, k := range list {
+		if k == pk {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Sessions) Update(session *Session) error {
+	s.writes.Lock()
+	defer s.writes.Unlock()
 	return s.crud.Update(TABLE_SESSION, session)
 }
 
+//updates the session only if it still exists, so that a concurrent revocation cannot be undone
+func (s *Sessions) Touch(session *Session) error {
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	tx := s.db.Partition(TABLE_SESSION).Begin(true)
+	defer tx.Commit()
+
+	if !tx.Has(session.Id) {
+		return &db.EntityNotFound{What: session.Id}
+	}
+	return s.crud.UpdateTX(tx, session)
+}
+
 func (s *Sessions) Create(session *Session) error {
 	return s.crud.Create(TABLE_SESSION, session)
 }
 
 func (s *Sessions) List() ([]*Session, error) {
 	res := make([]*Session, 0)
-	err := s.crud.List(TABLE_SESSION, "", res)
+	err := s.crud.List(TABLE_SESSION, "", &res)
 	return res, err
 }
+
+//returns all sessions which belong to the given user
+func (s *Sessions) ListByUser(user db.PK) ([]*Session, error) {
+	list, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Session, 0)
+	for _, ses := range list {
+		if ses.User == user {
+			res = append(res, ses)
+		}
+	}
+	return res, nil
+}
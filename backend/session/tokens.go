@@ -0,0 +1,178 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"github.com/worldiety/devdrasil/db"
+	"strings"
+	"time"
+)
+
+const TABLE_TOKEN = "token"
+
+//every token starts with this prefix, so that leaked tokens can be found by scanners
+const tokenPrefix = "ddt_"
+
+//the minimum amount of seconds between two writes of the last usage of a token
+const tokenTouchInterval = 60
+
+var ErrInvalidToken = fmt.Errorf("invalid token")
+
+//A personal access token for machine clients. Only the hash of the secret is stored.
+type Token struct {
+	//unique entity id, which is also part of the token string
+	Id db.PK
+
+	//the user, which is represented by the token
+	User db.PK
+
+	//a human readable description, e.g. 'jenkins'
+	Name string
+
+	//sha256 hash of the secret
+	SecretHash []byte
+
+	//the permission kinds which are granted to the token, always intersected with the permissions of the user
+	Permissions []db.PK
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	CreatedAt int64
+
+	//the number of seconds elapsed since January 1, 1970 UTC. 0 means that the token never expires.
+	ExpiresAt int64
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	LastUsedAt int64
+}
+
+//checks if the token has an expiry date which has been passed
+func (t *Token) IsExpired() bool {
+	return t.ExpiresAt != 0 && t.ExpiresAt < time.Now().Unix()
+}
+
+type Tokens struct {
+	db   *db.Database
+	crud *db.CRUD
+}
+
+func NewTokens(d *db.Database) *Tokens {
+	return &Tokens{d, db.NewCRUD(d)}
+}
+
+//creates the token with a new id and secret and returns the token string, which is only available now
+func (r *Tokens) Create(token *Token) (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	hash := sha256.Sum256([]byte(encodedSecret))
+	token.SecretHash = hash[:]
+	token.CreatedAt = time.Now().Unix()
+
+	err = r.crud.Create(TABLE_TOKEN, token)
+	if err != nil {
+		return "", err
+	}
+	return tokenPrefix + token.Id.String() + "_" + encodedSecret, nil
+}
+
+func (r *Tokens) Get(id db.PK) (*Token, error) {
+	token := &Token{Id: id}
+	err := r.crud.Read(TABLE_TOKEN, token)
+	return token, err
+}
+
+func (r *Tokens) Delete(id db.PK) error {
+	return r.crud.Delete(TABLE_TOKEN, id)
+}
+
+func (r *Tokens) List() ([]*Token, error) {
+	res := make([]*Token, 0)
+	err := r.crud.List(TABLE_TOKEN, "", &res)
+	return res, err
+}
+
+//returns all tokens of the given user
+func (r *Tokens) ListByUser(user db.PK) ([]*Token, error) {
+	list, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Token, 0)
+	for _, token := range list {
+		if token.User == user {
+			res = append(res, token)
+		}
+	}
+	return res, nil
+}
+
+//deletes all tokens of the given user, e.g. if the user is deleted
+func (r *Tokens) DeleteByUser(user db.PK) error {
+	list, err := r.ListByUser(user)
+	if err != nil {
+		return err
+	}
+	for _, token := range list {
+		err = r.Delete(token.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//parses the token string, compares the secret and checks the expiry. Returns ErrInvalidToken for any mismatch.
+func (r *Tokens) Authenticate(str string) (*Token, error) {
+	if !strings.HasPrefix(str, tokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+	parts := strings.SplitN(strings.TrimPrefix(str, tokenPrefix), "_", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+
+	id, err := db.ParsePK(parts[0])
+	if err != nil || id.IsNIL() {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := r.Get(id)
+	if err != nil {
+		if db.IsEntityNotFound(err) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	hash := sha256.Sum256([]byte(parts[1]))
+	if subtle.ConstantTimeCompare(hash[:], token.SecretHash) != 1 || token.IsExpired() {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now().Unix()
+	if now-token.LastUsedAt >= tokenTouchInterval {
+		token.LastUsedAt = now
+		err = r.touch(token)
+		if err != nil && !db.IsEntityNotFound(err) {
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+//updates the token only if it still exists, so that a concurrent revocation cannot be undone
+func (r *Tokens) touch(token *Token) error {
+	tx := r.db.Partition(TABLE_TOKEN).Begin(true)
+	defer tx.Commit()
+
+	if !tx.Has(token.Id) {
+		return &db.EntityNotFound{What: token.Id}
+	}
+	return r.crud.UpdateTX(tx, token)
+}
@@ -1,64 +1,80 @@
 package backend
 
 import (
+	"github.com/worldiety/devdrasil/backend/api"
 	"net/http"
 	"github.com/worldiety/devdrasil/backend/session"
 	"github.com/worldiety/devdrasil/backend/user"
 	"github.com/worldiety/devdrasil/db"
 	"time"
 	"strings"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 )
 
-var allowedClients = []string{"web-client-1.0"}
+var allowedClients = []string{"web-client-1.0", api.GoClient}
 
-type sessionDTO struct {
-	//hex encoded session id
-	Id db.PK
+//the name of the cookie which carries the session id
+const SessionCookie = "sid"
+
+//the header which must echo the sessions csrf token, if authenticated by cookie
+const CSRFHeader = "X-CSRF-Token"
+
+//the name of the cookie which carries the csrf token, readable by scripts
+const CSRFCookie = "csrf"
+
+type sessionDTO = api.Session
+
+type sessionInfoListDTO struct {
+	List []*sessionInfoDTO
+}
+
+//the public parts of a session, which never contains the csrf token
+type sessionInfoDTO struct {
+	//hex encoded handle of the session, which identifies it but, unlike the session id, cannot be used to authenticate
+	Handle db.PK
 
 	//hex encoded user id
 	User db.PK
-}
 
-type EndpointSessions struct {
-	mux      *http.ServeMux
-	sessions *session.Sessions
-	users    *user.Users
-}
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	CreatedAt int64
 
-func NewEndpointSessions(mux *http.ServeMux, sessions *session.Sessions, users *user.Users) *EndpointSessions {
-	endpoint := &EndpointSessions{mux: mux, users: users, sessions: sessions}
-	mux.HandleFunc("/sessions", endpoint.sessionsVerbs)
-	mux.HandleFunc("/sessions/", endpoint.sessionVerbs)
-	return endpoint
-}
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	LastUsedAt int64
 
-func (endpoint *EndpointSessions) sessionsVerbs(writer http.ResponseWriter, request *http.Request) {
+	//the last remote address
+	LastRemoteAddr string
 
-	switch request.Method {
-	case "GET":
-		endpoint.listSessions(writer, request)
-	case "POST":
-		endpoint.auth(writer, request)
+	//the user agent string
+	LastUserAgent string
 
-	default:
-		http.Error(writer, request.Method, http.StatusMethodNotAllowed);
-	}
+	//true, if this is the session of the request
+	Current bool
 }
 
-func (endpoint *EndpointSessions) sessionVerbs(writer http.ResponseWriter, request *http.Request) {
-	sessionId, err := db.ParsePK(strings.TrimPrefix(request.URL.Path, "/session/"))
-	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
-		return
-	}
+func newSessionInfoDTO(ses *session.Session, current *session.Session) *sessionInfoDTO {
+	return &sessionInfoDTO{Handle: ses.Handle(), User: ses.User, CreatedAt: ses.CreatedAt, LastUsedAt: ses.LastUsedAt, LastRemoteAddr: ses.LastRemoteAddr, LastUserAgent: ses.LastUserAgent, Current: current != nil && current.Id == ses.Id}
+}
 
-	switch request.Method {
-	case "DELETE":
-		endpoint.deleteSession(writer, request, sessionId);
+type credentialsDTO = api.Credentials
 
-	default:
-		http.Error(writer, request.Method, http.StatusMethodNotAllowed);
-	}
+type EndpointSessions struct {
+	router   *Router
+	sessions *session.Sessions
+	users    *user.Users
+
+	//consulted in order for the logins, which do not belong to a local user
+	authenticators []user.Authenticator
+}
+
+func NewEndpointSessions(router *Router, sessions *session.Sessions, users *user.Users, authenticators ...user.Authenticator) *EndpointSessions {
+	endpoint := &EndpointSessions{router: router, users: users, sessions: sessions, authenticators: authenticators}
+	router.Handle("GET", "/sessions", endpoint.listSessions, Interactive(sessions, users))
+	router.Handle("POST", "/sessions", endpoint.auth)
+	router.HandlePK("DELETE", "/sessions/{id:pk}", endpoint.deleteSession)
+	return endpoint
 }
 
 // Everybody can delete a session for logout.
@@ -68,56 +84,78 @@ func (endpoint *EndpointSessions) sessionVerbs(writer http.ResponseWriter, reque
 //  @Return 500 (for any other error)
 func (e *EndpointSessions) deleteSession(writer http.ResponseWriter, request *http.Request, sessionId db.PK) {
 	err := e.sessions.Delete(sessionId)
-	if err != nil {
-		if db.IsEntityNotFound(err) {
-			http.Error(writer, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	//also expire the cookie, if it refers to the deleted session
+	if cookie, err := request.Cookie(SessionCookie); err == nil && cookie.Value == sessionId.String() {
+		expireSessionCookie(writer, request)
 	}
 }
 
+//tells the browser to forget the session and the csrf cookie
+func expireSessionCookie(writer http.ResponseWriter, request *http.Request) {
+	secure := isSecureRequest(request)
+	http.SetCookie(writer, &http.Cookie{Name: SessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, Secure: secure, SameSite: http.SameSiteStrictMode})
+	http.SetCookie(writer, &http.Cookie{Name: CSRFCookie, Value: "", Path: "/", MaxAge: -1, Secure: secure, SameSite: http.SameSiteStrictMode})
+}
+
+//checks if the browser has used https, either to our listener or to a reverse proxy. A browser drops a secure cookie,
+//which is set by a plain http response, so cookies are only secure if the request is.
+func isSecureRequest(request *http.Request) bool {
+	return request.TLS != nil || strings.EqualFold(request.Header.Get("X-Forwarded-Proto"), "https")
+}
+
 // The admin user can list all available sessions.
 //  @Path GET /sessions
 //  @Header sid string
-//	@Return 200 []*github.com/worldiety/devdrasil/backend/session/Session
-//  @Return 403 (if session id is invalid | if session user is not admin)
+//	@Return 200 github.com/worldiety/devdrasil/backend/sessionInfoListDTO
+//  @Return 403 (if session id is invalid | if authenticated by an api token | if session user is not admin)
 //  @Return 500 (for any other error)
 func (e *EndpointSessions) listSessions(writer http.ResponseWriter, request *http.Request) {
-	sess, usr := GetSessionAndUser(e.sessions, e.users, writer, request)
-	if usr == nil {
-		return
-	}
+	sess, _ := CurrentSession(request)
 
 	//only admin users are allowed to view all sessions
 	if sess.User != user.ADMIN {
-		http.Error(writer, "user must be admin", http.StatusForbidden)
+		WriteError(writer, http.StatusForbidden, "user must be admin")
 		return
 	}
 
 	sessions, err := e.sessions.List()
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 
-	WriteJSONBody(writer, sessions)
+	res := &sessionInfoListDTO{}
+	res.List = make([]*sessionInfoDTO, 0)
+	for _, s := range sessions {
+		res.List = append(res.List, newSessionInfoDTO(s, sess))
+	}
+	WriteJSONBody(writer, res)
 }
 
 // Everybody can try to create a session by posting to the session resource. For security reason each request is delayed at least by 1 second.
+// Configured authenticators (e.g. LDAP) are consulted before the local password.
+// The credentials are either posted as json or as a form (login, password, client). The session id is returned and also set as an HttpOnly cookie.
 //  @Path POST /sessions
-//  @Header login string (The login)
-//  @Header password string (The password)
 //  @Header User-Agent string (The user agent)
-//	@Header client string (A client token, to validate, or issue compatiblity or what else. Allowed values: 'web-client-1.0')
+//	@Body github.com/worldiety/devdrasil/backend/credentialsDTO
 //	@Return 200 github.com/worldiety/devdrasil/backend/sessionDTO
+//  @Return 400 (if the body cannot be parsed)
 //  @Return 403 (if any auth data is invalid or rejected, or user is inactive etc.)
 //  @Return 500 (for any other error)
 func (e *EndpointSessions) auth(writer http.ResponseWriter, request *http.Request) {
-	login := request.Header.Get("login")
-	pwd := request.Header.Get("password")
+	credentials, err := readCredentials(writer, request)
+	if err != nil {
+		writeBodyError(writer, err)
+		return
+	}
+	login := credentials.Login
+	pwd := credentials.Password
+	client := credentials.Client
 	agent := request.Header.Get("User-Agent")
-	client := request.Header.Get("client")
 
 	//try to do something against brute force attacks, see also https://www.owasp.org/index.php/Blocking_Brute_Force_Attacks
 	time.Sleep(1000 * time.Millisecond)
@@ -125,22 +163,22 @@ func (e *EndpointSessions) auth(writer http.ResponseWriter, request *http.Reques
 	//another funny idea is to return a fake session id, after many wrong login attempts
 
 	if len(login) < 3 {
-		http.Error(writer, "login too short", http.StatusForbidden)
+		WriteError(writer, http.StatusForbidden, "login too short")
 		return
 	}
 
 	if len(agent) == 0 {
-		http.Error(writer, "user agent missing", http.StatusForbidden)
+		WriteError(writer, http.StatusForbidden, "user agent missing")
 		return
 	}
 
 	if len(pwd) < 4 {
-		http.Error(writer, "password too short", http.StatusForbidden)
+		WriteError(writer, http.StatusForbidden, "password too short")
 		return
 	}
 
 	if len(client) == 0 {
-		http.Error(writer, "client missing", http.StatusForbidden)
+		WriteError(writer, http.StatusForbidden, "client missing")
 		return
 	}
 
@@ -153,40 +191,113 @@ func (e *EndpointSessions) auth(writer http.ResponseWriter, request *http.Reques
 	}
 
 	if !allowed {
-		http.Error(writer, "client is invalid", http.StatusForbidden)
+		WriteError(writer, http.StatusForbidden, "client is invalid")
 		return
 	}
 
-	usr, err := e.users.FindByLogin(login)
+	usr, err := e.authenticate(login, pwd)
 
 	if err != nil {
-		if db.IsEntityNotFound(err) {
-			http.Error(writer, "credentials invalid", http.StatusForbidden)
+		if db.IsEntityNotFound(err) || err == user.ErrInvalidCredentials {
+			WriteError(writer, http.StatusForbidden, "credentials invalid")
+		} else if db.IsNotUnique(err) {
+			//an external user cannot be provisioned, because a local user has the same login
+			WriteError(writer, http.StatusForbidden, "login already taken")
 		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			WriteInternalError(writer, err)
 		}
 
 		return
 	}
 
 	if !usr.Active {
-		http.Error(writer, "credentials invalid", http.StatusForbidden)
+		WriteError(writer, http.StatusForbidden, "credentials invalid")
 		return
 	}
 
-	if !usr.PasswordEquals(pwd){
-		http.Error(writer, "credentials invalid", http.StatusForbidden)
+	//login is fine now, create a session
+	ses, err := createSession(e.sessions, writer, request, usr)
+	if err != nil {
+		WriteInternalError(writer, err)
 		return
 	}
 
-	//login is fine now, create a session
+	WriteJSONBody(writer, &sessionDTO{Id: ses.Id, User: usr.Id, CSRFToken: ses.CSRFToken})
+}
+
+//checks the local password of a local user. Only an unknown or external login is passed to the authenticators, so that
+//neither a directory entry with the same login nor an outage of the directory affects the local users.
+func (e *EndpointSessions) authenticate(login string, pwd string) (*user.User, error) {
+	usr, err := e.users.FindByLogin(login)
+	if err != nil && !db.IsEntityNotFound(err) {
+		return nil, err
+	}
+
+	if usr != nil && usr.IsLocal() {
+		//service accounts only authenticate with api tokens
+		if usr.ServiceAccount || !usr.PasswordEquals(pwd) {
+			return nil, user.ErrInvalidCredentials
+		}
+		return usr, nil
+	}
+
+	for _, authenticator := range e.authenticators {
+		other, err := authenticator.Authenticate(login, pwd)
+		if err == user.ErrUnknownLogin {
+			continue
+		}
+		return other, err
+	}
+	return nil, user.ErrInvalidCredentials
+}
+
+//creates a new session for an authenticated user and sets the session and the csrf cookie
+func createSession(sessions *session.Sessions, writer http.ResponseWriter, request *http.Request, usr *user.User) (*session.Session, error) {
 	currentTime := time.Now().Unix()
-	ses := &session.Session{User: usr.Id, LastUsedAt: currentTime, CreatedAt: currentTime, LastRemoteAddr: request.RemoteAddr, LastUserAgent: agent}
-	err = e.sessions.Create(ses)
+	ses := &session.Session{User: usr.Id, LastUsedAt: currentTime, CreatedAt: currentTime, LastRemoteAddr: remoteHost(request), LastUserAgent: request.Header.Get("User-Agent"), CSRFToken: newRandomToken()}
+	err := sessions.Create(ses)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+
+	//the browser forgets the cookies with the session, 0 keeps them until the browser is closed
+	maxAge := int(sessions.MaxLifetime().Seconds())
+	secure := isSecureRequest(request)
+	http.SetCookie(writer, &http.Cookie{Name: SessionCookie, Value: ses.Id.String(), Path: "/", MaxAge: maxAge, HttpOnly: true, Secure: secure, SameSite: http.SameSiteStrictMode})
+
+	//the csrf token must be readable by scripts, so that they can echo it in the header
+	http.SetCookie(writer, &http.Cookie{Name: CSRFCookie, Value: ses.CSRFToken, Path: "/", MaxAge: maxAge, Secure: secure, SameSite: http.SameSiteStrictMode})
+	return ses, nil
+}
+
+//the maximum size of the posted credentials, which are read before anybody is authenticated
+const maxCredentialsSize = 4096
+
+//reads the credentials either from a form encoded or from a json body
+func readCredentials(writer http.ResponseWriter, request *http.Request) (*credentialsDTO, error) {
+	request.Body = http.MaxBytesReader(writer, request.Body, maxCredentialsSize)
+	if strings.HasPrefix(request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		err := request.ParseForm()
+		if err != nil {
+			return nil, err
+		}
+		return &credentialsDTO{Login: request.PostForm.Get("login"), Password: request.PostForm.Get("password"), Client: request.PostForm.Get("client")}, nil
 	}
 
-	WriteJSONBody(writer, &sessionDTO{Id: ses.Id, User: usr.Id})
+	dto := &credentialsDTO{}
+	err := json.NewDecoder(request.Body).Decode(dto)
+	if err != nil {
+		return nil, err
+	}
+	return dto, nil
+}
+
+//creates a hex encoded random token of 32 bytes
+func newRandomToken() string {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
 }
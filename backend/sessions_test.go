@@ -0,0 +1,263 @@
+package backend
+
+import (
+	"crypto/tls"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+//all endpoints like the server and the repositories to prepare the data of a test
+type testEnv struct {
+	dir         string
+	router      *Router
+	users       *user.Users
+	sessions    *session.Sessions
+	permissions *user.Permissions
+	grants      *user.Grants
+}
+
+//the caller must remove the dir
+func newTestEnv(t *testing.T) *testEnv {
+	dir, err := ioutil.TempDir("", "devdrasil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &testEnv{dir: dir, router: newTestRouter(t, dir)}
+
+	d := db.Open(dir)
+	env.users, err = user.NewUsers(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.permissions, err = user.NewPermissions(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.sessions = session.NewSessions(d)
+	env.grants = user.NewGrants(d)
+	return env
+}
+
+//adds an active user without any permission
+func (e *testEnv) addUser(t *testing.T, login string) *user.User {
+	usr := &user.User{Login: login, Active: true}
+	usr.SetPassword("Secret-Password1")
+	err := e.users.Add(usr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return usr
+}
+
+//creates a session like a login does
+func (e *testEnv) login(t *testing.T, usr *user.User) *session.Session {
+	now := time.Now().Unix()
+	ses := &session.Session{User: usr.Id, CreatedAt: now, LastUsedAt: now, CSRFToken: newRandomToken()}
+	err := e.sessions.Create(ses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ses
+}
+
+func (e *testEnv) serve(request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	e.router.mux.ServeHTTP(recorder, request)
+	return recorder
+}
+
+//a request, which is authenticated by the sid header like a script does
+func newSessionRequest(method string, path string, body string, ses *session.Session) *http.Request {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	request := httptest.NewRequest(method, path, reader)
+	request.Header.Set("sid", ses.Id.String())
+	return request
+}
+
+func TestCSRF(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	ses := env.login(t, env.addUser(t, "alice"))
+	cookie := &http.Cookie{Name: SessionCookie, Value: ses.Id.String()}
+
+	cases := []struct {
+		name   string
+		method string
+		csrf   string
+		status int
+	}{
+		{"read without token", "GET", "", http.StatusOK},
+		{"write without token", "PUT", "", http.StatusForbidden},
+		{"write with wrong token", "PUT", newRandomToken(), http.StatusForbidden},
+		{"write with token", "PUT", ses.CSRFToken, http.StatusOK},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(c.method, "/me", strings.NewReader(`{"Firstname":"Alice"}`))
+		request.AddCookie(cookie)
+		if c.csrf != "" {
+			request.Header.Set(CSRFHeader, c.csrf)
+		}
+		if status := env.serve(request).Code; status != c.status {
+			t.Fatalf("%s: expected %d but got %d", c.name, c.status, status)
+		}
+	}
+
+	//a browser never sends the sid header on its own, so it requires no csrf token
+	recorder := env.serve(newSessionRequest("PUT", "/me", `{"Firstname":"Alice"}`, ses))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, recorder.Code)
+	}
+}
+
+func TestSessionCookies(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	credentials := `{"Login":"admin","Password":"admin","Client":"web-client-1.0"}`
+	for _, secure := range []bool{false, true} {
+		request := httptest.NewRequest("POST", "/sessions", strings.NewReader(credentials))
+		request.Header.Set("User-Agent", "test")
+		if secure {
+			request.TLS = &tls.ConnectionState{}
+		}
+		recorder := env.serve(request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+		}
+
+		//a browser drops secure cookies of a plain http response
+		cookies := recorder.Result().Cookies()
+		if len(cookies) != 2 {
+			t.Fatal(cookies)
+		}
+		for _, cookie := range cookies {
+			if cookie.Secure != secure {
+				t.Fatalf("%s: expected secure %v", cookie.Name, secure)
+			}
+		}
+	}
+
+	request := httptest.NewRequest("POST", "/sessions", strings.NewReader(`{"Login":"`+strings.Repeat("a", maxCredentialsSize)+`"}`))
+	if status := env.serve(request).Code; status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected %d but got %d", http.StatusRequestEntityTooLarge, status)
+	}
+}
+
+//an authenticator, whose directory is down
+type failingAuthenticator struct {
+	calls int
+}
+
+func (a *failingAuthenticator) Authenticate(login string, password string) (*user.User, error) {
+	a.calls++
+	return nil, user.ErrUnknownLogin
+}
+
+func TestAuthenticateLocalFirst(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	alice := env.addUser(t, "alice")
+	authenticator := &failingAuthenticator{}
+	endpoint := NewEndpointSessions(NewRouter(http.NewServeMux()), env.sessions, env.users, authenticator)
+
+	usr, err := endpoint.authenticate("alice", "Secret-Password1")
+	if err != nil || usr.Id != alice.Id {
+		t.Fatal(usr, err)
+	}
+	if _, err := endpoint.authenticate("alice", "Other-Password2"); err != user.ErrInvalidCredentials {
+		t.Fatal(err)
+	}
+	if authenticator.calls != 0 {
+		t.Fatalf("expected that a local login is not passed to the authenticator")
+	}
+
+	if _, err := endpoint.authenticate("bob", "Secret-Password1"); err != user.ErrInvalidCredentials || authenticator.calls != 1 {
+		t.Fatal(err, authenticator.calls)
+	}
+}
+
+func TestRevocation(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	alice := env.addUser(t, "alice")
+	current := env.login(t, alice)
+	other := env.login(t, alice)
+	bob := env.login(t, env.addUser(t, "bob"))
+
+	//the list only contains handles, which are no credentials
+	recorder := env.serve(newSessionRequest("GET", "/me/sessions", "", current))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, recorder.Code)
+	}
+	body := recorder.Body.String()
+	if strings.Contains(body, current.Id.String()) || strings.Contains(body, other.Id.String()) || !strings.Contains(body, other.Handle().String()) {
+		t.Fatal(body)
+	}
+
+	cases := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"the id is not a handle", "/me/sessions/" + other.Id.String(), http.StatusNotFound},
+		{"sessions of others are unknown", "/me/sessions/" + bob.Handle().String(), http.StatusNotFound},
+		{"sessions of others require the permission", "/users/sessions/" + bob.User.String() + "/" + bob.Handle().String(), http.StatusForbidden},
+		{"own session", "/me/sessions/" + other.Handle().String(), http.StatusOK},
+	}
+	for _, c := range cases {
+		if status := env.serve(newSessionRequest("DELETE", c.path, "", current)).Code; status != c.status {
+			t.Fatalf("%s: expected %d but got %d", c.name, c.status, status)
+		}
+	}
+	if status := env.serve(newSessionRequest("GET", "/me", "", other)).Code; status != http.StatusForbidden {
+		t.Fatalf("revoked session: expected %d but got %d", http.StatusForbidden, status)
+	}
+	if status := env.serve(newSessionRequest("GET", "/me", "", bob)).Code; status != http.StatusOK {
+		t.Fatalf("session of others: expected %d but got %d", http.StatusOK, status)
+	}
+
+	//a touch cannot bring back a revoked session
+	if err := env.sessions.Touch(other); !db.IsEntityNotFound(err) {
+		t.Fatal(err)
+	}
+
+	admin, err := env.users.Get(user.ADMIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/users/sessions/" + bob.User.String() + "/" + bob.Handle().String()
+	if status := env.serve(newSessionRequest("DELETE", path, "", env.login(t, admin))).Code; status != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, status)
+	}
+	if status := env.serve(newSessionRequest("GET", "/me", "", bob)).Code; status != http.StatusForbidden {
+		t.Fatalf("revoked session: expected %d but got %d", http.StatusForbidden, status)
+	}
+
+	//a changed password revokes all other sessions
+	other = env.login(t, alice)
+	recorder = env.serve(newSessionRequest("PUT", "/me/password", `{"OldPassword":"Secret-Password1","NewPassword":"Other-Password2"}`, current))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected %d but got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	if status := env.serve(newSessionRequest("GET", "/me", "", other)).Code; status != http.StatusForbidden {
+		t.Fatalf("other session: expected %d but got %d", http.StatusForbidden, status)
+	}
+	if status := env.serve(newSessionRequest("GET", "/me", "", current)).Code; status != http.StatusOK {
+		t.Fatalf("current session: expected %d but got %d", http.StatusOK, status)
+	}
+}
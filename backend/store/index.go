@@ -4,9 +4,11 @@ import (
 	"net/http"
 	"encoding/json"
 	"io/ioutil"
+	"sync"
 )
 
-const storeIndexUrl = "http://store.devdrasil.worldiety.com/index"
+//the index of the public plugin market
+const DefaultIndexURL = "http://store.devdrasil.worldiety.com/index"
 
 type Index struct {
 	Plugins []*Plugin `json:"plugins"`
@@ -76,10 +78,28 @@ type Comment struct {
 }
 
 type Store struct {
+	//the url of the index, e.g. DefaultIndexURL
+	indexURL string
+	mutex    sync.Mutex
+}
+
+func NewStore(indexURL string) *Store {
+	return &Store{indexURL: indexURL}
+}
+
+//changes the url of the index, e.g. by a reload of the configuration
+func (r *Store) SetIndexURL(indexURL string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.indexURL = indexURL
 }
 
 func (r *Store) GetIndex() (*Index, error) {
-	resp, err := http.Get(storeIndexUrl)
+	r.mutex.Lock()
+	indexURL := r.indexURL
+	r.mutex.Unlock()
+
+	resp, err := http.Get(indexURL)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"net/http"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+)
+
+//Each company is a tenant, which is isolated from the users, groups, plugins and audit entries of the other companies.
+//Users without a company form a tenant of their own. Only a user with MANAGE_TENANTS crosses the tenants, see
+//user.EffectivePermissions.InTenant.
+
+//checks if the company belongs to the tenant of the user, where nil is the tenant of the users without a company
+func isInTenant(permissions *user.Permissions, usr *user.User, company *db.PK) (bool, error) {
+	return permissions.InTenant(usr, &user.Target{User: &user.User{Company: company}})
+}
+
+//returns the tenant for a new entity. A tenant manager may choose any company or none, everybody else always creates
+//within his own company. Writes the error, so just return if false.
+func tenantOfNew(permissions *user.Permissions, writer http.ResponseWriter, ses *session.Session, usr *user.User, requested *db.PK) (*db.PK, bool) {
+	manager, err := isAllowed(permissions, ses, usr, user.MANAGE_TENANTS)
+	if AnyErrorAsInternalError(err, writer) {
+		return nil, false
+	}
+	if manager {
+		return requested, true
+	}
+	if requested != nil && !usr.HasCompany(*requested) {
+		writePermissionDenied(writer, ses, user.MANAGE_TENANTS, "the company belongs to another tenant")
+		return nil, false
+	}
+	return usr.Company, true
+}
+
+//checks that the groups belong to the tenant, because only members of the same tenant can be assigned. Writes the
+//error, so just return if false.
+func checkGroupsInTenant(permissions *user.Permissions, writer http.ResponseWriter, tenant *db.PK, groupIds []db.PK) bool {
+	outside, err := permissions.GroupsOutsideTenant(tenant, groupIds)
+	if AnyErrorAsInternalError(err, writer) {
+		return false
+	}
+	if len(outside) > 0 {
+		WriteErrorDetails(writer, http.StatusBadRequest, "groups of another tenant", outside)
+		return false
+	}
+	return true
+}
+
+//checks that the users belong to the tenant. Unknown users are ignored. Writes the error, so just return if false.
+func checkUsersInTenant(users *user.Users, writer http.ResponseWriter, tenant *db.PK, userIds []db.PK) bool {
+	outside := make([]db.PK, 0)
+	for _, uid := range userIds {
+		usr, err := users.Get(uid)
+		if err != nil {
+			if db.IsEntityNotFound(err) {
+				continue
+			}
+			WriteInternalError(writer, err)
+			return false
+		}
+		if !sameTenant(usr.Company, tenant) {
+			outside = append(outside, uid)
+		}
+	}
+	if len(outside) > 0 {
+		WriteErrorDetails(writer, http.StatusBadRequest, "users of another tenant", outside)
+		return false
+	}
+	return true
+}
+
+//checks if both are the default tenant or the same company
+func sameTenant(a *db.PK, b *db.PK) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+//checks that the user crosses the tenants, e.g. to change the global permissions and roles, which apply to all
+//tenants. Writes the error, so just return if false.
+func checkManagesTenants(permissions *user.Permissions, writer http.ResponseWriter, ses *session.Session, usr *user.User, reason string) bool {
+	manager, err := isAllowed(permissions, ses, usr, user.MANAGE_TENANTS)
+	if AnyErrorAsInternalError(err, writer) {
+		return false
+	}
+	if !manager {
+		writePermissionDenied(writer, ses, user.MANAGE_TENANTS, reason)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+package backend
+
+import (
+	"net/http"
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"time"
+)
+
+type tokenListDTO struct {
+	List []*tokenDTO
+}
+
+type tokenDTO struct {
+	//unique entity id, e.g. "abc38293"
+	Id db.PK
+
+	//the user, which is represented by the token. If absent on creation, the session user is used.
+	User *db.PK
+
+	//a human readable description, e.g. 'jenkins'
+	Name string
+
+	//the names of the granted permission kinds, e.g. LIST_USERS. Always intersected with the permissions of the user.
+	Permissions []string
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	CreatedAt int64
+
+	//the number of seconds elapsed since January 1, 1970 UTC. 0 means that the token never expires.
+	ExpiresAt int64
+
+	//the number of seconds elapsed since January 1, 1970 UTC.
+	LastUsedAt int64
+
+	//the token to use in the 'Authorization: Bearer' header. Only returned once, when the token is created.
+	Token string `json:",omitempty"`
+}
+
+func newTokenDTO(token *session.Token) *tokenDTO {
+	dto := &tokenDTO{Id: token.Id, User: &token.User, Name: token.Name, CreatedAt: token.CreatedAt, ExpiresAt: token.ExpiresAt, LastUsedAt: token.LastUsedAt}
+	dto.Permissions = make([]string, 0)
+	for _, kind := range token.Permissions {
+		dto.Permissions = append(dto.Permissions, user.PermissionName(kind))
+	}
+	return dto
+}
+
+//The api token endpoints. Every user can manage his own tokens, the tokens of others require GET_USER or UPDATE_USER.
+//Api tokens cannot manage tokens, see Interactive.
+type EndpointTokens struct {
+	router      *Router
+	sessions    *session.Sessions
+	users       *user.Users
+	permissions *user.Permissions
+	tokens      *session.Tokens
+}
+
+func NewEndpointTokens(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions) *EndpointTokens {
+	endpoint := &EndpointTokens{router: router, sessions: sessions, users: users, permissions: permissions, tokens: sessions.Tokens()}
+	auth := Interactive(sessions, users)
+	router.Handle("GET", "/tokens", endpoint.listTokens, auth)
+	router.Handle("POST", "/tokens", endpoint.addToken, auth)
+	router.HandlePK("DELETE", "/tokens/{id:pk}", endpoint.deleteToken, auth)
+	return endpoint
+}
+
+//checks if the session user is the given user or has the permission for the user. Writes the error, so just return if false.
+func (e *EndpointTokens) isSelfOrAllowed(writer http.ResponseWriter, ses *session.Session, usr *user.User, userId db.PK, kind db.PK) bool {
+	if usr.Id == userId {
+		return true
+	}
+
+	other, err := e.users.Get(userId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return false
+	}
+
+	return checkAllowedOn(e.permissions, writer, ses, usr, kind, &user.Target{User: other})
+}
+
+// A user can list his own tokens. The tokens of other users (e.g. service accounts) require GET_USER.
+//  @Path GET /tokens?user={id} (the user parameter is optional)
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/tokenListDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token | if user has not the permission)
+//  @Return 500 (for any other error)
+func (e *EndpointTokens) listTokens(writer http.ResponseWriter, request *http.Request) {
+	ses, usr := CurrentSession(request)
+
+	userId := usr.Id
+	if param := request.URL.Query().Get("user"); param != "" {
+		tmp, err := db.ParsePK(param)
+		if err != nil {
+			WriteError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+		userId = tmp
+	}
+
+	if !e.isSelfOrAllowed(writer, ses, usr, userId, user.GET_USER) {
+		return
+	}
+
+	list, err := e.tokens.ListByUser(userId)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	res := &tokenListDTO{}
+	res.List = make([]*tokenDTO, 0)
+	for _, token := range list {
+		res.List = append(res.List, newTokenDTO(token))
+	}
+	WriteJSONBody(writer, res)
+}
+
+// A user can create tokens for himself. Tokens for service accounts require UPDATE_USER, other users cannot get tokens
+// from somebody else. Each permission kind of the token must be held by the creator on the owner of the token.
+// The token string is only returned in this response.
+//  @Path POST /tokens
+//  @Header sid string
+//	@Body github.com/worldiety/devdrasil/backend/tokenDTO
+//	@Return 200 github.com/worldiety/devdrasil/backend/tokenDTO
+//  @Return 400 (if a permission kind is unknown or the expiry is in the past)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token | if user has not the permission | if the owner is another user but no service account | if user has not a permission kind of the token)
+//  @Return 500 (for any other error)
+func (e *EndpointTokens) addToken(writer http.ResponseWriter, request *http.Request) {
+	ses, usr := CurrentSession(request)
+
+	dto := &tokenDTO{}
+	err := ReadJSONBody(writer, request, dto)
+	if err != nil {
+		return
+	}
+
+	userId := usr.Id
+	if dto.User != nil {
+		userId = *dto.User
+	}
+
+	if !e.isSelfOrAllowed(writer, ses, usr, userId, user.UPDATE_USER) {
+		return
+	}
+
+	owner, err := e.users.Get(userId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	//a token of another person would impersonate him
+	if owner.Id != usr.Id && !owner.ServiceAccount {
+		writePermissionDenied(writer, ses, user.UPDATE_USER, "tokens for other users require a service account")
+		return
+	}
+
+	if dto.ExpiresAt != 0 && dto.ExpiresAt < time.Now().Unix() {
+		WriteError(writer, http.StatusBadRequest, "expiry is in the past")
+		return
+	}
+
+	token := &session.Token{User: userId, Name: dto.Name, ExpiresAt: dto.ExpiresAt, Permissions: make([]db.PK, 0)}
+	for _, name := range dto.Permissions {
+		kind, ok, err := e.permissions.ParseName(name)
+		if AnyErrorAsInternalError(err, writer) {
+			return
+		}
+		if !ok {
+			WriteError(writer, http.StatusBadRequest, "unknown permission kind: "+name)
+			return
+		}
+		//nobody can pass on a kind, which he does not hold himself
+		if !checkAllowedOn(e.permissions, writer, ses, usr, kind, &user.Target{User: owner}) {
+			return
+		}
+		token.Permissions = append(token.Permissions, kind)
+	}
+
+	str, err := e.tokens.Create(token)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	res := newTokenDTO(token)
+	res.Token = str
+	WriteJSONBody(writer, res)
+}
+
+// A user can revoke his own tokens. The tokens of other users require UPDATE_USER.
+//  @Path DELETE /tokens/{id}
+//  @Header sid string
+//	@Return 200
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token | if user has not the permission)
+//  @Return 404 (if the token does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointTokens) deleteToken(writer http.ResponseWriter, request *http.Request, tokenId db.PK) {
+	ses, usr := CurrentSession(request)
+
+	token, err := e.tokens.Get(tokenId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	if !e.isSelfOrAllowed(writer, ses, usr, token.User, user.UPDATE_USER) {
+		return
+	}
+
+	err = e.tokens.Delete(tokenId)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	WriteOK(writer)
+}
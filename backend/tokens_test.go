@@ -0,0 +1,126 @@
+package backend
+
+import (
+	"github.com/worldiety/devdrasil/backend/session"
+	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/db"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+//a request, which is authenticated by an api token
+func newTokenRequest(method string, path string, body string, token string) *http.Request {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	return request
+}
+
+func TestTokenScopes(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	alice := env.addUser(t, "alice")
+	ses := env.login(t, alice)
+	unscoped := &session.Token{User: alice.Id, Name: "ci", Permissions: make([]db.PK, 0)}
+	token, err := env.sessions.Tokens().Create(unscoped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	self := alice.Id.String()
+	handle := ses.Handle().String()
+	cases := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/me", ""},
+		{"PUT", "/me", `{"Firstname":"Mallory"}`},
+		{"PUT", "/me/password", `{"OldPassword":"Secret-Password1","NewPassword":"Other-Password2"}`},
+		{"GET", "/me/sessions", ""},
+		{"DELETE", "/me/sessions", ""},
+		{"DELETE", "/me/sessions/" + handle, ""},
+		{"GET", "/users/" + self, ""},
+		{"PUT", "/users/" + self, `{"Password":"Other-Password2"}`},
+		{"GET", "/users/sessions/" + self, ""},
+		{"DELETE", "/users/sessions/" + self, ""},
+		{"DELETE", "/users/sessions/" + self + "/" + handle, ""},
+		{"GET", "/sessions", ""},
+		{"GET", "/tokens", ""},
+		{"POST", "/tokens", `{"Name":"other"}`},
+		{"DELETE", "/tokens/" + unscoped.Id.String(), ""},
+	}
+	for _, c := range cases {
+		if status := env.serve(newTokenRequest(c.method, c.path, c.body, token)).Code; status != http.StatusForbidden {
+			t.Fatalf("%s %s: expected %d but got %d", c.method, c.path, http.StatusForbidden, status)
+		}
+	}
+
+	usr, err := env.users.Get(alice.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !usr.PasswordEquals("Secret-Password1") || usr.Firstname == "Mallory" {
+		t.Fatal(usr)
+	}
+	if status := env.serve(newSessionRequest("GET", "/me", "", ses)).Code; status != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, status)
+	}
+	if _, err := env.sessions.Tokens().Get(unscoped.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	//the scope grants the update, also of the own user
+	scoped := &session.Token{User: user.ADMIN, Name: "admin", Permissions: []db.PK{user.UPDATE_USER}}
+	token, err = env.sessions.Tokens().Create(scoped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := env.serve(newTokenRequest("PUT", "/users/"+user.ADMIN.String(), `{"Firstname":"Root"}`, token)).Code; status != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, status)
+	}
+	if status := env.serve(newTokenRequest("GET", "/users/"+user.ADMIN.String(), "", token)).Code; status != http.StatusForbidden {
+		t.Fatalf("expected %d but got %d", http.StatusForbidden, status)
+	}
+}
+
+func TestTokenCreation(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	alice := env.addUser(t, "alice")
+	bob := env.addUser(t, "bob")
+	ci := &user.User{Login: "ci", Active: true, ServiceAccount: true}
+	if err := env.users.Add(ci); err != nil {
+		t.Fatal(err)
+	}
+	perm, err := env.permissions.Get(user.UPDATE_USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perm.AllowedUsers = append(perm.AllowedUsers, alice.Id)
+	if err := env.permissions.Update(perm); err != nil {
+		t.Fatal(err)
+	}
+
+	ses := env.login(t, alice)
+	cases := []struct {
+		body   string
+		status int
+	}{
+		{`{"Name":"mine"}`, http.StatusOK},
+		{`{"Name":"mine","Permissions":["UPDATE_USER"]}`, http.StatusOK},
+		{`{"Name":"mine","Permissions":["DELETE_USER"]}`, http.StatusForbidden},
+		{`{"Name":"bob","User":"` + bob.Id.String() + `"}`, http.StatusForbidden},
+		{`{"Name":"ci","User":"` + ci.Id.String() + `","Permissions":["UPDATE_USER"]}`, http.StatusOK},
+		{`{"Name":"ci","User":"` + ci.Id.String() + `","Permissions":["UPDATE_USER","MANAGE_TENANTS"]}`, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		if status := env.serve(newSessionRequest("POST", "/tokens", c.body, ses)).Code; status != c.status {
+			t.Fatalf("%s: expected %d but got %d", c.body, c.status, status)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package user
+
+import "errors"
+
+//returned by an Authenticator, if it does not know the login or cannot ask its directory, so that the next one is asked
+var ErrUnknownLogin = errors.New("unknown login")
+
+//returned by an Authenticator, if it knows the login but the password is wrong
+var ErrInvalidCredentials = errors.New("credentials invalid")
+
+//An Authenticator verifies credentials at an external directory. It is only asked for logins, which do not belong to a
+//local user, whose bcrypt password is checked instead.
+type Authenticator interface {
+	//returns the authenticated (and probably just provisioned) user or ErrUnknownLogin or ErrInvalidCredentials or any other error
+	Authenticate(login string, password string) (*User, error)
+}
@@ -0,0 +1,96 @@
+package user
+
+import (
+	"github.com/worldiety/devdrasil/db"
+)
+
+//how a permission kind reaches a user
+const (
+	//the user is allowed directly
+	VIA_USER = "user"
+
+	//a direct or inherited group of the user is allowed
+	VIA_GROUP = "group"
+
+	//a role of the user or of one of his groups bundles the kind
+	VIA_ROLE = "role"
+
+	//a scoped grant to the user or to one of his groups
+	VIA_GRANT = "grant"
+)
+
+//A Source is one path, by which a permission kind is granted to a user
+type Source struct {
+	//one of the VIA_ constants
+	Via string
+
+	//the direct or inherited group of the user, through which the kind is granted
+	Group *db.PK `json:",omitempty"`
+
+	//the role, which bundles the kind
+	Role *db.PK `json:",omitempty"`
+
+	//the scoped grant
+	Grant *db.PK `json:",omitempty"`
+
+	//the scope of the grant
+	ScopeCompany *db.PK `json:",omitempty"`
+	ScopeGroup   *db.PK `json:",omitempty"`
+}
+
+//An Explanation tells whether and why a user has a permission kind
+type Explanation struct {
+	Allowed bool
+
+	//the paths which grant the kind globally or on the target
+	Sources []*Source
+
+	//the scoped grants, which contain the kind but not the target. These explain a denial, if the user has the kind only elsewhere.
+	OtherScopes []*Source
+
+	//true, if the target belongs to another tenant, which denies every kind
+	OtherTenant bool `json:",omitempty"`
+}
+
+//Explain returns all paths by which the kind is granted, either globally or on the target, which may be nil
+func (e *EffectivePermissions) Explain(kind db.PK, target *Target) *Explanation {
+	res := &Explanation{Sources: make([]*Source, 0), OtherScopes: make([]*Source, 0)}
+	res.Sources = append(res.Sources, e.sources[kind]...)
+
+	var companies []db.PK
+	var groups []db.PK
+	if target != nil {
+		companies, groups = e.expandTarget(target)
+	}
+
+	for _, scope := range e.scoped {
+		if !scope.kinds[kind] {
+			continue
+		}
+		if scope.contains(companies, groups) {
+			res.Sources = append(res.Sources, scope.sources[kind]...)
+		} else {
+			res.OtherScopes = append(res.OtherScopes, scope.sources[kind]...)
+		}
+	}
+	res.OtherTenant = target != nil && !e.InTenant(target)
+	res.Allowed = len(res.Sources) > 0 && !res.OtherTenant
+	return res
+}
+
+//remembers the global kind and its path
+func (e *EffectivePermissions) grant(kind db.PK, source *Source) {
+	e.kinds[kind] = true
+	e.sources[kind] = append(e.sources[kind], source)
+}
+
+//remembers the scoped kind and its path
+func (s *scopedKinds) grant(kind db.PK, source *Source) {
+	s.kinds[kind] = true
+	s.sources[kind] = append(s.sources[kind], source)
+}
+
+//returns a pointer to a copy
+func pkRef(pk db.PK) *db.PK {
+	return &pk
+}
@@ -0,0 +1,112 @@
+package user
+
+import (
+	"github.com/worldiety/devdrasil/db"
+)
+
+//Contains Grant objects as json
+const TABLE_USER_GRANT = "user_grant"
+
+//A Grant allows permission kinds only on the entities of a scope, e.g. UPDATE_USER for the users of a company.
+//The grantee is either a user or a group and the scope is either a company or a group.
+type Grant struct {
+	//unique entity id, e.g. "abc38293"
+	Id db.PK
+
+	//the user, who receives the grant
+	User *db.PK
+
+	//the group, whose (inherited) members receive the grant
+	Group *db.PK
+
+	//the granted permission kinds
+	Permissions []db.PK
+
+	//the granted roles, their permission kinds are granted within the scope
+	Roles []db.PK
+
+	//the company, its users and the company itself
+	ScopeCompany *db.PK
+
+	//the group, its (inherited) members, the group itself and the groups which are members of it
+	ScopeGroup *db.PK
+}
+
+//checks if the grant refers to the entity as grantee, scope or role
+func (g *Grant) References(id db.PK) bool {
+	for _, pk := range []*db.PK{g.User, g.Group, g.ScopeCompany, g.ScopeGroup} {
+		if pk != nil && *pk == id {
+			return true
+		}
+	}
+	return false
+}
+
+//removes the role and returns true if it has been actually removed
+func (g *Grant) RemoveRole(id db.PK) bool {
+	for i, rid := range g.Roles {
+		if rid == id {
+			g.Roles = append(g.Roles[:i], g.Roles[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+//the grants repository
+type Grants struct {
+	db   *db.Database
+	crud *db.CRUD
+}
+
+func NewGrants(d *db.Database) *Grants {
+	return &Grants{d, db.NewCRUD(d)}
+}
+
+func (r *Grants) List() ([]*Grant, error) {
+	res := make([]*Grant, 0)
+	err := r.crud.List(TABLE_USER_GRANT, "", &res)
+	return res, err
+}
+
+func (r *Grants) Get(id db.PK) (*Grant, error) {
+	grant := &Grant{Id: id}
+	err := r.crud.Read(TABLE_USER_GRANT, grant)
+	return grant, err
+}
+
+func (r *Grants) Add(grant *Grant) error {
+	return r.crud.Create(TABLE_USER_GRANT, grant)
+}
+
+func (r *Grants) Update(grant *Grant) error {
+	return r.crud.Update(TABLE_USER_GRANT, grant)
+}
+
+func (r *Grants) Delete(id db.PK) error {
+	return r.crud.Delete(TABLE_USER_GRANT, id)
+}
+
+//deletes all grants, which refer to the user, group or company as grantee or scope and removes the role from all others
+func (r *Grants) DeleteReferences(id db.PK) error {
+	tx := r.db.Partition(TABLE_USER_GRANT).Begin(true)
+	defer tx.Commit()
+
+	list := make([]*Grant, 0)
+	err := r.crud.ListTX(tx, "", &list)
+	if err != nil {
+		return err
+	}
+
+	for _, grant := range list {
+		if grant.References(id) {
+			err = tx.Delete(grant.Id)
+		} else if grant.RemoveRole(id) {
+			err = r.crud.UpdateTX(tx, grant)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
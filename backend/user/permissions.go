@@ -1,6 +1,11 @@
 package user
 
-import "github.com/worldiety/devdrasil/db"
+import (
+	"fmt"
+	"github.com/worldiety/devdrasil/db"
+	"github.com/worldiety/devdrasil/backend/group"
+	"strings"
+)
 
 //permissions for treating users
 const TABLE_USER_PERMISSION = "user_permission"
@@ -28,10 +33,50 @@ var DELETE_COMPANY = db.NewPK("DELETE_COMPANY")
 var UPDATE_COMPANY = db.NewPK("UPDATE_COMPANY")
 var GET_COMPANY = db.NewPK("GET_COMPANY")
 
+var LIST_ROLES = db.NewPK("LIST_ROLES")
+var CREATE_ROLE = db.NewPK("CREATE_ROLE")
+var DELETE_ROLE = db.NewPK("DELETE_ROLE")
+var UPDATE_ROLE = db.NewPK("UPDATE_ROLE")
+var GET_ROLE = db.NewPK("GET_ROLE")
+
+var LIST_GRANTS = db.NewPK("LIST_GRANTS")
+var CREATE_GRANT = db.NewPK("CREATE_GRANT")
+var DELETE_GRANT = db.NewPK("DELETE_GRANT")
+
+var GRANT_PERMISSION = db.NewPK("GRANT_PERMISSION")
+var LIST_AUDIT = db.NewPK("LIST_AUDIT")
+
+//crosses the tenants, see EffectivePermissions.InTenant. Every other kind only applies within the company of the user.
+var MANAGE_TENANTS = db.NewPK("MANAGE_TENANTS")
+
+//all permission kinds, for which an entity is ensured
+var PermissionKinds = []db.PK{LIST_USERS, CREATE_USER, DELETE_USER, UPDATE_USER, GET_USER, INSTALL_PLUGIN, REMOVE_PLUGIN, LIST_MARKET, LIST_GROUPS, CREATE_GROUP, DELETE_GROUP, UPDATE_GROUP, GET_GROUP, LIST_COMPANIES, CREATE_COMPANY, DELETE_COMPANY, UPDATE_COMPANY, GET_COMPANY, LIST_ROLES, CREATE_ROLE, DELETE_ROLE, UPDATE_ROLE, GET_ROLE, LIST_GRANTS, CREATE_GRANT, DELETE_GRANT, GRANT_PERMISSION, LIST_AUDIT, MANAGE_TENANTS}
+
+//returns the readable name of a permission kind, e.g. LIST_USERS
+func PermissionName(kind db.PK) string {
+	return strings.TrimRight(string(kind[:]), "\x00")
+}
+
+//returns the known permission kind of the given name or false
+func ParsePermissionName(name string) (db.PK, bool) {
+	for _, kind := range PermissionKinds {
+		if PermissionName(kind) == name {
+			return kind, true
+		}
+	}
+	return db.NIL, false
+}
+
 type Permission struct {
 	//unique entity id, e.g. "0xaccc32"
 	Id db.PK
 
+	//the plugin which declared this kind, empty for the built-in kinds
+	Plugin string
+
+	//human readable description of a plugin kind
+	Description string
+
 	//allowed groups
 	AllowedGroups []db.PK
 
@@ -76,8 +121,7 @@ func NewPermissions(d *db.Database) (*Permissions, error) {
 	json := db.NewJSONDecorator(tx)
 
 	//ensure that at least for each permission, an empty entity is available
-	ensureEntities := []db.PK{LIST_USERS, CREATE_USER, DELETE_USER, UPDATE_USER, GET_USER, INSTALL_PLUGIN, LIST_MARKET, LIST_GROUPS, CREATE_GROUP, DELETE_GROUP, UPDATE_GROUP, GET_GROUP, LIST_COMPANIES, CREATE_COMPANY, DELETE_COMPANY, UPDATE_COMPANY, GET_COMPANY}
-	for _, id := range ensureEntities {
+	for _, id := range PermissionKinds {
 		if tx.Has(id) {
 			continue
 		}
@@ -103,24 +147,155 @@ func (r *Permissions) Update(perm *Permission) error {
 	return r.crud.Update(TABLE_USER_PERMISSION, perm)
 }
 
+//returns the built-in and the plugin kinds
+func (r *Permissions) List() ([]*Permission, error) {
+	res := make([]*Permission, 0)
+	err := r.crud.List(TABLE_USER_PERMISSION, "", &res)
+	return res, err
+}
+
+//returns the kinds declared by the plugin
+func (r *Permissions) ListByPlugin(pluginId string) ([]*Permission, error) {
+	list, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Permission, 0)
+	for _, perm := range list {
+		if perm.Plugin == pluginId && pluginId != "" {
+			res = append(res, perm)
+		}
+	}
+	return res, nil
+}
+
+//returns the built-in or plugin kind of the given name or false
+func (r *Permissions) ParseName(name string) (db.PK, bool, error) {
+	kind, ok := ParsePermissionName(name)
+	if ok {
+		return kind, true, nil
+	}
+
+	list, err := r.List()
+	if err != nil {
+		return db.NIL, false, err
+	}
+	for _, perm := range list {
+		if perm.Plugin != "" && PermissionName(perm.Id) == name {
+			return perm.Id, true, nil
+		}
+	}
+	return db.NIL, false, nil
+}
+
+//RegisterPlugin creates the kinds declared by the plugin and removes the kinds it no longer declares. Existing kinds keep
+//their grants. Returns a db.NotUnique error, if a kind is built-in or belongs to another plugin.
+func (r *Permissions) RegisterPlugin(pluginId string, kinds []*Permission) error {
+	if pluginId == "" {
+		return fmt.Errorf("plugin id is required")
+	}
+
+	tx := r.db.Partition(TABLE_USER_PERMISSION).Begin(true)
+	defer tx.Commit()
+
+	list := make([]*Permission, 0)
+	err := r.crud.ListTX(tx, "", &list)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[db.PK]*Permission)
+	for _, perm := range list {
+		existing[perm.Id] = perm
+	}
+
+	declared := make(map[db.PK]bool)
+	for _, kind := range kinds {
+		other := existing[kind.Id]
+		if other != nil && other.Plugin != pluginId {
+			return &db.NotUnique{What: PermissionName(kind.Id)}
+		}
+		declared[kind.Id] = true
+
+		perm := other
+		if perm == nil {
+			//like the built-in kinds, the admin always has the new kind
+			perm = &Permission{Id: kind.Id, Plugin: pluginId, AllowedUsers: []db.PK{ADMIN}}
+		}
+		perm.Description = kind.Description
+		err = r.crud.UpdateTX(tx, perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, perm := range list {
+		if perm.Plugin == pluginId && !declared[perm.Id] {
+			err = tx.Delete(perm.Id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//removes all kinds of the plugin. Roles, grants and tokens keep referring to them, so a reinstalled plugin gets them back.
+func (r *Permissions) RemovePlugin(pluginId string) error {
+	return r.RegisterPlugin(pluginId, nil)
+}
+
+//checks the effective permissions of the user, see Resolve
 func (r *Permissions) IsAllowed(kind db.PK, user *User) (bool, error) {
-	perm, err := r.Get(kind)
+	effective, err := r.Resolve(user)
 	if err != nil {
 		return false, err
 	}
+	return effective.Has(kind), nil
+}
 
-	for _, k := range perm.AllowedUsers {
-		if k == user.Id {
-			return true, nil
-		}
+//checks the effective permissions of the user, including the grants whose scope contains the target
+func (r *Permissions) IsAllowedOn(kind db.PK, user *User, target *Target) (bool, error) {
+	effective, err := r.Resolve(user)
+	if err != nil {
+		return false, err
 	}
+	return effective.HasOn(kind, target), nil
+}
 
-	for _, allowedGroup := range perm.AllowedGroups {
-		for _, userGroup := range user.Groups {
-			if allowedGroup == userGroup {
-				return true, nil
+//checks if the target belongs to the tenant of the user, see EffectivePermissions.InTenant
+func (r *Permissions) InTenant(user *User, target *Target) (bool, error) {
+	effective, err := r.Resolve(user)
+	if err != nil {
+		return false, err
+	}
+	return effective.InTenant(target), nil
+}
+
+//returns those of the groups, which do not belong to the tenant. Unknown groups are ignored.
+func (r *Permissions) GroupsOutsideTenant(tenant *db.PK, groupIds []db.PK) ([]db.PK, error) {
+	groups := make([]*group.Group, 0)
+	err := r.crud.List(group.TABLE_GROUP, "", &groups)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]db.PK, 0)
+	for _, grp := range groups {
+		for _, gid := range groupIds {
+			if grp.Id == gid && !samePK(grp.Company, tenant) {
+				res = append(res, gid)
 			}
 		}
 	}
-	return false, nil
+	return res, nil
+}
+
+//explains the effective permission of the user on the target, see EffectivePermissions.Explain
+func (r *Permissions) Explain(kind db.PK, user *User, target *Target) (*Explanation, error) {
+	effective, err := r.Resolve(user)
+	if err != nil {
+		return nil, err
+	}
+	return effective.Explain(kind, target), nil
 }
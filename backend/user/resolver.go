@@ -0,0 +1,258 @@
+package user
+
+import (
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/db"
+)
+
+//The effective permission kinds of a user, from direct grants, grants to his (inherited) groups and all their roles.
+type EffectivePermissions struct {
+	//the direct and inherited groups of the user
+	Groups []db.PK
+
+	kinds  map[db.PK]bool
+	scoped []*scopedKinds
+
+	//the paths by which the global kinds are granted
+	sources map[db.PK][]*Source
+
+	//all groups, to expand the groups of targets
+	allGroups []*group.Group
+
+	//the company of the user, nil is the tenant of all users without a company
+	tenant *db.PK
+}
+
+//the kinds of a Grant, with its roles already expanded
+type scopedKinds struct {
+	kinds   map[db.PK]bool
+	company *db.PK
+	group   *db.PK
+	sources map[db.PK][]*Source
+}
+
+//checks if the scope contains any of the companies or groups of a target
+func (s *scopedKinds) contains(companies []db.PK, groups []db.PK) bool {
+	if s.company != nil && containsPK(companies, *s.company) {
+		return true
+	}
+	if s.group != nil && containsPK(groups, *s.group) {
+		return true
+	}
+	return false
+}
+
+//The target entity of a request, against which scoped grants are evaluated. Set exactly one field.
+type Target struct {
+	User    *User
+	Group   *db.PK
+	Company *db.PK
+}
+
+//checks if the kind is granted globally
+func (e *EffectivePermissions) Has(kind db.PK) bool {
+	return e.kinds[kind]
+}
+
+//checks if the kind is granted globally or by a grant, whose scope contains the target. A target of another tenant
+//is never allowed, see InTenant.
+func (e *EffectivePermissions) HasOn(kind db.PK, target *Target) bool {
+	if target != nil && !e.InTenant(target) {
+		return false
+	}
+
+	if e.kinds[kind] {
+		return true
+	}
+
+	if target == nil {
+		return false
+	}
+
+	companies, groups := e.expandTarget(target)
+	for _, scope := range e.scoped {
+		if scope.kinds[kind] && scope.contains(companies, groups) {
+			return true
+		}
+	}
+	return false
+}
+
+//InTenant checks if the target belongs to the same tenant as the user. The tenant of a user is his company, the
+//tenant of a group is its company and a company is its own tenant. Only MANAGE_TENANTS crosses the tenants.
+func (e *EffectivePermissions) InTenant(target *Target) bool {
+	if e.kinds[MANAGE_TENANTS] {
+		return true
+	}
+	return samePK(e.tenant, e.tenantOf(target))
+}
+
+func (e *EffectivePermissions) tenantOf(target *Target) *db.PK {
+	switch {
+	case target.User != nil:
+		return target.User.Company
+	case target.Group != nil:
+		for _, grp := range e.allGroups {
+			if grp.Id == *target.Group {
+				return grp.Company
+			}
+		}
+	case target.Company != nil:
+		return target.Company
+	}
+	return nil
+}
+
+//checks if both are nil or equal
+func samePK(a *db.PK, b *db.PK) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+//returns the companies and the expanded groups, which contain the target
+func (e *EffectivePermissions) expandTarget(target *Target) ([]db.PK, []db.PK) {
+	var companies []db.PK
+	var groups []db.PK
+	switch {
+	case target.User != nil:
+		if target.User.Company != nil {
+			companies = append(companies, *target.User.Company)
+		}
+		groups = group.Expand(e.allGroups, target.User.Groups)
+	case target.Group != nil:
+		groups = group.Expand(e.allGroups, []db.PK{*target.Group})
+	case target.Company != nil:
+		companies = append(companies, *target.Company)
+	}
+	return companies, groups
+}
+
+//checks if the kind is granted globally or on any scope. Used to filter lists.
+func (e *EffectivePermissions) HasAnywhere(kind db.PK) bool {
+	if e.kinds[kind] {
+		return true
+	}
+	for _, scope := range e.scoped {
+		if scope.kinds[kind] {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPK(list []db.PK, pk db.PK) bool {
+	for _, k := range list {
+		if k == pk {
+			return true
+		}
+	}
+	return false
+}
+
+//returns the granted kinds
+func (e *EffectivePermissions) Kinds() []db.PK {
+	res := make([]db.PK, 0, len(e.kinds))
+	for kind := range e.kinds {
+		res = append(res, kind)
+	}
+	return res
+}
+
+//Resolve computes the effective permissions of the user. The result is remembered in the user object, so that
+//a request, which loads the user once, resolves only once. Changes to the user object afterwards are not reflected.
+func (r *Permissions) Resolve(usr *User) (*EffectivePermissions, error) {
+	if usr.effective != nil {
+		return usr.effective, nil
+	}
+
+	perms := make([]*Permission, 0)
+	err := r.crud.List(TABLE_USER_PERMISSION, "", &perms)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*group.Group, 0)
+	err = r.crud.List(group.TABLE_GROUP, "", &groups)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]*Role, 0)
+	err = r.crud.List(TABLE_USER_ROLE, "", &roles)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := make([]*Grant, 0)
+	err = r.crud.List(TABLE_USER_GRANT, "", &grants)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &EffectivePermissions{Groups: group.Expand(groups, usr.Groups), kinds: make(map[db.PK]bool), sources: make(map[db.PK][]*Source), allGroups: groups, tenant: usr.Company}
+	memberOf := make(map[db.PK]bool)
+	for _, gid := range res.Groups {
+		memberOf[gid] = true
+	}
+
+	for _, perm := range perms {
+		if perm.IsAllowed(&usr.Id, nil) {
+			res.grant(perm.Id, &Source{Via: VIA_USER})
+		}
+		for _, gid := range perm.AllowedGroups {
+			if memberOf[gid] {
+				res.grant(perm.Id, &Source{Via: VIA_GROUP, Group: pkRef(gid)})
+			}
+		}
+	}
+
+	//collect the roles of the user and of all his groups, remembering the group
+	rolesById := make(map[db.PK]*Role)
+	for _, role := range roles {
+		rolesById[role.Id] = role
+	}
+	for _, rid := range usr.Roles {
+		if role := rolesById[rid]; role != nil {
+			for _, kind := range role.Permissions {
+				res.grant(kind, &Source{Via: VIA_ROLE, Role: pkRef(rid)})
+			}
+		}
+	}
+	for _, grp := range groups {
+		if !memberOf[grp.Id] {
+			continue
+		}
+		for _, rid := range grp.Roles {
+			if role := rolesById[rid]; role != nil {
+				for _, kind := range role.Permissions {
+					res.grant(kind, &Source{Via: VIA_ROLE, Role: pkRef(rid), Group: pkRef(grp.Id)})
+				}
+			}
+		}
+	}
+
+	for _, grant := range grants {
+		isGrantee := (grant.User != nil && *grant.User == usr.Id) || (grant.Group != nil && memberOf[*grant.Group])
+		if !isGrantee || (grant.ScopeCompany == nil && grant.ScopeGroup == nil) {
+			continue
+		}
+
+		scope := &scopedKinds{kinds: make(map[db.PK]bool), company: grant.ScopeCompany, group: grant.ScopeGroup, sources: make(map[db.PK][]*Source)}
+		for _, kind := range grant.Permissions {
+			scope.grant(kind, &Source{Via: VIA_GRANT, Grant: pkRef(grant.Id), Group: grant.Group, ScopeCompany: grant.ScopeCompany, ScopeGroup: grant.ScopeGroup})
+		}
+		for _, rid := range grant.Roles {
+			if role := rolesById[rid]; role != nil {
+				for _, kind := range role.Permissions {
+					scope.grant(kind, &Source{Via: VIA_GRANT, Grant: pkRef(grant.Id), Role: pkRef(rid), Group: grant.Group, ScopeCompany: grant.ScopeCompany, ScopeGroup: grant.ScopeGroup})
+				}
+			}
+		}
+		res.scoped = append(res.scoped, scope)
+	}
+
+	usr.effective = res
+	return res, nil
+}
@@ -0,0 +1,116 @@
+package user
+
+import (
+	"github.com/worldiety/devdrasil/backend/group"
+	"github.com/worldiety/devdrasil/db"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestResolveNestedGroupsRolesAndGrants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devdrasil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := db.Open(dir)
+	permissions, err := NewPermissions(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := group.NewGroups(d)
+	roles := NewRoles(d)
+	grants := NewGrants(d)
+
+	//staff <- developers <- user
+	staff := &group.Group{Name: "staff"}
+	if err := groups.Add(staff); err != nil {
+		t.Fatal(err)
+	}
+	developers := &group.Group{Name: "developers", Groups: []db.PK{staff.Id}}
+	if err := groups.Add(developers); err != nil {
+		t.Fatal(err)
+	}
+
+	viewer := &Role{Name: "viewer", Permissions: []db.PK{LIST_USERS}}
+	if err := roles.Add(viewer); err != nil {
+		t.Fatal(err)
+	}
+	staff.Roles = []db.PK{viewer.Id}
+	if err := groups.Update(staff); err != nil {
+		t.Fatal(err)
+	}
+
+	perm, err := permissions.Get(LIST_GROUPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perm.AllowedGroups = append(perm.AllowedGroups, staff.Id)
+	if err := permissions.Update(perm); err != nil {
+		t.Fatal(err)
+	}
+
+	companyA := db.NewPK("A")
+	companyB := db.NewPK("B")
+	if err := grants.Add(&Grant{Group: &developers.Id, Permissions: []db.PK{UPDATE_USER}, ScopeCompany: &companyA}); err != nil {
+		t.Fatal(err)
+	}
+
+	usr := &User{Id: db.NewPK("user"), Groups: []db.PK{developers.Id}, Company: &companyA}
+	effective, err := permissions.Resolve(usr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !effective.Has(LIST_GROUPS) {
+		t.Fatal("expected LIST_GROUPS inherited from staff")
+	}
+	if !effective.Has(LIST_USERS) {
+		t.Fatal("expected LIST_USERS from the role of staff")
+	}
+	if effective.Has(UPDATE_USER) {
+		t.Fatal("UPDATE_USER must only be granted within company A")
+	}
+	if !effective.HasOn(UPDATE_USER, &Target{User: &User{Company: &companyA}}) {
+		t.Fatal("expected UPDATE_USER for users of company A")
+	}
+	if effective.HasOn(UPDATE_USER, &Target{User: &User{Company: &companyB}}) {
+		t.Fatal("UPDATE_USER must not be granted for users of company B")
+	}
+
+	explanation := effective.Explain(LIST_USERS, nil)
+	if !explanation.Allowed || len(explanation.Sources) != 1 || explanation.Sources[0].Via != VIA_ROLE || *explanation.Sources[0].Group != staff.Id {
+		t.Fatalf("expected LIST_USERS by the role of staff but got %+v", explanation.Sources)
+	}
+	explanation = effective.Explain(UPDATE_USER, &Target{User: &User{Company: &companyB}})
+	if explanation.Allowed || len(explanation.OtherScopes) != 1 || *explanation.OtherScopes[0].ScopeCompany != companyA {
+		t.Fatalf("expected UPDATE_USER only in company A but got %+v", explanation)
+	}
+
+	//the global LIST_USERS ends at the tenant
+	if effective.HasOn(LIST_USERS, &Target{User: &User{Company: &companyB}}) || effective.HasOn(LIST_USERS, &Target{User: &User{}}) {
+		t.Fatal("LIST_USERS must not cross the tenant of company A")
+	}
+	if !explanation.OtherTenant {
+		t.Fatal("expected company B to be another tenant")
+	}
+
+	manager := &User{Id: db.NewPK("manager"), Company: &companyA}
+	perm, err = permissions.Get(MANAGE_TENANTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perm.AllowedUsers = append(perm.AllowedUsers, manager.Id)
+	if err := permissions.Update(perm); err != nil {
+		t.Fatal(err)
+	}
+	effective, err = permissions.Resolve(manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !effective.InTenant(&Target{Company: &companyB}) || !effective.InTenant(&Target{User: &User{}}) {
+		t.Fatal("MANAGE_TENANTS must cross the tenants")
+	}
+}
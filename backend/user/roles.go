@@ -0,0 +1,94 @@
+package user
+
+import (
+	"github.com/worldiety/devdrasil/db"
+	"strings"
+)
+
+//Contains Role objects as json
+const TABLE_USER_ROLE = "user_role"
+
+//A named bundle of permission kinds, which is assigned to users and groups
+type Role struct {
+	//unique entity id, e.g. "abc38293"
+	Id db.PK
+
+	//unique name of the role, e.g. 'Account manager'
+	Name string
+
+	//the bundled permission kinds
+	Permissions []db.PK
+}
+
+func (r *Role) HasPermission(kind db.PK) bool {
+	for _, k := range r.Permissions {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+//the roles repository
+type Roles struct {
+	db   *db.Database
+	crud *db.CRUD
+}
+
+func NewRoles(d *db.Database) *Roles {
+	return &Roles{d, db.NewCRUD(d)}
+}
+
+func (r *Roles) List() ([]*Role, error) {
+	res := make([]*Role, 0)
+	err := r.crud.List(TABLE_USER_ROLE, "", &res)
+	return res, err
+}
+
+func (r *Roles) Get(id db.PK) (*Role, error) {
+	role := &Role{Id: id}
+	err := r.crud.Read(TABLE_USER_ROLE, role)
+	return role, err
+}
+
+func (r *Roles) Delete(id db.PK) error {
+	return r.crud.Delete(TABLE_USER_ROLE, id)
+}
+
+func (r *Roles) Add(role *Role) error {
+	tx := r.db.Partition(TABLE_USER_ROLE).Begin(true)
+	defer tx.Commit()
+
+	err := r.ensureUniqueName(tx, role)
+	if err != nil {
+		return err
+	}
+	return r.crud.CreateTX(tx, role)
+}
+
+func (r *Roles) Update(role *Role) error {
+	tx := r.db.Partition(TABLE_USER_ROLE).Begin(true)
+	defer tx.Commit()
+
+	err := r.ensureUniqueName(tx, role)
+	if err != nil {
+		return err
+	}
+	return r.crud.UpdateTX(tx, role)
+}
+
+func (r *Roles) ensureUniqueName(tx db.Transaction, role *Role) error {
+	res := make([]*Role, 0)
+	err := r.crud.ListTX(tx, "", &res)
+	if err != nil {
+		return err
+	}
+
+	myLowerCaseName := strings.ToLower(role.Name)
+	for _, other := range res {
+		if strings.ToLower(other.Name) == myLowerCaseName && other.Id != role.Id {
+			return &db.NotUnique{What: role.Name}
+		}
+	}
+	return nil
+}
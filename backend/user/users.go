@@ -4,6 +4,7 @@ import (
 	"github.com/worldiety/devdrasil/db"
 	"golang.org/x/crypto/bcrypt"
 	"strings"
+	"unicode"
 )
 
 //Contains User objects as json
@@ -18,6 +19,15 @@ var ADMIN = db.NewPK("admin")
 const ADMIN_LOGIN = "admin"
 const ADMIN_PWD = "admin"
 
+//users without a provider are managed locally and authenticate with their bcrypt password
+const PROVIDER_LOCAL = ""
+
+//users which are provisioned from an OpenID Connect issuer
+const PROVIDER_OIDC = "oidc"
+
+//users which are authenticated and synchronized from a LDAP directory
+const PROVIDER_LDAP = "ldap"
+
 type User struct {
 	//unique entity id, e.g. "abc38293"
 	Id db.PK
@@ -48,6 +58,55 @@ type User struct {
 
 	//the groups, which this user is a member of. This determines his actual permissions.
 	Groups []db.PK
+
+	//the external authentication provider which manages this user, e.g. oidc. Empty for local users.
+	Provider string
+
+	//the unique id of the user at the provider, e.g. the subject of an id token
+	ExternalId string
+
+	//true, if the provider has deactivated the user, because it does not know him anymore. He is activated again, when he reappears.
+	Vanished bool `json:",omitempty"`
+
+	//the groups, which the provider has assigned. The provider only removes these again and keeps the local groups.
+	ProviderGroups []db.PK `json:",omitempty"`
+
+	//a service account represents a machine client. It has no password and authenticates only with api tokens.
+	ServiceAccount bool
+
+	//the roles, which are assigned directly to this user
+	Roles []db.PK
+
+	//the preferred language, e.g. de. Empty means the Accept-Language of the client.
+	Locale string
+
+	//the effective permissions, resolved at most once for each loaded user object
+	effective *EffectivePermissions
+}
+
+func (u *User) HasRole(id db.PK) bool {
+	for _, rid := range u.Roles {
+		if rid == id {
+			return true
+		}
+	}
+	return false
+}
+
+//removes the role and returns true if it has been actually removed
+func (u *User) RemoveRole(id db.PK) bool {
+	for i, rid := range u.Roles {
+		if rid == id {
+			u.Roles = append(u.Roles[:i], u.Roles[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+//checks if the user is managed locally and not by an external provider
+func (u *User) IsLocal() bool {
+	return u.Provider == PROVIDER_LOCAL
 }
 
 //removes the group and returns true if it has been actually removed
@@ -83,6 +142,29 @@ func (u *User) SetPassword(pwd string) {
 	u.PasswordHash = hash
 }
 
+//checks if the password has at least 7 letters, a number, an upper case letter and a special character
+func IsGoodPassword(s string) bool {
+	var sevenOrMore, number, upper, special bool
+	letters := 0
+	for _, s := range s {
+		switch {
+		case unicode.IsNumber(s):
+			number = true
+		case unicode.IsUpper(s):
+			upper = true
+			letters++
+		case unicode.IsPunct(s) || unicode.IsSymbol(s):
+			special = true
+		case unicode.IsLetter(s) || s == ' ':
+			letters++
+		default:
+			//return false, false, false, false
+		}
+	}
+	sevenOrMore = letters >= 7
+	return sevenOrMore && number && upper && special
+}
+
 //Compares the password hash with the given plaintext
 func (u *User) PasswordEquals(plainTextPasswordToCompare string) bool {
 	err := bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(plainTextPasswordToCompare))
@@ -204,3 +286,18 @@ func (r *Users) FindByLogin(login string) (*User, error) {
 
 	return foundUsr, nil
 }
+
+//finds the user which has been provisioned by the given provider with the given external id
+func (r *Users) FindByExternalId(provider string, externalId string) (*User, error) {
+	list, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, usr := range list {
+		if usr.Provider == provider && usr.ExternalId == externalId {
+			return usr, nil
+		}
+	}
+	return nil, &db.EntityNotFound{What: provider + ":" + externalId}
+}
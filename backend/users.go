@@ -1,163 +1,104 @@
 package backend
 
 import (
+	"github.com/worldiety/devdrasil/backend/api"
 	"net/http"
+	"github.com/worldiety/devdrasil/backend/audit"
 	"github.com/worldiety/devdrasil/backend/user"
 	"github.com/worldiety/devdrasil/backend/session"
 	"github.com/worldiety/devdrasil/db"
-	"strings"
-	"unicode"
 )
 
-type userListDTO struct {
-	List []*userDTO
-}
-
-type userDTO struct {
-	//unique entity id, e.g. "abc38293"
-	Id *db.PK
-
-	//Abbreviation and/or Login, something like "tschinke", used for the login
-	Login *string
-
-	//e.g. Torben
-	Firstname *string
-
-	//e.g. Schinke
-	Lastname *string
-
-	//the new password
-	Password *string
-
-	//flag if user is active or not, without deleting him
-	Active *bool
-
-	//reference to an optional avatar image
-	AvatarImage *db.PK
-
-	//list of connected email addresses e.g. tschinke@domain.com, torben.schinke@otherdomain.com, ...
-	EMailAddresses *[]string
+type userListDTO = api.UserList
 
-	//reference to an optional company
-	Company *db.PK
-
-	//the groups, which this user is a member of. This determines his actual permissions.
-	Groups *[]db.PK
-}
+type userDTO = api.User
 
 func newUserDTO(user *user.User) *userDTO {
-	return &userDTO{Id: &user.Id, Login: &user.Login, Firstname: &user.Firstname, Lastname: &user.Lastname, Active: &user.Active, AvatarImage: user.AvatarImage, EMailAddresses: &user.EMailAddresses, Groups: &user.Groups, Company: user.Company}
+	return &userDTO{Id: &user.Id, Login: &user.Login, Firstname: &user.Firstname, Lastname: &user.Lastname, Active: &user.Active, AvatarImage: user.AvatarImage, EMailAddresses: &user.EMailAddresses, Groups: &user.Groups, Company: user.Company, Provider: &user.Provider, ServiceAccount: &user.ServiceAccount, Roles: &user.Roles, Locale: &user.Locale}
 }
 
 type EndpointUsers struct {
-	mux         *http.ServeMux
+	router      *Router
 	sessions    *session.Sessions
 	users       *user.Users
 	permissions *user.Permissions
+	grants      *user.Grants
+	audit       *audit.Log
 }
 
-func NewEndpointUsers(mux *http.ServeMux, sessions *session.Sessions, users *user.Users, permissions *user.Permissions) *EndpointUsers {
-	endpoint := &EndpointUsers{mux: mux, users: users, sessions: sessions, permissions: permissions}
-	mux.HandleFunc("/users/", endpoint.userVerbs)
-	mux.HandleFunc("/users/permissions/", endpoint.permissionsVerbs)
-	mux.HandleFunc("/users", endpoint.usersVerbs)
+func NewEndpointUsers(router *Router, sessions *session.Sessions, users *user.Users, permissions *user.Permissions, grants *user.Grants, auditLog *audit.Log) *EndpointUsers {
+	endpoint := &EndpointUsers{router: router, users: users, sessions: sessions, permissions: permissions, grants: grants, audit: auditLog}
+	auth := Authenticated(sessions, users)
+	router.Handle("GET", "/users", endpoint.listUsers, auth)
+	router.Handle("POST", "/users", endpoint.addUser, auth)
+	router.HandlePK("GET", "/users/{id:pk}", endpoint.getUser, auth)
+	router.HandlePK("PUT", "/users/{id:pk}", endpoint.updateUser, auth)
+	router.HandlePK("DELETE", "/users/{id:pk}", endpoint.deleteUser, auth)
+	router.HandlePK("GET", "/users/permissions/{id:pk}", endpoint.queryPermissions, Permitted(sessions, users, permissions, user.LIST_USERS))
+
+	//the sessions are credentials, which are never exposed to api tokens
+	interactive := Interactive(sessions, users)
+	router.HandlePK("GET", "/users/sessions/{id:pk}", endpoint.listSessions, interactive)
+	router.HandlePK("DELETE", "/users/sessions/{id:pk}", endpoint.deleteSessions, interactive)
+	router.Handle("DELETE", "/users/sessions/{id:pk}/{handle:pk}", endpoint.deleteSession, interactive)
+	router.HandlePK("GET", "/users/explain/{id:pk}", endpoint.explainPermission, auth)
 	return endpoint
 }
 
-func (endpoint *EndpointUsers) permissionsVerbs(writer http.ResponseWriter, request *http.Request) {
-	userId, err := db.ParsePK(strings.TrimPrefix(request.URL.Path, "/users/permissions/"))
-	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	switch request.Method {
-	case "GET":
-		endpoint.queryPermissions(writer, request, userId)
-	default:
-		http.Error(writer, request.Method, http.StatusMethodNotAllowed);
-		return
+//loads the user, which is the target of a request. Writes the error, so just return if nil.
+func (e *EndpointUsers) getTarget(writer http.ResponseWriter, userId db.PK) *user.User {
+	otherUser, err := e.users.Get(userId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return nil
 	}
+	return otherUser
 }
 
-func (endpoint *EndpointUsers) userVerbs(writer http.ResponseWriter, request *http.Request) {
-	userId, err := db.ParsePK(strings.TrimPrefix(request.URL.Path, "/users/"))
-	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	switch request.Method {
-	case "GET":
-		endpoint.getUser(writer, request, userId)
-	case "PUT":
-		endpoint.updateUser(writer, request, userId)
-	case "DELETE":
-		endpoint.deleteUser(writer, request, userId)
-
-	default:
-		http.Error(writer, request.Method, http.StatusMethodNotAllowed);
-		return
-	}
-}
-
-// A session user can always request it's own user object, but others require the correct permission (which is GET_USER)
+// A session user can always request it's own user object, but others require the correct permission (which is GET_USER),
+// either globally or for a company or group of the other user. An api token always requires the permission in its scopes.
 //  @Path GET /users/{id} (id is hex encoded user PK)
 //  @Header sid string
 //	@Return 200 github.com/worldiety/devdrasil/backend/userDTO
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
 //  @Return 500 (for any other error)
 func (e *EndpointUsers) getUser(writer http.ResponseWriter, request *http.Request, userId db.PK) {
-	_, usr := GetSessionAndUser(e.sessions, e.users, writer, request)
-	if usr == nil {
-		return
-	}
+	ses, usr := CurrentSession(request)
 
-	//a user can always request himself
-	if usr.Id == userId {
+	//a user can always request himself, but a token is restricted to its scopes
+	if usr.Id == userId && ses.Token == nil {
 		//return the user dto
 		WriteJSONBody(writer, newUserDTO(usr))
 		return
 	} else {
-		//check if the permission is available
-		allowed, err := e.permissions.IsAllowed(user.GET_USER, usr)
-		if err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if !allowed {
-			http.Error(writer, err.Error(), http.StatusForbidden)
+		otherUser := e.getTarget(writer, userId)
+		if otherUser == nil {
 			return
 		}
 
-		otherUser, err := e.users.Get(userId)
-		if err != nil {
-			if db.IsEntityNotFound(err) {
-				http.Error(writer, err.Error(), http.StatusNotFound)
-				return
-			} else {
-				http.Error(writer, err.Error(), http.StatusInternalServerError)
-			}
+		//check if the permission is available
+		if !checkAllowedOn(e.permissions, writer, ses, usr, user.GET_USER, &user.Target{User: otherUser}) {
 			return
 		}
+
 		//return the other user dto
 		WriteJSONBody(writer, newUserDTO(otherUser))
 		return
 	}
 }
 
-// A user can always update his data on his own. Inactive users cannot make changes, but they can make themself inactive. Also users can do so, when having UPDATE permission.
+// A user can always update his data on his own, except groups, company, service account, active state and password. Also users can do so, when having UPDATE permission. See also PUT /me and PUT /me/password.
+// An api token always requires the UPDATE permission in its scopes, also to update its own user.
+// The UPDATE permission may also be granted for a company or group of the user, see isAllowedToAssign for the limits.
+// Deactivating a user or changing his password revokes all of his sessions, except the one of the request.
 //  @Path PUT /users/{id}
 //  @Header sid string
 //	@Body github.com/worldiety/devdrasil/backend/userDTO
 //	@Return 200 github.com/worldiety/devdrasil/backend/userDTO
-//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent)
+//  @Return 400 (if the locale is unknown)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointUsers) updateUser(writer http.ResponseWriter, request *http.Request, userId db.PK) {
-	_, usr := GetSessionAndUser(e.sessions, e.users, writer, request)
-	if usr == nil {
-		return
-	}
+	ses, usr := CurrentSession(request)
 
 	dto := &userDTO{}
 	err := ReadJSONBody(writer, request, dto)
@@ -166,64 +107,181 @@ func (e *EndpointUsers) updateUser(writer http.ResponseWriter, request *http.Req
 	}
 
 	var userToUpdate *user.User
-	//a user can always update himself
-	if usr.Id == userId {
+	//a user can always update himself, but without the permission he cannot change his groups, company or active state.
+	//A token is restricted to its scopes, because otherwise e.g. a leaked token could change the password.
+	if usr.Id == userId && ses.Token == nil {
+		//the own password is changed by PUT /me/password, which requires the old one
+		changesPassword := dto.Password != nil && len(*dto.Password) > 0
+		if isEscalation(usr, dto) || changesPassword {
+			allowed, err := isAllowedOn(e.permissions, ses, usr, user.UPDATE_USER, &user.Target{User: usr})
+			if err != nil {
+				WriteInternalError(writer, err)
+				return
+			}
+			if !allowed && changesPassword {
+				writePermissionDenied(writer, ses, user.UPDATE_USER, "use PUT /me/password to change the own password")
+				return
+			}
+			if !allowed {
+				writePermissionDenied(writer, ses, user.UPDATE_USER, "groups, company and active state require the permission")
+				return
+			}
+		}
 		userToUpdate = usr
 
 	} else {
-		//check if the permission is available
-		allowed, err := e.permissions.IsAllowed(user.UPDATE_USER, usr)
-		if err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if !allowed {
-			http.Error(writer, "", http.StatusForbidden)
+		otherUser := e.getTarget(writer, userId)
+		if otherUser == nil {
 			return
 		}
 
-		otherUser, err := e.users.Get(userId)
-		if err != nil {
-			if db.IsEntityNotFound(err) {
-				http.Error(writer, err.Error(), http.StatusNotFound)
-			} else {
-				http.Error(writer, err.Error(), http.StatusInternalServerError)
-			}
+		//check if the permission is available
+		if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_USER, &user.Target{User: otherUser}) {
 			return
 		}
 
 		userToUpdate = otherUser
 	}
 
+	if !e.isAllowedToAssign(writer, ses, usr, userToUpdate, dto) {
+		return
+	}
+
+	if !isValidLocale(writer, dto.Locale) {
+		return
+	}
+
 	if dto.Password != nil {
 		if len(*dto.Password) > 0 {
-			if !isGoodPassword(*dto.Password) {
-				http.Error(writer, "password to weak", http.StatusBadRequest)
+			if !user.IsGoodPassword(*dto.Password) {
+				WriteError(writer, http.StatusBadRequest, "password to weak")
 				return
 			}
 		}
 	}
 
+	//a deactivated user or a changed password invalidates all sessions, except the one which made the change
+	revokeSessions := (dto.Active != nil && !*dto.Active && userToUpdate.Active) || (dto.Password != nil && len(*dto.Password) > 0)
+
+	before := *userToUpdate
+
 	//actually transfer affected fields
 	e.updateUserFields(userToUpdate, dto)
 
 	//rewrite
 	err = e.users.Update(userToUpdate)
 	if err != nil {
-		if db.IsNotUnique(err) {
-			http.Error(writer, err.Error(), http.StatusBadRequest)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+		AnyErrorAsHTTPError(err, writer)
 
 		return
 	}
 
+	if revokeSessions {
+		_, err = e.sessions.DeleteByUser(userToUpdate.Id, ses.Id)
+		if err != nil {
+			WriteInternalError(writer, err)
+			return
+		}
+	}
+
+	recordAudit(e.audit, ses, usr, request, "user.update", userToUpdate.Id.String(), &before, userToUpdate)
+
 	//return the newly data
 	WriteJSONBody(writer, newUserDTO(userToUpdate))
 
 }
 
+//checks if the dto would change the groups, roles, company or active state of the user
+func isEscalation(usr *user.User, dto *userDTO) bool {
+	if dto.Active != nil && *dto.Active != usr.Active {
+		return true
+	}
+
+	if dto.Company != nil && !usr.HasCompany(*dto.Company) {
+		return true
+	}
+
+	if dto.ServiceAccount != nil && *dto.ServiceAccount != usr.ServiceAccount {
+		return true
+	}
+
+	if dto.Groups != nil {
+		if len(*dto.Groups) != len(usr.Groups) {
+			return true
+		}
+		for _, gid := range *dto.Groups {
+			if !usr.HasGroup(gid) {
+				return true
+			}
+		}
+	}
+
+	if dto.Roles != nil {
+		if len(*dto.Roles) != len(usr.Roles) {
+			return true
+		}
+		for _, rid := range *dto.Roles {
+			if !usr.HasRole(rid) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//Only MANAGE_TENANTS moves a user into another tenant and the groups must always belong to the tenant of the user.
+//Within the tenant, a global UPDATE_USER permission allows any assignment. Otherwise moving a user into a company requires UPDATE_USER
+//for that company, changing the groups requires UPDATE_GROUP for each added or removed group and roles or service
+//accounts cannot be changed at all. Writes the error, so just return if false.
+func (e *EndpointUsers) isAllowedToAssign(writer http.ResponseWriter, ses *session.Session, usr *user.User, target *user.User, dto *userDTO) bool {
+	tenant := target.Company
+	if dto.Company != nil && !target.HasCompany(*dto.Company) {
+		company, ok := tenantOfNew(e.permissions, writer, ses, usr, dto.Company)
+		if !ok {
+			return false
+		}
+		tenant = company
+	}
+	groups := target.Groups
+	if dto.Groups != nil {
+		groups = *dto.Groups
+	}
+	if !checkGroupsInTenant(e.permissions, writer, tenant, groups) {
+		return false
+	}
+
+	global, err := isAllowed(e.permissions, ses, usr, user.UPDATE_USER)
+	if AnyErrorAsInternalError(err, writer) {
+		return false
+	}
+	if global {
+		return true
+	}
+
+	if dto.Company != nil && !target.HasCompany(*dto.Company) {
+		if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_USER, &user.Target{Company: dto.Company}) {
+			return false
+		}
+	}
+
+	if dto.Groups != nil {
+		for _, gid := range changedPKs(target.Groups, *dto.Groups) {
+			groupId := gid
+			if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_GROUP, &user.Target{Group: &groupId}) {
+				return false
+			}
+		}
+	}
+
+	changesRoles := dto.Roles != nil && len(changedPKs(target.Roles, *dto.Roles)) > 0
+	changesServiceAccount := dto.ServiceAccount != nil && *dto.ServiceAccount != target.ServiceAccount
+	if changesRoles || changesServiceAccount {
+		writePermissionDenied(writer, ses, user.UPDATE_USER, "roles and service accounts require the global permission")
+		return false
+	}
+	return true
+}
+
 func (e *EndpointUsers) updateUserFields(usr *user.User, dto *userDTO) {
 	dto.Id = &usr.Id
 	if dto.Active != nil {
@@ -233,6 +291,10 @@ func (e *EndpointUsers) updateUserFields(usr *user.User, dto *userDTO) {
 		usr.Groups = *dto.Groups
 	}
 
+	if dto.Roles != nil {
+		usr.Roles = *dto.Roles
+	}
+
 	if dto.EMailAddresses != nil {
 		usr.EMailAddresses = *dto.EMailAddresses
 	}
@@ -257,61 +319,68 @@ func (e *EndpointUsers) updateUserFields(usr *user.User, dto *userDTO) {
 		usr.Company = dto.Company
 	}
 
-	if dto.Password != nil && len(*dto.Password) > 0 {
-		usr.SetPassword(*dto.Password)
+	if dto.ServiceAccount != nil {
+		usr.ServiceAccount = *dto.ServiceAccount
 	}
-}
 
-func (endpoint *EndpointUsers) usersVerbs(writer http.ResponseWriter, request *http.Request) {
-	switch request.Method {
-	case "GET":
-		endpoint.listUsers(writer, request);
-	case "POST":
-		endpoint.addUser(writer, request);
-	default:
-		http.Error(writer, request.Method, http.StatusMethodNotAllowed);
-		return
+	if dto.Locale != nil {
+		usr.Locale = *dto.Locale
+	}
+
+	if dto.Password != nil && len(*dto.Password) > 0 {
+		usr.SetPassword(*dto.Password)
 	}
 }
 
-// A user can list all other users, if he has the permission
+// A user can list all other users, if he has the permission. A permission for a company or group lists only their users.
 //  @Path GET /users
 //  @Header sid string
-//	@Body []github.com/worldiety/devdrasil/backend/userListDTO
-//	@Return 200
+//	@Return 200 github.com/worldiety/devdrasil/backend/userListDTO
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointUsers) listUsers(writer http.ResponseWriter, request *http.Request) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.LIST_USERS)
-	if usr == nil {
+	ses, usr := CurrentSession(request)
+
+	allowed, err := isAllowedAnywhere(e.permissions, ses, usr, user.LIST_USERS)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	if !allowed {
+		writePermissionDenied(writer, ses, user.LIST_USERS, "not granted on any scope")
 		return
 	}
 
 	users, err := e.users.List()
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 
 	res := &userListDTO{}
 	for _, u := range users {
-		res.List = append(res.List, newUserDTO(u))
+		visible, err := isAllowedOn(e.permissions, ses, usr, user.LIST_USERS, &user.Target{User: u})
+		if AnyErrorAsInternalError(err, writer) {
+			return
+		}
+		if visible {
+			res.List = append(res.List, newUserDTO(u))
+		}
 	}
 	WriteJSONBody(writer, res)
 }
 
-// A user can add another user, if he has the permission
+// A user can add another user, if he has the permission, either globally or for the company of the new user.
+// Without MANAGE_TENANTS, the new user always belongs to the company of the session user.
+// A service account requires no password.
 //  @Path POST /users
 //  @Header sid string
 //	@Body github.com/worldiety/devdrasil/backend/userDTO
 //	@Return 200 github.com/worldiety/devdrasil/backend/userDTO
+//  @Return 400 (if the locale is unknown)
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointUsers) addUser(writer http.ResponseWriter, request *http.Request) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.CREATE_USER)
-	if usr == nil {
-		return
-	}
+	ses, usr := CurrentSession(request)
 
 	dto := &userDTO{}
 	err := ReadJSONBody(writer, request, dto)
@@ -319,8 +388,34 @@ func (e *EndpointUsers) addUser(writer http.ResponseWriter, request *http.Reques
 		return
 	}
 
-	if dto.Password == nil || !isGoodPassword(*dto.Password) {
-		http.Error(writer, "password to weak", http.StatusBadRequest)
+	tenant, ok := tenantOfNew(e.permissions, writer, ses, usr, dto.Company)
+	if !ok {
+		return
+	}
+	dto.Company = tenant
+
+	var target *user.Target
+	if dto.Company != nil {
+		target = &user.Target{Company: dto.Company}
+	}
+	if !checkAllowedOn(e.permissions, writer, ses, usr, user.CREATE_USER, target) {
+		return
+	}
+
+	if !e.isAllowedToAssign(writer, ses, usr, &user.User{}, dto) {
+		return
+	}
+
+	if !isValidLocale(writer, dto.Locale) {
+		return
+	}
+
+	isServiceAccount := dto.ServiceAccount != nil && *dto.ServiceAccount
+	if isServiceAccount {
+		//a service account never has a password
+		dto.Password = nil
+	} else if dto.Password == nil || !user.IsGoodPassword(*dto.Password) {
+		WriteError(writer, http.StatusBadRequest, "password to weak")
 		return
 	}
 
@@ -328,67 +423,159 @@ func (e *EndpointUsers) addUser(writer http.ResponseWriter, request *http.Reques
 	e.updateUserFields(newUser, dto)
 
 	err = e.users.Add(newUser)
-	if err != nil {
-		if db.IsNotUnique(err) {
-			http.Error(writer, err.Error(), http.StatusBadRequest)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
+	if AnyErrorAsHTTPError(err, writer) {
 		return
 	}
 
+	recordAudit(e.audit, ses, usr, request, "user.create", newUser.Id.String(), nil, newUser)
 	WriteJSONBody(writer, newUserDTO(newUser))
 }
 
-func isGoodPassword(s string) bool {
-	var sevenOrMore, number, upper, special bool
-	letters := 0
-	for _, s := range s {
-		switch {
-		case unicode.IsNumber(s):
-			number = true
-		case unicode.IsUpper(s):
-			upper = true
-			letters++
-		case unicode.IsPunct(s) || unicode.IsSymbol(s):
-			special = true
-		case unicode.IsLetter(s) || s == ' ':
-			letters++
-		default:
-			//return false, false, false, false
-		}
-	}
-	sevenOrMore = letters >= 7
-	return sevenOrMore && number && upper && special
-}
-
-// A user can delete another user, if he has the permission
+// A user can delete another user, if he has the permission, either globally or for a company or group of the other user
 //  @Path DELETE /users/{id}
 //  @Header sid string
 //	@Return 200
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 404 (if the user does not exist)
 //  @Return 500 (for any other error)
 func (e *EndpointUsers) deleteUser(writer http.ResponseWriter, request *http.Request, userId db.PK) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.DELETE_USER)
-	if usr == nil {
+	ses, usr := CurrentSession(request)
+
+	otherUser := e.getTarget(writer, userId)
+	if otherUser == nil {
+		return
+	}
+
+	if !checkAllowedOn(e.permissions, writer, ses, usr, user.DELETE_USER, &user.Target{User: otherUser}) {
 		return
 	}
 
 	if userId == user.ADMIN {
-		http.Error(writer, "you cannot delete the super user", http.StatusForbidden)
+		WriteError(writer, http.StatusForbidden, "you cannot delete the super user")
 		return
 	}
 
 	err := e.users.Delete(userId)
+	if AnyErrorAsHTTPError(err, writer) {
+		return
+	}
+
+	_, err = e.sessions.DeleteByUser(userId)
+	if err != nil {
+		WriteInternalError(writer, err)
+		return
+	}
+
+	err = e.sessions.Tokens().DeleteByUser(userId)
+	if err != nil {
+		WriteInternalError(writer, err)
+		return
+	}
+
+	err = e.grants.DeleteReferences(userId)
 	if err != nil {
-		if db.IsEntityNotFound(err) {
-			http.Error(writer, err.Error(), http.StatusNotFound)
-		} else {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
+		return
+	}
+
+	recordAudit(e.audit, ses, usr, request, "user.delete", userId.String(), otherUser, nil)
+	WriteOK(writer)
+}
+
+// A user can always list his own sessions, others require the GET_USER permission.
+//  @Path GET /users/sessions/{id} (id is hex encoded user PK)
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/sessionInfoListDTO
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token | if user has not the permission)
+//  @Return 500 (for any other error)
+func (e *EndpointUsers) listSessions(writer http.ResponseWriter, request *http.Request, userId db.PK) {
+	ses, usr := CurrentSession(request)
+
+	if usr.Id != userId {
+		otherUser := e.getTarget(writer, userId)
+		if otherUser == nil {
+			return
+		}
+		if !checkAllowedOn(e.permissions, writer, ses, usr, user.GET_USER, &user.Target{User: otherUser}) {
+			return
+		}
+	}
+
+	list, err := e.sessions.ListByUser(userId)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	res := &sessionInfoListDTO{}
+	res.List = make([]*sessionInfoDTO, 0)
+	for _, s := range list {
+		res.List = append(res.List, newSessionInfoDTO(s, ses))
+	}
+	WriteJSONBody(writer, res)
+}
+
+// Logs a user out everywhere. A user can always revoke his own sessions, others require the UPDATE_USER permission.
+// Single sessions are revoked by DELETE /users/sessions/{id}/{handle}.
+//  @Path DELETE /users/sessions/{id} (id is hex encoded user PK)
+//  @Header sid string
+//	@Return 200
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token | if user has not the permission)
+//  @Return 500 (for any other error)
+func (e *EndpointUsers) deleteSessions(writer http.ResponseWriter, request *http.Request, userId db.PK) {
+	ses, usr := CurrentSession(request)
+
+	if usr.Id != userId {
+		otherUser := e.getTarget(writer, userId)
+		if otherUser == nil {
+			return
+		}
+		if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_USER, &user.Target{User: otherUser}) {
+			return
+		}
+	}
+
+	_, err := e.sessions.DeleteByUser(userId)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	recordAudit(e.audit, ses, usr, request, "user.sessions.revoke", userId.String(), nil, nil)
+	WriteOK(writer)
+}
+
+// Revokes a single session of a user by its handle, see GET /users/sessions/{id}. A user can always revoke his own sessions, others require the UPDATE_USER permission.
+//  @Path DELETE /users/sessions/{id}/{handle} (id is hex encoded user PK)
+//  @Header sid string
+//	@Return 200
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if authenticated by an api token | if user has not the permission)
+//  @Return 404 (if the session does not exist or belongs to another user)
+//  @Return 500 (for any other error)
+func (e *EndpointUsers) deleteSession(writer http.ResponseWriter, request *http.Request) {
+	ses, usr := CurrentSession(request)
+	userId := PathPK(request, "id")
+
+	if usr.Id != userId {
+		otherUser := e.getTarget(writer, userId)
+		if otherUser == nil {
+			return
 		}
+		if !checkAllowedOn(e.permissions, writer, ses, usr, user.UPDATE_USER, &user.Target{User: otherUser}) {
+			return
+		}
+	}
+
+	other, err := e.sessions.GetByHandle(userId, PathPK(request, "handle"))
+	if AnyErrorAsHTTPError(err, writer) {
 		return
 	}
 
+	err = e.sessions.Delete(other.Id)
+	if err != nil && !db.IsEntityNotFound(err) {
+		WriteInternalError(writer, err)
+		return
+	}
+
+	recordAudit(e.audit, ses, usr, request, "user.session.revoke", userId.String(), nil, nil)
 	WriteOK(writer)
 }
 
@@ -408,37 +595,34 @@ type userPermissionDTO struct {
 //  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
 //  @Return 500 (for any other error)
 func (e *EndpointUsers) queryPermissions(writer http.ResponseWriter, request *http.Request, userId db.PK) {
-	_, usr := validate(e.sessions, e.users, e.permissions, writer, request, user.LIST_USERS)
-	if usr == nil {
-		return
-	}
+	ses, usr := CurrentSession(request)
 
-	listUser, err := e.permissions.IsAllowed(user.LIST_USERS, usr)
+	listUser, err := isAllowed(e.permissions, ses, usr, user.LIST_USERS)
 	if AnyErrorAsInternalError(err, writer) {
 		return
 	}
 
-	createUser, err := e.permissions.IsAllowed(user.CREATE_USER, usr)
+	createUser, err := isAllowed(e.permissions, ses, usr, user.CREATE_USER)
 	if AnyErrorAsInternalError(err, writer) {
 		return
 	}
 
-	deleteUser, err := e.permissions.IsAllowed(user.DELETE_USER, usr)
+	deleteUser, err := isAllowed(e.permissions, ses, usr, user.DELETE_USER)
 	if AnyErrorAsInternalError(err, writer) {
 		return
 	}
 
-	updateUser, err := e.permissions.IsAllowed(user.UPDATE_USER, usr)
+	updateUser, err := isAllowed(e.permissions, ses, usr, user.UPDATE_USER)
 	if AnyErrorAsInternalError(err, writer) {
 		return
 	}
 
-	getUser, err := e.permissions.IsAllowed(user.GET_USER, usr)
+	getUser, err := isAllowed(e.permissions, ses, usr, user.GET_USER)
 	if AnyErrorAsInternalError(err, writer) {
 		return
 	}
 
-	listMarket, err := e.permissions.IsAllowed(user.LIST_MARKET, usr)
+	listMarket, err := isAllowed(e.permissions, ses, usr, user.LIST_MARKET)
 	if AnyErrorAsInternalError(err, writer) {
 		return
 	}
@@ -453,3 +637,101 @@ func (e *EndpointUsers) queryPermissions(writer http.ResponseWriter, request *ht
 
 	WriteJSONBody(writer, dto)
 }
+
+type explanationDTO struct {
+	//the user, whose permission is explained
+	User db.PK
+
+	//the name of the permission kind, e.g. UPDATE_USER
+	Permission string
+
+	//true, if the user has the permission globally or on the target
+	Allowed bool
+
+	//the paths which grant the kind globally or on the target, e.g. by a role of an inherited group
+	Sources []*user.Source
+
+	//the scoped grants, which contain the kind but not the target
+	OtherScopes []*user.Source
+
+	//true, if the target belongs to another tenant, which denies every kind except for MANAGE_TENANTS
+	OtherTenant bool `json:",omitempty"`
+}
+
+// Explains why a user has a permission or not. A user can always explain his own permissions, otherwise GET_USER is required.
+// The optional target is one of the query parameters user, group or company, to include the scoped grants.
+//  @Path GET /users/explain/{id}?permission={name}
+//  @Header sid string
+//	@Return 200 github.com/worldiety/devdrasil/backend/explanationDTO
+//  @Return 400 (if the permission kind is unknown or the target is invalid)
+//  @Return 403 (if session id is invalid | if session user is inactive | if session user is absent | if user has not the permission)
+//  @Return 404 (if the user or the target user does not exist)
+//  @Return 500 (for any other error)
+func (e *EndpointUsers) explainPermission(writer http.ResponseWriter, request *http.Request, userId db.PK) {
+	ses, usr := CurrentSession(request)
+
+	subject := usr
+	if usr.Id != userId {
+		subject = e.getTarget(writer, userId)
+		if subject == nil {
+			return
+		}
+		if !checkAllowedOn(e.permissions, writer, ses, usr, user.GET_USER, &user.Target{User: subject}) {
+			return
+		}
+	}
+
+	query := request.URL.Query()
+	name := query.Get("permission")
+	kind, ok, err := e.permissions.ParseName(name)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+	if !ok {
+		WriteError(writer, http.StatusBadRequest, "unknown permission kind: "+name)
+		return
+	}
+
+	target, ok := e.readExplainTarget(writer, request)
+	if !ok {
+		return
+	}
+
+	explanation, err := e.permissions.Explain(kind, subject, target)
+	if AnyErrorAsInternalError(err, writer) {
+		return
+	}
+
+	WriteJSONBody(writer, &explanationDTO{User: subject.Id, Permission: user.PermissionName(kind), Allowed: explanation.Allowed, Sources: explanation.Sources, OtherScopes: explanation.OtherScopes, OtherTenant: explanation.OtherTenant})
+}
+
+//parses the optional target of an explanation from the query parameters user, group or company. Writes the error, so just return if false.
+func (e *EndpointUsers) readExplainTarget(writer http.ResponseWriter, request *http.Request) (*user.Target, bool) {
+	query := request.URL.Query()
+	for _, param := range []string{"user", "group", "company"} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+
+		pk, err := db.ParsePK(value)
+		if err != nil {
+			WriteError(writer, http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+
+		switch param {
+		case "user":
+			other := e.getTarget(writer, pk)
+			if other == nil {
+				return nil, false
+			}
+			return &user.Target{User: other}, true
+		case "group":
+			return &user.Target{Group: &pk}, true
+		default:
+			return &user.Target{Company: &pk}, true
+		}
+	}
+	return nil, true
+}
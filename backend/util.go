@@ -1,13 +1,23 @@
 package backend
 
 import (
+	"github.com/worldiety/devdrasil/backend/api"
 	"fmt"
+	"errors"
 	"net/http"
 	"encoding/json"
 	"github.com/worldiety/devdrasil/backend/session"
 	"github.com/worldiety/devdrasil/db"
 	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/backend/i18n"
 	"io/ioutil"
+	"crypto/subtle"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+	"net"
+	"strings"
+	"github.com/worldiety/devdrasil/log"
 )
 
 func ErrPermissionDenied(which string) error {
@@ -27,7 +37,7 @@ func WriteJSONBody(writer http.ResponseWriter, obj interface{}) {
 	writer.Header().Add("Content-Type", "application/json")
 	b, err := json.Marshal(obj)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return
 	}
 	writer.Write(b)
@@ -37,72 +47,351 @@ func WriteJSONBody(writer http.ResponseWriter, obj interface{}) {
 func ReadJSONBody(writer http.ResponseWriter, request *http.Request, obj interface{}) error {
 	b, err := ioutil.ReadAll(request.Body)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		writeBodyError(writer, err)
 		return err
 	}
 	err = json.Unmarshal(b, obj)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		WriteError(writer, http.StatusBadRequest, err.Error())
 		return err
 	}
 	return nil
 }
 
-//returns either a session and a user or both nil. In the latter, you may not write anything more to the outputstream
+//responds to an unreadable or malformed request body with a 413, if it exceeds a http.MaxBytesReader, and otherwise with a 400
+func writeBodyError(writer http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		WriteError(writer, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	WriteError(writer, http.StatusBadRequest, err.Error())
+}
+
+//returns either a session and a user or both nil. In the latter, you may not write anything more to the outputstream.
+//A bearer token in the Authorization header results in an ephemeral session, restricted to the scopes of the token.
+//Otherwise the session id is taken from the sid header or from the sid cookie. Mutating requests which are authenticated
+//by the cookie must also provide the csrf token of the session.
 func GetSessionAndUser(sessions *session.Sessions, users *user.Users, writer http.ResponseWriter, request *http.Request) (*session.Session, *user.User) {
-	sessionId, err := db.ParsePK(request.Header.Get("sid"))
-	if err != nil {
-		http.Error(writer, "invalid session id format", http.StatusForbidden)
-		return nil, nil
+	//already authenticated by a middleware
+	if ses, usr := CurrentSession(request); usr != nil {
+		return ses, usr
 	}
 
-	//check session
-	session, err := sessions.Get(sessionId)
-	if err != nil {
-		http.Error(writer, "invalid session id", http.StatusForbidden)
-		return nil, nil
+	var ses *session.Session
+	if auth := request.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		tmp, err := sessions.FromToken(strings.TrimPrefix(auth, "Bearer "))
+		if err != nil {
+			WriteError(writer, http.StatusForbidden, "invalid token")
+			return nil, nil
+		}
+		ses = tmp
+	} else {
+		tmp, ok := getCookieOrHeaderSession(sessions, writer, request)
+		if !ok {
+			return nil, nil
+		}
+		ses = tmp
 	}
 
 	//re-check if user actually still exists
-	user, err := users.Get(session.User)
+	user, err := users.Get(ses.User)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusForbidden)
+		if db.IsEntityNotFound(err) {
+			WriteError(writer, http.StatusForbidden, "user does not exist")
+		} else {
+			WriteInternalError(writer, err)
+		}
 		return nil, nil
 	}
 
+	applyUserLocale(writer, user)
+
 	//check inactive
 	if !user.Active {
-		http.Error(writer, "user is inactive", http.StatusForbidden)
+		WriteError(writer, http.StatusForbidden, "user is inactive")
 		return nil, nil
 	}
 
-	return session, user
+	return ses, user
+}
+
+//resolves the session from the sid header or the sid cookie and writes an error, if it fails
+func getCookieOrHeaderSession(sessions *session.Sessions, writer http.ResponseWriter, request *http.Request) (*session.Session, bool) {
+	sid := request.Header.Get("sid")
+	fromCookie := false
+	if sid == "" {
+		if cookie, err := request.Cookie(SessionCookie); err == nil {
+			sid = cookie.Value
+			fromCookie = true
+		}
+	}
+
+	sessionId, err := db.ParsePK(sid)
+	if err != nil || sessionId.IsNIL() {
+		WriteError(writer, http.StatusForbidden, "invalid session id format")
+		return nil, false
+	}
+
+	//check session
+	ses, err := sessions.Get(sessionId)
+	if err != nil {
+		WriteError(writer, http.StatusForbidden, "invalid session id")
+		return nil, false
+	}
+
+	if sessions.IsExpired(ses) {
+		err = sessions.Delete(ses.Id)
+		if err != nil && !db.IsEntityNotFound(err) {
+			log.Default.Warn(log.New("failed to delete expired session").Put("session", ses.Id.String()).SetError(err))
+		}
+		WriteError(writer, http.StatusForbidden, "session expired")
+		return nil, false
+	}
+
+	//a browser sends the cookie automatically, so only the csrf token proves the origin of the request
+	if fromCookie && isMutating(request.Method) {
+		token := request.Header.Get(CSRFHeader)
+		if len(ses.CSRFToken) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(ses.CSRFToken)) != 1 {
+			WriteError(writer, http.StatusForbidden, "invalid csrf token")
+			return nil, false
+		}
+	}
+
+	touchSession(sessions, ses, request)
+	return ses, true
+}
+
+//checks the permission of the user, restricted to the scopes of the session (e.g. of an api token)
+func isAllowed(permissions *user.Permissions, ses *session.Session, usr *user.User, kind db.PK) (bool, error) {
+	return isAllowedOn(permissions, ses, usr, kind, nil)
+}
+
+//like isAllowed, but also accepts the grants whose scope contains the target. A nil target requires a global permission.
+func isAllowedOn(permissions *user.Permissions, ses *session.Session, usr *user.User, kind db.PK, target *user.Target) (bool, error) {
+	if ses != nil && !ses.InScope(kind) {
+		return false, nil
+	}
+	return permissions.IsAllowedOn(kind, usr, target)
 }
 
 //if returns nil, just return, because the request has been cancelled
 func validate(sessions *session.Sessions, users *user.Users, permissions *user.Permissions, writer http.ResponseWriter, request *http.Request, kind db.PK) (*session.Session, *user.User) {
+	return validateOn(sessions, users, permissions, writer, request, kind, nil)
+}
+
+//like validate, but the permission may also be granted for the scope of the target entity, e.g. the company of a user.
+//If returns nil, just return, because the request has been cancelled
+func validateOn(sessions *session.Sessions, users *user.Users, permissions *user.Permissions, writer http.ResponseWriter, request *http.Request, kind db.PK, target *user.Target) (*session.Session, *user.User) {
 	ses, usr := GetSessionAndUser(sessions, users, writer, request)
 	if usr == nil {
 		return nil, nil
 	}
 
-	allowed, err := permissions.IsAllowed(kind, usr)
+	allowed, err := isAllowedOn(permissions, ses, usr, kind, target)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return nil, nil
 	}
 
 	if !allowed {
-		http.Error(writer, "", http.StatusForbidden)
+		writePermissionDenied(writer, ses, kind, deniedReason(target))
 		return nil, nil
 	}
 	return ses, usr
 }
 
+//checks the permission on the target like isAllowedOn. Writes the error, so just return if false.
+func checkAllowedOn(permissions *user.Permissions, writer http.ResponseWriter, ses *session.Session, usr *user.User, kind db.PK, target *user.Target) bool {
+	allowed, err := isAllowedOn(permissions, ses, usr, kind, target)
+	if AnyErrorAsInternalError(err, writer) {
+		return false
+	}
+	if !allowed {
+		writePermissionDenied(writer, ses, kind, deniedReason(target))
+		return false
+	}
+	return true
+}
+
+//the details of a 403 response, if a permission kind is missing
+type permissionDeniedDTO = api.PermissionDenied
+
+//explains a denial of isAllowedOn
+func deniedReason(target *user.Target) string {
+	if target == nil {
+		return "not granted"
+	}
+	return "neither granted globally nor on the target"
+}
+
+//writes a 403, whose details name the missing permission kind. Use GET /users/explain/{id} for the details.
+func writePermissionDenied(writer http.ResponseWriter, ses *session.Session, kind db.PK, reason string) {
+	if ses != nil && !ses.InScope(kind) {
+		reason = "not in the scopes of the api token"
+	}
+	WriteErrorDetails(writer, http.StatusForbidden, "permission denied", &permissionDeniedDTO{Permission: user.PermissionName(kind), Reason: reason})
+}
+
+//returns the ids which are only in one of both lists
+func changedPKs(a []db.PK, b []db.PK) []db.PK {
+	res := make([]db.PK, 0)
+	for _, pk := range a {
+		if !containsPK(b, pk) {
+			res = append(res, pk)
+		}
+	}
+	for _, pk := range b {
+		if !containsPK(a, pk) {
+			res = append(res, pk)
+		}
+	}
+	return res
+}
+
+func containsPK(list []db.PK, pk db.PK) bool {
+	for _, k := range list {
+		if k == pk {
+			return true
+		}
+	}
+	return false
+}
+
+//checks if the kind is granted globally or on any scope, restricted to the scopes of the session. Lists must be filtered with isAllowedOn.
+func isAllowedAnywhere(permissions *user.Permissions, ses *session.Session, usr *user.User, kind db.PK) (bool, error) {
+	if ses != nil && !ses.InScope(kind) {
+		return false, nil
+	}
+	effective, err := permissions.Resolve(usr)
+	if err != nil {
+		return false, err
+	}
+	return effective.HasAnywhere(kind), nil
+}
+
+//the minimum amount of seconds between two writes of the usage information of a session
+const sessionTouchInterval = 60
+
+//remembers when, from where and with which agent a session has been used the last time
+func touchSession(sessions *session.Sessions, ses *session.Session, request *http.Request) {
+	now := time.Now().Unix()
+	addr := remoteHost(request)
+	agent := request.Header.Get("User-Agent")
+	if now-ses.LastUsedAt < sessionTouchInterval && ses.LastRemoteAddr == addr && ses.LastUserAgent == agent {
+		return
+	}
+
+	ses.LastUsedAt = now
+	ses.LastRemoteAddr = addr
+	ses.LastUserAgent = agent
+	err := sessions.Touch(ses)
+	if err != nil && !db.IsEntityNotFound(err) {
+		log.Default.Warn(log.New("failed to update session usage").Put("session", ses.Id.String()).SetError(err))
+	}
+}
+
+//returns the remote address without the port, which changes with every connection
+func remoteHost(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+//checks if the http method may change any state
+func isMutating(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return false
+	default:
+		return true
+	}
+}
+
+//writes any error as 500 without exposing the details, which are only logged together with the request id
 func AnyErrorAsInternalError(err error, writer http.ResponseWriter) bool {
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		WriteInternalError(writer, err)
 		return true
 	}
 	return false
 }
+
+//maps db.EntityNotFound to 404, db.NotUnique to 409 and anything else to 500
+func AnyErrorAsHTTPError(err error, writer http.ResponseWriter) bool {
+	switch {
+	case err == nil:
+		return false
+	case db.IsEntityNotFound(err):
+		WriteError(writer, http.StatusNotFound, err.Error())
+	case db.IsNotUnique(err):
+		WriteError(writer, http.StatusConflict, err.Error())
+	default:
+		WriteInternalError(writer, err)
+	}
+	return true
+}
+
+//the header which correlates a response with the server log
+const RequestIdHeader = "X-Request-Id"
+
+//the json body of every error response
+type errorDTO = api.Error
+
+//responds with the error envelope
+func WriteError(writer http.ResponseWriter, code int, message string) {
+	WriteErrorDetails(writer, code, message, nil)
+}
+
+//responds with the error envelope, including the details. The message is translated into the locale of the response, see Localize.
+func WriteErrorDetails(writer http.ResponseWriter, code int, message string, details interface{}) {
+	message = i18n.Default.Translate(responseLocale(writer), message)
+	b, err := json.Marshal(&errorDTO{Code: code, Message: message, Details: details, RequestId: responseRequestId(writer)})
+	if err != nil {
+		//cannot happen for our details, but never leave a request without a response
+		b = []byte(`{"Code":500,"Message":"internal server error"}`)
+		code = http.StatusInternalServerError
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(code)
+	writer.Write(b)
+}
+
+//logs the error with the request id and responds with a 500, which does not tell anything about the cause
+func WriteInternalError(writer http.ResponseWriter, err error) {
+	id := responseRequestId(writer)
+	log.Default.Error(log.New("internal server error").Put("request", id).SetError(err))
+	WriteError(writer, http.StatusInternalServerError, "internal server error")
+}
+
+//returns the request id of the response, which is usually set by WithRequestId, otherwise a new one is set
+func responseRequestId(writer http.ResponseWriter) string {
+	id := writer.Header().Get(RequestIdHeader)
+	if id == "" {
+		id = newRequestId()
+		writer.Header().Set(RequestIdHeader, id)
+	}
+	return id
+}
+
+func newRequestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+//checks if a request id of a client or a reverse proxy can be taken over into our log
+func isValidRequestId(id string) bool {
+	if len(id) == 0 || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
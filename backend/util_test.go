@@ -0,0 +1,37 @@
+package backend
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadJSONBody(t *testing.T) {
+	cases := []struct {
+		body   func(writer http.ResponseWriter) io.ReadCloser
+		status int
+	}{
+		{func(writer http.ResponseWriter) io.ReadCloser {
+			return http.MaxBytesReader(writer, ioutil.NopCloser(strings.NewReader(`{"Login":"alice"}`)), 4)
+		}, http.StatusRequestEntityTooLarge},
+		{func(writer http.ResponseWriter) io.ReadCloser {
+			return ioutil.NopCloser(iotest.ErrReader(errors.New("connection reset")))
+		}, http.StatusBadRequest},
+		{func(writer http.ResponseWriter) io.ReadCloser {
+			return ioutil.NopCloser(strings.NewReader(`{`))
+		}, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("PUT", "/me", nil)
+		request.Body = c.body(recorder)
+		if err := ReadJSONBody(recorder, request, &credentialsDTO{}); err == nil || recorder.Code != c.status {
+			t.Fatalf("expected %d but got %d: %v", c.status, recorder.Code, err)
+		}
+	}
+}
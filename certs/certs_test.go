@@ -0,0 +1,70 @@
+package certs
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "tls", "cert.pem")
+	keyFile := filepath.Join(dir, "tls", "key.pem")
+	err = EnsureSelfSigned(certFile, keyFile, []string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloader, err := NewReloader(certFile, keyFile, time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := reloader.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(first.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.VerifyHostname("localhost") != nil || leaf.VerifyHostname("127.0.0.1") != nil {
+		t.Fatal(leaf.DNSNames, leaf.IPAddresses)
+	}
+
+	//a valid certificate is kept
+	err = EnsureSelfSigned(certFile, keyFile, []string{"other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, _ := reloader.GetCertificate(nil); same != first {
+		t.Fatal("expected the same certificate")
+	}
+
+	//a renewal is reloaded
+	err = GenerateSelfSigned(certFile, keyFile, []string{"other"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	renewed, _ := reloader.GetCertificate(nil)
+	if renewed == first {
+		t.Fatal("expected the renewed certificate")
+	}
+
+	//a broken file keeps the current certificate
+	err = ioutil.WriteFile(certFile, []byte("broken"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	future = future.Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	if current, _ := reloader.GetCertificate(nil); current != renewed {
+		t.Fatal("expected the renewed certificate")
+	}
+}
@@ -0,0 +1,98 @@
+//Package certs provides the certificate of the https listener. It is reloaded from its files, when they change, e.g.
+//after a renewal by certbot, and can be generated as self-signed certificate for internal deployments.
+package certs
+
+import (
+	"crypto/tls"
+	"github.com/worldiety/devdrasil/log"
+	"os"
+	"sync"
+	"time"
+)
+
+//The Reloader serves the certificate of a cert and a key file for tls.Config.GetCertificate. It checks the files
+//at most once per interval and keeps the current certificate, if a changed file cannot be loaded, e.g. because it
+//has been written only partially.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mutex sync.Mutex
+	cert  *tls.Certificate
+
+	//the modification time of the newer file, when the certificate has been loaded
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+//NewReloader loads the certificate and fails, if it is invalid. An interval of 0 disables the reloading.
+func NewReloader(certFile string, keyFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//GetCertificate returns the current certificate and reloads it before, if the files have been changed
+func (r *Reloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	if r.interval > 0 && now.Sub(r.checkedAt) >= r.interval {
+		r.checkedAt = now
+		modTime, err := r.lastModified()
+		if err != nil {
+			log.Default.Warn(log.New("failed to check the certificate").Put("cert", r.certFile).SetError(err))
+		} else if !modTime.Equal(r.modTime) {
+			err = r.reloadLocked(modTime)
+			if err != nil {
+				log.Default.Warn(log.New("failed to reload the certificate, keeping the current one").Put("cert", r.certFile).SetError(err))
+			} else {
+				log.Default.Info(log.New("certificate reloaded").Put("cert", r.certFile))
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+//Reload loads the files immediately, e.g. on SIGHUP. The current certificate is kept, if it fails.
+func (r *Reloader) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	r.checkedAt = time.Now()
+	return r.reloadLocked(modTime)
+}
+
+func (r *Reloader) reloadLocked(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+//returns the modification time of the newer file, because a renewal replaces both
+func (r *Reloader) lastModified() (time.Time, error) {
+	res := time.Time{}
+	for _, name := range []string{r.certFile, r.keyFile} {
+		stat, err := os.Stat(name)
+		if err != nil {
+			return res, err
+		}
+		if stat.ModTime().After(res) {
+			res = stat.ModTime()
+		}
+	}
+	return res, nil
+}
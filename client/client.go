@@ -0,0 +1,197 @@
+//Package client is a typed client of the devdrasil rest api. It shares the json bodies with the backend, see package api.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/worldiety/devdrasil/backend/api"
+	"github.com/worldiety/devdrasil/db"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	//the base url of the server, e.g. https://devdrasil.mycompany.com
+	URL string
+
+	//an optional api token, which is sent instead of a session id, so that no Login is required
+	Token string
+
+	//the number of retries of idempotent requests after a network error or a 502, 503 or 504. 0 means 3 retries, a
+	//negative value disables retries.
+	Retries int
+
+	//the delay before the first retry, which doubles with each retry. 0 means 500ms.
+	RetryDelay time.Duration
+
+	//0 means a client with a timeout of 30 seconds
+	HTTPClient *http.Client
+}
+
+//A Client is safe for concurrent use. It is either authenticated by Login or by the token of the config.
+type Client struct {
+	url        string
+	token      string
+	retries    int
+	retryDelay time.Duration
+	http       *http.Client
+
+	mutex sync.Mutex
+	sid   db.PK
+}
+
+func NewClient(config *Config) *Client {
+	c := &Client{url: strings.TrimSuffix(config.URL, "/"), token: config.Token, retries: config.Retries, retryDelay: config.RetryDelay, http: config.HTTPClient}
+	if c.retries == 0 {
+		c.retries = 3
+	}
+	if c.retries < 0 {
+		c.retries = 0
+	}
+	if c.retryDelay == 0 {
+		c.retryDelay = 500 * time.Millisecond
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: 30 * time.Second}
+	}
+	return c
+}
+
+//Login creates a session, whose id is sent as sid header with all following requests
+func (c *Client) Login(login string, password string) (*api.Session, error) {
+	ses := &api.Session{}
+	err := c.do("POST", "/sessions", &api.Credentials{Login: login, Password: password, Client: api.GoClient}, ses)
+	if err != nil {
+		return nil, err
+	}
+	c.SetSession(ses.Id)
+	return ses, nil
+}
+
+//Logout deletes the current session
+func (c *Client) Logout() error {
+	sid := c.Session()
+	if sid.IsNIL() {
+		return nil
+	}
+	err := c.do("DELETE", "/sessions/"+sid.String(), nil, nil)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	c.SetSession(db.NIL)
+	return nil
+}
+
+//SetSession continues an existing session, e.g. one which has been remembered by a command line tool
+func (c *Client) SetSession(sid db.PK) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sid = sid
+}
+
+//returns the current session id or db.NIL
+func (c *Client) Session() db.PK {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.sid
+}
+
+func (c *Client) Users() *Users {
+	return &Users{client: c}
+}
+
+func (c *Client) Groups() *Groups {
+	return &Groups{client: c}
+}
+
+func (c *Client) Companies() *Companies {
+	return &Companies{client: c}
+}
+
+func (c *Client) Permissions() *Permissions {
+	return &Permissions{client: c}
+}
+
+func (c *Client) Market() *Market {
+	return &Market{client: c}
+}
+
+//sends the json body, if not nil, and decodes the response into out, if not nil. An error response is returned as *Error.
+func (c *Client) do(method string, path string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		tmp, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = tmp
+	}
+
+	//a POST may have been processed, even if the response got lost
+	retries := c.retries
+	if method == "POST" {
+		retries = 0
+	}
+
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(method, path, body)
+		retry := attempt < retries && (err != nil || isTemporary(res.StatusCode))
+		if !retry {
+			if err != nil {
+				return err
+			}
+			return readResponse(res, out)
+		}
+
+		if res != nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (c *Client) send(method string, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if sid := c.Session(); !sid.IsNIL() {
+		req.Header.Set("sid", sid.String())
+	}
+	return c.http.Do(req)
+}
+
+func readResponse(res *http.Response, out interface{}) error {
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return readError(res)
+	}
+	if out == nil {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+//the gateway of a restarting server
+func isTemporary(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"github.com/worldiety/devdrasil/db"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetriesAndErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		calls++
+		if request.Header.Get("sid") != db.NewPK("session").String() {
+			t.Errorf("missing sid header")
+		}
+		switch {
+		case request.Method == "GET" && calls == 1:
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		case request.Method == "GET":
+			writer.Write([]byte(`{"List":[{"Name":"developers"}]}`))
+		case request.Method == "POST":
+			writer.WriteHeader(http.StatusBadGateway)
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+			writer.Write([]byte(`{"Code":404,"Message":"not found","RequestId":"abc"}`))
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(&Config{URL: server.URL + "/", RetryDelay: time.Millisecond})
+	c.SetSession(db.NewPK("session"))
+
+	groups, err := c.Groups().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || len(groups) != 1 || groups[0].Name != "developers" {
+		t.Fatalf("unexpected result after %d calls: %v", calls, groups)
+	}
+
+	calls = 0
+	_, err = c.Groups().Create(groups[0])
+	if calls != 1 || err == nil {
+		t.Fatalf("a post must not be retried, but got %d calls", calls)
+	}
+
+	err = c.Groups().Delete(db.NewPK("group"))
+	if !IsNotFound(err) || err.(*Error).Body.RequestId != "abc" {
+		t.Fatalf("expected a not found error but got %v", err)
+	}
+}
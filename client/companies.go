@@ -0,0 +1,53 @@
+package client
+
+import (
+	"github.com/worldiety/devdrasil/backend/api"
+	"github.com/worldiety/devdrasil/db"
+)
+
+//the /companies endpoints
+type Companies struct {
+	client *Client
+}
+
+//returns the companies which are visible to the current user
+func (s *Companies) List() ([]*api.Company, error) {
+	res := &api.CompanyList{}
+	err := s.client.do("GET", "/companies", nil, res)
+	if err != nil {
+		return nil, err
+	}
+	return res.List, nil
+}
+
+func (s *Companies) Get(id db.PK) (*api.Company, error) {
+	res := &api.Company{}
+	err := s.client.do("GET", "/companies/"+id.String(), nil, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+//returns the created cmp, including the new id
+func (s *Companies) Create(cmp *api.Company) (*api.Company, error) {
+	res := &api.Company{}
+	err := s.client.do("POST", "/companies", cmp, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Companies) Update(id db.PK, cmp *api.Company) (*api.Company, error) {
+	res := &api.Company{}
+	err := s.client.do("PUT", "/companies/"+id.String(), cmp, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Companies) Delete(id db.PK) error {
+	return s.client.do("DELETE", "/companies/"+id.String(), nil, nil)
+}
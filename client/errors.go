@@ -0,0 +1,74 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/api"
+	"io/ioutil"
+	"net/http"
+)
+
+//An Error is returned for every error response of the server
+type Error struct {
+	//the http status of the response, which only differs from the Code of the body, if a proxy has answered
+	Status int
+
+	//the error envelope of the server
+	Body api.Error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("devdrasil: %d %s", e.Status, e.Body.Message)
+	if e.Body.RequestId != "" {
+		msg += " (request " + e.Body.RequestId + ")"
+	}
+	return msg
+}
+
+//returns the missing permission of a 403 or nil
+func (e *Error) PermissionDenied() *api.PermissionDenied {
+	if e.Body.Details == nil {
+		return nil
+	}
+	b, err := json.Marshal(e.Body.Details)
+	if err != nil {
+		return nil
+	}
+	denied := &api.PermissionDenied{}
+	if json.Unmarshal(b, denied) != nil || denied.Permission == "" {
+		return nil
+	}
+	return denied
+}
+
+func readError(res *http.Response) error {
+	e := &Error{Status: res.StatusCode}
+	b, _ := ioutil.ReadAll(res.Body)
+	if json.Unmarshal(b, &e.Body) != nil || e.Body.Message == "" {
+		//not the envelope, e.g. the response of a proxy
+		e.Body.Code = res.StatusCode
+		e.Body.Message = http.StatusText(res.StatusCode)
+	}
+	return e
+}
+
+func hasStatus(err error, status int) bool {
+	e, ok := err.(*Error)
+	return ok && e.Status == status
+}
+
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+func IsBadRequest(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
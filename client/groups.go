@@ -0,0 +1,53 @@
+package client
+
+import (
+	"github.com/worldiety/devdrasil/backend/api"
+	"github.com/worldiety/devdrasil/db"
+)
+
+//the /groups endpoints. An update replaces the members, groups and roles.
+type Groups struct {
+	client *Client
+}
+
+//returns the groups which are visible to the current user
+func (s *Groups) List() ([]*api.Group, error) {
+	res := &api.GroupList{}
+	err := s.client.do("GET", "/groups", nil, res)
+	if err != nil {
+		return nil, err
+	}
+	return res.List, nil
+}
+
+func (s *Groups) Get(id db.PK) (*api.Group, error) {
+	res := &api.Group{}
+	err := s.client.do("GET", "/groups/"+id.String(), nil, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+//returns the created grp, including the new id
+func (s *Groups) Create(grp *api.Group) (*api.Group, error) {
+	res := &api.Group{}
+	err := s.client.do("POST", "/groups", grp, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Groups) Update(id db.PK, grp *api.Group) (*api.Group, error) {
+	res := &api.Group{}
+	err := s.client.do("PUT", "/groups/"+id.String(), grp, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Groups) Delete(id db.PK) error {
+	return s.client.do("DELETE", "/groups/"+id.String(), nil, nil)
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"github.com/worldiety/devdrasil/backend/api"
+	"github.com/worldiety/devdrasil/backend/store"
+	"net/url"
+)
+
+//the market index and the /plugins endpoints. A plugin is identified by its id, e.g. my.company.plugin
+type Market struct {
+	client *Client
+}
+
+//returns the plugins and vendors of the market
+func (s *Market) Index() (*store.Index, error) {
+	res := &store.Index{}
+	err := s.client.do("GET", "/market/index", nil, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Market) Get(id string) (*api.PluginInfo, error) {
+	return s.plugin("GET", id)
+}
+
+//installs the plugin from the market
+func (s *Market) Install(id string) (*api.PluginInfo, error) {
+	return s.plugin("POST", id)
+}
+
+//updates the plugin to the latest version
+func (s *Market) Update(id string) (*api.PluginInfo, error) {
+	return s.plugin("PUT", id)
+}
+
+func (s *Market) Delete(id string) error {
+	return s.client.do("DELETE", "/plugins/"+url.PathEscape(id), nil, nil)
+}
+
+func (s *Market) plugin(method string, id string) (*api.PluginInfo, error) {
+	res := &api.PluginInfo{}
+	err := s.client.do(method, "/plugins/"+url.PathEscape(id), nil, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
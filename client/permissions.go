@@ -0,0 +1,31 @@
+package client
+
+import (
+	"github.com/worldiety/devdrasil/backend/api"
+	"net/url"
+)
+
+//the /permissions endpoints
+type Permissions struct {
+	client *Client
+}
+
+//returns the built-in and plugin permission kinds and who has them globally
+func (s *Permissions) List() ([]*api.Permission, error) {
+	res := &api.PermissionList{}
+	err := s.client.do("GET", "/permissions", nil, res)
+	if err != nil {
+		return nil, err
+	}
+	return res.List, nil
+}
+
+//replaces the users and groups, which have the kind globally, e.g. LIST_USERS
+func (s *Permissions) Update(name string, perm *api.Permission) (*api.Permission, error) {
+	res := &api.Permission{}
+	err := s.client.do("PUT", "/permissions/"+url.PathEscape(name), perm, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"github.com/worldiety/devdrasil/backend/api"
+	"github.com/worldiety/devdrasil/db"
+)
+
+//the /users endpoints. An update only changes the fields, which are not nil.
+type Users struct {
+	client *Client
+}
+
+//returns the users which are visible to the current user
+func (s *Users) List() ([]*api.User, error) {
+	res := &api.UserList{}
+	err := s.client.do("GET", "/users", nil, res)
+	if err != nil {
+		return nil, err
+	}
+	return res.List, nil
+}
+
+func (s *Users) Get(id db.PK) (*api.User, error) {
+	res := &api.User{}
+	err := s.client.do("GET", "/users/"+id.String(), nil, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+//returns the created usr, including the new id
+func (s *Users) Create(usr *api.User) (*api.User, error) {
+	res := &api.User{}
+	err := s.client.do("POST", "/users", usr, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Users) Update(id db.PK, usr *api.User) (*api.User, error) {
+	res := &api.User{}
+	err := s.client.do("PUT", "/users/"+id.String(), usr, res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Users) Delete(id db.PK) error {
+	return s.client.do("DELETE", "/users/"+id.String(), nil, nil)
+}
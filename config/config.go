@@ -0,0 +1,459 @@
+//Package config contains the settings of the server. They are read in this order, a later one overrides an earlier one:
+//	1. the defaults, see Default
+//	2. the config file, e.g. devdrasil.toml, see ReadFile
+//	3. the environment variables, e.g. DEVDRASIL_LDAP_URL for the key ldap.url, see ApplyEnv
+//	4. the command line flags, e.g. -ldap-url for the key ldap.url
+package config
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/worldiety/devdrasil/log"
+	"github.com/worldiety/devdrasil/db"
+	"github.com/worldiety/devdrasil/backend/store"
+	"github.com/worldiety/devdrasil/backend/plugin"
+)
+
+//the prefix of all environment variables
+const EnvPrefix = "DEVDRASIL_"
+
+//the environment variable, which names the config file, like the flag -config
+const EnvConfig = EnvPrefix + "CONFIG"
+
+//the name of the config file within the workspace, which is read if neither -config nor DEVDRASIL_CONFIG is set
+const Filename = "devdrasil.toml"
+
+//the formats of log.format
+const LogFormatText = "text"
+const LogFormatJSON = "json"
+
+//the appender of log.appenders, which writes to stdout. Any other appender is a file name.
+const LogAppenderConsole = "console"
+
+type Config struct {
+	//the folder where all data and the (un-isolated) plugins are organized
+	Workspace string `config:"workspace" usage:"The folder where all data and plugins are stored, defaults to ~/.devdrasil"`
+
+	//the working dir with the resources, e.g. the frontend
+	Resources string `config:"resources" usage:"The working dir with the resources"`
+
+	Host string `config:"host" usage:"A host name or ip address to which devdrasil is bound"`
+
+	Port int `config:"port" usage:"The port on which devdrasil listens"`
+
+	//additional addresses, e.g. [::1]:8080
+	Listen []string `config:"listen" usage:"A comma separated list of additional addresses to listen on, e.g. 127.0.0.1:9090"`
+
+	PublicURL string `config:"public-url" usage:"The public url of devdrasil, which is used in links of mails, e.g. https://devdrasil.mycompany.com. Required to send invitations"`
+
+	TLS        TLS        `config:"tls"`
+	Session    Session    `config:"session"`
+	Log        Log        `config:"log"`
+	Store      Store      `config:"store"`
+	Plugins    Plugins    `config:"plugins"`
+	CORS       CORS       `config:"cors"`
+	OIDC       OIDC       `config:"oidc"`
+	LDAP       LDAP       `config:"ldap"`
+	Audit      Audit      `config:"audit"`
+	SMTP       SMTP       `config:"smtp"`
+	Invitation Invitation `config:"invitation"`
+	Shutdown   Shutdown   `config:"shutdown"`
+}
+
+type TLS struct {
+	Cert string `config:"cert" usage:"The PEM encoded certificate (chain). If empty, devdrasil serves plain http"`
+	Key  string `config:"key" usage:"The PEM encoded private key of the certificate"`
+
+	//for internal deployments without a certificate authority
+	SelfSigned bool `config:"self-signed" usage:"Serve https with a self-signed certificate, which is generated into the workspace on the first start. Only for internal deployments, excludes cert and key"`
+
+	ReloadInterval time.Duration `config:"reload-interval" usage:"How often the cert and key files are checked for changes, e.g. after a renewal. 0 disables the reloading"`
+
+	RedirectAddr string `config:"redirect-addr" usage:"An address, e.g. :80, whose plain http requests are redirected to https. If empty, no redirect listener is started"`
+
+	HSTSMaxAge            time.Duration `config:"hsts-max-age" usage:"How long a browser must only use https, see Strict-Transport-Security. 0 disables the header"`
+	HSTSIncludeSubdomains bool          `config:"hsts-include-subdomains" usage:"Whether the Strict-Transport-Security also applies to all subdomains"`
+}
+
+type Session struct {
+	IdleTimeout time.Duration `config:"idle-timeout" usage:"A session expires, if it has not been used for this duration. 0 disables the expiry"`
+	MaxLifetime time.Duration `config:"max-lifetime" usage:"A session expires at the latest after this duration, regardless of its usage. 0 disables the expiry"`
+}
+
+type Log struct {
+	Level     string   `config:"level" usage:"The most verbose level to log, one of emergency, alert, critical, error, warning, notice, informational or debug"`
+	Format    string   `config:"format" usage:"The format of the log entries, text or json"`
+	Appenders []string `config:"appenders" usage:"A comma separated list of console and file names, where the log is appended"`
+}
+
+type Store struct {
+	IndexURL string `config:"index-url" usage:"The url of the index of the plugin market"`
+}
+
+type Plugins struct {
+	PortMin int `config:"port-min" usage:"The first host port, which is assigned to a plugin container"`
+	PortMax int `config:"port-max" usage:"The last host port, which is assigned to a plugin container"`
+}
+
+type CORS struct {
+	Origins []string `config:"origins" usage:"A comma separated list of origins, which may call the api from a browser, e.g. https://app.mycompany.com. If empty, cross origin requests are not allowed. * allows any origin, but without cookies"`
+}
+
+type OIDC struct {
+	Issuer       string `config:"issuer" usage:"The OpenID Connect issuer url. If empty, the login with an identity provider is disabled"`
+	ClientId     string `config:"client-id" usage:"The client id, registered at the issuer"`
+	ClientSecret string `config:"client-secret" usage:"The client secret, registered at the issuer" secret:"true"`
+	RedirectURL  string `config:"redirect-url" usage:"The public url of the callback, e.g. https://devdrasil.mycompany.com/oidc/callback"`
+	LoginClaim   string `config:"login-claim" usage:"The claim which is used as login"`
+	GroupsClaim  string `config:"groups-claim" usage:"The claim which contains the names of the groups"`
+
+	//the tenant of the users of the issuer
+	Company string `config:"company" usage:"The hex encoded id of the company, which provisioned users belong to. If empty, they belong to no company"`
+}
+
+//parses the company of the provisioned users, which is nil if empty
+func (o *OIDC) CompanyId() (*db.PK, error) {
+	if o.Company == "" {
+		return nil, nil
+	}
+	//ParsePK pads a short id with zeros, so that a typo would name a different company
+	if len(o.Company) != hex.EncodedLen(len(db.NIL)) {
+		return nil, fmt.Errorf("invalid company id '%s'", o.Company)
+	}
+	pk, err := db.ParsePK(o.Company)
+	if err != nil {
+		return nil, err
+	}
+	return &pk, nil
+}
+
+type LDAP struct {
+	URL            string        `config:"url" usage:"The LDAP url, e.g. ldaps://ldap.mycompany.com. If empty, the LDAP authentication is disabled"`
+	StartTLS       bool          `config:"starttls" usage:"Upgrade a ldap:// connection using StartTLS"`
+	BindDN         string        `config:"bind-dn" usage:"The DN of the service account"`
+	BindPassword   string        `config:"bind-password" usage:"The password of the service account" secret:"true"`
+	UserBaseDN     string        `config:"user-base-dn" usage:"Where to search for users, e.g. ou=people,dc=mycompany,dc=com"`
+	UserFilter     string        `config:"user-filter" usage:"The filter for all users"`
+	LoginAttribute string        `config:"login-attribute" usage:"The attribute which contains the login, e.g. uid or sAMAccountName"`
+	GroupBaseDN    string        `config:"group-base-dn" usage:"Where to search for groups. If empty, groups are not synchronized"`
+	GroupFilter    string        `config:"group-filter" usage:"The filter for all groups"`
+	SyncInterval   time.Duration `config:"sync-interval" usage:"The interval to synchronize users and groups, 0 disables the synchronization"`
+}
+
+type Audit struct {
+	CheckpointInterval time.Duration `config:"checkpoint-interval" usage:"The interval to sign the head of the audit chain"`
+}
+
+type SMTP struct {
+	Addr     string `config:"addr" usage:"The mail server, e.g. smtp.mycompany.com:587. If empty, mails are only written to the log"`
+	From     string `config:"from" usage:"The sender address of mails, e.g. devdrasil@mycompany.com"`
+	Username string `config:"username" usage:"The user to authenticate at the mail server"`
+	Password string `config:"password" usage:"The password to authenticate at the mail server" secret:"true"`
+}
+
+type Invitation struct {
+	TTL time.Duration `config:"ttl" usage:"How long an invitation can be accepted"`
+}
+
+type Shutdown struct {
+	Timeout    time.Duration `config:"timeout" usage:"How long the open requests and write transactions may take on SIGTERM"`
+	JobTimeout time.Duration `config:"job-timeout" usage:"How long the running installations, updates and removals of plugins may take on SIGTERM"`
+}
+
+//the keys, which a reload of the configuration applies without a restart, see Changed
+var Reloadable = []string{"log.level", "log.format", "log.appenders", "session.idle-timeout", "session.max-lifetime", "cors.origins", "store.index-url", "tls.hsts-max-age", "tls.hsts-include-subdomains", "shutdown.timeout", "shutdown.job-timeout"}
+
+//Default returns the settings, which are used if nothing else is configured
+func Default() *Config {
+	cfg := &Config{}
+	if home := os.Getenv("HOME"); home != "" {
+		cfg.Workspace = filepath.Join(home, ".devdrasil")
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		cfg.Resources = cwd
+	}
+	cfg.Host = "0.0.0.0"
+	cfg.Port = 8080
+	cfg.TLS.ReloadInterval = time.Minute
+	cfg.TLS.HSTSMaxAge = 365 * 24 * time.Hour
+	cfg.Log = Log{Level: "informational", Format: LogFormatText, Appenders: []string{LogAppenderConsole}}
+	cfg.Store.IndexURL = store.DefaultIndexURL
+	cfg.Plugins = Plugins{PortMin: plugin.DefaultPortMin, PortMax: plugin.DefaultPortMax}
+	cfg.OIDC.LoginClaim = "preferred_username"
+	cfg.OIDC.GroupsClaim = "groups"
+	cfg.LDAP.UserFilter = "(objectClass=person)"
+	cfg.LDAP.LoginAttribute = "uid"
+	cfg.LDAP.GroupFilter = "(objectClass=groupOfNames)"
+	cfg.LDAP.SyncInterval = time.Hour
+	cfg.Audit.CheckpointInterval = 10 * time.Minute
+	cfg.Invitation.TTL = 72 * time.Hour
+	cfg.Shutdown = Shutdown{Timeout: 30 * time.Second, JobTimeout: 10 * time.Minute}
+	return cfg
+}
+
+//Load reads the config file, the environment and the flags of the command line, in this order, and validates the result.
+//The config file is given by -config or DEVDRASIL_CONFIG, otherwise the devdrasil.toml in the workspace is read, if it
+//exists. Returns flag.ErrHelp, if -h has been requested. An invalid configuration is returned together with the error.
+func Load(name string, args []string) (*Config, error) {
+	cfg := Default()
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagConfig := flags.String("config", os.Getenv(EnvConfig), "The config file, see devdrasil config print. Defaults to $"+EnvConfig+" or "+Filename+" in the workspace")
+
+	//the flags override the file and the environment, so they are applied at last
+	overrides := &flagOverrides{}
+	for _, f := range cfg.fields() {
+		flags.Var(&flagValue{field: f, overrides: overrides}, f.Flag(), f.Usage+" ($"+f.Env()+")")
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	file := *flagConfig
+	if file == "" {
+		workspace := cfg.Workspace
+		if env, ok := os.LookupEnv(EnvPrefix + "WORKSPACE"); ok {
+			workspace = env
+		}
+		if overrides.has("workspace") {
+			workspace = overrides.get("workspace")
+		}
+		if _, err := os.Stat(filepath.Join(workspace, Filename)); err == nil {
+			file = filepath.Join(workspace, Filename)
+		}
+	}
+	if file != "" {
+		err = cfg.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = cfg.ApplyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	err = overrides.apply()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+//Addresses returns host:port and the additional listen addresses
+func (c *Config) Addresses() []string {
+	res := []string{net.JoinHostPort(c.Host, strconv.Itoa(c.Port))}
+	return append(res, c.Listen...)
+}
+
+//checks if a certificate is configured or self-signed, so that devdrasil serves https
+func (c *Config) IsTLS() bool {
+	return c.TLS.Cert != "" || c.TLS.SelfSigned
+}
+
+//returns the cert and the key file, which is either configured or the self-signed one in the workspace
+func (c *Config) CertFiles() (string, string) {
+	if c.TLS.SelfSigned {
+		return filepath.Join(c.Workspace, "tls", "cert.pem"), filepath.Join(c.Workspace, "tls", "key.pem")
+	}
+	return c.TLS.Cert, c.TLS.Key
+}
+
+//Validate checks the settings and returns an error, which lists each invalid one
+func (c *Config) Validate() error {
+	problems := make([]string, 0)
+	fail := func(key string, format string, args ...interface{}) {
+		problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+	}
+
+	if c.Workspace == "" {
+		fail("workspace", "is required, because $HOME is not set")
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		fail("port", "must be between 1 and 65535")
+	}
+	for _, addr := range c.Listen {
+		if _, port, err := net.SplitHostPort(addr); err != nil {
+			fail("listen", "%v", err)
+		} else if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			fail("listen", "invalid port in %s", addr)
+		}
+	}
+	if c.PublicURL != "" && !isAbsoluteURL(c.PublicURL) {
+		fail("public-url", "must be an absolute url")
+	}
+
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		fail("tls", "requires both, cert and key")
+	}
+	for _, file := range []string{c.TLS.Cert, c.TLS.Key} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			fail("tls", "%v", err)
+		}
+	}
+	if c.TLS.SelfSigned && c.TLS.Cert != "" {
+		fail("tls.self-signed", "excludes cert and key")
+	}
+	if c.TLS.ReloadInterval < 0 {
+		fail("tls.reload-interval", "must not be negative")
+	}
+	if c.TLS.RedirectAddr != "" {
+		if !c.IsTLS() {
+			fail("tls.redirect-addr", "requires https, either by cert and key or self-signed")
+		}
+		if _, _, err := net.SplitHostPort(c.TLS.RedirectAddr); err != nil {
+			fail("tls.redirect-addr", "%v", err)
+		}
+	}
+	if c.TLS.HSTSMaxAge < 0 {
+		fail("tls.hsts-max-age", "must not be negative")
+	}
+
+	if c.Session.IdleTimeout < 0 {
+		fail("session.idle-timeout", "must not be negative")
+	}
+	if c.Session.MaxLifetime < 0 {
+		fail("session.max-lifetime", "must not be negative")
+	}
+
+	if _, err := log.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level", "%v", err)
+	}
+	if c.Log.Format != LogFormatText && c.Log.Format != LogFormatJSON {
+		fail("log.format", "must be %s or %s", LogFormatText, LogFormatJSON)
+	}
+	if len(c.Log.Appenders) == 0 {
+		fail("log.appenders", "at least one appender is required")
+	}
+
+	if !isAbsoluteURL(c.Store.IndexURL) {
+		fail("store.index-url", "must be an absolute url")
+	}
+
+	if c.Plugins.PortMin < 1 || c.Plugins.PortMax > 65535 || c.Plugins.PortMin > c.Plugins.PortMax {
+		fail("plugins", "the port range %d-%d is invalid", c.Plugins.PortMin, c.Plugins.PortMax)
+	}
+
+	for _, origin := range c.CORS.Origins {
+		if origin != "*" && !isAbsoluteURL(origin) {
+			fail("cors.origins", "%s is not an origin, e.g. https://app.mycompany.com", origin)
+		}
+	}
+
+	if c.OIDC.Issuer != "" {
+		if !isAbsoluteURL(c.OIDC.Issuer) {
+			fail("oidc.issuer", "must be an absolute url")
+		}
+		if c.OIDC.ClientId == "" {
+			fail("oidc.client-id", "is required by the issuer")
+		}
+		if !isAbsoluteURL(c.OIDC.RedirectURL) {
+			fail("oidc.redirect-url", "must be an absolute url")
+		}
+	}
+	if _, err := c.OIDC.CompanyId(); err != nil {
+		fail("oidc.company", "must be the hex encoded id of a company")
+	}
+
+	if c.LDAP.URL != "" {
+		if u, err := url.Parse(c.LDAP.URL); err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+			fail("ldap.url", "must be a ldap:// or ldaps:// url")
+		}
+		if c.LDAP.UserBaseDN == "" {
+			fail("ldap.user-base-dn", "is required by the url")
+		}
+	}
+	if c.LDAP.SyncInterval < 0 {
+		fail("ldap.sync-interval", "must not be negative")
+	}
+
+	if c.Audit.CheckpointInterval <= 0 {
+		fail("audit.checkpoint-interval", "must be positive")
+	}
+
+	if c.SMTP.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.SMTP.Addr); err != nil {
+			fail("smtp.addr", "%v", err)
+		}
+		if c.SMTP.From == "" {
+			fail("smtp.from", "is required by the mail server")
+		}
+	}
+
+	if c.Invitation.TTL <= 0 {
+		fail("invitation.ttl", "must be positive")
+	}
+
+	if c.Shutdown.Timeout <= 0 {
+		fail("shutdown.timeout", "must be positive")
+	}
+	if c.Shutdown.JobTimeout <= 0 {
+		fail("shutdown.job-timeout", "must be positive")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+//Changed returns the keys, whose values differ in the other configuration
+func (c *Config) Changed(other *Config) []string {
+	res := make([]string, 0)
+	otherFields := other.fields()
+	for i, f := range c.fields() {
+		if f.String() != otherFields[i].String() {
+			res = append(res, f.Key)
+		}
+	}
+	return res
+}
+
+//NewLogger creates a logger with the level, the format and the appenders of the settings
+func (l *Log) NewLogger() (*log.Logger, error) {
+	level, err := log.ParseLevel(l.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := log.NewConsoleLogger()
+	logger.Level = level
+	logger.Appenders = nil
+	for _, name := range l.Appenders {
+		var writer log.WriteAppender = &log.TextWriter{}
+		if l.Format == LogFormatJSON {
+			writer = &log.JSONWriter{}
+		}
+		if name == LogAppenderConsole {
+			logger.Appenders = append(logger.Appenders, log.NewConsoleWriteAppender(writer))
+			continue
+		}
+		appender, err := log.NewFileWriteAppender(name, writer)
+		if err != nil {
+			return nil, err
+		}
+		logger.Appenders = append(logger.Appenders, appender)
+	}
+	return logger, nil
+}
+
+func isAbsoluteURL(str string) bool {
+	u, err := url.Parse(str)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTOML = `
+# the listener
+port = 9090
+listen = [
+	"127.0.0.1:9091", # loopback
+	'[::1]:9092',
+]
+
+[ldap]
+url = "ldaps://ldap.mycompany.com" # with a comment
+user-base-dn = "ou=people,dc=mycompany,dc=com"
+starttls = true
+sync-interval = "30m"
+bind-password = "a#b"
+
+[session]
+idle-timeout = "2h"
+`
+
+func TestReadTOML(t *testing.T) {
+	cfg := Default()
+	err := cfg.ReadTOML(strings.NewReader(testTOML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 9090 || len(cfg.Listen) != 2 || cfg.Listen[1] != "[::1]:9092" {
+		t.Fatal(cfg.Port, cfg.Listen)
+	}
+	if cfg.LDAP.URL != "ldaps://ldap.mycompany.com" || !cfg.LDAP.StartTLS || cfg.LDAP.SyncInterval != 30*time.Minute || cfg.LDAP.BindPassword != "a#b" {
+		t.Fatal(cfg.LDAP)
+	}
+	if cfg.Session.IdleTimeout != 2*time.Hour {
+		t.Fatal(cfg.Session)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Default().ReadTOML(strings.NewReader("[ldap]\nuri = \"x\""))
+	if err == nil || !strings.Contains(err.Error(), "unknown key ldap.uri") {
+		t.Fatal(err)
+	}
+	err = Default().ReadTOML(strings.NewReader("port = \"abc\""))
+	if err == nil {
+		t.Fatal("expected an invalid value")
+	}
+}
+
+func TestOIDCCompany(t *testing.T) {
+	for company, valid := range map[string]bool{"": true, "61636d65000000000000000000000000": true, "61636d65": false, "acme": false} {
+		cfg := Default()
+		cfg.OIDC.Company = company
+		err := cfg.Validate()
+		if (err == nil) != valid {
+			t.Fatal(company, err)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := Default()
+	env := map[string]string{"DEVDRASIL_PORT": "1234", "DEVDRASIL_CORS_ORIGINS": "https://a.com, https://b.com", "DEVDRASIL_SMTP_ADDR": "mail:25"}
+	err := cfg.ApplyEnv(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 1234 || len(cfg.CORS.Origins) != 2 || cfg.CORS.Origins[1] != "https://b.com" {
+		t.Fatal(cfg.Port, cfg.CORS.Origins)
+	}
+
+	//the sender is missing
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "smtp.from") {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteTOML(t *testing.T) {
+	cfg := Default()
+	err := cfg.ReadTOML(strings.NewReader(testTOML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = cfg.WriteTOML(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "a#b") || !strings.Contains(buf.String(), "$DEVDRASIL_LDAP_BIND_PASSWORD, -ldap-bind-password") {
+		t.Fatal(buf.String())
+	}
+
+	other := Default()
+	err = other.ReadTOML(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Port != cfg.Port || other.LDAP.SyncInterval != cfg.LDAP.SyncInterval || other.Listen[0] != cfg.Listen[0] {
+		t.Fatal(other)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	cfg := Default()
+	other := Default()
+	other.Port = 1
+	other.CORS.Origins = []string{"https://a.com"}
+	changed := cfg.Changed(other)
+	if len(changed) != 2 || changed[0] != "port" || changed[1] != "cors.origins" {
+		t.Fatal(changed)
+	}
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//a single setting of the Config, e.g. ldap.url
+type field struct {
+	//the key of the setting, e.g. ldap.url
+	Key string
+
+	Usage string
+
+	//secrets are not printed, see WriteTOML
+	Secret bool
+
+	value reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+//returns the settings in the order of their declaration, the nested structs become sections, e.g. ldap.url
+func (c *Config) fields() []*field {
+	return collectFields("", reflect.ValueOf(c).Elem())
+}
+
+func collectFields(section string, value reflect.Value) []*field {
+	res := make([]*field, 0)
+	for i := 0; i < value.NumField(); i++ {
+		info := value.Type().Field(i)
+		key := info.Tag.Get("config")
+		if key == "" {
+			continue
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		if info.Type.Kind() == reflect.Struct {
+			res = append(res, collectFields(key, value.Field(i))...)
+			continue
+		}
+		res = append(res, &field{Key: key, Usage: info.Tag.Get("usage"), Secret: info.Tag.Get("secret") == "true", value: value.Field(i)})
+	}
+	return res
+}
+
+//returns the setting of the key or nil
+func (c *Config) field(key string) *field {
+	for _, f := range c.fields() {
+		if f.Key == key {
+			return f
+		}
+	}
+	return nil
+}
+
+//the section of the key, e.g. ldap for ldap.url or empty for port
+func (f *field) Section() string {
+	if idx := strings.LastIndex(f.Key, "."); idx >= 0 {
+		return f.Key[:idx]
+	}
+	return ""
+}
+
+//the key without its section, e.g. url for ldap.url
+func (f *field) Name() string {
+	return f.Key[strings.LastIndex(f.Key, ".")+1:]
+}
+
+//the name of the command line flag, e.g. ldap-url for ldap.url
+func (f *field) Flag() string {
+	return strings.Replace(f.Key, ".", "-", -1)
+}
+
+//the name of the environment variable, e.g. DEVDRASIL_LDAP_URL for ldap.url
+func (f *field) Env() string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(f.Key))
+}
+
+func (f *field) IsList() bool {
+	return f.value.Kind() == reflect.Slice
+}
+
+//parses the text like the flag package, a list is comma separated
+func (f *field) Set(text string) error {
+	if f.IsList() {
+		list := make([]string, 0)
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return f.SetList(list)
+	}
+
+	var err error
+	switch {
+	case f.value.Type() == durationType:
+		var d time.Duration
+		d, err = time.ParseDuration(text)
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.Int:
+		var i int
+		i, err = strconv.Atoi(text)
+		f.value.SetInt(int64(i))
+	case f.value.Kind() == reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(text)
+		f.value.SetBool(b)
+	default:
+		f.value.SetString(text)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: invalid value '%s'", f.Key, text)
+	}
+	return nil
+}
+
+func (f *field) SetList(list []string) error {
+	if !f.IsList() {
+		return fmt.Errorf("%s: expected a single value but got a list", f.Key)
+	}
+	f.value.Set(reflect.ValueOf(list))
+	return nil
+}
+
+//formats the value like the flag package, a list is comma separated
+func (f *field) String() string {
+	if f.IsList() {
+		return strings.Join(f.value.Interface().([]string), ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+//ApplyEnv sets each setting, whose environment variable is present, e.g. DEVDRASIL_LDAP_URL. The lookup is usually
+//os.LookupEnv.
+func (c *Config) ApplyEnv(lookup func(key string) (string, bool)) error {
+	for _, f := range c.fields() {
+		if text, ok := lookup(f.Env()); ok {
+			err := f.Set(text)
+			if err != nil {
+				return fmt.Errorf("%s: %v", f.Env(), err)
+			}
+		}
+	}
+	return nil
+}
+
+//collects the values of the flags, which are applied after the config file and the environment
+type flagOverrides struct {
+	values []*flagValue
+	texts  []string
+}
+
+func (o *flagOverrides) has(key string) bool {
+	for _, v := range o.values {
+		if v.field.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+//returns the last value of the key
+func (o *flagOverrides) get(key string) string {
+	res := ""
+	for i, v := range o.values {
+		if v.field.Key == key {
+			res = o.texts[i]
+		}
+	}
+	return res
+}
+
+func (o *flagOverrides) apply() error {
+	for i, v := range o.values {
+		err := v.field.Set(o.texts[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//a flag.Value, which defers the setting to flagOverrides
+type flagValue struct {
+	field     *field
+	overrides *flagOverrides
+}
+
+func (v *flagValue) String() string {
+	//the flag package calls it on a zero value to detect defaults
+	if v.field == nil {
+		return ""
+	}
+	return v.field.String()
+}
+
+func (v *flagValue) Set(text string) error {
+	//fail early, the actual value is set by flagOverrides.apply
+	tmp := reflect.New(v.field.value.Type()).Elem()
+	err := (&field{Key: v.field.Key, value: tmp}).Set(text)
+	if err != nil {
+		return err
+	}
+	v.overrides.values = append(v.overrides.values, v)
+	v.overrides.texts = append(v.overrides.texts, text)
+	return nil
+}
+
+//lets the flag package print -ldap-starttls instead of -ldap-starttls value
+func (v *flagValue) IsBoolFlag() bool {
+	return v.field != nil && v.field.value.Kind() == reflect.Bool
+}
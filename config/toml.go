@@ -0,0 +1,225 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/*
+ReadFile reads a config file in a subset of TOML, which is sufficient for the flat settings of the Config:
+	# a comment
+	port = 8080
+	listen = ["127.0.0.1:9090", "[::1]:8080"]
+
+	[ldap]
+	url = "ldaps://ldap.mycompany.com"
+	sync-interval = "30m"
+
+Each line is either a comment, a [section] or a key = value. A value is a string in double or single quotes, a number,
+a boolean or an array of strings, which may span multiple lines. Unknown keys are rejected to reveal typos.
+*/
+func (c *Config) ReadFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = c.ReadTOML(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+//ReadTOML parses the settings from the reader, see ReadFile
+func (c *Config) ReadTOML(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	section := ""
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return fmt.Errorf("line %d: unterminated section", lineNo)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			return fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key := strings.TrimSpace(line[:idx])
+		if section != "" {
+			key = section + "." + key
+		}
+		f := c.field(key)
+		if f == nil {
+			return fmt.Errorf("line %d: unknown key %s", lineNo, key)
+		}
+
+		value := strings.TrimSpace(line[idx+1:])
+		start := lineNo
+		if strings.HasPrefix(value, "[") {
+			//an array may span multiple lines
+			for !strings.HasSuffix(value, "]") && scanner.Scan() {
+				lineNo++
+				value += " " + strings.TrimSpace(stripComment(scanner.Text()))
+			}
+			list, err := parseArray(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", start, err)
+			}
+			err = f.SetList(list)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", start, err)
+			}
+			continue
+		}
+
+		text, err := parseValue(value)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", start, err)
+		}
+		err = f.Set(text)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", start, err)
+		}
+	}
+	return scanner.Err()
+}
+
+//removes a # comment, which is not within a string
+func stripComment(line string) string {
+	quote := rune(0)
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote == '"':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+//parses a quoted string or returns a bare value, like a number or a boolean, as it is
+func parseValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return value[1 : len(value)-1], nil
+	case value == "":
+		return "", fmt.Errorf("missing value")
+	default:
+		return value, nil
+	}
+}
+
+//parses an array of strings, e.g. ["a", 'b']
+func parseArray(value string) ([]string, error) {
+	if !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("unterminated array")
+	}
+	res := make([]string, 0)
+	rest := strings.TrimSpace(value[1 : len(value)-1])
+	for rest != "" {
+		end := -1
+		switch rest[0] {
+		case '"':
+			escaped := false
+			for i := 1; i < len(rest) && end < 0; i++ {
+				switch {
+				case escaped:
+					escaped = false
+				case rest[i] == '\\':
+					escaped = true
+				case rest[i] == '"':
+					end = i
+				}
+			}
+		case '\'':
+			if idx := strings.Index(rest[1:], "'"); idx >= 0 {
+				end = idx + 1
+			}
+		default:
+			return nil, fmt.Errorf("expected a string in the array but got %s", rest)
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string %s", rest)
+		}
+
+		item, err := parseValue(rest[:end+1])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, item)
+
+		rest = strings.TrimSpace(rest[end+1:])
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if rest != "" {
+			return nil, fmt.Errorf("expected , in the array but got %s", rest)
+		}
+	}
+	return res, nil
+}
+
+//WriteTOML writes the effective settings, documented by their usage and environment variable, so that the output can
+//be used as a config file. Secrets are masked.
+func (c *Config) WriteTOML(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	section := ""
+	for _, f := range c.fields() {
+		if f.Section() != section {
+			section = f.Section()
+			fmt.Fprintf(w, "\n[%s]\n", section)
+		}
+		fmt.Fprintf(w, "# %s ($%s, -%s)\n", f.Usage, f.Env(), f.Flag())
+		fmt.Fprintf(w, "%s = %s\n", f.Name(), formatValue(f))
+	}
+	return w.Flush()
+}
+
+func formatValue(f *field) string {
+	if f.IsList() {
+		items := make([]string, 0)
+		for _, item := range f.value.Interface().([]string) {
+			items = append(items, strconv.Quote(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	text := f.String()
+	if f.Secret && text != "" {
+		text = "********"
+	}
+	if f.value.Kind() == reflect.Int || f.value.Kind() == reflect.Bool {
+		return text
+	}
+	return strconv.Quote(text)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/worldiety/devdrasil/config"
+	"os"
+)
+
+//prints the effective configuration, which the server would use with the same file, environment and flags. Returns
+//the exit code, 1 if the configuration is invalid.
+//  usage: devdrasil config print [-config devdrasil.toml] [flags of the server]
+func printConfig(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: devdrasil config print [-config devdrasil.toml] [flags of the server]")
+		return 2
+	}
+
+	cfg, err := config.Load("config print", args[1:])
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if cfg == nil {
+			return 2
+		}
+		return 1
+	}
+
+	err = cfg.WriteTOML(os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package ctl
+
+import (
+	"flag"
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/api"
+	"github.com/worldiety/devdrasil/db"
+	"strconv"
+)
+
+func init() {
+	register("companies list", "", true, listCompanies)
+	register("companies create", "-name name [-color #112233]", true, createCompany)
+	register("companies delete", "<company id or name>", true, deleteCompany)
+}
+
+func printCompanies(e *env, companies []*api.Company) error {
+	rows := [][]string{{"ID", "NAME", "USERS", "COLOR"}}
+	for _, cmp := range companies {
+		rows = append(rows, []string{cmp.Id.String(), cmp.Name, strconv.Itoa(len(cmp.Users)), cmp.ThemePrimaryColor})
+	}
+	return e.print(companies, rows)
+}
+
+func listCompanies(e *env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("companies list", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	companies, err := e.client.Companies().List()
+	if err != nil {
+		return err
+	}
+	return printCompanies(e, companies)
+}
+
+func createCompany(e *env, args []string) error {
+	flags := flag.NewFlagSet("companies create", flag.ContinueOnError)
+	flagName := flags.String("name", "", "")
+	flagColor := flags.String("color", "", "")
+	if _, err := parseArgs(flags, args, 0); err != nil {
+		return err
+	}
+	if *flagName == "" {
+		return usageError("name is required")
+	}
+
+	created, err := e.client.Companies().Create(&api.Company{Name: *flagName, ThemePrimaryColor: *flagColor})
+	if err != nil {
+		return err
+	}
+	return printCompanies(e, []*api.Company{created})
+}
+
+func deleteCompany(e *env, args []string) error {
+	refs, err := parseArgs(flag.NewFlagSet("companies delete", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	companyId, err := resolveCompany(e, refs[0])
+	if err != nil {
+		return err
+	}
+	return e.client.Companies().Delete(companyId)
+}
+
+func resolveCompany(e *env, ref string) (db.PK, error) {
+	if id, ok := parseId(ref); ok {
+		return id, nil
+	}
+	companies, err := e.client.Companies().List()
+	if err != nil {
+		return db.NIL, err
+	}
+	for _, cmp := range companies {
+		if cmp.Name == ref {
+			return cmp.Id, nil
+		}
+	}
+	return db.NIL, fmt.Errorf("unknown company: %s", ref)
+}
@@ -0,0 +1,301 @@
+//Package ctl implements the devdrasil ctl commands, which administrate a server by its rest api.
+package ctl
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/worldiety/devdrasil/client"
+	"github.com/worldiety/devdrasil/db"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+//the output formats
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+//the remembered login of the ctl commands
+type state struct {
+	//the base url of the server
+	URL string
+
+	//the session, which has been created by login
+	Session db.PK
+}
+
+//the parsed global flags and the client for a single command
+type env struct {
+	client     *client.Client
+	url        string
+	output     string
+	stateFile  string
+	stdin      io.Reader
+	stdout     io.Writer
+	hasSession bool
+}
+
+type command struct {
+	//e.g. users create
+	name string
+
+	//the arguments, e.g. -login name [-password secret]
+	usage string
+
+	//false for login
+	requiresAuth bool
+
+	run func(e *env, args []string) error
+}
+
+//a wrong invocation, which prints the usage
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+var commands []*command
+
+func register(name string, usage string, requiresAuth bool, run func(e *env, args []string) error) {
+	commands = append(commands, &command{name: name, usage: usage, requiresAuth: requiresAuth, run: run})
+}
+
+func init() {
+	register("login", "-url https://devdrasil.mycompany.com -login name [-password secret]", false, login)
+	register("logout", "", true, logout)
+}
+
+//Run executes the ctl command and returns the exit code: 0 on success, 1 if the server rejected the request and 2 for a wrong invocation.
+//  usage: devdrasil ctl [-url url] [-token token] [-o table|json] <command> [arguments]
+func Run(args []string) int {
+	workspace := filepath.Join(os.Getenv("HOME"), ".devdrasil")
+
+	flags := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	flagURL := flags.String("url", "", "The base url of the server, defaults to the one of the last login")
+	flagToken := flags.String("token", os.Getenv("DEVDRASIL_TOKEN"), "An api token, which is used instead of the session of the last login. Defaults to $DEVDRASIL_TOKEN")
+	flagOutput := flags.String("o", OutputTable, "The output format, table or json")
+	flagState := flags.String("state", filepath.Join(workspace, "ctl.json"), "The file which remembers the session of the last login")
+	flags.Usage = func() {
+		printUsage(flags)
+	}
+	if flags.Parse(args) != nil {
+		return 2
+	}
+	if *flagOutput != OutputTable && *flagOutput != OutputJSON {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s\n", *flagOutput)
+		return 2
+	}
+
+	cmd, rest := findCommand(flags.Args())
+	if cmd == nil {
+		printUsage(flags)
+		return 2
+	}
+
+	e := &env{url: *flagURL, output: *flagOutput, stateFile: *flagState, stdin: os.Stdin, stdout: os.Stdout}
+	if cmd.requiresAuth {
+		st, err := readState(e.stateFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read %s: %s\n", e.stateFile, err)
+			return 2
+		}
+		if e.url == "" {
+			e.url = st.URL
+		}
+		if e.url == "" || (*flagToken == "" && st.Session.IsNIL()) {
+			fmt.Fprintln(os.Stderr, "not logged in, use devdrasil ctl login or -token")
+			return 2
+		}
+		e.client = client.NewClient(&client.Config{URL: e.url, Token: *flagToken})
+		if *flagToken == "" {
+			e.client.SetSession(st.Session)
+			e.hasSession = true
+		}
+	}
+
+	err := cmd.run(e, rest)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if _, ok := err.(usageError); ok {
+			fmt.Fprintf(os.Stderr, "usage: devdrasil ctl %s %s\n", cmd.name, cmd.usage)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+//finds the longest command, which matches the arguments
+func findCommand(args []string) (*command, []string) {
+	var res *command
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(words) > len(args) || strings.Join(args[:len(words)], " ") != cmd.name {
+			continue
+		}
+		if res == nil || len(words) > len(strings.Fields(res.name)) {
+			res = cmd
+		}
+	}
+	if res == nil {
+		return nil, nil
+	}
+	return res, args[len(strings.Fields(res.name)):]
+}
+
+func printUsage(flags *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "usage: devdrasil ctl [flags] <command> [arguments]")
+	flags.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "commands:")
+	sorted := append([]*command{}, commands...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+	for _, cmd := range sorted {
+		fmt.Fprintf(os.Stderr, "  %s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+//parses the flags of a command, which must not have any other arguments than the expected number of positional ones
+func parseArgs(flags *flag.FlagSet, args []string, positional int) ([]string, error) {
+	flags.SetOutput(ioutil.Discard)
+	if err := flags.Parse(args); err != nil {
+		return nil, usageError(err.Error())
+	}
+	if flags.NArg() != positional {
+		return nil, usageError(fmt.Sprintf("expected %d arguments but got %d", positional, flags.NArg()))
+	}
+	return flags.Args(), nil
+}
+
+func login(e *env, args []string) error {
+	flags := flag.NewFlagSet("login", flag.ContinueOnError)
+	flagURL := flags.String("url", e.url, "")
+	flagLogin := flags.String("login", "", "")
+	flagPassword := flags.String("password", os.Getenv("DEVDRASIL_PASSWORD"), "")
+	if _, err := parseArgs(flags, args, 0); err != nil {
+		return err
+	}
+	if *flagURL == "" || *flagLogin == "" {
+		return usageError("url and login are required")
+	}
+
+	password := *flagPassword
+	if password == "" {
+		fmt.Fprint(os.Stderr, "password: ")
+		line, err := bufio.NewReader(e.stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	c := client.NewClient(&client.Config{URL: *flagURL})
+	ses, err := c.Login(*flagLogin, password)
+	if err != nil {
+		return err
+	}
+
+	err = writeState(e.stateFile, &state{URL: *flagURL, Session: ses.Id})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "logged in as %s\n", *flagLogin)
+	return nil
+}
+
+func logout(e *env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("logout", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	if e.hasSession {
+		if err := e.client.Logout(); err != nil {
+			return err
+		}
+	}
+	return writeState(e.stateFile, &state{URL: e.url})
+}
+
+func readState(file string) (*state, error) {
+	st := &state{}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(b, st)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+//only the owner can read the session
+func writeState(file string, st *state) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0600)
+}
+
+//prints the value as json or the rows as table, whose first row is the header
+func (e *env) print(value interface{}, rows [][]string) error {
+	if e.output == OutputJSON {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(value)
+	}
+
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+//a hex encoded id has 32 characters, anything else is a name
+func parseId(ref string) (db.PK, bool) {
+	if len(ref) != 32 {
+		return db.NIL, false
+	}
+	pk, err := db.ParsePK(ref)
+	return pk, err == nil
+}
+
+func str(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+func pks(list []db.PK) string {
+	res := make([]string, len(list))
+	for i, pk := range list {
+		res[i] = pk.String()
+	}
+	return strings.Join(res, ",")
+}
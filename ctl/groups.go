@@ -0,0 +1,92 @@
+package ctl
+
+import (
+	"flag"
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/api"
+	"github.com/worldiety/devdrasil/db"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	register("groups list", "", true, listGroups)
+	register("groups create", "-name name [-groups group,...]", true, createGroup)
+	register("groups delete", "<group id or name>", true, deleteGroup)
+}
+
+func printGroups(e *env, groups []*api.Group) error {
+	rows := [][]string{{"ID", "NAME", "USERS", "GROUPS"}}
+	for _, grp := range groups {
+		rows = append(rows, []string{grp.Id.String(), grp.Name, strconv.Itoa(len(grp.Users)), pks(grp.Groups)})
+	}
+	return e.print(groups, rows)
+}
+
+func listGroups(e *env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("groups list", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	groups, err := e.client.Groups().List()
+	if err != nil {
+		return err
+	}
+	return printGroups(e, groups)
+}
+
+func createGroup(e *env, args []string) error {
+	flags := flag.NewFlagSet("groups create", flag.ContinueOnError)
+	flagName := flags.String("name", "", "")
+	flagGroups := flags.String("groups", "", "")
+	if _, err := parseArgs(flags, args, 0); err != nil {
+		return err
+	}
+	if *flagName == "" {
+		return usageError("name is required")
+	}
+
+	grp := &api.Group{Name: *flagName}
+	if *flagGroups != "" {
+		for _, ref := range strings.Split(*flagGroups, ",") {
+			parentId, err := resolveGroup(e, ref)
+			if err != nil {
+				return err
+			}
+			grp.Groups = append(grp.Groups, parentId)
+		}
+	}
+
+	created, err := e.client.Groups().Create(grp)
+	if err != nil {
+		return err
+	}
+	return printGroups(e, []*api.Group{created})
+}
+
+func deleteGroup(e *env, args []string) error {
+	refs, err := parseArgs(flag.NewFlagSet("groups delete", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	groupId, err := resolveGroup(e, refs[0])
+	if err != nil {
+		return err
+	}
+	return e.client.Groups().Delete(groupId)
+}
+
+func resolveGroup(e *env, ref string) (db.PK, error) {
+	if id, ok := parseId(ref); ok {
+		return id, nil
+	}
+	groups, err := e.client.Groups().List()
+	if err != nil {
+		return db.NIL, err
+	}
+	for _, grp := range groups {
+		if grp.Name == ref {
+			return grp.Id, nil
+		}
+	}
+	return db.NIL, fmt.Errorf("unknown group: %s", ref)
+}
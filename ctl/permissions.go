@@ -0,0 +1,109 @@
+package ctl
+
+import (
+	"flag"
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/api"
+	"github.com/worldiety/devdrasil/db"
+	"strconv"
+)
+
+func init() {
+	register("permissions list", "", true, listPermissions)
+	register("permissions grant", "<kind> [-user user] [-group group]", true, grantPermission)
+	register("permissions revoke", "<kind> [-user user] [-group group]", true, revokePermission)
+}
+
+func printPermissions(e *env, perms []*api.Permission) error {
+	rows := [][]string{{"NAME", "PLUGIN", "USERS", "GROUPS"}}
+	for _, perm := range perms {
+		rows = append(rows, []string{perm.Name, perm.Plugin, strconv.Itoa(len(perm.AllowedUsers)), strconv.Itoa(len(perm.AllowedGroups))})
+	}
+	return e.print(perms, rows)
+}
+
+func listPermissions(e *env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("permissions list", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	perms, err := e.client.Permissions().List()
+	if err != nil {
+		return err
+	}
+	return printPermissions(e, perms)
+}
+
+func grantPermission(e *env, args []string) error {
+	return changePermission(e, "permissions grant", args, true)
+}
+
+func revokePermission(e *env, args []string) error {
+	return changePermission(e, "permissions revoke", args, false)
+}
+
+//adds or removes the user and the group to the global holders of the kind
+func changePermission(e *env, name string, args []string, grant bool) error {
+	if len(args) == 0 {
+		return usageError("kind is required")
+	}
+	kind := args[0]
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagUser := flags.String("user", "", "")
+	flagGroup := flags.String("group", "", "")
+	if _, err := parseArgs(flags, args[1:], 0); err != nil {
+		return err
+	}
+	if *flagUser == "" && *flagGroup == "" {
+		return usageError("a user or a group is required")
+	}
+
+	perms, err := e.client.Permissions().List()
+	if err != nil {
+		return err
+	}
+	var perm *api.Permission
+	for _, p := range perms {
+		if p.Name == kind {
+			perm = p
+		}
+	}
+	if perm == nil {
+		return fmt.Errorf("unknown permission kind: %s", kind)
+	}
+
+	if *flagUser != "" {
+		userId, err := resolveUser(e, *flagUser)
+		if err != nil {
+			return err
+		}
+		perm.AllowedUsers = changePKs(perm.AllowedUsers, userId, grant)
+	}
+	if *flagGroup != "" {
+		groupId, err := resolveGroup(e, *flagGroup)
+		if err != nil {
+			return err
+		}
+		perm.AllowedGroups = changePKs(perm.AllowedGroups, groupId, grant)
+	}
+
+	updated, err := e.client.Permissions().Update(kind, perm)
+	if err != nil {
+		return err
+	}
+	return printPermissions(e, []*api.Permission{updated})
+}
+
+//adds the pk if missing or removes it
+func changePKs(list []db.PK, pk db.PK, add bool) []db.PK {
+	res := make([]db.PK, 0, len(list)+1)
+	for _, other := range list {
+		if other != pk {
+			res = append(res, other)
+		}
+	}
+	if add {
+		res = append(res, pk)
+	}
+	return res
+}
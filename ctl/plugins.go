@@ -0,0 +1,67 @@
+package ctl
+
+import (
+	"flag"
+	"github.com/worldiety/devdrasil/backend/api"
+)
+
+func init() {
+	register("plugins list", "", true, listPlugins)
+	register("plugins install", "<plugin id>", true, installPlugin)
+	register("plugins update", "<plugin id>", true, updatePlugin)
+	register("plugins remove", "<plugin id>", true, removePlugin)
+}
+
+//lists the plugins of the market
+func listPlugins(e *env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("plugins list", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	index, err := e.client.Market().Index()
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"ID", "NAME", "VENDOR"}}
+	for _, p := range index.Plugins {
+		rows = append(rows, []string{p.Id, p.Name, p.Vendor})
+	}
+	return e.print(index.Plugins, rows)
+}
+
+func printPluginInfo(e *env, info *api.PluginInfo) error {
+	rows := [][]string{{"ID", "INSTALLED", "VERSION", "BRANCH"}, {info.Id, yesNo(info.Installed), info.RepositoryVersionCurrent, info.RepositoryBranch}}
+	return e.print(info, rows)
+}
+
+func installPlugin(e *env, args []string) error {
+	ids, err := parseArgs(flag.NewFlagSet("plugins install", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	info, err := e.client.Market().Install(ids[0])
+	if err != nil {
+		return err
+	}
+	return printPluginInfo(e, info)
+}
+
+func updatePlugin(e *env, args []string) error {
+	ids, err := parseArgs(flag.NewFlagSet("plugins update", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	info, err := e.client.Market().Update(ids[0])
+	if err != nil {
+		return err
+	}
+	return printPluginInfo(e, info)
+}
+
+func removePlugin(e *env, args []string) error {
+	ids, err := parseArgs(flag.NewFlagSet("plugins remove", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	return e.client.Market().Delete(ids[0])
+}
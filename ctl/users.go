@@ -0,0 +1,130 @@
+package ctl
+
+import (
+	"flag"
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/api"
+	"github.com/worldiety/devdrasil/db"
+	"strings"
+)
+
+func init() {
+	register("users list", "", true, listUsers)
+	register("users create", "-login name [-firstname name] [-lastname name] [-email a@b.com,...] [-password secret | -service-account] [-company company] [-groups group,...]", true, createUser)
+	register("users deactivate", "<user id or login>", true, deactivateUser)
+}
+
+func printUsers(e *env, users []*api.User) error {
+	rows := [][]string{{"ID", "LOGIN", "NAME", "ACTIVE", "SERVICE ACCOUNT", "PROVIDER"}}
+	for _, usr := range users {
+		id := ""
+		if usr.Id != nil {
+			id = usr.Id.String()
+		}
+		active := usr.Active != nil && *usr.Active
+		serviceAccount := usr.ServiceAccount != nil && *usr.ServiceAccount
+		rows = append(rows, []string{id, str(usr.Login), strings.TrimSpace(str(usr.Firstname) + " " + str(usr.Lastname)), yesNo(active), yesNo(serviceAccount), str(usr.Provider)})
+	}
+	return e.print(users, rows)
+}
+
+func listUsers(e *env, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("users list", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	users, err := e.client.Users().List()
+	if err != nil {
+		return err
+	}
+	return printUsers(e, users)
+}
+
+func createUser(e *env, args []string) error {
+	flags := flag.NewFlagSet("users create", flag.ContinueOnError)
+	flagLogin := flags.String("login", "", "")
+	flagFirstname := flags.String("firstname", "", "")
+	flagLastname := flags.String("lastname", "", "")
+	flagEMail := flags.String("email", "", "")
+	flagPassword := flags.String("password", "", "")
+	flagServiceAccount := flags.Bool("service-account", false, "")
+	flagCompany := flags.String("company", "", "")
+	flagGroups := flags.String("groups", "", "")
+	if _, err := parseArgs(flags, args, 0); err != nil {
+		return err
+	}
+	if *flagLogin == "" {
+		return usageError("login is required")
+	}
+	if *flagPassword == "" && !*flagServiceAccount {
+		return usageError("either a password or -service-account is required")
+	}
+
+	active := true
+	usr := &api.User{Login: flagLogin, Firstname: flagFirstname, Lastname: flagLastname, Active: &active, ServiceAccount: flagServiceAccount}
+	if *flagPassword != "" {
+		usr.Password = flagPassword
+	}
+	if *flagEMail != "" {
+		emails := strings.Split(*flagEMail, ",")
+		usr.EMailAddresses = &emails
+	}
+	if *flagCompany != "" {
+		companyId, err := resolveCompany(e, *flagCompany)
+		if err != nil {
+			return err
+		}
+		usr.Company = &companyId
+	}
+	if *flagGroups != "" {
+		groups := make([]db.PK, 0)
+		for _, ref := range strings.Split(*flagGroups, ",") {
+			groupId, err := resolveGroup(e, ref)
+			if err != nil {
+				return err
+			}
+			groups = append(groups, groupId)
+		}
+		usr.Groups = &groups
+	}
+
+	created, err := e.client.Users().Create(usr)
+	if err != nil {
+		return err
+	}
+	return printUsers(e, []*api.User{created})
+}
+
+//a deactivated user cannot login anymore and all of his sessions are revoked
+func deactivateUser(e *env, args []string) error {
+	refs, err := parseArgs(flag.NewFlagSet("users deactivate", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	userId, err := resolveUser(e, refs[0])
+	if err != nil {
+		return err
+	}
+
+	active := false
+	updated, err := e.client.Users().Update(userId, &api.User{Active: &active})
+	if err != nil {
+		return err
+	}
+	return printUsers(e, []*api.User{updated})
+}
+
+func resolveUser(e *env, ref string) (db.PK, error) {
+	if id, ok := parseId(ref); ok {
+		return id, nil
+	}
+	users, err := e.client.Users().List()
+	if err != nil {
+		return db.NIL, err
+	}
+	for _, usr := range users {
+		if str(usr.Login) == ref && usr.Id != nil {
+			return *usr.Id, nil
+		}
+	}
+	return db.NIL, fmt.Errorf("unknown user: %s", ref)
+}
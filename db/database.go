@@ -1,7 +1,10 @@
 package db
 
 import (
+	"context"
 	"path/filepath"
+	"sync/atomic"
+	"time"
 	"encoding/hex"
 	"fmt"
 	"encoding/json"
@@ -22,11 +25,32 @@ key is encoded as hex within the fanout. Empty keys are not supported.
  */
 type Database struct {
 	dir string
+
+	//the amount of open write transactions, see WaitForWrites
+	writes int64
 }
 
 //open the database, performs no I/O. Do not share the same directory across multiple instances.
 func Open(dir string) *Database {
-	return &Database{dir}
+	return &Database{dir: dir}
+}
+
+//the interval to check for open write transactions
+const waitInterval = 10 * time.Millisecond
+
+//WaitForWrites blocks until all write transactions have been committed, e.g. before the process exits. Returns the
+//error of the context, if it is done before.
+func (d *Database) WaitForWrites(ctx context.Context) error {
+	ticker := time.NewTicker(waitInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&d.writes) > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d write transactions still open: %v", atomic.LoadInt64(&d.writes), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
 }
 
 //The primary key definition is a fixed length byte array
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 )
 
 type writeTransaction struct {
@@ -18,6 +19,7 @@ func (tx *writeTransaction) Err() error {
 
 //creates a new write and aquires a write lock
 func newWriteTransaction(partition *Partition) *writeTransaction {
+	atomic.AddInt64(&partition.parent.writes, 1)
 	partition.rwLock.Lock()
 	return &writeTransaction{partition, &readTransaction{partition, true, nil}}
 }
@@ -27,6 +29,7 @@ func (tx *writeTransaction) Commit() error {
 	tx.reader.check()
 	tx.reader.alive = false
 	tx.partition.rwLock.Unlock();
+	atomic.AddInt64(&tx.partition.parent.writes, -1)
 	return nil;
 }
 
@@ -38,8 +38,8 @@ class ExampleApp extends Application {
         this.getNavigation().registerUserInterfaceState(UISMarketPlugin.NAME(), app => new UISMarketPlugin(app));
         this.getNavigation().registerUserInterfaceState(UISBuilder.NAME(), app => new UISBuilder(app));
         this.setLocale("de");
-        this.addTranslation("de", "/frontend/values-de/strings.xml");
-        this.addTranslation("en", "/frontend/values-en/strings.xml");
+        this.addTranslation("de", "/i18n/de?format=xml");
+        this.addTranslation("en", "/i18n/en?format=xml");
 
         //add the default bootstrapping entries
         this.getMenuEnrichers().push(drawer => {
@@ -105,7 +105,9 @@ class ViewDetails extends Box {
 
 
         this.add(new PullRightBox(starBox));
-        this.add(new InstallRemoveIdleArea(this.ctx, this.plugin));
+        let permissionsArea = new PermissionsArea(this.ctx);
+        this.add(new InstallRemoveIdleArea(this.ctx, this.plugin, permissionsArea));
+        this.add(permissionsArea);
 
         this.add(new HR());
 
@@ -122,19 +124,56 @@ class ViewDetails extends Box {
 
 }
 
+/**
+ * Shows the permission kinds, which an installed plugin has declared in its manifest.
+ */
+class PermissionsArea extends Box {
+    /**
+     *
+     * @param {DefaultUserInterfaceState} ctx
+     */
+    constructor(ctx) {
+        super();
+        this.ctx = ctx;
+    }
+
+    /**
+     * @param {Array<{name: string, description: string}>} permissions
+     */
+    setModel(permissions) {
+        this.removeAll();
+        if (permissions.length === 0) {
+            return;
+        }
+
+        this.add(new Body1(this.ctx.getString("plugin_permissions")));
+        for (let perm of permissions) {
+            let line = new Body2(perm.name + (perm.description ? " - " + perm.description : ""));
+            line.getElement().style.margin = "3px";
+            this.add(line);
+        }
+    }
+}
+
 class InstallRemoveIdleArea extends PullRightBox {
     /**
      *
      * @param {DefaultUserInterfaceState} ctx
      * @param {Plugin} plugin
+     * @param {PermissionsArea} permissionsArea
      */
-    constructor(ctx, plugin) {
+    constructor(ctx, plugin, permissionsArea) {
         super();
         this.ctx = ctx;
         this.plugin = plugin;
+        this.permissionsArea = permissionsArea;
         this.setStatusUnknown();
+        this.loadStatus();
+    }
 
-        this.ctx.getApplication().getMarketRepository().getInstallInfo(plugin.getId()).then(info => {
+    loadStatus() {
+        this.ctx.getApplication().getMarketRepository().getInstallInfo(this.plugin.getId()).then(info => {
+            this.permissionsArea.setModel(info.installed ? info.permissions : []);
             if (info.installed) {
                 if (info.repositoryVersionCurrent !== info.repositoryVersionRemote) {
                     this.setStatusUpdateable();
@@ -165,7 +204,7 @@ class InstallRemoveIdleArea extends PullRightBox {
             btnUpdate.setText(this.ctx.getString("is_updating"));
             btnUpdate.setEnabled(false);
             this.ctx.getApplication().getMarketRepository().update(this.plugin.getId()).then(_ => {
-                this.setStatusUninstallable();
+                this.loadStatus();
             }).catch(err => this.ctx.handleDefaultError(err));
         });
 
@@ -180,7 +219,7 @@ class InstallRemoveIdleArea extends PullRightBox {
             btnInstall.setText(this.ctx.getString("is_installing"));
             btnInstall.setEnabled(false);
             this.ctx.getApplication().getMarketRepository().install(this.plugin.getId()).then(_ => {
-                this.setStatusUninstallable();
+                this.loadStatus();
             }).catch(err => this.ctx.handleDefaultError(err));
         });
 
@@ -196,6 +235,7 @@ class InstallRemoveIdleArea extends PullRightBox {
             btnUninstall.setText(this.ctx.getString("is_uninstalling"));
             btnUninstall.setEnabled(false);
             this.ctx.getApplication().getMarketRepository().remove(this.plugin.getId()).then(_ => {
+                this.permissionsArea.setModel([]);
                 this.setStatusInstallable();
             }).catch(err => this.ctx.handleDefaultError(err));
         });
@@ -255,8 +255,9 @@ class PluginInstallInfo {
      * @param {string} repositoryVersionRemote
      * @param {string} repositoryBranch
      * @param {string} appDirectory
+     * @param {Array<{name: string, description: string}>} permissions
      */
-    constructor(id, installed, repositoryUrl, repositoryVersionCurrent, repositoryVersionRemote, repositoryBranch, appDirectory) {
+    constructor(id, installed, repositoryUrl, repositoryVersionCurrent, repositoryVersionRemote, repositoryBranch, appDirectory, permissions) {
         this.id = id;
         this.installed = installed;
         this.repositoryUrl = repositoryUrl;
@@ -264,6 +265,7 @@ class PluginInstallInfo {
         this.repositoryVersionRemote = repositoryVersionRemote;
         this.repositoryBranch = repositoryBranch;
         this.appDirectory = appDirectory;
+        this.permissions = permissions;
     }
 }
 
@@ -342,7 +344,11 @@ class MarketRepository {
         return restInstallInfo(this.fetcher, session.sid, pluginId).then(raw => {
             return throwFromHTTP(raw).then(raw => raw.json());
         }).then(json => {
-            return new PluginInstallInfo(json["Id"], json["Installed"], json["RepositoryURL"], json["RepositoryVersionCurrent"], json["RepositoryVersionRemote"], json["RepositoryBranch"], json["AppDirectory"])
+            let permissions = [];
+            for (let perm of json["Permissions"] || []) {
+                permissions.push({name: perm["Name"], description: perm["Description"]});
+            }
+            return new PluginInstallInfo(json["Id"], json["Installed"], json["RepositoryURL"], json["RepositoryVersionCurrent"], json["RepositoryVersionRemote"], json["RepositoryBranch"], json["AppDirectory"], permissions)
         });
     }
 
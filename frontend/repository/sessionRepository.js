@@ -99,11 +99,14 @@ function _requestSession(fetcher, user, password, client) {
     let cfg = {
         method: 'POST',
         headers: {
-            'login': user,
-            'password': password,
-            'client': client,
+            'Content-Type': 'application/json',
             'User-Agent': navigator.userAgent,
         },
+        body: JSON.stringify({
+            'Login': user,
+            'Password': password,
+            'Client': client,
+        }),
         cache: 'no-store'
     };
     return fetcher.fetchRaw('/sessions', cfg)
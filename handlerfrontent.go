@@ -1,6 +1,8 @@
 package main
 
 import (
+	"github.com/worldiety/devdrasil/backend"
+	"html"
 	"log"
 	"net/http"
 	"os"
@@ -9,11 +11,13 @@ import (
 )
 
 type frontendHandler struct {
-	server *Devdrasil
+	server   *Devdrasil
+	branding *backend.EndpointBranding
 }
 
-func installFrontendHandler(server *Devdrasil) {
-	handler := &frontendHandler{}
+//the root document is branded for the company of the session user
+func installFrontendHandler(server *Devdrasil, branding *backend.EndpointBranding) {
+	handler := &frontendHandler{server: server, branding: branding}
 
 	//directly server the wwt from the working dir
 	wwtDir := filepath.Join(server.cwd, "wwt", "wwt")
@@ -32,6 +36,8 @@ func installFrontendHandler(server *Devdrasil) {
 }
 
 func (h *frontendHandler) handleRoot(writer http.ResponseWriter, request *http.Request) {
+	branding := h.branding.Current(request)
+	title := html.EscapeString(branding.AppTitle)
 
 	sb := strings.Builder{}
 	sb.WriteString(`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN"`)
@@ -52,15 +58,29 @@ func (h *frontendHandler) handleRoot(writer http.ResponseWriter, request *http.R
 	sb.WriteString(`<meta name="apple-mobile-web-app-capable" content="yes"/>`)
 	sb.WriteString("\n")
 
-	sb.WriteString(`<meta name="apple-mobile-web-app-status-bar-style" content="green"/>`)
+	sb.WriteString(`<meta name="apple-mobile-web-app-status-bar-style" content="` + branding.ThemePrimaryColor + `"/>`)
 	sb.WriteString("\n")
 
-	sb.WriteString(`<meta name="theme-color" content="green">`)
+	sb.WriteString(`<meta name="theme-color" content="` + branding.ThemePrimaryColor + `">`)
 	sb.WriteString("\n")
 
-	sb.WriteString(`<meta name="apple-mobile-web-app-title" content="demo wwt app">`)
+	sb.WriteString(`<meta name="apple-mobile-web-app-title" content="` + title + `">`)
 	sb.WriteString("\n")
 
+	sb.WriteString(`<title>` + title + `</title>`)
+	sb.WriteString("\n")
+
+	if branding.Favicon != nil {
+		sb.WriteString(`<link rel="icon" href="` + backend.BrandingImageURL(branding.Favicon) + `">`)
+		sb.WriteString("\n")
+	}
+
+	//the frontend shows the logo, if present
+	if branding.Logo != nil {
+		sb.WriteString(`<meta name="devdrasil-logo" content="` + backend.BrandingImageURL(branding.Logo) + `">`)
+		sb.WriteString("\n")
+	}
+
 	sb.WriteString(`<meta name="viewport" content="width=device-width, minimum-scale=1.0,initial-scale=1 maximum-scale=1 user-scalable=0 minimal-ui"/>`)
 	sb.WriteString("\n")
 
@@ -73,6 +93,9 @@ func (h *frontendHandler) handleRoot(writer http.ResponseWriter, request *http.R
 	sb.WriteString(`<link rel="stylesheet" href="/frontend/custom.css">`)
 	sb.WriteString("\n")
 
+	sb.WriteString(`<link rel="stylesheet" href="/branding/theme.css">`)
+	sb.WriteString("\n")
+
 	sb.WriteString(`<script type="text/javascript" src="/wwt/mcw.min.js"></script>`)
 	sb.WriteString("\n")
 
@@ -94,6 +117,8 @@ func (h *frontendHandler) handleRoot(writer http.ResponseWriter, request *http.R
 	sb.WriteString(`</html>`)
 
 	writer.Header().Add("Content-Type", "text/html;charset=utf-8")
+	//depends on the session cookie
+	writer.Header().Add("Cache-Control", "no-cache, private")
 	writer.Write([]byte(sb.String()))
 }
 
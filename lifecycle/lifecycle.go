@@ -0,0 +1,131 @@
+//Package lifecycle runs the server until SIGINT or SIGTERM and shuts it down gracefully, e.g. by draining the open
+//requests and waiting for the running plugin jobs, so that nothing is cut off. SIGHUP reloads the configuration.
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"github.com/worldiety/devdrasil/log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//a step of the shutdown
+type hook struct {
+	name     string
+	timeout  func() time.Duration
+	shutdown func(ctx context.Context) error
+}
+
+//The Lifecycle keeps the shutdown hooks and the reload handlers of the components
+type Lifecycle struct {
+	mutex   sync.Mutex
+	hooks   []*hook
+	reloads []func()
+}
+
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{}
+}
+
+//OnShutdown registers a step of the shutdown, which is cancelled by its context after the timeout. The steps run in
+//the order of their registration, so e.g. the open requests are drained before the database is closed. The timeout
+//is a function, because a reload may change it.
+func (l *Lifecycle) OnShutdown(name string, timeout func() time.Duration, shutdown func(ctx context.Context) error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.hooks = append(l.hooks, &hook{name: name, timeout: timeout, shutdown: shutdown})
+}
+
+//OnReload registers a handler for SIGHUP
+func (l *Lifecycle) OnReload(reload func()) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.reloads = append(l.reloads, reload)
+}
+
+//Run blocks until SIGINT or SIGTERM or until failed delivers an error, e.g. of a listener, and shuts down afterwards.
+//A second signal exits immediately. Returns the exit code, which is 0 if the shutdown has been requested and has
+//completed in time.
+func (l *Lifecycle) Run(failed <-chan error) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	code := 0
+	for code == 0 {
+		select {
+		case err := <-failed:
+			log.Default.Error(log.New("server failed, shutting down").SetError(err))
+			code = 1
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				log.Default.Info(log.New("reloading"))
+				l.Reload()
+				continue
+			}
+			log.Default.Info(log.New("shutting down").Put("signal", sig.String()))
+			code = -1
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Shutdown()
+	}()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return 1
+			}
+			if code < 0 {
+				return 0
+			}
+			return code
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				fmt.Fprintf(os.Stderr, "%s during shutdown, exiting immediately\n", sig)
+				return 1
+			}
+		}
+	}
+}
+
+//Reload calls each reload handler
+func (l *Lifecycle) Reload() {
+	l.mutex.Lock()
+	reloads := append([]func(){}, l.reloads...)
+	l.mutex.Unlock()
+
+	for _, reload := range reloads {
+		reload()
+	}
+}
+
+//Shutdown runs each step, even if a previous one has failed, and returns the first error
+func (l *Lifecycle) Shutdown() error {
+	l.mutex.Lock()
+	hooks := append([]*hook{}, l.hooks...)
+	l.mutex.Unlock()
+
+	var res error
+	for _, h := range hooks {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+		err := h.shutdown(ctx)
+		cancel()
+		if err != nil {
+			log.Default.Error(log.New("shutdown failed").Put("step", h.name).Put("duration", time.Since(start).String()).SetError(err))
+			if res == nil {
+				res = err
+			}
+			continue
+		}
+		log.Default.Info(log.New("shutdown").Put("step", h.name).Put("duration", time.Since(start).String()))
+	}
+	return res
+}
@@ -0,0 +1,81 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	l := NewLifecycle()
+	steps := make([]string, 0)
+	short := func() time.Duration {
+		return 10 * time.Millisecond
+	}
+	l.OnShutdown("first", short, func(ctx context.Context) error {
+		steps = append(steps, "first")
+		return nil
+	})
+	l.OnShutdown("timeout", short, func(ctx context.Context) error {
+		steps = append(steps, "timeout")
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	l.OnShutdown("last", short, func(ctx context.Context) error {
+		steps = append(steps, "last")
+		return nil
+	})
+
+	err := l.Shutdown()
+	if err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(steps) != "[first timeout last]" {
+		t.Fatal(steps)
+	}
+}
+
+func TestRun(t *testing.T) {
+	l := NewLifecycle()
+	reloaded := make(chan bool, 1)
+	l.OnReload(func() {
+		select {
+		case reloaded <- true:
+		default:
+		}
+	})
+	shutdown := false
+	l.OnShutdown("step", func() time.Duration { return time.Second }, func(ctx context.Context) error {
+		shutdown = true
+		return nil
+	})
+
+	//Run registers the signals asynchronously, so the default action of SIGHUP must not terminate the test before
+	ignored := make(chan os.Signal, 100)
+	signal.Notify(ignored, syscall.SIGHUP)
+	defer signal.Stop(ignored)
+
+	failed := make(chan error)
+	codes := make(chan int)
+	go func() {
+		codes <- l.Run(failed)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(reloaded) == 0 && time.Now().Before(deadline) {
+		syscall.Kill(syscall.Getpid(), syscall.SIGHUP)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(reloaded) == 0 {
+		t.Fatal("not reloaded")
+	}
+
+	failed <- fmt.Errorf("listener failed")
+	if code := <-codes; code != 1 || !shutdown {
+		t.Fatal(code, shutdown)
+	}
+}
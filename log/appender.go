@@ -153,7 +153,7 @@ func (f *JSONWriter) Append(fields Fields) error {
 	if f.Writer == nil {
 		return fmt.Errorf("no writer")
 	}
-	_, err = f.Writer.Write(tmp)
+	_, err = f.Writer.Write(append(tmp, '\n'))
 	return err
 }
 
@@ -177,6 +177,7 @@ func NewFileWriteAppender(fname string, delegate WriteAppender) (*FileWriteAppen
 	if err != nil {
 		return nil, err
 	}
+	delegate.SetWriter(file)
 	return &FileWriteAppender{delegate, file}, nil
 }
 
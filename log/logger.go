@@ -3,6 +3,8 @@ package log
 
 import (
 	"fmt"
+	"io"
+	"sync"
 )
 
 type Level int
@@ -23,10 +25,14 @@ const FieldCallerFile = "file"
 const FieldCallerLine = "line"
 const FieldError = "error"
 
+//the logger of the application. Use Replace to configure it, because it may be used concurrently.
 var Default = NewConsoleLogger()
 
 //A very lean structured logger design
 type Logger struct {
+	//guards the fields against Replace and Close, while an entry is added
+	mutex sync.RWMutex
+
 	//the level to log (inclusive), ordered by the definition of syslog. Required to optimize performance. Entries out of log level range are neither decorated nor appended.
 	Level Level
 
@@ -94,6 +100,9 @@ func (l *Logger) Add(level Level, fields Fields) {
 
 //adds a new log entry, if level >= Logger.Level
 func (l *Logger) add(level Level, fields Fields) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
 	if l.Level >= level {
 		for _, dec := range l.Decorators {
 			fields.SetLevel(level)
@@ -112,7 +121,51 @@ func (l *Logger) add(level Level, fields Fields) {
 	}
 }
 
+//Replace takes over the level, decorators and appenders of the other logger, which must not be used afterwards. It waits
+//for the entries, which are currently added, and returns the previous configuration, so that its appenders can be
+//closed without losing an entry.
+func (l *Logger) Replace(other *Logger) *Logger {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	previous := &Logger{Level: l.Level, Decorators: l.Decorators, Appenders: l.Appenders}
+	l.Level = other.Level
+	l.Decorators = other.Decorators
+	l.Appenders = other.Appenders
+	return previous
+}
+
+//Close closes the appenders, which write into files, so that each entry has been written. The logger must not be used afterwards.
+func (l *Logger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var res error
+	for _, appender := range l.Appenders {
+		if closer, ok := appender.(io.Closer); ok {
+			err := closer.Close()
+			if err != nil && res == nil {
+				res = err
+			}
+		}
+	}
+	return res
+}
+
 //A simple default configuration, ready to use
 func NewConsoleLogger() *Logger {
 	return &Logger{Level: Informational, Appenders: []Appender{NewConsoleWriteAppender(&TextWriter{})}, Decorators: []Decorator{&TimeDecorator{}, &CallerDecorator{}}}
 }
+
+//the names of the levels, e.g. for a configuration
+var levelNames = []string{"emergency", "alert", "critical", "error", "warning", "notice", "informational", "debug"}
+
+//parses the name of a level, e.g. warning or debug
+func ParseLevel(name string) (Level, error) {
+	for i, str := range levelNames {
+		if str == name {
+			return Level(i), nil
+		}
+	}
+	return Debug, fmt.Errorf("unknown log level '%s', use one of %v", name, levelNames)
+}
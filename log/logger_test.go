@@ -0,0 +1,61 @@
+package log
+
+import (
+	"sync"
+	"testing"
+)
+
+//counts the entries, which are appended after it has been closed
+type closingAppender struct {
+	mutex  sync.Mutex
+	closed bool
+	late   int
+}
+
+func (a *closingAppender) Append(fields Fields) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.closed {
+		a.late++
+	}
+	return nil
+}
+
+func (a *closingAppender) Close() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.closed = true
+	return nil
+}
+
+func TestReplace(t *testing.T) {
+	appenders := []*closingAppender{{}}
+	logger := &Logger{Level: Informational, Appenders: []Appender{appenders[0]}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				logger.Info(New("entry"))
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		next := &closingAppender{}
+		appenders = append(appenders, next)
+		err := logger.Replace(&Logger{Level: Informational, Appenders: []Appender{next}}).Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	for _, appender := range appenders {
+		if appender.late > 0 {
+			t.Fatalf("%d entries appended after close", appender.late)
+		}
+	}
+}
@@ -1,6 +1,23 @@
 package main
 
+import (
+	"github.com/worldiety/devdrasil/ctl"
+	"os"
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit" {
+		os.Exit(verifyAudit(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(ctl.Run(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(printConfig(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		os.Exit(generateOpenAPI(os.Args[2:]))
+	}
 
-	NewDevdrasil().Start()
+	os.Exit(NewDevdrasil().Start())
 }
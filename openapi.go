@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/openapi"
+	"io/ioutil"
+	"os"
+)
+
+//generates the OpenAPI document from the annotations of the endpoints, which is embedded and served at /openapi.json.
+//Returns the exit code.
+//  usage: devdrasil openapi [-module .] [-out backend/openapi.json]
+func generateOpenAPI(args []string) int {
+	flags := flag.NewFlagSet("openapi", flag.ExitOnError)
+	flagModule := flags.String("module", ".", "The root directory of the devdrasil sources")
+	flagOut := flags.String("out", "backend/openapi.json", "The file to write, - writes to stdout")
+	flags.Parse(args)
+
+	doc, err := openapi.Generate(*flagModule, openapi.Module+"/backend")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse the annotations: %s\n", err)
+		return 1
+	}
+	data, err := doc.JSON()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode the document: %s\n", err)
+		return 1
+	}
+
+	if *flagOut == "-" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	err = ioutil.WriteFile(*flagOut, data, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write %s: %s\n", *flagOut, err)
+		return 1
+	}
+	return 0
+}
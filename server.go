@@ -9,21 +9,51 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"sync"
 	"github.com/worldiety/devdrasil/backend/session"
 	"github.com/worldiety/devdrasil/backend/user"
+	"github.com/worldiety/devdrasil/backend/i18n"
+	"github.com/worldiety/devdrasil/backend/store"
+	"github.com/worldiety/devdrasil/config"
+	"github.com/worldiety/devdrasil/lifecycle"
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+	"github.com/worldiety/devdrasil/certs"
+	"crypto/tls"
+	"net"
+	"net/url"
+	dlog "github.com/worldiety/devdrasil/log"
 	"github.com/worldiety/devdrasil/backend/group"
 	"github.com/worldiety/devdrasil/backend/company"
 	"github.com/worldiety/devdrasil/backend/plugin"
+	"github.com/worldiety/devdrasil/backend/oidc"
+	"github.com/worldiety/devdrasil/backend/ldap"
+	"github.com/worldiety/devdrasil/backend/audit"
+	"github.com/worldiety/devdrasil/backend/bulk"
+	"github.com/worldiety/devdrasil/backend/invite"
+	"github.com/worldiety/devdrasil/backend/mail"
 )
 
 type Devdrasil struct {
-	//Host is the ip or host name where the server listens
-	host string
+	//the effective settings
+	config *config.Config
 
-	//Port is the actual port where the server listens
-	port int
+	//the certificate of the https listener, nil for plain http
+	certs *certs.Reloader
+
+	//the command line, which is parsed again on SIGHUP
+	args []string
+
+	//the current middlewares and the mux, which are replaced by a reload
+	handler atomic.Value
+
+	lifecycle *lifecycle.Lifecycle
+	sessions  *session.Sessions
+	store     *store.Store
+	tenants   *plugin.Tenants
+	auditLog  *audit.Log
 
 	//the folder where all data and the (un-isolated) plugins are organized
 	plugins string
@@ -47,6 +77,22 @@ type Devdrasil struct {
 	restGroups    *backend.EndpointGroups
 	restCompanies *backend.EndpointCompanies
 	restMarket    *backend.EndpointMarket
+	restMe        *backend.EndpointMe
+	restOIDC      *backend.EndpointOIDC
+	restTokens    *backend.EndpointTokens
+	restRoles     *backend.EndpointRoles
+	restGrants    *backend.EndpointGrants
+	restPerms     *backend.EndpointPermissions
+	restProxy     *backend.EndpointPluginProxy
+	restAudit     *backend.EndpointAudit
+	restOpenAPI   *backend.EndpointOpenAPI
+	restBulk      *backend.EndpointBulk
+	restInvites   *backend.EndpointInvitations
+	restBranding  *backend.EndpointBranding
+	restI18n      *backend.EndpointI18n
+
+	//the optional ldap directory
+	directory *ldap.Directory
 }
 
 func NewDevdrasil() *Devdrasil {
@@ -54,38 +100,56 @@ func NewDevdrasil() *Devdrasil {
 		log.Fatal("devdrasil currently does not support windows.")
 	}
 
-	home := os.Getenv("HOME")
-	if home == "" {
-		log.Fatal("the 'HOME' environment variable is missing")
+	args := os.Args[1:]
+	cfg, err := config.Load("devdrasil", args)
+	if err == flag.ErrHelp {
+		os.Exit(0)
 	}
-
-	pcwd, e := os.Getwd()
-	if e != nil {
-		log.Fatalf("failed to get the current working dir: %s\n", e)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	flagCwd := flag.String("resources", pcwd, "The working dir with the resources")
-	flagHost := flag.String("host", "0.0.0.0", "A host name or ip address to which devdrasil is bound")
-	flagPort := flag.Int("port", 8080, "The port on which devdrasil listens")
-	flag.Parse()
+	logger, err := cfg.Log.NewLogger()
+	if err != nil {
+		log.Fatalf("failed to configure the log: %s\n", err)
+	}
+	dlog.Default.Replace(logger)
 
-	devdrasil := &Devdrasil{}
-	devdrasil.workspace = filepath.Join(home, ".devdrasil")
+	devdrasil := &Devdrasil{config: cfg, args: args, lifecycle: lifecycle.NewLifecycle()}
+	devdrasil.workspace = cfg.Workspace
 	ensureDir(devdrasil.workspace)
 
 	devdrasil.plugins = filepath.Join(devdrasil.workspace, "plugins")
 	ensureDir(devdrasil.plugins)
 
-	devdrasil.cwd = *flagCwd
+	devdrasil.cwd = cfg.Resources
+
+	if cfg.IsTLS() {
+		certFile, keyFile := cfg.CertFiles()
+		if cfg.TLS.SelfSigned {
+			err = certs.EnsureSelfSigned(certFile, keyFile, selfSignedHosts(cfg))
+			if err != nil {
+				log.Fatalf("failed to generate a self-signed certificate: %s\n", err)
+			}
+			log.Printf("serving a self-signed certificate from %s\n", certFile)
+		}
+		devdrasil.certs, err = certs.NewReloader(certFile, keyFile, cfg.TLS.ReloadInterval)
+		if err != nil {
+			log.Fatalf("failed to load the certificate: %s\n", err)
+		}
+	}
+
+	//the server messages are translated with the same resources as the frontend
+	catalog, err := i18n.Load(filepath.Join(devdrasil.cwd, "devdrasil", "frontend"))
+	if err != nil {
+		log.Fatalf("failed to load translations: %s\n", err)
+	}
+	i18n.Default = catalog
 
 	devdrasil.db = db.Open(ensureDir(filepath.Join(devdrasil.workspace, "db")))
-	devdrasil.host = *flagHost
-	devdrasil.port = *flagPort
 
 	devdrasil.mux = http.DefaultServeMux
 
-	installFrontendHandler(devdrasil)
-
 	users, err := user.NewUsers(devdrasil.db)
 	if err != nil {
 		panic(err)
@@ -96,18 +160,92 @@ func NewDevdrasil() *Devdrasil {
 		panic(err)
 	}
 	sessions := session.NewSessions(devdrasil.db)
+	sessions.SetLifetime(cfg.Session.IdleTimeout, cfg.Session.MaxLifetime)
+	devdrasil.sessions = sessions
 
 	groups := group.NewGroups(devdrasil.db)
 
+	roles := user.NewRoles(devdrasil.db)
+
+	grants := user.NewGrants(devdrasil.db)
+
 	companies := company.NewCompanies(devdrasil.db)
 
-	pluginManager := plugin.NewPluginManager(devdrasil.plugins)
+	pluginTenants := plugin.NewTenants(devdrasil.plugins, cfg.Plugins.PortMin, cfg.Plugins.PortMax)
+	devdrasil.tenants = pluginTenants
+
+	auditLog, err := audit.Open(filepath.Join(devdrasil.workspace, "audit.log"))
+	if err != nil {
+		panic(err)
+	}
+	auditKey, err := audit.LoadOrCreateKey(filepath.Join(devdrasil.workspace, "audit.key"))
+	if err != nil {
+		panic(err)
+	}
+	auditLog.SetKey(auditKey)
+	devdrasil.auditLog = auditLog
+	auditLog.StartCheckpoints(cfg.Audit.CheckpointInterval)
+	log.Printf("audit checkpoints are signed with the public key %s\n", audit.PublicKeyString(auditKey))
+
+	invitationKey, err := invite.LoadOrCreateKey(filepath.Join(devdrasil.workspace, "invitation.key"))
+	if err != nil {
+		panic(err)
+	}
+	invitations := invite.NewInvitations(devdrasil.db, invitationKey)
+
+	var mailer mail.Mailer = &mail.LogMailer{}
+	if cfg.SMTP.Addr != "" {
+		mailer = mail.NewSMTPMailer(&mail.SMTPConfig{Addr: cfg.SMTP.Addr, From: cfg.SMTP.From, Username: cfg.SMTP.Username, Password: cfg.SMTP.Password})
+	} else {
+		log.Println("no mail server configured, mails are only written to the log")
+	}
 
-	devdrasil.restUsers = backend.NewEndpointUsers(devdrasil.mux, sessions, users, permissions)
-	devdrasil.restSessions = backend.NewEndpointSessions(devdrasil.mux, sessions, users)
-	devdrasil.restGroups = backend.NewEndpointGroups(devdrasil.mux, sessions, users, permissions, groups)
-	devdrasil.restCompanies = backend.NewEndpointCompanies(devdrasil.mux, sessions, users, permissions, companies)
-	devdrasil.restMarket = backend.NewEndpointStore(devdrasil.mux, sessions, users, permissions, pluginManager)
+	router := backend.NewRouter(devdrasil.mux)
+
+	authenticators := make([]user.Authenticator, 0)
+	if cfg.LDAP.URL != "" {
+		devdrasil.directory = ldap.NewDirectory(&ldap.Config{URL: cfg.LDAP.URL, StartTLS: cfg.LDAP.StartTLS, BindDN: cfg.LDAP.BindDN, BindPassword: cfg.LDAP.BindPassword, UserBaseDN: cfg.LDAP.UserBaseDN, UserFilter: cfg.LDAP.UserFilter, LoginAttribute: cfg.LDAP.LoginAttribute, GroupBaseDN: cfg.LDAP.GroupBaseDN, GroupFilter: cfg.LDAP.GroupFilter}, users, groups, sessions)
+		authenticators = append(authenticators, devdrasil.directory)
+		if cfg.LDAP.SyncInterval > 0 {
+			devdrasil.directory.StartSync(cfg.LDAP.SyncInterval)
+		}
+	}
+
+	devdrasil.restUsers = backend.NewEndpointUsers(router, sessions, users, permissions, grants, auditLog)
+	devdrasil.restSessions = backend.NewEndpointSessions(router, sessions, users, authenticators...)
+	devdrasil.restGroups = backend.NewEndpointGroups(router, sessions, users, permissions, groups, grants, auditLog)
+	devdrasil.restCompanies = backend.NewEndpointCompanies(router, sessions, users, permissions, companies, grants, auditLog)
+	devdrasil.store = store.NewStore(cfg.Store.IndexURL)
+	devdrasil.restMarket = backend.NewEndpointStore(router, sessions, users, permissions, pluginTenants, devdrasil.store, auditLog)
+	devdrasil.restMe = backend.NewEndpointMe(router, sessions, users)
+	devdrasil.restTokens = backend.NewEndpointTokens(router, sessions, users, permissions)
+	devdrasil.restRoles = backend.NewEndpointRoles(router, sessions, users, permissions, groups, roles, grants, auditLog)
+	devdrasil.restGrants = backend.NewEndpointGrants(router, sessions, users, permissions, groups, companies, roles, grants, auditLog)
+	devdrasil.restPerms = backend.NewEndpointPermissions(router, sessions, users, permissions, auditLog)
+	devdrasil.restProxy = backend.NewEndpointPluginProxy(router, sessions, users, permissions, pluginTenants)
+	devdrasil.restAudit = backend.NewEndpointAudit(router, sessions, users, permissions, auditLog)
+	devdrasil.restOpenAPI = backend.NewEndpointOpenAPI(router)
+	devdrasil.restBulk = backend.NewEndpointBulk(router, sessions, users, permissions, bulk.NewImporter(users, groups, companies, roles, sessions), auditLog)
+	devdrasil.restBranding = backend.NewEndpointBranding(router, sessions, users, permissions, companies, auditLog)
+	devdrasil.restI18n = backend.NewEndpointI18n(router)
+	devdrasil.restInvites = backend.NewEndpointInvitations(router, sessions, users, permissions, groups, companies, invitations, mailer, cfg.PublicURL, cfg.Invitation.TTL, auditLog)
+
+	installFrontendHandler(devdrasil, devdrasil.restBranding)
+
+	if cfg.OIDC.Issuer != "" {
+		provider := oidc.NewProvider(&oidc.Config{Issuer: cfg.OIDC.Issuer, ClientId: cfg.OIDC.ClientId, ClientSecret: cfg.OIDC.ClientSecret, RedirectURL: cfg.OIDC.RedirectURL, Scopes: []string{"profile", "email"}, LoginClaim: cfg.OIDC.LoginClaim, GroupsClaim: cfg.OIDC.GroupsClaim})
+		oidcCompany, err := cfg.OIDC.CompanyId()
+		if err != nil {
+			log.Fatalf("failed to parse the company of oidc users: %s\n", err)
+		}
+		if oidcCompany != nil {
+			_, err = companies.Get(*oidcCompany)
+			if err != nil {
+				log.Fatalf("failed to find the company of oidc users: %s\n", err)
+			}
+		}
+		devdrasil.restOIDC = backend.NewEndpointOIDC(router, sessions, users, groups, provider, oidcCompany)
+	}
 
 	return devdrasil
 }
@@ -125,12 +263,190 @@ func ensureDir(dir string) string {
 	return dir
 }
 
-//Start actually launches the server
-func (s *Devdrasil) Start() {
+//Start launches the server and blocks until it has been shut down, see lifecycle.Lifecycle.Run. Returns the exit code.
+func (s *Devdrasil) Start() int {
 
 	log.Printf("current working directory is %s\n", s.cwd)
 	log.Printf("workspace is %s\n", s.workspace)
 	log.Printf("plugins located at %s\n", s.plugins)
-	log.Printf("starting devdrasil at %s:%d...\n", s.host, s.port)
-	log.Fatal(http.ListenAndServe(s.host+":"+strconv.Itoa(s.port), nil))
+	s.handler.Store(s.newHandler(s.config))
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		s.handler.Load().(http.Handler).ServeHTTP(writer, request)
+	})
+
+	//the first failing address stops the server
+	failed := make(chan error, 1)
+	servers := make([]*http.Server, 0)
+	for _, addr := range s.config.Addresses() {
+		server := &http.Server{Addr: addr, Handler: handler}
+		servers = append(servers, server)
+		go func(server *http.Server) {
+			var err error
+			if s.certs != nil {
+				log.Printf("starting devdrasil at https://%s...\n", server.Addr)
+				server.TLSConfig = &tls.Config{GetCertificate: s.certs.GetCertificate, MinVersion: tls.VersionTLS12}
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				log.Printf("starting devdrasil at http://%s...\n", server.Addr)
+				err = server.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				select {
+				case failed <- err:
+				default:
+				}
+			}
+		}(server)
+	}
+
+	if s.certs != nil && s.config.TLS.RedirectAddr != "" {
+		server := &http.Server{Addr: s.config.TLS.RedirectAddr, Handler: backend.RedirectToHTTPS(s.config.Port)}
+		servers = append(servers, server)
+		go func() {
+			log.Printf("redirecting http://%s to https\n", server.Addr)
+			err := server.ListenAndServe()
+			if err != http.ErrServerClosed {
+				select {
+				case failed <- err:
+				default:
+				}
+			}
+		}()
+	}
+
+	s.registerShutdown(servers)
+	s.lifecycle.OnReload(s.reload)
+	code := s.lifecycle.Run(failed)
+
+	//at last, so that the shutdown itself is logged
+	err := dlog.Default.Close()
+	if err != nil {
+		log.Printf("failed to close the log: %s\n", err)
+	}
+	return code
+}
+
+//the mux with the middlewares of the configuration
+func (s *Devdrasil) newHandler(cfg *config.Config) http.Handler {
+	middlewares := []backend.Middleware{backend.WithRequestId, backend.Localize, backend.Recover, backend.LogRequests, backend.CORS(cfg.CORS.Origins)}
+	if s.certs != nil && cfg.TLS.HSTSMaxAge > 0 {
+		middlewares = append(middlewares, backend.HSTS(cfg.TLS.HSTSMaxAge, cfg.TLS.HSTSIncludeSubdomains))
+	}
+	return backend.Chain(s.mux, middlewares...)
+}
+
+//the steps of the shutdown: first no more requests, so that no new work arrives, then the running work and at last the
+//background tasks, which may still write into the database
+func (s *Devdrasil) registerShutdown(servers []*http.Server) {
+	timeout := func() time.Duration {
+		return s.currentConfig().Shutdown.Timeout
+	}
+	jobTimeout := func() time.Duration {
+		return s.currentConfig().Shutdown.JobTimeout
+	}
+
+	s.lifecycle.OnShutdown("drain http connections", timeout, func(ctx context.Context) error {
+		var res error
+		for _, server := range servers {
+			err := server.Shutdown(ctx)
+			if err != nil && res == nil {
+				res = err
+			}
+		}
+		return res
+	})
+
+	s.lifecycle.OnShutdown("wait for plugin jobs", jobTimeout, s.tenants.WaitForJobs)
+
+	s.lifecycle.OnShutdown("stop background tasks", timeout, func(ctx context.Context) error {
+		if s.directory != nil {
+			s.directory.StopSync()
+		}
+		s.auditLog.StopCheckpoints()
+
+		//sign the head, so that the entries since the last checkpoint are covered as well
+		return s.auditLog.Checkpoint()
+	})
+
+	s.lifecycle.OnShutdown("wait for database writes", timeout, s.db.WaitForWrites)
+}
+
+func (s *Devdrasil) currentConfig() *config.Config {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.config
+}
+
+//reads the configuration again and applies the settings, which can be changed without a restart, see config.Reloadable.
+//An invalid configuration is rejected as a whole.
+func (s *Devdrasil) reload() {
+	cfg, err := config.Load("devdrasil", s.args)
+	if err != nil {
+		dlog.Default.Error(dlog.New("failed to reload the configuration, keeping the current one").SetError(err))
+		return
+	}
+
+	logger, err := cfg.Log.NewLogger()
+	if err != nil {
+		dlog.Default.Error(dlog.New("failed to reload the log configuration, keeping the current one").SetError(err))
+		return
+	}
+
+	s.mutex.Lock()
+	previous := s.config
+	s.config = cfg
+	s.mutex.Unlock()
+
+	//the previous appenders are closed, after the entries which are currently written through them have been completed
+	err = dlog.Default.Replace(logger).Close()
+	if err != nil {
+		dlog.Default.Warn(dlog.New("failed to close the previous log").SetError(err))
+	}
+
+	s.sessions.SetLifetime(cfg.Session.IdleTimeout, cfg.Session.MaxLifetime)
+	s.store.SetIndexURL(cfg.Store.IndexURL)
+	s.handler.Store(s.newHandler(cfg))
+
+	//a renewed certificate is also loaded, if the reload interval has not yet passed
+	if s.certs != nil {
+		err = s.certs.Reload()
+		if err != nil {
+			dlog.Default.Error(dlog.New("failed to reload the certificate, keeping the current one").SetError(err))
+		}
+	}
+
+	restart := make([]string, 0)
+	for _, key := range previous.Changed(cfg) {
+		if !containsString(config.Reloadable, key) {
+			restart = append(restart, key)
+		}
+	}
+	if len(restart) > 0 {
+		dlog.Default.Warn(dlog.New("changed settings require a restart").Put("keys", strings.Join(restart, ", ")))
+	}
+	dlog.Default.Info(dlog.New("configuration reloaded"))
+}
+
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+//the names of this machine, which a self-signed certificate is valid for
+func selfSignedHosts(cfg *config.Config) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+	if ip := net.ParseIP(cfg.Host); ip == nil || !ip.IsUnspecified() {
+		hosts = append(hosts, cfg.Host)
+	}
+	if u, err := url.Parse(cfg.PublicURL); err == nil && u.Hostname() != "" {
+		hosts = append(hosts, u.Hostname())
+	}
+	return hosts
 }
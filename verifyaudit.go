@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"github.com/worldiety/devdrasil/backend/audit"
+	"os"
+	"path/filepath"
+)
+
+//walks the audit chain and prints the first broken link. Returns the exit code, 1 if the log has been tampered with.
+//  usage: devdrasil verify-audit [-log ~/.devdrasil/audit.log] [-public-key hex]
+func verifyAudit(args []string) int {
+	workspace := filepath.Join(os.Getenv("HOME"), ".devdrasil")
+
+	flags := flag.NewFlagSet("verify-audit", flag.ExitOnError)
+	flagLog := flags.String("log", filepath.Join(workspace, "audit.log"), "The audit log file")
+	flagPublicKey := flags.String("public-key", "", "The hex encoded public key of the server. If empty, it is derived from the key in the workspace, which only proves the integrity if the key has not been stolen")
+	flags.Parse(args)
+
+	var publicKey ed25519.PublicKey
+	if *flagPublicKey != "" {
+		key, err := audit.ParsePublicKey(*flagPublicKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid public key: %s\n", err)
+			return 2
+		}
+		publicKey = key
+	} else {
+		key, err := audit.LoadKey(filepath.Join(workspace, "audit.key"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load the audit key: %s\n", err)
+			return 2
+		}
+		publicKey = key.Public().(ed25519.PublicKey)
+	}
+
+	report, err := audit.Verify(*flagLog, publicKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to verify %s: %s\n", *flagLog, err)
+		return 2
+	}
+
+	if report.Broken != nil {
+		fmt.Printf("broken after %d valid entries: %s\n", report.Entries, report.Broken)
+		return 1
+	}
+	fmt.Printf("ok, %d entries and %d checkpoints verified\n", report.Entries, report.Checkpoints)
+	return 0
+}